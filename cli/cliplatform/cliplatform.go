@@ -33,6 +33,12 @@ func IsSplitTunRunsApp() bool {
 	}
 	return runtime.GOOS == "linux"
 }
+func IsGatewaySupported() bool {
+	return runtime.GOOS == "linux"
+}
+func IsNetnsSupported() bool {
+	return runtime.GOOS == "linux"
+}
 func IsDnsOverHttpsSupported() bool {
 	return true
 }
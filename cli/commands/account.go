@@ -59,23 +59,25 @@ type CmdLogin struct {
 	flags.CmdInfo
 	accountID string
 	force     bool
+	add       bool
 }
 
 func (c *CmdLogin) Init() {
 	c.Initialize("login", "Login operation (register ACCOUNT_ID on this device)")
 	c.DefaultStringVar(&c.accountID, "ACCOUNT_ID")
 	c.BoolVar(&c.force, "force", false, "Log out from all other devices (applicable only with 'login' option)")
+	c.BoolVar(&c.add, "add", false, "Login to another account but keep the current session stored (to switch between accounts use 'account -switch')")
 }
 
 func (c *CmdLogin) Run() error {
-	return doLogin(c.accountID, c.force)
+	return doLogin(c.accountID, c.force, c.add)
 }
 
-func doLogin(accountID string, force bool) error {
+func doLogin(accountID string, force bool, keepCurrentSession bool) error {
 	// checking if we are logged-in
 	_proto.SessionStatus() // do not check error response (could be received 'not logged in' errors)
 	helloResp := _proto.GetHelloResponse()
-	if len(helloResp.Session.Session) != 0 {
+	if len(helloResp.Session.Session) != 0 && !keepCurrentSession {
 		fmt.Println("Already logged in")
 		PrintTips([]TipType{TipLogout})
 		return fmt.Errorf("unable login (please, log out first)")
@@ -92,7 +94,7 @@ func doLogin(accountID string, force bool) error {
 		accountID = string(data)
 	}
 
-	apiStatus, err := _proto.SessionNew(accountID, force, "")
+	apiStatus, err := _proto.SessionNew(accountID, force, "", keepCurrentSession)
 	if err != nil {
 		if apiStatus == types.The2FARequired {
 			fmt.Println("Account has two-factor authentication enabled.")
@@ -103,7 +105,7 @@ func doLogin(accountID string, force bool) error {
 			topt = strings.TrimSuffix(topt, "\n")
 			topt = strings.TrimSuffix(topt, "\r")
 
-			apiStatus, err = _proto.SessionNew(accountID, force, topt)
+			apiStatus, err = _proto.SessionNew(accountID, force, topt, keepCurrentSession)
 		}
 
 		if apiStatus == types.CodeSessionsLimitReached {
@@ -125,13 +127,25 @@ func doLogin(accountID string, force bool) error {
 
 type CmdAccount struct {
 	flags.CmdInfo
+	switchTo string
 }
 
 func (c *CmdAccount) Init() {
 	c.Initialize("account", "Get info about current account")
+	c.StringVar(&c.switchTo, "switch", "", "ACCOUNT_ID", "Switch to the stored session of another account (see 'login -add')")
 }
 
 func (c *CmdAccount) Run() error {
+	if len(c.switchTo) > 0 {
+		if err := _proto.SessionSwitch(c.switchTo); err != nil {
+			return err
+		}
+		fmt.Println("Switched to account", c.switchTo)
+		// update the session info
+		if _, err := _proto.SendHello(); err != nil {
+			return err
+		}
+	}
 	return checkStatus()
 }
 
@@ -243,6 +257,9 @@ func checkStatus() error {
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
 
 	fmt.Fprintln(w, fmt.Sprintf("Account ID:\t%v", helloResp.Session.AccountID))
+	if len(helloResp.StoredAccounts) > 0 {
+		fmt.Fprintln(w, fmt.Sprintf("Stored accounts:\t%v", strings.Join(helloResp.StoredAccounts, ", ")))
+	}
 
 	if acc.IsFreeTrial {
 		fmt.Fprintln(w, fmt.Sprintf("Plan:\tFree Trial"))
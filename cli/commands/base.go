@@ -36,6 +36,7 @@ import (
 	apitypes "github.com/ivpn/desktop-app/daemon/api/types"
 	"github.com/ivpn/desktop-app/daemon/protocol/types"
 	"github.com/ivpn/desktop-app/daemon/service/dns"
+	fwtypes "github.com/ivpn/desktop-app/daemon/service/firewall/types"
 	"github.com/ivpn/desktop-app/daemon/splittun"
 	"github.com/ivpn/desktop-app/daemon/vpn"
 )
@@ -86,12 +87,16 @@ func printState(w *tabwriter.Writer, state vpn.State, connected types.ConnectedR
 		fmt.Fprintf(w, "    Local IPv6\t:\t%v\n", connected.ClientIPv6)
 	}
 	fmt.Fprintf(w, "    Server IP\t:\t%v\n", connected.ServerIP)
+	if len(connected.NetNamespace) > 0 {
+		fmt.Fprintf(w, "    Namespace\t:\t%v (isolated; the host traffic is not routed through the VPN)\n", connected.NetNamespace)
+	}
 	fmt.Fprintf(w, "    Connected\t:\t%v\n", since)
 
 	return w
 }
 
-func printDNSState(w *tabwriter.Writer, dnsCfg dns.DnsSettings, servers *apitypes.ServersInfoResponse) *tabwriter.Writer {
+// 'activeDns' - the DNS server in use when 'dnsCfg' defines fallback servers
+func printDNSState(w *tabwriter.Writer, dnsCfg dns.DnsSettings, activeDns dns.DnsSettings, servers *apitypes.ServersInfoResponse) *tabwriter.Writer {
 	if w == nil {
 		w = tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
 	}
@@ -116,12 +121,15 @@ func printDNSState(w *tabwriter.Writer, dnsCfg dns.DnsSettings, servers *apitype
 		fmt.Fprintf(w, "AntiTracker\t:\t%v\n", antitrackerText.String())
 	} else {
 		fmt.Fprintf(w, "DNS\t:\t%v\n", dnsCfg.InfoString())
+		if len(dnsCfg.Fallbacks) > 0 && !activeDns.IsEmpty() {
+			fmt.Fprintf(w, "Active DNS\t:\t%v\n", activeDns.InfoString())
+		}
 	}
 
 	return w
 }
 
-func printFirewallState(w *tabwriter.Writer, isEnabled, isPersistent, isAllowLAN, isAllowMulticast, isAllowApiServers bool, userExceptions string) *tabwriter.Writer {
+func printFirewallState(w *tabwriter.Writer, isEnabled, isPersistent, isAllowLAN, isAllowMulticast, isAllowApiServers bool, exceptions []fwtypes.Exception) *tabwriter.Writer {
 	if w == nil {
 		w = tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
 	}
@@ -137,9 +145,36 @@ func printFirewallState(w *tabwriter.Writer, isEnabled, isPersistent, isAllowLAN
 		fmt.Fprintf(w, "    Persistent\t:\t%v\n", isPersistent)
 	}
 	fmt.Fprintf(w, "    Allow IVPN servers\t:\t%v\n", isAllowApiServers)
-	if len(userExceptions) > 0 {
+	if userExceptions := fwtypes.UserExceptionsString(exceptions); len(userExceptions) > 0 {
 		fmt.Fprintf(w, "    Allow IP masks\t:\t%v\n", userExceptions)
 	}
+	restricted := 0
+	for _, e := range exceptions {
+		if !e.IsHostOnly() {
+			restricted++
+		}
+	}
+	if restricted > 0 {
+		fmt.Fprintf(w, "    Exceptions (port/protocol)\t:\t%d (use 'ivpn firewall -exceptions' to list)\n", restricted)
+	}
+
+	return w
+}
+
+func printIPv6LeakProtectionState(w *tabwriter.Writer, isActive bool, bypassInterface string) *tabwriter.Writer {
+	if w == nil {
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	}
+
+	if isActive {
+		if len(bypassInterface) > 0 {
+			fmt.Fprintf(w, "IPv6 leak protection\t:\tActive (native IPv6 route via '%s' is blocked)\n", bypassInterface)
+		} else {
+			fmt.Fprintf(w, "IPv6 leak protection\t:\tActive\n")
+		}
+	} else if len(bypassInterface) > 0 {
+		fmt.Fprintf(w, "IPv6 leak protection\t:\tNot active (WARNING! Native IPv6 route via '%s' bypasses the VPN tunnel)\n", bypassInterface)
+	}
 
 	return w
 }
@@ -28,11 +28,13 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/ivpn/desktop-app/cli/cliplatform"
 	"github.com/ivpn/desktop-app/cli/commands/config"
 	"github.com/ivpn/desktop-app/cli/flags"
 	apitypes "github.com/ivpn/desktop-app/daemon/api/types"
 	"github.com/ivpn/desktop-app/daemon/protocol/types"
 	"github.com/ivpn/desktop-app/daemon/service/dns"
+	"github.com/ivpn/desktop-app/daemon/service/serverselector"
 	"github.com/ivpn/desktop-app/daemon/service/srverrors"
 	"github.com/ivpn/desktop-app/daemon/vpn"
 )
@@ -113,6 +115,7 @@ type CmdConnect struct {
 	antitracker     bool
 	antitrackerHard bool
 	isIPv6Tunnel    bool
+	isolatedNetns   bool
 
 	filter_proto       string
 	filter_location    bool
@@ -124,6 +127,8 @@ type CmdConnect struct {
 	multihopExitSvr string
 
 	fastest bool
+	nearest bool
+	random  bool
 }
 
 func (c *CmdConnect) Init() {
@@ -148,6 +153,9 @@ func (c *CmdConnect) Init() {
 	c.BoolVar(&c.antitracker, "antitracker", false, "Enable AntiTracker for this connection")
 	c.BoolVar(&c.antitrackerHard, "antitracker_hard", false, "Enable 'Hard Core' AntiTracker for this connection")
 	c.BoolVar(&c.isIPv6Tunnel, "ipv6tunnel", false, "Enable IPv6 in VPN tunnel (WireGuard connections only)\n(IPv6 addresses are preferred when a host has a dual stack IPv6/IPv4; IPv4-only hosts are unaffected)")
+	if cliplatform.IsNetnsSupported() {
+		c.BoolVar(&c.isolatedNetns, "netns", false, "Create VPN interface in isolated network namespace (WireGuard connections only)\n(the host network stays untouched; use 'ivpn exec' to run applications through the VPN)")
+	}
 
 	// filters
 	c.StringVar(&c.filter_proto, "p", "", "PROTOCOL", "Protocol type OpenVPN|ovpn|WireGuard|wg")
@@ -167,13 +175,19 @@ func (c *CmdConnect) Init() {
 	c.BoolVar(&c.filter_invert, "filter_invert", false, "Invert filtering")
 
 	c.BoolVar(&c.fastest, "fastest", false, "Connect to fastest server")
+	c.BoolVar(&c.nearest, "nearest", false, "Connect to the server nearest to the current location")
+	c.BoolVar(&c.random, "random", false, "Connect to random server")
 
 	c.BoolVar(&c.last, "last", false, "Connect with last successful connection parameters")
 }
 
 // Run executes command
 func (c *CmdConnect) Run() (retError error) {
-	if len(c.gateway) == 0 && c.fastest == false && c.last == false {
+	strategy, err := c.selectionStrategy()
+	if err != nil {
+		return err
+	}
+	if len(c.gateway) == 0 && len(strategy) == 0 && c.last == false {
 		return flags.BadParameter{}
 	}
 
@@ -248,6 +262,7 @@ func (c *CmdConnect) Run() (retError error) {
 		c.antitrackerHard = ci.AntitrackerHard
 		c.multihopExitSvr = ci.MultiopExitSvr
 		c.isIPv6Tunnel = ci.IPv6Tunnel
+		c.isolatedNetns = ci.IsolatedNetns
 	}
 
 	if c.obfsproxy && len(helloResp.DisabledFunctions.ObfsproxyError) > 0 {
@@ -259,8 +274,8 @@ func (c *CmdConnect) Run() (retError error) {
 	if len(c.multihopExitSvr) > 0 {
 		// MULTI-HOP
 
-		if c.fastest {
-			return flags.BadParameter{Message: "'fastest' flag is not applicable for Multi-Hop connection [exit_svr]"}
+		if len(strategy) > 0 {
+			return flags.BadParameter{Message: fmt.Sprintf("'%s' flag is not applicable for Multi-Hop connection [exit_svr]", strategy)}
 		}
 
 		if c.filter_location || c.filter_city || c.filter_countryCode || c.filter_country || c.filter_invert {
@@ -291,23 +306,20 @@ func (c *CmdConnect) Run() (retError error) {
 
 		srvID := ""
 
-		// Fastest server
-		if c.fastest && len(svrs) > 1 {
-			if err := serversPing(svrs, true); err != nil && c.any == false {
-				if c.any {
-					fmt.Printf("Error: Failed to ping servers to determine fastest: %s\n", err)
-				} else {
-					return err
+		// Fastest/nearest/random server: the server is selected by the daemon
+		// (from the servers of the preferred VPN protocol matching the filter)
+		if len(strategy) > 0 && len(svrs) > 1 {
+			req.ServerSelector = serverselector.Selector{Strategy: strategy}
+			for _, s := range svrs {
+				if s.protocol == svrs[0].protocol {
+					req.ServerSelector.Gateways = append(req.ServerSelector.Gateways, s.gateway)
 				}
 			}
-			fastestSrv := svrs[len(svrs)-1]
-			if fastestSrv.pingMs == 0 {
-				fmt.Println("WARNING! Servers pinging problem.")
-			}
-			srvID = fastestSrv.gateway
+			// the entry server parameters are ignored by the daemon; the first candidate is used to prepare the request
+			srvID = svrs[0].gateway
 		}
 
-		// if we not found required server before (by 'fastest' option)
+		// if we not found required server before (by 'fastest', 'nearest' or 'random' option)
 		if len(srvID) == 0 {
 			showTipsServerFilterError := func() {
 				fmt.Println()
@@ -385,6 +397,7 @@ func (c *CmdConnect) Run() (retError error) {
 				req.VpnType = vpn.WireGuard
 				req.WireGuardParameters.EntryVpnServer.Hosts = s.Hosts
 				req.IPv6 = c.isIPv6Tunnel
+				req.WireGuardParameters.IsolatedNetns = c.isolatedNetns
 
 				// port
 				p, err := getPort(vpn.WireGuard, c.port)
@@ -393,7 +406,9 @@ func (c *CmdConnect) Run() (retError error) {
 				}
 				req.WireGuardParameters.Port.Port = p.port
 
-				if len(c.multihopExitSvr) == 0 {
+				if req.ServerSelector.IsDefined() {
+					fmt.Printf("[WireGuard] Connecting to the %s server (%d servers) %s...\n", strategy, len(req.ServerSelector.Gateways), p.String())
+				} else if len(c.multihopExitSvr) == 0 {
 					fmt.Printf("[WireGuard] Connecting to: %s, %s (%s) %s %s...\n", s.City, s.CountryCode, s.Country, s.Gateway, p.String())
 				} else {
 					if exitSvrWg == nil {
@@ -465,7 +480,9 @@ func (c *CmdConnect) Run() (retError error) {
 			return fmt.Errorf("serverID not found in servers list (%s)", c.multihopExitSvr)
 		}
 
-		if len(c.multihopExitSvr) == 0 {
+		if req.ServerSelector.IsDefined() {
+			fmt.Printf("[OpenVPN] Connecting to the %s server (%d servers) %s...\n", strategy, len(req.ServerSelector.Gateways), destPort.String())
+		} else if len(c.multihopExitSvr) == 0 {
 			fmt.Printf("[OpenVPN] Connecting to: %s, %s (%s) %s %s...\n", entrySvrOvpn.City, entrySvrOvpn.CountryCode, entrySvrOvpn.Country, entrySvrOvpn.Gateway, destPort.String())
 		} else {
 			fmt.Printf("[OpenVPN] Connecting Multi-Hop...\n")
@@ -518,6 +535,10 @@ func (c *CmdConnect) Run() (retError error) {
 		}
 	}
 
+	if c.isolatedNetns && req.VpnType != vpn.WireGuard {
+		return fmt.Errorf("isolated network namespace is applicable only for WireGuard connections")
+	}
+
 	fmt.Println("Connecting...")
 	_, err = _proto.ConnectVPN(req)
 	if err != nil {
@@ -530,6 +551,12 @@ func (c *CmdConnect) Run() (retError error) {
 	}
 
 	if cState, stateResp, stateErr := _proto.GetVPNState(); stateErr == nil && cState == vpn.CONNECTED {
+		if req.ServerSelector.IsDefined() {
+			// the server was selected by the daemon
+			if gw := gatewayByHostIP(servers, stateResp.ServerIP); len(gw) > 0 {
+				c.gateway = gw
+			}
+		}
 		if !stateResp.ManualDNS.Equal(req.ManualDNS) {
 			fmt.Printf("Connected but failed to initialize custom DNS!\n")
 			fmt.Printf("Disconnecting...\n")
@@ -550,11 +577,52 @@ func (c *CmdConnect) Run() (retError error) {
 		Antitracker:     c.antitracker,
 		AntitrackerHard: c.antitrackerHard,
 		IPv6Tunnel:      c.isIPv6Tunnel,
+		IsolatedNetns:   c.isolatedNetns,
 		MultiopExitSvr:  c.multihopExitSvr})
 
 	return nil
 }
 
+// selectionStrategy returns the server selection strategy defined by the flags ("" - not defined)
+func (c *CmdConnect) selectionStrategy() (serverselector.Strategy, error) {
+	var ret serverselector.Strategy
+	for _, f := range []struct {
+		isSet    bool
+		strategy serverselector.Strategy
+	}{{c.fastest, serverselector.Fastest}, {c.nearest, serverselector.Nearest}, {c.random, serverselector.Random}} {
+		if !f.isSet {
+			continue
+		}
+		if len(ret) > 0 {
+			return "", flags.BadParameter{Message: "only one of 'fastest', 'nearest' or 'random' flags can be used"}
+		}
+		ret = f.strategy
+	}
+	return ret, nil
+}
+
+// gatewayByHostIP returns gateway of the server which has the host with the IP address
+func gatewayByHostIP(servers apitypes.ServersInfoResponse, ip string) string {
+	if len(ip) == 0 {
+		return ""
+	}
+	for _, s := range servers.WireguardServers {
+		for _, h := range s.Hosts {
+			if h.Host == ip {
+				return s.Gateway
+			}
+		}
+	}
+	for _, s := range servers.OpenvpnServers {
+		for _, h := range s.Hosts {
+			if h.Host == ip {
+				return s.Gateway
+			}
+		}
+	}
+	return ""
+}
+
 func getPort(vpnType vpn.Type, portInfo string) (port, error) {
 	var err error
 	var portPtr *int
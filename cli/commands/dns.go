@@ -24,7 +24,9 @@ package commands
 
 import (
 	"fmt"
+	"net"
 	"os"
+	"path/filepath"
 	"strings"
 	"text/tabwriter"
 
@@ -32,16 +34,35 @@ import (
 	"github.com/ivpn/desktop-app/cli/commands/config"
 	"github.com/ivpn/desktop-app/cli/flags"
 	apitypes "github.com/ivpn/desktop-app/daemon/api/types"
+	"github.com/ivpn/desktop-app/daemon/protocol/types"
 	"github.com/ivpn/desktop-app/daemon/service/dns"
+	"github.com/ivpn/desktop-app/daemon/service/dns/dnsforwarder"
+	"github.com/ivpn/desktop-app/daemon/service/dns/querystats"
 	"github.com/ivpn/desktop-app/daemon/vpn"
 )
 
 type CmdDns struct {
 	flags.CmdInfo
-	reset       bool
-	dns         string
-	dohTemplate string
-	dotTemplate string
+	reset         bool
+	dns           string
+	dohTemplate   string
+	dotTemplate   string
+	doqTemplate   string
+	doh3Template  string
+	stamp         string
+	relayStamp    string
+	fallback      string
+	fallbackClear bool
+
+	domain       string
+	domainRemove string
+	domainClear  bool
+
+	stats       bool
+	statsOn     bool
+	statsOff    bool
+	statsRecent int
+	statsReset  bool
 }
 
 func (c *CmdDns) Init() {
@@ -55,6 +76,22 @@ func (c *CmdDns) Init() {
 	if cliplatform.IsDnsOverTlsSupported() {
 		c.StringVar(&c.dotTemplate, "dot", "", "URI", "DNS-over-TLS URI template")
 	}
+	c.StringVar(&c.doqTemplate, "doq", "", "URI", "DNS-over-QUIC (RFC 9250) URI template: 'quic://host[:port]' (default port 853)\nExample: ivpn dns -doq quic://dns.adguard-dns.com 94.140.14.140")
+	c.StringVar(&c.doh3Template, "doh3", "", "URI", "DNS-over-HTTPS over HTTP/3 URI template\nExample: ivpn dns -doh3 https://cloudflare-dns.com/dns-query 1.1.1.1")
+	c.StringVar(&c.stamp, "stamp", "", "STAMP", "DNS stamp ('sdns://...') of the DNS server: DNSCrypt, DoH or ODoH target\n(DNS_IP is not required: the server address is defined by the stamp)\nExample: ivpn dns -stamp sdns://AgcAAAAAAAAABzEuMS4xLjEAEmRucy5jbG91ZGZsYXJlLmNvbQovZG5zLXF1ZXJ5")
+	c.StringVar(&c.relayStamp, "relay", "", "STAMP", "DNS stamp of the relay for '-stamp' server: DNSCrypt relay (Anonymized DNSCrypt) or ODoH relay (required for ODoH target)")
+	c.StringVar(&c.fallback, "fallback", "", "LIST", fmt.Sprintf("Comma-separated ordered list of fallback DNS servers, used when the custom DNS server is not responding (max %d)\nElement formats: DNS_IP (plain DNS), DNS_IP=URI (DoH for 'https://' URI; DoT for 'tls://' URI; DoQ for 'quic://' URI; DoH over HTTP/3 for 'h3://' URI), STAMP ('sdns://...')\nExample: ivpn dns 10.0.254.2 -fallback 9.9.9.9,1.1.1.1=https://cloudflare-dns.com/dns-query", dns.MaxDnsServers-1))
+	c.BoolVar(&c.fallbackClear, "fallback_clear", false, "Remove all fallback DNS servers")
+
+	c.StringVar(&c.domain, "domain", "", "DOMAIN=DNS_IP", "Split DNS: resolve the domain (and all its subdomains) by specific DNS server\nThe DNS server must be reachable outside the VPN tunnel (e.g. LAN or split-tunnel route)\nNote: split DNS rules are not applied when DoH/DoT or DNS stamp is in use (they are applied for DoQ and DoH3)\nExample: ivpn dns -domain corp.example.com=10.0.0.53")
+	c.StringVar(&c.domainRemove, "domain_remove", "", "DOMAIN", "Split DNS: remove the rule for the domain")
+	c.BoolVar(&c.domainClear, "domain_clear", false, "Split DNS: remove all rules")
+
+	c.BoolVar(&c.stats, "stats", false, "Show DNS query statistics: counters per upstream DNS server, failures, latency percentiles and recent queries")
+	c.BoolVar(&c.statsOn, "stats_on", false, "Enable DNS query statistics (the data is kept in memory only)\nNote: when enabled, plain DNS queries are processed by the local resolver of the daemon")
+	c.BoolVar(&c.statsOff, "stats_off", false, "Disable DNS query statistics (all collected data is erased)")
+	c.IntVar(&c.statsRecent, "stats_recent", -1, "COUNT", fmt.Sprintf("Enable DNS query statistics and keep COUNT recent queries in memory (0 - do not keep; max %d)", querystats.MaxRecentQueries))
+	c.BoolVar(&c.statsReset, "stats_reset", false, "Erase collected DNS query statistics")
 }
 
 func (c *CmdDns) Run() error {
@@ -62,8 +99,42 @@ func (c *CmdDns) Run() error {
 		return flags.BadParameter{}
 	}
 
-	if len(c.dohTemplate) > 0 && len(c.dotTemplate) > 0 {
-		return flags.BadParameter{}
+	templatesCnt := 0
+	for _, t := range []string{c.dohTemplate, c.dotTemplate, c.doqTemplate, c.doh3Template} {
+		if len(t) > 0 {
+			templatesCnt++
+		}
+	}
+	if templatesCnt > 1 {
+		return flags.BadParameter{Message: "only one of '-doh', '-dot', '-doq' or '-doh3' can be defined"}
+	}
+
+	if len(c.stamp) > 0 && (c.reset || len(c.dns) > 0 || templatesCnt > 0) {
+		return flags.BadParameter{Message: "'-stamp' can not be combined with DNS_IP, '-off', '-doh', '-dot', '-doq' or '-doh3'"}
+	}
+	if len(c.relayStamp) > 0 && len(c.stamp) == 0 {
+		return flags.BadParameter{Message: "'-relay' is applicable only with '-stamp'"}
+	}
+
+	if c.stats || c.statsOn || c.statsOff || c.statsRecent >= 0 || c.statsReset {
+		if c.reset || len(c.dns) > 0 || len(c.stamp) > 0 || len(c.domain) > 0 || len(c.domainRemove) > 0 || c.domainClear {
+			return flags.BadParameter{Message: "DNS query statistics parameters can not be combined with other parameters"}
+		}
+		return c.processQueryStats()
+	}
+
+	isFallbackChange := len(c.fallback) > 0 || c.fallbackClear
+	if isFallbackChange && (c.reset || (len(c.fallback) > 0 && c.fallbackClear)) {
+		return flags.BadParameter{Message: "'-fallback' and '-fallback_clear' can not be combined with '-off' or with each other"}
+	}
+
+	if len(c.domain) > 0 || len(c.domainRemove) > 0 || c.domainClear {
+		if c.reset || len(c.dns) > 0 || len(c.stamp) > 0 || isFallbackChange {
+			return flags.BadParameter{}
+		}
+		if err := c.updateSplitDnsRules(); err != nil {
+			return err
+		}
 	}
 
 	cfg, err := config.GetConfig()
@@ -73,8 +144,45 @@ func (c *CmdDns) Run() error {
 
 	var servers *apitypes.ServersInfoResponse
 	// do we have to change custom DNS configuration ?
-	if c.reset || len(c.dns) > 0 {
+	if c.reset || len(c.dns) > 0 || len(c.stamp) > 0 || isFallbackChange {
+		// the fallback servers are kept when the primary server is changed
+		fallbacks := cfg.CustomDnsCfg.Fallbacks
+		if c.reset {
+			fallbacks = nil
+		} else if isFallbackChange {
+			if fallbacks, err = parseFallbackDns(c.fallback); err != nil {
+				return flags.BadParameter{Message: err.Error()}
+			}
+		}
+		if !c.reset && len(c.dns) == 0 && len(c.stamp) == 0 {
+			// only the fallback servers are changed
+			c.dns = cfg.CustomDnsCfg.DnsHost
+			c.stamp = cfg.CustomDnsCfg.Stamp
+			c.relayStamp = cfg.CustomDnsCfg.RelayStamp
+			switch cfg.CustomDnsCfg.Encryption {
+			case dns.EncryptionDnsOverHttps:
+				c.dohTemplate = cfg.CustomDnsCfg.DohTemplate
+			case dns.EncryptionDnsOverTls:
+				c.dotTemplate = cfg.CustomDnsCfg.DohTemplate
+			case dns.EncryptionDnsOverQuic:
+				c.doqTemplate = cfg.CustomDnsCfg.DohTemplate
+			case dns.EncryptionDnsOverHttp3:
+				c.doh3Template = cfg.CustomDnsCfg.DohTemplate
+			}
+			if len(c.stamp) > 0 {
+				c.dns = ""
+			}
+			if len(c.dns) == 0 && len(c.stamp) == 0 {
+				return flags.BadParameter{Message: "custom DNS is not defined: the fallback servers can be used only with custom DNS"}
+			}
+		}
+
 		cfg.CustomDnsCfg = dns.DnsSettings{}
+		if len(c.stamp) > 0 {
+			if cfg.CustomDnsCfg, err = dns.DnsSettingsCreateFromStamp(c.stamp, c.relayStamp); err != nil {
+				return flags.BadParameter{Message: err.Error()}
+			}
+		}
 		if len(c.dns) > 0 {
 			cfg.CustomDnsCfg.DnsHost = c.dns
 		}
@@ -86,6 +194,18 @@ func (c *CmdDns) Run() error {
 			cfg.CustomDnsCfg.Encryption = dns.EncryptionDnsOverTls
 			cfg.CustomDnsCfg.DohTemplate = c.dotTemplate
 		}
+		if len(c.doqTemplate) > 0 {
+			cfg.CustomDnsCfg.Encryption = dns.EncryptionDnsOverQuic
+			cfg.CustomDnsCfg.DohTemplate = c.doqTemplate
+		}
+		if len(c.doh3Template) > 0 {
+			cfg.CustomDnsCfg.Encryption = dns.EncryptionDnsOverHttp3
+			cfg.CustomDnsCfg.DohTemplate = c.doh3Template
+		}
+		if err := cfg.CustomDnsCfg.ValidateTemplate(); err != nil {
+			return flags.BadParameter{Message: err.Error()}
+		}
+		cfg.CustomDnsCfg.Fallbacks = fallbacks
 
 		err = config.SaveConfig(cfg)
 		if err != nil {
@@ -125,15 +245,104 @@ func (c *CmdDns) Run() error {
 			svrs, _ := _proto.GetServers()
 			servers = &svrs
 		}
-		w = printDNSState(w, connected.ManualDNS, servers)
+		w = printDNSState(w, connected.ManualDNS, connected.ActiveDNS, servers)
 	}
 
 	w = printDNSConfigInfo(w, cfg.CustomDnsCfg)
+	if rules, isActive, err := _proto.GetSplitDnsRules(); err == nil {
+		w = printSplitDnsRules(w, rules, isActive, state == vpn.CONNECTED)
+	}
+	if stats, err := _proto.DnsQueryStats(); err == nil {
+		w = printDnsQueryStats(w, stats, false)
+	}
 	w.Flush()
 
 	return nil
 }
 
+func (c *CmdDns) processQueryStats() error {
+	if c.statsOn && c.statsOff {
+		return flags.BadParameter{Message: "'-stats_on' and '-stats_off' can not be used together"}
+	}
+	if c.statsOff && c.statsRecent >= 0 {
+		return flags.BadParameter{Message: "'-stats_off' and '-stats_recent' can not be used together"}
+	}
+
+	resp, err := _proto.DnsQueryStats()
+	if err != nil {
+		return err
+	}
+
+	if c.statsOn || c.statsOff || c.statsRecent >= 0 {
+		cfg := resp.Config
+		cfg.Enabled = !c.statsOff
+		if c.statsRecent >= 0 {
+			cfg.RecentQueriesCount = c.statsRecent
+		}
+		if resp, err = _proto.DnsQueryStatsSet(cfg); err != nil {
+			return err
+		}
+	}
+	if c.statsReset {
+		if resp, err = _proto.DnsQueryStatsReset(); err != nil {
+			return err
+		}
+	}
+
+	w := printDnsQueryStats(nil, resp, true)
+	w.Flush()
+	return nil
+}
+
+func (c *CmdDns) updateSplitDnsRules() error {
+	rules, _, err := _proto.GetSplitDnsRules()
+	if err != nil {
+		return err
+	}
+
+	var newRules []dns.DomainRule
+	if !c.domainClear {
+		removeDomain := dnsforwarder.NormalizeDomain(c.domainRemove)
+
+		var toAdd *dns.DomainRule
+		if len(c.domain) > 0 {
+			cols := strings.Split(c.domain, "=")
+			if len(cols) != 2 || len(strings.TrimSpace(cols[0])) == 0 || len(strings.TrimSpace(cols[1])) == 0 {
+				return flags.BadParameter{Message: "-domain: expected format DOMAIN=DNS_IP"}
+			}
+			r, err := dns.DomainRule{Domain: cols[0], Server: strings.TrimSpace(cols[1])}.Validate()
+			if err != nil {
+				return flags.BadParameter{Message: err.Error()}
+			}
+			toAdd = &r
+		}
+
+		isRemoved := false
+		for _, r := range rules {
+			if len(removeDomain) > 0 && r.Domain == removeDomain {
+				isRemoved = true
+				continue
+			}
+			if toAdd != nil && r.Domain == toAdd.Domain {
+				continue // replaced by the new rule
+			}
+			newRules = append(newRules, r)
+		}
+		if len(removeDomain) > 0 && !isRemoved {
+			return fmt.Errorf("split DNS rule for domain '%s' not found", removeDomain)
+		}
+		if toAdd != nil {
+			newRules = append(newRules, *toAdd)
+		}
+	}
+
+	if _, err := _proto.SetSplitDnsRules(newRules); err != nil {
+		return err
+	}
+	fmt.Println("Split DNS rules successfully updated")
+	return nil
+}
+
 //----------------------------------------------------------------------------------------
 
 type CmdAntitracker struct {
@@ -141,13 +350,31 @@ type CmdAntitracker struct {
 	def      bool
 	off      bool
 	hardcore bool
+
+	allow           string
+	allowRemove     string
+	blocklist       string
+	blocklistRemove string
+	override        string
+	overrideRemove  string
+	filterClear     bool
+	stats           bool
 }
 
 func (c *CmdAntitracker) Init() {
-	c.Initialize("antitracker", "Default AntiTracker configuration management for VPN connection")
+	c.Initialize("antitracker", "Default AntiTracker configuration management for VPN connection\nCustom lists (blocklists, allowlist, overrides) are applied by the local DNS resolver of the daemon on top of the DNS server in use\nNote: custom lists are not applied when DoH/DoT or DNS stamp is in use (they are applied for DoQ and DoH3)")
 	c.BoolVar(&c.def, "on", false, "Enable AntiTracker")
 	c.BoolVar(&c.hardcore, "on_hardcore", false, "Enable AntiTracker 'hardcore' mode")
 	c.BoolVar(&c.off, "off", false, "Disable AntiTracker")
+
+	c.StringVar(&c.allow, "allow", "", "DOMAIN", "Never block the domain (and all its subdomains)\nThe allowlisted domains are resolved by the default DNS of the VPN server (bypassing AntiTracker)")
+	c.StringVar(&c.allowRemove, "allow_remove", "", "DOMAIN", "Remove the domain from allowlist")
+	c.StringVar(&c.blocklist, "blocklist", "", "FILE", "Add the blocklist file (hosts-file or adblock-domain format)\nExample: ivpn antitracker -blocklist /etc/hosts.blocked")
+	c.StringVar(&c.blocklistRemove, "blocklist_remove", "", "FILE", "Remove the blocklist file")
+	c.StringVar(&c.override, "override", "", "DOMAIN=IP", "Resolve the domain (and all its subdomains) to the IP address")
+	c.StringVar(&c.overrideRemove, "override_remove", "", "DOMAIN", "Remove the override for the domain")
+	c.BoolVar(&c.filterClear, "lists_clear", false, "Remove all custom lists (blocklists, allowlist and overrides)")
+	c.BoolVar(&c.stats, "stats", false, "Show custom lists and the most blocked domains")
 }
 
 func (c *CmdAntitracker) Run() error {
@@ -160,6 +387,12 @@ func (c *CmdAntitracker) Run() error {
 		return err
 	}
 
+	if c.isFilterChange() {
+		if err := c.updateFilter(); err != nil {
+			return err
+		}
+	}
+
 	var servers apitypes.ServersInfoResponse
 
 	servers, err = _proto.GetServers()
@@ -220,15 +453,116 @@ func (c *CmdAntitracker) Run() error {
 
 	if state == vpn.CONNECTED {
 		servers, _ := _proto.GetServers()
-		w = printDNSState(w, connected.ManualDNS, &servers)
+		w = printDNSState(w, connected.ManualDNS, connected.ActiveDNS, &servers)
 	}
 
 	w = printAntitrackerConfigInfo(w, cfg.Antitracker, cfg.AntitrackerHardcore)
+
+	topBlockedCount := 0
+	if c.stats {
+		topBlockedCount = 10
+	}
+	if filterCfg, filterStatus, err := _proto.AntiTrackerFilter(topBlockedCount); err == nil {
+		w = printAntitrackerFilter(w, filterCfg, filterStatus, c.stats)
+	}
 	w.Flush()
 
 	return nil
 }
 
+func (c *CmdAntitracker) isFilterChange() bool {
+	return len(c.allow) > 0 || len(c.allowRemove) > 0 ||
+		len(c.blocklist) > 0 || len(c.blocklistRemove) > 0 ||
+		len(c.override) > 0 || len(c.overrideRemove) > 0 ||
+		c.filterClear
+}
+
+func (c *CmdAntitracker) updateFilter() error {
+	cfg, _, err := _proto.AntiTrackerFilter(0)
+	if err != nil {
+		return err
+	}
+
+	// removes the element from the list; returns error if element not found
+	removeFromList := func(list []string, elem string, listName string) ([]string, error) {
+		for i, e := range list {
+			if e == elem {
+				return append(list[:i], list[i+1:]...), nil
+			}
+		}
+		return list, fmt.Errorf("'%s' not found in %s", elem, listName)
+	}
+
+	switch {
+	case c.filterClear:
+		cfg = dns.FilterConfig{}
+
+	case len(c.allow) > 0:
+		domain := dnsforwarder.NormalizeDomain(c.allow)
+		if _, err := removeFromList(cfg.Allowlist, domain, ""); err == nil {
+			return fmt.Errorf("'%s' is already in allowlist", domain)
+		}
+		cfg.Allowlist = append(cfg.Allowlist, domain)
+
+	case len(c.allowRemove) > 0:
+		if cfg.Allowlist, err = removeFromList(cfg.Allowlist, dnsforwarder.NormalizeDomain(c.allowRemove), "allowlist"); err != nil {
+			return err
+		}
+
+	case len(c.blocklist) > 0:
+		path, err := filepath.Abs(c.blocklist)
+		if err != nil {
+			return err
+		}
+		if _, err := removeFromList(cfg.Blocklists, path, ""); err == nil {
+			return fmt.Errorf("blocklist '%s' is already added", path)
+		}
+		cfg.Blocklists = append(cfg.Blocklists, path)
+
+	case len(c.blocklistRemove) > 0:
+		path, err := filepath.Abs(c.blocklistRemove)
+		if err != nil {
+			return err
+		}
+		if cfg.Blocklists, err = removeFromList(cfg.Blocklists, path, "blocklists"); err != nil {
+			return err
+		}
+
+	case len(c.override) > 0:
+		cols := strings.Split(c.override, "=")
+		if len(cols) != 2 || len(strings.TrimSpace(cols[0])) == 0 || net.ParseIP(strings.TrimSpace(cols[1])) == nil {
+			return flags.BadParameter{Message: "-override: expected format DOMAIN=IP"}
+		}
+		o := dns.DomainOverride{Domain: dnsforwarder.NormalizeDomain(cols[0]), IP: strings.TrimSpace(cols[1])}
+		overrides := make([]dns.DomainOverride, 0, len(cfg.Overrides)+1)
+		for _, e := range cfg.Overrides {
+			if e.Domain != o.Domain {
+				overrides = append(overrides, e)
+			}
+		}
+		cfg.Overrides = append(overrides, o)
+
+	case len(c.overrideRemove) > 0:
+		domain := dnsforwarder.NormalizeDomain(c.overrideRemove)
+		overrides := make([]dns.DomainOverride, 0, len(cfg.Overrides))
+		for _, e := range cfg.Overrides {
+			if e.Domain != domain {
+				overrides = append(overrides, e)
+			}
+		}
+		if len(overrides) == len(cfg.Overrides) {
+			return fmt.Errorf("override for '%s' not found", domain)
+		}
+		cfg.Overrides = overrides
+	}
+
+	if _, err := _proto.AntiTrackerFilterSet(cfg); err != nil {
+		return err
+	}
+	fmt.Println("AntiTracker custom lists successfully updated")
+	return nil
+}
+
 //----------------------------------------------------------------------------------------
 
 func printDNSConfigInfo(w *tabwriter.Writer, customDNS dns.DnsSettings) *tabwriter.Writer {
@@ -245,6 +579,66 @@ func printDNSConfigInfo(w *tabwriter.Writer, customDNS dns.DnsSettings) *tabwrit
 	return w
 }
 
+func printSplitDnsRules(w *tabwriter.Writer, rules []dns.DomainRule, isActive, isConnected bool) *tabwriter.Writer {
+	if w == nil {
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	}
+	if len(rules) == 0 {
+		return w
+	}
+
+	status := "inactive (applied when VPN is connected)"
+	if isActive {
+		status = "active"
+	} else if isConnected {
+		status = "inactive (not applied to current DNS configuration)"
+	}
+	fmt.Fprintf(w, "Split DNS\t:\t%s\n", status)
+	for _, r := range rules {
+		fmt.Fprintf(w, "    %s\t:\t%s\n", r.Domain, r.Server)
+	}
+	return w
+}
+
+func printAntitrackerFilter(w *tabwriter.Writer, cfg dns.FilterConfig, status dns.FilterStatus, isDetailed bool) *tabwriter.Writer {
+	if w == nil {
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	}
+	if cfg.IsEmpty() {
+		return w
+	}
+
+	state := "inactive (applied when VPN is connected)"
+	if status.IsActive {
+		state = fmt.Sprintf("active (blocked %d of %d queries)", status.Blocked, status.Queries)
+	}
+	fmt.Fprintf(w, "Custom lists\t:\t%s\n", state)
+	fmt.Fprintf(w, "    Blocklists\t:\t%d (%d domains)\n", len(cfg.Blocklists), status.BlockedDomains)
+	fmt.Fprintf(w, "    Allowlist\t:\t%d\n", len(cfg.Allowlist))
+	fmt.Fprintf(w, "    Overrides\t:\t%d\n", len(cfg.Overrides))
+	if !isDetailed {
+		return w
+	}
+
+	for _, b := range cfg.Blocklists {
+		fmt.Fprintf(w, "    Blocklist\t:\t%s\n", b)
+	}
+	for _, a := range cfg.Allowlist {
+		fmt.Fprintf(w, "    Allowed\t:\t%s\n", a)
+	}
+	for _, o := range cfg.Overrides {
+		fmt.Fprintf(w, "    Override\t:\t%s => %s\n", o.Domain, o.IP)
+	}
+	for i, d := range status.TopBlocked {
+		title := ""
+		if i == 0 {
+			title = "    Most blocked"
+		}
+		fmt.Fprintf(w, "%s\t:\t%s (%d)\n", title, d.Domain, d.Count)
+	}
+	return w
+}
+
 func printAntitrackerConfigInfo(w *tabwriter.Writer, antitracker, antitrackerHardcore bool) *tabwriter.Writer {
 	if w == nil {
 		w = tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
@@ -298,3 +692,92 @@ func IsAntiTrackerIP(dns string, servers *apitypes.ServersInfoResponse) (antitra
 
 	return false, false
 }
+
+func printDnsQueryStats(w *tabwriter.Writer, resp types.DnsQueryStatsResp, isDetailed bool) *tabwriter.Writer {
+	if w == nil {
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	}
+	stats := resp.Stats
+	if !stats.IsEnabled {
+		if isDetailed {
+			fmt.Fprintf(w, "DNS query statistics\t:\tDisabled\n")
+		}
+		return w
+	}
+
+	fmt.Fprintf(w, "DNS query statistics\t:\tEnabled (since %s)\n", stats.Since.Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(w, "    Queries\t:\t%d (failed: %d; processed locally: %d)\n", stats.Queries, stats.Failures, stats.Local)
+	if !isDetailed {
+		return w
+	}
+	if !resp.IsEncryptedDnsSupported {
+		fmt.Fprintf(w, "    Note\t:\tQueries to encrypted DNS (DoH, DNS stamps) are not accounted on this platform\n")
+	}
+
+	for _, u := range stats.Upstreams {
+		fmt.Fprintf(w, "    %s\t:\t%d queries (failed: %d); latency p50/p90/p99: %v / %v / %v\n",
+			u.Upstream, u.Queries, u.Failures, u.LatencyP50, u.LatencyP90, u.LatencyP99)
+	}
+
+	if resp.Config.RecentQueriesCount > 0 {
+		fmt.Fprintf(w, "Recent queries\t:\t%d (max %d)\n", len(stats.RecentQueries), resp.Config.RecentQueriesCount)
+		for _, q := range stats.RecentQueries {
+			upstream := q.Upstream
+			if len(upstream) == 0 {
+				upstream = "local"
+			}
+			fmt.Fprintf(w, "    %s\t:\t%s %s %s (%s, %v)\n", q.Time.Format("15:04:05"), q.Domain, q.Type, q.Result, upstream, q.Duration)
+		}
+	}
+	return w
+}
+
+// parseFallbackDns parses the comma-separated list of DNS servers.
+// Element formats: DNS_IP (plain DNS), DNS_IP=URI (DoH for 'https://' URI; DoT for 'tls://' URI; DoQ for 'quic://' URI;
+// DoH over HTTP/3 for 'h3://' URI), STAMP ('sdns://...')
+func parseFallbackDns(list string) ([]dns.DnsSettings, error) {
+	var ret []dns.DnsSettings
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+
+		if strings.HasPrefix(item, "sdns://") {
+			d, err := dns.DnsSettingsCreateFromStamp(item, "")
+			if err != nil {
+				return nil, fmt.Errorf("fallback DNS '%s': %w", item, err)
+			}
+			ret = append(ret, d)
+			continue
+		}
+
+		cols := strings.SplitN(item, "=", 2)
+		d := dns.DnsSettings{DnsHost: strings.TrimSpace(cols[0])}
+		if d.IsEmpty() {
+			return nil, fmt.Errorf("fallback DNS '%s': bad IP address", item)
+		}
+		if len(cols) == 2 {
+			uri := strings.TrimSpace(cols[1])
+			switch {
+			case strings.HasPrefix(uri, "https://"):
+				d.Encryption = dns.EncryptionDnsOverHttps
+			case strings.HasPrefix(uri, "tls://"):
+				d.Encryption = dns.EncryptionDnsOverTls
+			case strings.HasPrefix(uri, "quic://"):
+				d.Encryption = dns.EncryptionDnsOverQuic
+			case strings.HasPrefix(uri, "h3://"):
+				d.Encryption = dns.EncryptionDnsOverHttp3
+				uri = "https://" + strings.TrimPrefix(uri, "h3://")
+			default:
+				return nil, fmt.Errorf("fallback DNS '%s': unsupported URI (expected 'https://', 'tls://', 'quic://' or 'h3://')", item)
+			}
+			d.DohTemplate = uri
+			if err := d.ValidateTemplate(); err != nil {
+				return nil, fmt.Errorf("fallback DNS '%s': %w", item, err)
+			}
+		}
+		ret = append(ret, d)
+	}
+	return ret, nil
+}
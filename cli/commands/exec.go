@@ -0,0 +1,119 @@
+//
+//  IVPN command line interface (CLI)
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the IVPN command line interface.
+//
+//  The IVPN command line interface is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The IVPN command line interface is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the IVPN command line interface. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package commands
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/ivpn/desktop-app/cli/flags"
+	"github.com/ivpn/desktop-app/daemon/vpn"
+)
+
+type CmdExec struct {
+	flags.CmdInfo
+	execute              string // this parameter is not in use. We need it just for help info. (using executeSpecParseArgs after special parsing)
+	executeSpecParseArgs []string
+}
+
+func (c *CmdExec) Init() {
+	// register special parse function (the command arguments are passed as is)
+	c.SetParseSpecialFunc(c.specialParse)
+
+	c.Initialize("exec", "Run command in isolated network namespace of the VPN connection\n(the command is able to reach the network only through the VPN tunnel; see 'ivpn connect -netns')\nRoot privileges are required to enter the namespace:\nthe command is started with the privileges of the user who called 'sudo'\nExamples:\n    sudo ivpn exec firefox\n    sudo ivpn exec -- curl https://api.ivpn.net/v4/geo-lookup")
+	c.DefaultStringVar(&c.execute, "COMMAND")
+}
+
+func (c *CmdExec) specialParse(arguments []string) bool {
+	if len(arguments) > 0 && arguments[0] == "--" {
+		arguments = arguments[1:]
+	}
+	if len(arguments) <= 0 || strings.ToLower(arguments[0]) == "-h" {
+		return false
+	}
+	c.executeSpecParseArgs = arguments
+	return true
+}
+
+func (c *CmdExec) Run() error {
+	if len(c.executeSpecParseArgs) <= 0 {
+		c.Usage(false)
+		return fmt.Errorf("no parameters defined")
+	}
+
+	state, connected, err := _proto.GetVPNState()
+	if err != nil {
+		return err
+	}
+	if state != vpn.CONNECTED || len(connected.NetNamespace) == 0 {
+		PrintTips([]TipType{TipConnectNetns})
+		return fmt.Errorf("VPN is not connected in isolated network namespace")
+	}
+
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("root privileges required to enter the network namespace (use 'sudo %s exec ...')", filepath.Base(os.Args[0]))
+	}
+
+	ipBinary, err := exec.LookPath("ip")
+	if err != nil {
+		return err
+	}
+	// 'ip netns exec' also applies the DNS configuration of the namespace (/etc/netns/<name>/resolv.conf)
+	args := []string{"ip", "netns", "exec", connected.NetNamespace}
+
+	// drop root privileges (run the command as the user who called 'sudo')
+	env := os.Environ()
+	if uid, gid := os.Getenv("SUDO_UID"), os.Getenv("SUDO_GID"); len(uid) > 0 && len(gid) > 0 && uid != "0" {
+		setpriv, err := exec.LookPath("setpriv")
+		if err != nil {
+			return fmt.Errorf("unable to drop root privileges: %w", err)
+		}
+		args = append(args, setpriv, "--reuid="+uid, "--regid="+gid, "--init-groups", "--")
+
+		if u, err := user.LookupId(uid); err == nil {
+			env = setEnv(env, "HOME", u.HomeDir)
+			env = setEnv(env, "USER", u.Username)
+			env = setEnv(env, "LOGNAME", u.Username)
+		}
+	}
+	args = append(args, c.executeSpecParseArgs...)
+
+	fmt.Printf("Running command in network namespace '%s': %v\n", connected.NetNamespace, strings.Join(c.executeSpecParseArgs, " "))
+	return syscall.Exec(ipBinary, args, env)
+}
+
+// setEnv replaces (or adds) the variable in the environment list
+func setEnv(env []string, key string, value string) []string {
+	ret := make([]string, 0, len(env)+1)
+	for _, e := range env {
+		if !strings.HasPrefix(e, key+"=") {
+			ret = append(ret, e)
+		}
+	}
+	return append(ret, key+"="+value)
+}
@@ -24,8 +24,15 @@ package commands
 
 import (
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/ivpn/desktop-app/cli/flags"
+	"github.com/ivpn/desktop-app/daemon/protocol/types"
+	fwtypes "github.com/ivpn/desktop-app/daemon/service/firewall/types"
 )
 
 type CmdFirewall struct {
@@ -40,6 +47,28 @@ type CmdFirewall struct {
 	persistentOn       bool
 	persistentOff      bool
 	exceptions         string
+	exceptionsList     bool // '-exceptions' without value (detected by special parsing)
+	exceptionAdd       string
+	exceptionRemove    string
+	exceptionProto     string
+	exceptionPort      string
+	exceptionDirection string
+	exceptionDesc      string
+	inboundAllow       string
+	inboundFrom        string
+	inboundRemove      int
+	inboundList        bool
+	allowTemp          string
+	allowTempDuration  string // DURATION argument of '-allow-temp' (detected by special parsing)
+	specialParseErr    error  // error of parsing the arguments in specialParse()
+	allowTempRemove    string
+	portalCheck        bool
+	portalMode         string
+	blockedLog         string
+	blockedList        bool
+	blockedLive        bool
+	verify             bool
+	verifyRepair       bool
 	//allowLanMulticast bool
 	//blockLanMulticast bool
 }
@@ -47,6 +76,9 @@ type CmdFirewall struct {
 const StringValueNoData = "<!NO DATA!>"
 
 func (c *CmdFirewall) Init() {
+	// register special parse function (for '-exceptions' without value)
+	c.SetParseSpecialFunc(c.specialParse)
+
 	c.Initialize("firewall", "Firewall management")
 	c.BoolVar(&c.status, "status", false, "(default) Show info about current firewall status")
 	c.BoolVar(&c.off, "off", false, "Switch-off firewall")
@@ -57,11 +89,34 @@ func (c *CmdFirewall) Init() {
 	c.BoolVar(&c.ivpnSvrAccessBlock, "ivpn_access_block", false, "Block access to IVPN servers when Firewall is enabled")
 	c.BoolVar(&c.persistentOff, "persistent_off", false, "Persistent firewall (Always-on firewall): disable")
 	c.BoolVar(&c.persistentOn, "persistent_on", false, "Persistent firewall (Always-on firewall): enable. When the option is enabled the IVPN Firewall is started during system boot")
-	c.StringVar(&c.exceptions, "exceptions", StringValueNoData, "EXCEPTIONS", "Set configuration: comma-separated list of IP addresses or subnets (using CIDR notation)\nthat will be allowed through the firewall when enabled\nExamples:\n\tivpn firewall -exceptions '1.2.3.0/24, 11.22.33.44'\n\tivpn firewall -exceptions ''")
+	c.StringVar(&c.exceptions, "exceptions", StringValueNoData, "EXCEPTIONS", "Set configuration: comma-separated list of IP addresses or subnets (using CIDR notation)\nthat will be allowed through the firewall when enabled\nExamples:\n\tivpn firewall -exceptions '1.2.3.0/24, 11.22.33.44'\n\tivpn firewall -exceptions ''\nWhen used without value - shows the list of all firewall exceptions")
+	c.StringVar(&c.exceptionAdd, "exception-add", "", "HOST", "Add firewall exception for IP address or subnet (using CIDR notation)\nCan be restricted by protocol, port and direction (see: -proto, -port, -direction, -description)\nExamples:\n\tivpn firewall -exception-add 192.168.1.10 -proto tcp -port 22 -direction in -description 'ssh'\n\tivpn firewall -exception-add 10.0.0.0/8 -proto udp -port 5000-5010")
+	c.StringVar(&c.inboundAllow, "inbound-allow", "", "PORT", "Allow incoming connections to the local service (listening port or range of ports)\nThe rule is in use both when VPN is connected and disconnected\n(see also: -proto, -from, -description)\nExamples:\n\tivpn firewall -inbound-allow 22 -proto tcp -from 203.0.113.0/24 -description 'office ssh'\n\tivpn firewall -inbound-allow 60000-61000 -proto udp")
+	c.StringVar(&c.inboundFrom, "from", "", "NETWORK", "(applicable with '-inbound-allow') Source IP address or network (CIDR); default: any")
+	c.IntVar(&c.inboundRemove, "inbound-remove", 0, "N", "Remove the inbound rule\nN - number of the rule in the list (see: 'ivpn firewall -inbound-rules')")
+	c.BoolVar(&c.inboundList, "inbound-rules", false, "Show the list of inbound rules")
+	c.StringVar(&c.exceptionProto, "proto", "", "PROTOCOL", "(applicable with '-exception-add' or '-inbound-allow') Protocol: tcp, udp or icmp (default: any)")
+	c.StringVar(&c.exceptionPort, "port", "", "PORT", "(applicable with '-exception-add') Port or range of ports (e.g. '443' or '5000-5010'; default: any)\nIt is a port of the service: remote port for outbound connections and local port for inbound connections")
+	c.StringVar(&c.exceptionDirection, "direction", "", "DIRECTION", "(applicable with '-exception-add') Allowed connections: 'out' (outbound), 'in' (inbound) or 'both' (default)")
+	c.StringVar(&c.exceptionDesc, "description", "", "TEXT", "(applicable with '-exception-add' or '-inbound-allow') Description of the exception")
+	c.StringVar(&c.allowTemp, "allow-temp", "", "HOST DURATION", "Temporary allow IP address or subnet (using CIDR notation) through the firewall\nThe exception is automatically removed when DURATION expires (e.g. '30s', '15m', '2h'; max: 7 days)\nExample:\n\tivpn firewall -allow-temp 192.168.1.1 15m")
+	c.StringVar(&c.allowTempRemove, "allow-temp-remove", "", "HOST", "Remove the temporary exception for IP address or subnet before its expiration")
+	c.BoolVar(&c.portalCheck, "portal-check", false, "Detect captive portal (e.g. hotel or airport Wi-Fi login page)\nWhen the firewall is enabled, only DNS requests to the gateway and the detection request are temporarily allowed")
+	c.StringVar(&c.portalMode, "portal-mode", "", "DURATION|on|off", "Portal mode: temporarily allow only DNS/HTTP(S) to the gateway network to be able to login to the captive portal\n(and HTTP(S) to the login page host, if it was detected)\nThe mode is closed automatically when expired or when VPN is connected\nDURATION - e.g. '5m' (max: 30m); 'on' - default duration (5m)\nExamples:\n\tivpn firewall -portal-mode 10m\n\tivpn firewall -portal-mode off")
+	c.StringVar(&c.blockedLog, "blocked-log", "", "on|off", "Enable/disable logging of the packets blocked by the firewall (the log is kept in memory; it is disabled after the daemon restart)\nNote: supported only on Linux")
+	c.BoolVar(&c.blockedList, "blocked", false, "Show the packets blocked by the firewall (see: -blocked-log)")
+	c.BoolVar(&c.blockedLive, "blocked-live", false, "Show the packets blocked by the firewall in real time (press Ctrl+C to stop)")
+	c.BoolVar(&c.verify, "verify", false, "Verify that the active firewall rules were not modified by third-party software (e.g. Docker, ufw, firewalld)\nNote: the daemon verifies the rules periodically and re-applies them automatically")
+	c.BoolVar(&c.verifyRepair, "repair", false, "(applicable with '-verify') Re-apply the firewall rules if they were modified")
+	c.StringVar(&c.exceptionRemove, "exception-remove", "", "N|HOST", "Remove firewall exception\nN - number of the exception in the list (see: 'ivpn firewall -exceptions')\nHOST - remove all exceptions for the IP address or subnet")
 	//c.BoolVar(&c.allowLanMulticast, "lan_multicast_allow", false, "Same as 'lan_allow' + allow multicast communication ")
 	//c.BoolVar(&c.blockLanMulticast, "lan_multicast_block", false, "Same as 'lan_block' + block multicast communication")
 }
 func (c *CmdFirewall) Run() error {
+	if c.specialParseErr != nil {
+		return c.specialParseErr
+	}
+
 	if c.on && c.off {
 		return flags.BadParameter{}
 	}
@@ -118,6 +173,107 @@ func (c *CmdFirewall) Run() error {
 		}
 	}
 
+	if len(c.exceptionAdd) > 0 {
+		exception, err := c.parseException()
+		if err != nil {
+			return err
+		}
+		if err := _proto.FirewallAddException(exception); err != nil {
+			return err
+		}
+	} else if len(c.inboundAllow) > 0 {
+		if len(c.exceptionPort) > 0 || len(c.exceptionDirection) > 0 {
+			return flags.BadParameter{Message: "'-port' and '-direction' are not applicable with '-inbound-allow'"}
+		}
+		rule, err := c.parseInboundRule()
+		if err != nil {
+			return err
+		}
+		if err := _proto.FirewallAddInboundRule(rule); err != nil {
+			return err
+		}
+	} else if len(c.exceptionProto) > 0 || len(c.exceptionPort) > 0 || len(c.exceptionDirection) > 0 || len(c.exceptionDesc) > 0 {
+		return flags.BadParameter{Message: "'-proto', '-port', '-direction' and '-description' are applicable only with '-exception-add' or '-inbound-allow'"}
+	}
+	if len(c.inboundFrom) > 0 && len(c.inboundAllow) == 0 {
+		return flags.BadParameter{Message: "'-from' is applicable only with '-inbound-allow'"}
+	}
+
+	if c.inboundRemove != 0 {
+		state, err := _proto.FirewallStatus()
+		if err != nil {
+			return err
+		}
+		if c.inboundRemove < 0 || c.inboundRemove > len(state.InboundRules) {
+			return flags.BadParameter{Message: fmt.Sprintf("inbound rule #%d not found (see: 'ivpn firewall -inbound-rules')", c.inboundRemove)}
+		}
+		if err := _proto.FirewallRemoveInboundRule(state.InboundRules[c.inboundRemove-1]); err != nil {
+			return err
+		}
+	}
+
+	if len(c.exceptionRemove) > 0 {
+		if err := c.removeExceptions(c.exceptionRemove); err != nil {
+			return err
+		}
+	}
+
+	if len(c.allowTemp) > 0 {
+		if len(c.allowTempDuration) == 0 {
+			return flags.BadParameter{Message: "DURATION not defined (expected: -allow-temp HOST DURATION)"}
+		}
+		duration, err := time.ParseDuration(c.allowTempDuration)
+		if err != nil || duration < time.Second {
+			return flags.BadParameter{Message: fmt.Sprintf("bad duration value '%s' (examples: '30s', '15m', '2h')", c.allowTempDuration)}
+		}
+		if err := _proto.FirewallAddTempException(c.allowTemp, duration); err != nil {
+			return err
+		}
+	}
+	if len(c.allowTempRemove) > 0 {
+		if err := _proto.FirewallRemoveTempException(c.allowTempRemove); err != nil {
+			return err
+		}
+	}
+
+	if c.portalCheck {
+		if _, err := _proto.CaptivePortalCheck(); err != nil {
+			return err
+		}
+	}
+	if len(c.portalMode) > 0 {
+		enable := true
+		var duration time.Duration
+		switch strings.ToLower(strings.TrimSpace(c.portalMode)) {
+		case "off":
+			enable = false
+		case "on":
+		default:
+			var err error
+			if duration, err = time.ParseDuration(c.portalMode); err != nil || duration < time.Second {
+				return flags.BadParameter{Message: fmt.Sprintf("bad portal mode value '%s' (expected: DURATION, 'on' or 'off')", c.portalMode)}
+			}
+		}
+		if _, err := _proto.CaptivePortalSetMode(enable, duration); err != nil {
+			return err
+		}
+	}
+
+	if len(c.blockedLog) > 0 {
+		switch strings.ToLower(strings.TrimSpace(c.blockedLog)) {
+		case "on":
+			if err := _proto.FirewallSetBlockedLog(true); err != nil {
+				return err
+			}
+		case "off":
+			if err := _proto.FirewallSetBlockedLog(false); err != nil {
+				return err
+			}
+		default:
+			return flags.BadParameter{Message: fmt.Sprintf("bad value '%s' (expected: on or off)", c.blockedLog)}
+		}
+	}
+
 	if c.persistentOn {
 		if err := _proto.FirewallPersistentSet(true); err != nil {
 			return err
@@ -153,7 +309,36 @@ func (c *CmdFirewall) Run() error {
 		return err
 	}
 
-	w := printFirewallState(nil, state.IsEnabled, state.IsPersistent, state.IsAllowLAN, state.IsAllowMulticast, state.IsAllowApiServers, state.UserExceptions)
+	if c.exceptionsList {
+		printFirewallExceptions(state.Exceptions)
+		return nil
+	}
+	if c.inboundList {
+		printFirewallInboundRules(state.InboundRules)
+		return nil
+	}
+	if c.blockedList || c.blockedLive {
+		return c.showBlockedTraffic(c.blockedLive)
+	}
+	if c.verify {
+		return c.showVerifyReport()
+	}
+
+	w := printFirewallState(nil, state.IsEnabled, state.IsPersistent, state.IsAllowLAN, state.IsAllowMulticast, state.IsAllowApiServers, state.Exceptions)
+	if len(state.InboundRules) > 0 {
+		fmt.Fprintf(w, "    Inbound rules\t:\t%d (use 'ivpn firewall -inbound-rules' to list)\n", len(state.InboundRules))
+	}
+	for i, e := range state.TempExceptions {
+		title := ""
+		if i == 0 {
+			title = "    Temporary exceptions"
+		}
+		fmt.Fprintf(w, "%s\t:\t%s (expires in %v)\n", title, e.Host, time.Duration(e.RemainingSec)*time.Second)
+	}
+	portal, portalErr := _proto.CaptivePortalStatus()
+	if portalErr == nil {
+		printCaptivePortalStatus(w, portal, c.portalCheck)
+	}
 	w.Flush()
 
 	// TIPS
@@ -162,7 +347,315 @@ func (c *CmdFirewall) Run() error {
 		tips = append(tips, TipFirewallEnable)
 	} else {
 		tips = append(tips, TipFirewallDisable)
+		if portalErr == nil && portal.IsDetected && !portal.IsPortalMode {
+			tips = append(tips, TipFirewallPortalMode)
+		}
 	}
 	PrintTips(tips)
 	return nil
 }
+
+func (c *CmdFirewall) specialParse(arguments []string) bool {
+	if len(arguments) == 1 && strings.ToLower(arguments[0]) == "-exceptions" {
+		c.exceptionsList = true
+		c.exceptions = StringValueNoData
+		return true
+	}
+	// '-allow-temp HOST DURATION': two-value flag (can be combined with other flags)
+	for i, arg := range arguments {
+		name := strings.ToLower(arg)
+		durationIdx := i + 2 // '-allow-temp HOST DURATION'
+		if strings.HasPrefix(name, "-allow-temp=") || strings.HasPrefix(name, "--allow-temp=") {
+			durationIdx = i + 1 // '-allow-temp=HOST DURATION'
+		} else if name != "-allow-temp" && name != "--allow-temp" {
+			continue
+		}
+		if durationIdx >= len(arguments) || strings.HasPrefix(arguments[durationIdx], "-") {
+			return false // DURATION not defined (the error will be reported on Run)
+		}
+
+		c.allowTempDuration = arguments[durationIdx]
+		// parse the rest of arguments (without DURATION) in a usual way
+		args := append(append([]string{}, arguments[:durationIdx]...), arguments[durationIdx+1:]...)
+		c.specialParseErr = c.Parse(args)
+		return true
+	}
+	return false
+}
+
+func (c *CmdFirewall) parseException() (fwtypes.Exception, error) {
+	e := fwtypes.Exception{
+		Host:        strings.TrimSpace(c.exceptionAdd),
+		Protocol:    fwtypes.ExceptionProtocol(strings.ToLower(strings.TrimSpace(c.exceptionProto))),
+		Description: c.exceptionDesc}
+
+	if e.Protocol == "any" {
+		e.Protocol = fwtypes.ExceptionProtocolAny
+	}
+
+	switch strings.ToLower(strings.TrimSpace(c.exceptionDirection)) {
+	case "", "both", "any":
+		e.Direction = fwtypes.ExceptionDirectionBoth
+	case "out", "outbound":
+		e.Direction = fwtypes.ExceptionDirectionOut
+	case "in", "inbound":
+		e.Direction = fwtypes.ExceptionDirectionIn
+	default:
+		return e, flags.BadParameter{Message: fmt.Sprintf("unexpected direction '%s' (expected: out, in or both)", c.exceptionDirection)}
+	}
+
+	if port := strings.TrimSpace(c.exceptionPort); len(port) > 0 && port != "any" {
+		var err error
+		if e.PortFrom, e.PortTo, err = parsePortRange(port); err != nil {
+			return e, err
+		}
+	}
+
+	if err := e.Validate(); err != nil {
+		return e, flags.BadParameter{Message: err.Error()}
+	}
+	return e, nil
+}
+
+func (c *CmdFirewall) parseInboundRule() (fwtypes.InboundRule, error) {
+	rule := fwtypes.InboundRule{
+		Protocol:    fwtypes.ExceptionProtocol(strings.ToLower(strings.TrimSpace(c.exceptionProto))),
+		Source:      strings.TrimSpace(c.inboundFrom),
+		Description: c.exceptionDesc}
+
+	if rule.Protocol == "any" {
+		rule.Protocol = fwtypes.ExceptionProtocolAny
+	}
+
+	var err error
+	if rule.PortFrom, rule.PortTo, err = parsePortRange(c.inboundAllow); err != nil {
+		return rule, err
+	}
+
+	if err := rule.Validate(); err != nil {
+		return rule, flags.BadParameter{Message: err.Error()}
+	}
+	return rule, nil
+}
+
+// parsePortRange parses port or range of ports in format: 'N' or 'N-M'
+func parsePortRange(port string) (from, to uint16, err error) {
+	parsePort := func(p string) (uint16, error) {
+		v, err := strconv.ParseUint(strings.TrimSpace(p), 10, 16)
+		if err != nil || v == 0 {
+			return 0, flags.BadParameter{Message: fmt.Sprintf("bad port value '%s'", port)}
+		}
+		return uint16(v), nil
+	}
+
+	ports := strings.SplitN(strings.TrimSpace(port), "-", 2)
+	if from, err = parsePort(ports[0]); err != nil {
+		return 0, 0, err
+	}
+	if len(ports) > 1 {
+		if to, err = parsePort(ports[1]); err != nil {
+			return 0, 0, err
+		}
+	}
+	return from, to, nil
+}
+
+// removeExceptions removes exception by its number in the list (1-based) or all exceptions for the host
+func (c *CmdFirewall) removeExceptions(numberOrHost string) error {
+	state, err := _proto.FirewallStatus()
+	if err != nil {
+		return err
+	}
+
+	var toRemove []fwtypes.Exception
+	if n, err := strconv.Atoi(numberOrHost); err == nil {
+		if n <= 0 || n > len(state.Exceptions) {
+			return flags.BadParameter{Message: fmt.Sprintf("exception #%d not found (see: 'ivpn firewall -exceptions')", n)}
+		}
+		toRemove = append(toRemove, state.Exceptions[n-1])
+	} else {
+		host, err := fwtypes.Exception{Host: numberOrHost}.Normalized()
+		if err != nil {
+			return flags.BadParameter{Message: err.Error()}
+		}
+		for _, e := range state.Exceptions {
+			if en, err := e.Normalized(); err == nil && en.Host == host.Host {
+				toRemove = append(toRemove, e)
+			}
+		}
+		if len(toRemove) == 0 {
+			return fmt.Errorf("no firewall exceptions for '%s'", numberOrHost)
+		}
+	}
+
+	for _, e := range toRemove {
+		if err := _proto.FirewallRemoveException(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// showBlockedTraffic prints the packets blocked by the firewall
+// When 'isLive' - the new packets are printed until the command is interrupted
+func (c *CmdFirewall) showBlockedTraffic(isLive bool) error {
+	isEnabled, entries, err := _proto.FirewallBlockedLog(0)
+	if err != nil {
+		return err
+	}
+	if !isEnabled {
+		fmt.Println("Logging of blocked packets is disabled")
+		PrintTips([]TipType{TipFirewallBlockedLogEnable})
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tDIRECTION\tPROTOCOL\tSOURCE\tDESTINATION\tPORT\tPROCESS")
+	printEntries := func(entries []fwtypes.BlockedPacket) (lastSeq uint64) {
+		for _, e := range entries {
+			port := ""
+			if e.DestinationPort != 0 {
+				port = strconv.Itoa(int(e.DestinationPort))
+			}
+			process := ""
+			if e.Pid != 0 {
+				process = fmt.Sprintf("%s (%d)", e.Process, e.Pid)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.Time.Local().Format("15:04:05"), e.Direction, e.Protocol, e.Source, e.Destination, port, process)
+			lastSeq = e.Seq
+		}
+		w.Flush()
+		return lastSeq
+	}
+
+	lastSeq := printEntries(entries)
+	if !isLive {
+		if len(entries) == 0 {
+			fmt.Println("No blocked packets")
+		}
+		return nil
+	}
+
+	for {
+		time.Sleep(time.Second)
+		if isEnabled, entries, err = _proto.FirewallBlockedLog(lastSeq); err != nil {
+			return err
+		}
+		if !isEnabled {
+			fmt.Println("Logging of blocked packets was disabled")
+			return nil
+		}
+		if len(entries) > 0 {
+			lastSeq = printEntries(entries)
+		}
+	}
+}
+
+// showVerifyReport prints the result of the firewall rules verification
+func (c *CmdFirewall) showVerifyReport() error {
+	report, err := _proto.FirewallVerify(c.verifyRepair)
+	if err != nil {
+		return err
+	}
+	if !report.IsEnabled {
+		fmt.Println("Firewall is disabled: nothing to verify")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	if !report.IsTampered() {
+		fmt.Fprintf(w, "Firewall rules\t:\tOK\n")
+		w.Flush()
+		return nil
+	}
+
+	fmt.Fprintf(w, "Firewall rules\t:\tModified by third-party software\n")
+	for i, p := range report.Problems {
+		title := ""
+		if i == 0 {
+			title = "    Problems"
+		}
+		fmt.Fprintf(w, "%s\t:\t%s\n", title, p)
+	}
+	if report.IsRepaired {
+		fmt.Fprintf(w, "    Re-applied\t:\tYes\n")
+	}
+	w.Flush()
+
+	if !report.IsRepaired {
+		PrintTips([]TipType{TipFirewallVerifyRepair})
+	}
+	return nil
+}
+
+func printCaptivePortalStatus(w *tabwriter.Writer, s types.CaptivePortalStatus, isJustChecked bool) {
+	if s.IsDetected {
+		fmt.Fprintf(w, "    Captive portal\t:\tDetected\n")
+		if len(s.RedirectURL) > 0 {
+			fmt.Fprintf(w, "    Login page\t:\t%s\n", s.RedirectURL)
+		}
+	} else if isJustChecked {
+		fmt.Fprintf(w, "    Captive portal\t:\tNot detected\n")
+	}
+	if s.IsPortalMode {
+		fmt.Fprintf(w, "    Portal mode\t:\tActive for %s (expires in %v)\n", s.PortalModeNetwork, time.Duration(s.PortalModeRemainingSec)*time.Second)
+	}
+}
+
+func printFirewallExceptions(exceptions []fwtypes.Exception) {
+	if len(exceptions) == 0 {
+		fmt.Println("No firewall exceptions defined")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tHOST\tPROTOCOL\tPORT\tDIRECTION\tDESCRIPTION")
+	for i, e := range exceptions {
+		proto := string(e.Protocol)
+		if len(proto) == 0 {
+			proto = "any"
+		}
+		port := "any"
+		if from, to := e.Ports(); from != 0 {
+			port = strconv.Itoa(int(from))
+			if to != from {
+				port = fmt.Sprintf("%d-%d", from, to)
+			}
+		}
+		direction := "both"
+		switch e.Direction {
+		case fwtypes.ExceptionDirectionOut:
+			direction = "out"
+		case fwtypes.ExceptionDirectionIn:
+			direction = "in"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", i+1, e.Host, proto, port, direction, e.Description)
+	}
+	w.Flush()
+}
+
+func printFirewallInboundRules(rules []fwtypes.InboundRule) {
+	if len(rules) == 0 {
+		fmt.Println("No inbound rules defined")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tPROTOCOL\tPORT\tFROM\tDESCRIPTION")
+	for i, r := range rules {
+		proto := string(r.Protocol)
+		if len(proto) == 0 {
+			proto = "tcp/udp"
+		}
+		port := strconv.Itoa(int(r.PortFrom))
+		if r.PortTo != 0 && r.PortTo != r.PortFrom {
+			port = fmt.Sprintf("%d-%d", r.PortFrom, r.PortTo)
+		}
+		source := r.Source
+		if len(source) == 0 {
+			source = "any"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", i+1, proto, port, source, r.Description)
+	}
+	w.Flush()
+}
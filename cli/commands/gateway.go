@@ -0,0 +1,124 @@
+//
+//  IVPN command line interface (CLI)
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the IVPN command line interface.
+//
+//  The IVPN command line interface is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The IVPN command line interface is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the IVPN command line interface. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ivpn/desktop-app/cli/flags"
+	fwtypes "github.com/ivpn/desktop-app/daemon/service/firewall/types"
+)
+
+type CmdGateway struct {
+	flags.CmdInfo
+	status bool
+	on     string
+	off    bool
+	dns    string
+}
+
+func (c *CmdGateway) Init() {
+	c.Initialize("gateway", "VPN gateway mode (sharing the VPN tunnel with the devices in LAN)\nThe traffic from LAN interface is forwarded only through the VPN tunnel; when VPN is not connected - it is blocked")
+	c.BoolVar(&c.status, "status", false, "(default) Show VPN gateway mode status")
+	c.StringVar(&c.on, "on", "", "LAN_INTERFACE", "Enable VPN gateway mode for LAN interface (e.g. 'eth1')")
+	c.BoolVar(&c.off, "off", false, "Disable VPN gateway mode")
+	c.StringVar(&c.dns, "dns", "", "on/off", "Redirect DNS requests of LAN clients to the DNS server of VPN connection (VPN, AntiTracker or custom DNS)")
+}
+
+func (c *CmdGateway) Run() error {
+	if len(c.on) > 0 && c.off {
+		return flags.BadParameter{Message: "'-on' and '-off' cannot be used together"}
+	}
+
+	var isRedirectDNS *bool
+	if len(c.dns) > 0 {
+		switch strings.ToLower(c.dns) {
+		case "on":
+			v := true
+			isRedirectDNS = &v
+		case "off":
+			v := false
+			isRedirectDNS = &v
+		default:
+			return flags.BadParameter{Message: "'-dns' argument must be 'on' or 'off'"}
+		}
+	}
+
+	status, err := _proto.GatewayStatus()
+	if err != nil {
+		return err
+	}
+
+	if len(c.on) > 0 || c.off || isRedirectDNS != nil {
+		cfg := status.Config
+		if len(c.on) > 0 {
+			cfg.LanInterface = c.on
+		} else if c.off {
+			cfg = fwtypes.GatewayConfig{}
+		}
+		if isRedirectDNS != nil {
+			if !cfg.IsEnabled() {
+				return fmt.Errorf("VPN gateway mode is disabled (use '-on' to enable it)")
+			}
+			cfg.IsRedirectDNS = *isRedirectDNS
+		}
+
+		if status, err = _proto.GatewaySetConfig(cfg); err != nil {
+			return err
+		}
+	}
+
+	printGatewayStatus(status)
+	return nil
+}
+
+func printGatewayStatus(status fwtypes.GatewayStatus) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	if !status.Config.IsEnabled() {
+		fmt.Fprintln(w, "VPN gateway mode\t:\tDisabled")
+		w.Flush()
+		PrintTips([]TipType{TipGatewayEnable})
+		return
+	}
+
+	fmt.Fprintln(w, "VPN gateway mode\t:\tEnabled")
+	fmt.Fprintf(w, "LAN interface\t:\t%s\n", status.Config.LanInterface)
+	if len(status.VpnInterface) > 0 {
+		fmt.Fprintf(w, "VPN interface\t:\t%s\n", status.VpnInterface)
+	} else {
+		fmt.Fprintln(w, "VPN interface\t:\tnot connected (traffic from LAN is blocked)")
+	}
+	if status.Config.IsRedirectDNS {
+		if len(status.DnsIP) > 0 {
+			fmt.Fprintf(w, "DNS for LAN clients\t:\t%s\n", status.DnsIP)
+		} else {
+			fmt.Fprintln(w, "DNS for LAN clients\t:\tredirection enabled (not active)")
+		}
+	}
+	w.Flush()
+
+	PrintTips([]TipType{TipGatewayDisable})
+}
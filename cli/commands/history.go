@@ -0,0 +1,153 @@
+//
+//  IVPN command line interface (CLI)
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the IVPN command line interface.
+//
+//  The IVPN command line interface is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The IVPN command line interface is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the IVPN command line interface. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package commands
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ivpn/desktop-app/cli/flags"
+	"github.com/ivpn/desktop-app/daemon/protocol/types"
+	"github.com/ivpn/desktop-app/daemon/vpn"
+)
+
+type CmdHistory struct {
+	flags.CmdInfo
+	count int
+}
+
+func (c *CmdHistory) Init() {
+	c.Initialize("history", "Show the history of VPN connections")
+	c.IntVar(&c.count, "n", 10, "COUNT", "Number of the last connections to show (0 - show all)")
+}
+
+func (c *CmdHistory) Run() error {
+	if c.count < 0 {
+		return flags.BadParameter{}
+	}
+
+	entries, err := _proto.GetConnectionHistory()
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("Connection history is empty")
+		return nil
+	}
+
+	if c.count > 0 && len(entries) > c.count {
+		entries = entries[len(entries)-c.count:]
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	fmt.Fprintln(w, "STARTED\tDURATION\tSERVER\tPROTOCOL\tRECONNECTS\tTRAFFIC (IN/OUT)\tDISCONNECTION")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			time.Unix(e.StartTime, 0).Format("2006-01-02 15:04:05"),
+			historyDuration(e),
+			historyServer(e),
+			historyProtocol(e),
+			e.Reconnects,
+			fmt.Sprintf("%s / %s", historyBytes(e.BytesReceived), historyBytes(e.BytesSent)),
+			historyDisconnection(e))
+	}
+	w.Flush()
+
+	return nil
+}
+
+func historyDuration(e types.ConnectionHistoryEntry) string {
+	if e.EndTime == 0 {
+		if len(e.ReasonDescription) > 0 {
+			return "-" // session interrupted (daemon stopped)
+		}
+		return "active"
+	}
+	return (time.Duration(e.EndTime-e.StartTime) * time.Second).String()
+}
+
+func historyServer(e types.ConnectionHistoryEntry) string {
+	if e.ConnectedTime == 0 {
+		return "(not connected)"
+	}
+
+	ret := e.Hostname
+	if len(ret) == 0 {
+		ret = e.ServerIP
+	}
+	if len(e.ExitServerID) > 0 {
+		ret += " -> " + e.ExitServerID
+	}
+	return ret
+}
+
+func historyProtocol(e types.ConnectionHistoryEntry) string {
+	if e.ConnectedTime == 0 {
+		return "-"
+	}
+
+	proto := "UDP"
+	if e.IsTCP {
+		proto = "TCP"
+	}
+	if e.VpnType == vpn.WireGuard {
+		return fmt.Sprintf("%v %d", e.VpnType, e.Port)
+	}
+	return fmt.Sprintf("%v %s %d", e.VpnType, proto, e.Port)
+}
+
+func historyDisconnection(e types.ConnectionHistoryEntry) string {
+	if e.EndTime == 0 {
+		return e.ReasonDescription
+	}
+
+	var ret string
+	switch e.Reason {
+	case types.DisconnectRequested:
+		ret = "requested"
+	case types.AuthenticationError:
+		ret = "authentication error"
+	default:
+		ret = "unexpected"
+	}
+	if e.Failure && len(e.ReasonDescription) > 0 {
+		ret += ": " + e.ReasonDescription
+	}
+	return ret
+}
+
+func historyBytes(b uint64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%dB", b)
+	}
+	div, exp := uint64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", float64(b)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,129 @@
+//
+//  IVPN command line interface (CLI)
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the IVPN command line interface.
+//
+//  The IVPN command line interface is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The IVPN command line interface is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the IVPN command line interface. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ivpn/desktop-app/cli/flags"
+	"github.com/ivpn/desktop-app/daemon/protocol/types"
+	"github.com/ivpn/desktop-app/daemon/service/localproxy"
+)
+
+type CmdProxy struct {
+	flags.CmdInfo
+	status bool
+	on     bool
+	off    bool
+	port   int
+	auth   string
+	noauth bool
+}
+
+func (c *CmdProxy) Init() {
+	c.Initialize("proxy", "Local SOCKS5/HTTP proxy bound to the VPN tunnel\nThe proxy listens on localhost and forwards the connections only through the VPN interface.\nIt is running only when VPN is connected; when the tunnel is down - all connections are refused.")
+	c.BoolVar(&c.status, "status", false, "(default) Show local proxy status")
+	c.BoolVar(&c.on, "on", false, "Enable local proxy")
+	c.BoolVar(&c.off, "off", false, "Disable local proxy")
+	c.IntVar(&c.port, "port", 0, "PORT", fmt.Sprintf("Local port to listen on (default = %d)", localproxy.DefaultPort))
+	c.StringVar(&c.auth, "auth", "", "USER:PASSWORD", "Require authentication with username and password")
+	c.BoolVar(&c.noauth, "noauth", false, "Do not require authentication")
+}
+
+func (c *CmdProxy) Run() error {
+	if c.on && c.off {
+		return flags.BadParameter{Message: "'-on' and '-off' cannot be used together"}
+	}
+	if len(c.auth) > 0 && c.noauth {
+		return flags.BadParameter{Message: "'-auth' and '-noauth' cannot be used together"}
+	}
+	if c.port < 0 || c.port > 65535 {
+		return flags.BadParameter{Message: "bad port number"}
+	}
+
+	status, err := _proto.LocalProxyStatus()
+	if err != nil {
+		return err
+	}
+
+	if c.on || c.off || c.port > 0 || len(c.auth) > 0 || c.noauth {
+		cfg := localproxy.Config{IsEnabled: status.IsEnabled, Port: status.Port}
+		if c.on {
+			cfg.IsEnabled = true
+		} else if c.off {
+			cfg.IsEnabled = false
+		}
+		if c.port > 0 {
+			cfg.Port = c.port
+		}
+
+		keepCredentials := true
+		if len(c.auth) > 0 {
+			cols := strings.SplitN(c.auth, ":", 2)
+			if len(cols) != 2 || len(cols[0]) == 0 {
+				return flags.BadParameter{Message: "'-auth' argument must be in format USER:PASSWORD"}
+			}
+			cfg.Username, cfg.Password = cols[0], cols[1]
+			keepCredentials = false
+		} else if c.noauth {
+			keepCredentials = false
+		}
+
+		if status, err = _proto.LocalProxySetConfig(cfg, keepCredentials); err != nil {
+			return err
+		}
+	}
+
+	printProxyStatus(status)
+	return nil
+}
+
+func printProxyStatus(status types.LocalProxyStatus) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	if !status.IsEnabled {
+		fmt.Fprintln(w, "Local proxy\t:\tDisabled")
+		w.Flush()
+		PrintTips([]TipType{TipProxyEnable})
+		return
+	}
+
+	fmt.Fprintln(w, "Local proxy\t:\tEnabled")
+	fmt.Fprintf(w, "Port\t:\t%d (SOCKS5, HTTP CONNECT)\n", status.Port)
+	if len(status.Username) > 0 {
+		fmt.Fprintf(w, "Authentication\t:\tusername '%s'\n", status.Username)
+	} else {
+		fmt.Fprintln(w, "Authentication\t:\tnot required")
+	}
+	switch {
+	case !status.IsRunning:
+		fmt.Fprintln(w, "State\t:\tStopped (VPN is not connected)")
+	case len(status.BindIP) == 0:
+		fmt.Fprintf(w, "State\t:\tListening on %s (connections refused: VPN is paused)\n", status.ListenAddress)
+	default:
+		fmt.Fprintf(w, "State\t:\tListening on %s (outgoing IP: %s)\n", status.ListenAddress, status.BindIP)
+	}
+	w.Flush()
+}
@@ -30,6 +30,7 @@ import (
 	"text/tabwriter"
 
 	apitypes "github.com/ivpn/desktop-app/daemon/api/types"
+	"github.com/ivpn/desktop-app/daemon/service/latency"
 	"github.com/ivpn/desktop-app/daemon/vpn"
 
 	"github.com/ivpn/desktop-app/cli/flags"
@@ -51,6 +52,7 @@ type CmdServers struct {
 	ping         bool
 	hosts        bool
 	filterInvert bool
+	tunnel       string
 }
 
 func (c *CmdServers) Init() {
@@ -71,13 +73,35 @@ func (c *CmdServers) Init() {
 
 	c.BoolVar(&c.city, "city", false, "Apply FILTER to city name")
 
-	c.BoolVar(&c.ping, "ping", false, "Ping servers and view ping result")
+	c.BoolVar(&c.ping, "ping", false, "Ping servers and view ping result\n(the recent results are cached by the daemon: JITTER and LOSS are calculated from the latency history)")
+	c.StringVar(&c.tunnel, "ping_tunnel", "", "on|off", "Measure servers latency through the VPN tunnel while connected\n(the latency is refreshed by the daemon in background)")
 
 	c.BoolVar(&c.hosts, "hosts", false, "Show location hosts")
 
 	c.BoolVar(&c.filterInvert, "filter_invert", false, "Invert filtering result")
 }
 func (c *CmdServers) Run() error {
+	if len(c.tunnel) > 0 {
+		var val bool
+		switch strings.ToLower(strings.TrimSpace(c.tunnel)) {
+		case "on":
+			val = true
+		case "off":
+			val = false
+		default:
+			return flags.BadParameter{Message: fmt.Sprintf("bad value '%s' (expected: on or off)", c.tunnel)}
+		}
+		if err := _proto.SetPreferences("latency_through_tunnel", fmt.Sprint(val)); err != nil {
+			return err
+		}
+		if val {
+			fmt.Println("Servers latency will be measured through the VPN tunnel while connected")
+		} else {
+			fmt.Println("Servers latency will not be measured while connected")
+		}
+		return nil
+	}
+
 	servers, err := _proto.GetServers()
 	if err != nil {
 		return err
@@ -97,8 +121,8 @@ func (c *CmdServers) Run() error {
 	hostsHeader := ""
 	pingEmptyVal := ""
 	if c.ping {
-		pingHeader = "PING\t"
-		pingEmptyVal = "\t"
+		pingHeader = "PING\tJITTER\tLOSS\t"
+		pingEmptyVal = "\t\t\t"
 	}
 	if c.hosts {
 		hostsHeader = "HOSTS\t"
@@ -121,9 +145,12 @@ func (c *CmdServers) Run() error {
 
 		pingStr := ""
 		if c.ping {
-			pingStr = " ?  \t"
+			pingStr = " ?  \t\t\t"
 			if s.pingMs > 0 {
-				pingStr = fmt.Sprintf("%dms\t", s.pingMs)
+				pingStr = fmt.Sprintf("%dms\t\t\t", s.pingMs)
+				if st := s.pingStats; st != nil && st.Samples > 1 {
+					pingStr = fmt.Sprintf("%dms\t%dms\t%d%%\t", s.pingMs, st.JitterMs, st.Loss)
+				}
 			}
 		}
 
@@ -302,6 +329,7 @@ func serversPing(servers []serverDesc, needSort bool) error {
 			for _, h := range s.hosts {
 				if h.host == pr.Host {
 					s.pingMs = pr.Ping
+					s.pingStats = pr.Stats
 					servers[i] = s
 					break
 				}
@@ -339,6 +367,7 @@ type serverDesc struct {
 	country      string
 	hosts        []hostDesc
 	pingMs       int
+	pingStats    *latency.HostStats
 	isIPv6Tunnel bool
 }
 
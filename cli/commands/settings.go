@@ -0,0 +1,115 @@
+//
+//  IVPN command line interface (CLI)
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the IVPN command line interface.
+//
+//  The IVPN command line interface is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The IVPN command line interface is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the IVPN command line interface. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/ivpn/desktop-app/cli/commands/config"
+	"github.com/ivpn/desktop-app/cli/flags"
+)
+
+type CmdSettings struct {
+	flags.CmdInfo
+	exportFile string
+	importFile string
+	secrets    bool
+}
+
+func (c *CmdSettings) Init() {
+	c.Initialize("settings", "Export or import settings (backup\\restore or moving the configuration to another machine)")
+	c.StringVar(&c.exportFile, "export", "", "FILE", "Export settings to a file")
+	c.StringVar(&c.importFile, "import", "", "FILE", "Import settings from a file")
+	c.BoolVar(&c.secrets, "secrets", false, "Include account credentials (session token, WireGuard keys) into exported settings\n  WARNING! Keep such file in a secure place")
+}
+
+func (c *CmdSettings) Run() error {
+	if (len(c.exportFile) > 0) == (len(c.importFile) > 0) {
+		return flags.BadParameter{}
+	}
+	if c.secrets && len(c.exportFile) == 0 {
+		return flags.BadParameter{Message: "'secrets' option is applicable only for export"}
+	}
+
+	if len(c.exportFile) > 0 {
+		return c.doExport()
+	}
+	return c.doImport()
+}
+
+func (c *CmdSettings) doExport() error {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return err
+	}
+	cfgData, err := json.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to serialize CLI configuration: %w", err)
+	}
+
+	data, err := _proto.ExportSettings(c.secrets, cfgData)
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(c.exportFile, data, 0600); err != nil { // read\write only for owner
+		return fmt.Errorf("failed to save settings: %w", err)
+	}
+
+	fmt.Println("Settings exported to:", c.exportFile)
+	if c.secrets {
+		fmt.Println("WARNING! The file contains account credentials. Keep it in a secure place.")
+	}
+	return nil
+}
+
+func (c *CmdSettings) doImport() error {
+	data, err := ioutil.ReadFile(c.importFile)
+	if err != nil {
+		return fmt.Errorf("failed to read settings: %w", err)
+	}
+	if !json.Valid(data) {
+		return fmt.Errorf("failed to read settings: unexpected file format")
+	}
+
+	cfgData, err := _proto.ImportSettings(data)
+	if err != nil {
+		return err
+	}
+
+	// restore CLI configuration
+	if len(cfgData) > 0 && string(cfgData) != "null" {
+		var cfg config.Configuration
+		if err := json.Unmarshal(cfgData, &cfg); err != nil {
+			return fmt.Errorf("failed to parse CLI configuration: %w", err)
+		}
+		if err := config.SaveConfig(cfg); err != nil {
+			return fmt.Errorf("failed to save CLI configuration: %w", err)
+		}
+	}
+
+	fmt.Println("Settings imported from:", c.importFile)
+	return nil
+}
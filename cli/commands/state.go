@@ -23,7 +23,11 @@
 package commands
 
 import (
+	"fmt"
+	"net"
+	"os"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/ivpn/desktop-app/cli/flags"
 	apitypes "github.com/ivpn/desktop-app/daemon/api/types"
@@ -33,15 +37,77 @@ import (
 
 type CmdState struct {
 	flags.CmdInfo
+	leakTest     bool
+	leakTestZone string
 }
 
 func (c *CmdState) Init() {
 	c.Initialize("status", "Prints full info about IVPN state")
+	c.BoolVar(&c.leakTest, "leaktest", false, "Check that DNS requests and outbound traffic go through the VPN tunnel (VPN must be connected)")
+	c.StringVar(&c.leakTestZone, "leaktest_zone", "", "ZONE", "(optional) The DNS zone to resolve the unique probe names in during the leak test\nThe A records returned by the zone are printed (e.g. the egress IP of the resolver)")
 }
 func (c *CmdState) Run() error {
+	if len(c.leakTestZone) > 0 && !c.leakTest {
+		return flags.BadParameter{Message: "'-leaktest_zone' can be used only with '-leaktest'"}
+	}
+	if c.leakTest {
+		return runLeakTest(c.leakTestZone)
+	}
 	return showState()
 }
 
+func runLeakTest(testZone string) error {
+	result, err := _proto.RunLeakTest(testZone)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+	d := result.Dns
+	fmt.Fprintf(w, "Expected DNS\t:\t%s\n", d.ExpectedDns.InfoString())
+	if !d.AppliedDns.IsEmpty() && !d.AppliedDns.Equal(d.ExpectedDns) {
+		fmt.Fprintf(w, "Applied OS DNS\t:\t%s\n", d.AppliedDns.InfoString())
+	}
+	fmt.Fprintf(w, "OS DNS servers\t:\t%s\n", ipListToString(d.SystemDns))
+	fmt.Fprintf(w, "Probe name\t:\t%s\n", d.ProbeName)
+	if d.IsProbeObserved {
+		fmt.Fprintf(w, "Probe forwarded to\t:\t%s\n", d.ProbeUpstream)
+	}
+	if len(d.ProbeAddresses) > 0 {
+		fmt.Fprintf(w, "Probe answer\t:\t%s\n", ipListToString(d.ProbeAddresses))
+	}
+	fmt.Fprintf(w, "Outbound IP before connection\t:\t%s\n", result.OutboundIPv4Before)
+	fmt.Fprintf(w, "Outbound IP\t:\t%s\n", result.OutboundIPv4)
+	for _, p := range d.Problems {
+		fmt.Fprintf(w, "WARNING\t:\t%s\n", p)
+	}
+	if !result.IsOutboundIPChanged {
+		fmt.Fprintf(w, "WARNING\t:\tThe outbound IP is the same as before the VPN connection\n")
+	}
+	if result.IsLeak {
+		fmt.Fprintf(w, "Leak test\t:\tFAILED\n")
+	} else {
+		fmt.Fprintf(w, "Leak test\t:\tPassed\n")
+	}
+	w.Flush()
+
+	if result.IsLeak {
+		return fmt.Errorf("leak detected")
+	}
+	return nil
+}
+
+func ipListToString(ips []net.IP) string {
+	if len(ips) == 0 {
+		return "-"
+	}
+	ret := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		ret = append(ret, ip.String())
+	}
+	return strings.Join(ret, ", ")
+}
+
 func showState() error {
 	fwstate, err := _proto.FirewallStatus()
 	if err != nil {
@@ -75,12 +141,13 @@ func showState() error {
 	w := printAccountInfo(nil, _proto.GetHelloResponse().Session.AccountID)
 	printState(w, state, connected, serverInfo, exitServerInfo)
 	if state == vpn.CONNECTED {
-		printDNSState(w, connected.ManualDNS, &servers)
+		printDNSState(w, connected.ManualDNS, connected.ActiveDNS, &servers)
+		printIPv6LeakProtectionState(w, fwstate.IsIPv6LeakProtection, fwstate.IPv6BypassInterface)
 	}
 	if !stStatus.IsFunctionalityNotAvailable {
 		printSplitTunState(w, true, false, stStatus.IsEnabled, stStatus.SplitTunnelApps, stStatus.RunningApps)
 	}
-	printFirewallState(w, fwstate.IsEnabled, fwstate.IsPersistent, fwstate.IsAllowLAN, fwstate.IsAllowMulticast, fwstate.IsAllowApiServers, fwstate.UserExceptions)
+	printFirewallState(w, fwstate.IsEnabled, fwstate.IsPersistent, fwstate.IsAllowLAN, fwstate.IsAllowMulticast, fwstate.IsAllowApiServers, fwstate.Exceptions)
 	w.Flush()
 
 	// TIPS
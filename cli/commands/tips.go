@@ -48,6 +48,13 @@ const (
 	TipLastConnection            TipType = iota
 	TipSplittunEnable            TipType = iota
 	TipEaaDisable                TipType = iota
+	TipFirewallPortalMode        TipType = iota
+	TipFirewallBlockedLogEnable  TipType = iota
+	TipFirewallVerifyRepair      TipType = iota
+	TipGatewayEnable             TipType = iota
+	TipGatewayDisable            TipType = iota
+	TipProxyEnable               TipType = iota
+	TipConnectNetns              TipType = iota
 )
 
 func PrintTips(tips []TipType) {
@@ -107,6 +114,27 @@ func PrintTip(w *tabwriter.Writer, tip TipType) {
 	case TipFirewallDisablePersistent:
 		str = newTip("firewall -persistent_off", "Disable firewall persistency (Always-on firewall)")
 		break
+	case TipFirewallPortalMode:
+		str = newTip("firewall -portal-mode on", "Temporarily allow access to the captive portal (to login to the network)")
+		break
+	case TipFirewallBlockedLogEnable:
+		str = newTip("firewall -blocked-log on", "Enable logging of the packets blocked by the firewall")
+		break
+	case TipFirewallVerifyRepair:
+		str = newTip("firewall -verify -repair", "Re-apply the firewall rules")
+		break
+	case TipGatewayEnable:
+		str = newTip("gateway -on LAN_INTERFACE", "Share the VPN tunnel with the devices in LAN")
+		break
+	case TipGatewayDisable:
+		str = newTip("gateway -off", "Disable VPN gateway mode")
+		break
+	case TipProxyEnable:
+		str = newTip("proxy -on", "Enable local SOCKS5/HTTP proxy bound to the VPN tunnel")
+		break
+	case TipConnectNetns:
+		str = newTip("connect -netns LOCATION", "Connect with VPN interface in isolated network namespace")
+		break
 	case TipLastConnection:
 		str = newTip("connect -last", "Connect with last successful connection parameters")
 		break
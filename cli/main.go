@@ -95,6 +95,7 @@ func main() {
 	addCommand(&stateCmd)
 	addCommand(&commands.CmdConnect{})
 	addCommand(&commands.CmdDisconnect{})
+	addCommand(&commands.CmdHistory{})
 	addCommand(&commands.CmdServers{})
 	addCommand(&commands.CmdFirewall{})
 	if cliplatform.IsSplitTunSupported() {
@@ -104,10 +105,18 @@ func main() {
 			addCommand(&commands.Exclude{})
 		}
 	}
+	if cliplatform.IsGatewaySupported() {
+		addCommand(&commands.CmdGateway{})
+	}
+	if cliplatform.IsNetnsSupported() {
+		addCommand(&commands.CmdExec{})
+	}
+	addCommand(&commands.CmdProxy{})
 	addCommand(&commands.CmdWireGuard{})
 	addCommand(&commands.CmdDns{})
 	addCommand(&commands.CmdAntitracker{})
 	addCommand(&commands.CmdLogs{})
+	addCommand(&commands.CmdSettings{})
 	addCommand(&commands.CmdLogin{})
 	addCommand(&commands.CmdLogout{})
 	addCommand(&commands.CmdAccount{})
@@ -26,6 +26,7 @@ import (
 	"bufio"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
@@ -39,6 +40,9 @@ import (
 	"github.com/ivpn/desktop-app/daemon/logger"
 	"github.com/ivpn/desktop-app/daemon/protocol/types"
 	"github.com/ivpn/desktop-app/daemon/service/dns"
+	"github.com/ivpn/desktop-app/daemon/service/dns/querystats"
+	fwtypes "github.com/ivpn/desktop-app/daemon/service/firewall/types"
+	"github.com/ivpn/desktop-app/daemon/service/localproxy"
 	"github.com/ivpn/desktop-app/daemon/vpn"
 	"golang.org/x/crypto/pbkdf2"
 )
@@ -155,12 +159,12 @@ func (c *Client) GetHelloResponse() types.HelloResp {
 }
 
 // SessionNew creates new session
-func (c *Client) SessionNew(accountID string, forceLogin bool, the2FA string) (apiStatus int, err error) {
+func (c *Client) SessionNew(accountID string, forceLogin bool, the2FA string, keepCurrentSession bool) (apiStatus int, err error) {
 	if err := c.ensureConnected(); err != nil {
 		return 0, err
 	}
 
-	req := types.SessionNew{AccountID: accountID, ForceLogin: forceLogin, Confirmation2FA: the2FA}
+	req := types.SessionNew{AccountID: accountID, ForceLogin: forceLogin, Confirmation2FA: the2FA, KeepCurrentSession: keepCurrentSession}
 	var resp types.SessionNewResp
 
 	if err := c.sendRecv(&req, &resp); err != nil {
@@ -174,6 +178,22 @@ func (c *Client) SessionNew(accountID string, forceLogin bool, the2FA string) (a
 	return resp.APIStatus, nil
 }
 
+// SessionSwitch makes active the stored session of another account
+func (c *Client) SessionSwitch(accountID string) error {
+	if err := c.ensureConnected(); err != nil {
+		return err
+	}
+
+	req := types.SessionSwitch{AccountID: accountID}
+	var resp types.EmptyResp
+
+	if err := c.sendRecv(&req, &resp); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 // SessionDelete remove session
 func (c *Client) SessionDelete(needToDisableFirewall, resetAppSettingsToDefaults, isCanDeleteSessionLocally bool) error {
 	if err := c.ensureConnected(); err != nil {
@@ -295,6 +315,203 @@ func (c *Client) FirewallAllowLan(allow bool) error {
 	return nil
 }
 
+// FirewallAddException adds the firewall exception (host/network with optional protocol, ports and direction)
+func (c *Client) FirewallAddException(exception fwtypes.Exception) error {
+	if err := c.ensureConnected(); err != nil {
+		return err
+	}
+
+	req := types.KillSwitchAddException{Exception: exception}
+	var resp types.EmptyResp
+	if err := c.sendRecv(&req, &resp); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// FirewallRemoveException removes the firewall exception
+func (c *Client) FirewallRemoveException(exception fwtypes.Exception) error {
+	if err := c.ensureConnected(); err != nil {
+		return err
+	}
+
+	req := types.KillSwitchRemoveException{Exception: exception}
+	var resp types.EmptyResp
+	if err := c.sendRecv(&req, &resp); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// FirewallAddInboundRule adds the firewall rule allowing incoming connections to local service
+func (c *Client) FirewallAddInboundRule(rule fwtypes.InboundRule) error {
+	if err := c.ensureConnected(); err != nil {
+		return err
+	}
+
+	req := types.KillSwitchAddInboundRule{Rule: rule}
+	var resp types.EmptyResp
+	if err := c.sendRecv(&req, &resp); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// FirewallRemoveInboundRule removes the firewall inbound rule
+func (c *Client) FirewallRemoveInboundRule(rule fwtypes.InboundRule) error {
+	if err := c.ensureConnected(); err != nil {
+		return err
+	}
+
+	req := types.KillSwitchRemoveInboundRule{Rule: rule}
+	var resp types.EmptyResp
+	if err := c.sendRecv(&req, &resp); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// FirewallAddTempException adds the firewall exception for the host (IP address or network) which is automatically removed after 'duration'
+func (c *Client) FirewallAddTempException(host string, duration time.Duration) error {
+	if err := c.ensureConnected(); err != nil {
+		return err
+	}
+
+	req := types.KillSwitchAddTempException{Host: host, DurationSec: int64(duration.Seconds())}
+	var resp types.EmptyResp
+	if err := c.sendRecv(&req, &resp); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// FirewallRemoveTempException removes the temporary firewall exception before its expiration
+func (c *Client) FirewallRemoveTempException(host string) error {
+	if err := c.ensureConnected(); err != nil {
+		return err
+	}
+
+	req := types.KillSwitchRemoveTempException{Host: host}
+	var resp types.EmptyResp
+	if err := c.sendRecv(&req, &resp); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// FirewallBlockedLog returns the log of packets blocked by the firewall (only entries with the sequence number bigger than 'sinceSeq')
+func (c *Client) FirewallBlockedLog(sinceSeq uint64) (isEnabled bool, entries []fwtypes.BlockedPacket, err error) {
+	if err := c.ensureConnected(); err != nil {
+		return false, nil, err
+	}
+
+	req := types.KillSwitchGetBlockedLog{SinceSeq: sinceSeq}
+	var resp types.KillSwitchBlockedLogResp
+	if err := c.sendRecv(&req, &resp); err != nil {
+		return false, nil, err
+	}
+
+	return resp.IsEnabled, resp.Entries, nil
+}
+
+// FirewallSetBlockedLog enables/disables logging of the packets blocked by the firewall
+func (c *Client) FirewallSetBlockedLog(enable bool) error {
+	if err := c.ensureConnected(); err != nil {
+		return err
+	}
+
+	req := types.KillSwitchSetBlockedLog{Enable: enable}
+	var resp types.KillSwitchBlockedLogResp
+	if err := c.sendRecv(&req, &resp); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// FirewallVerify compares the active firewall rules with the expected state
+// If 'repair' is true, the rules modified by third-party software are re-applied
+func (c *Client) FirewallVerify(repair bool) (fwtypes.VerifyReport, error) {
+	if err := c.ensureConnected(); err != nil {
+		return fwtypes.VerifyReport{}, err
+	}
+
+	req := types.KillSwitchVerify{Repair: repair}
+	var resp types.KillSwitchVerifyResp
+	if err := c.sendRecv(&req, &resp); err != nil {
+		return fwtypes.VerifyReport{}, err
+	}
+
+	return resp.Report, nil
+}
+
+// GatewayStatus returns the state of VPN gateway mode
+func (c *Client) GatewayStatus() (fwtypes.GatewayStatus, error) {
+	if err := c.ensureConnected(); err != nil {
+		return fwtypes.GatewayStatus{}, err
+	}
+
+	req := types.GatewayGetStatus{}
+	var resp types.GatewayStatusResp
+	if err := c.sendRecv(&req, &resp); err != nil {
+		return fwtypes.GatewayStatus{}, err
+	}
+
+	return resp.Status, nil
+}
+
+// GatewaySetConfig applies the configuration of VPN gateway mode
+func (c *Client) GatewaySetConfig(cfg fwtypes.GatewayConfig) (fwtypes.GatewayStatus, error) {
+	if err := c.ensureConnected(); err != nil {
+		return fwtypes.GatewayStatus{}, err
+	}
+
+	req := types.GatewaySetConfig{Config: cfg}
+	var resp types.GatewayStatusResp
+	if err := c.sendRecv(&req, &resp); err != nil {
+		return fwtypes.GatewayStatus{}, err
+	}
+
+	return resp.Status, nil
+}
+
+// LocalProxyStatus returns the state of the local SOCKS5/HTTP proxy
+func (c *Client) LocalProxyStatus() (types.LocalProxyStatus, error) {
+	if err := c.ensureConnected(); err != nil {
+		return types.LocalProxyStatus{}, err
+	}
+
+	req := types.LocalProxyGetStatus{}
+	var resp types.LocalProxyStatusResp
+	if err := c.sendRecv(&req, &resp); err != nil {
+		return types.LocalProxyStatus{}, err
+	}
+
+	return resp.Status, nil
+}
+
+// LocalProxySetConfig changes the configuration of the local SOCKS5/HTTP proxy
+// (keepCredentials: keep the username/password configured before)
+func (c *Client) LocalProxySetConfig(cfg localproxy.Config, keepCredentials bool) (types.LocalProxyStatus, error) {
+	if err := c.ensureConnected(); err != nil {
+		return types.LocalProxyStatus{}, err
+	}
+
+	req := types.LocalProxySetConfig{Config: cfg, KeepCredentials: keepCredentials}
+	var resp types.LocalProxyStatusResp
+	if err := c.sendRecv(&req, &resp); err != nil {
+		return types.LocalProxyStatus{}, err
+	}
+
+	return resp.Status, nil
+}
+
 // FirewallAllowLan set configuration 'firewall exceptions' (comma separated list of IP addresses/masks in format: x.x.x.x[/xx])
 func (c *Client) FirewallSetUserExceptions(exceptions string) error {
 	if err := c.ensureConnected(); err != nil {
@@ -528,6 +745,100 @@ func (c *Client) GetVPNState() (vpn.State, types.ConnectedResp, error) {
 	return vpn.DISCONNECTED, respConnected, fmt.Errorf("failed to receive VPN state (not expected return type)")
 }
 
+// GetConnectionHistory returns the journal of VPN connections (the newest entries are at the end)
+func (c *Client) GetConnectionHistory() ([]types.ConnectionHistoryEntry, error) {
+	if err := c.ensureConnected(); err != nil {
+		return nil, err
+	}
+
+	req := types.GetConnectionHistory{}
+	var resp types.ConnectionHistoryResp
+
+	if err := c.sendRecv(&req, &resp); err != nil {
+		return nil, err
+	}
+
+	return resp.Entries, nil
+}
+
+// CaptivePortalStatus returns the status of captive portal detection and 'portal mode'
+func (c *Client) CaptivePortalStatus() (types.CaptivePortalStatus, error) {
+	if err := c.ensureConnected(); err != nil {
+		return types.CaptivePortalStatus{}, err
+	}
+
+	req := types.CaptivePortalGetStatus{}
+	var resp types.CaptivePortalStatusResp
+	if err := c.sendRecv(&req, &resp); err != nil {
+		return types.CaptivePortalStatus{}, err
+	}
+
+	return resp.Status, nil
+}
+
+// CaptivePortalCheck requests the daemon to perform captive portal detection
+func (c *Client) CaptivePortalCheck() (types.CaptivePortalStatus, error) {
+	if err := c.ensureConnected(); err != nil {
+		return types.CaptivePortalStatus{}, err
+	}
+
+	req := types.CaptivePortalCheck{}
+	var resp types.CaptivePortalStatusResp
+	if err := c.sendRecv(&req, &resp); err != nil {
+		return types.CaptivePortalStatus{}, err
+	}
+
+	return resp.Status, nil
+}
+
+// CaptivePortalSetMode enables (for the defined duration; 0 - default duration) or disables 'portal mode'
+func (c *Client) CaptivePortalSetMode(enable bool, duration time.Duration) (types.CaptivePortalStatus, error) {
+	if err := c.ensureConnected(); err != nil {
+		return types.CaptivePortalStatus{}, err
+	}
+
+	req := types.CaptivePortalSetMode{Enable: enable, DurationSec: int64(duration.Seconds())}
+	var resp types.CaptivePortalStatusResp
+	if err := c.sendRecv(&req, &resp); err != nil {
+		return types.CaptivePortalStatus{}, err
+	}
+
+	return resp.Status, nil
+}
+
+// ExportSettings requests the daemon settings in a portable format
+func (c *Client) ExportSettings(includeSecrets bool, clientConfig json.RawMessage) (json.RawMessage, error) {
+	if err := c.ensureConnected(); err != nil {
+		return nil, err
+	}
+
+	req := types.ExportSettings{IncludeSecrets: includeSecrets, ClientConfig: clientConfig}
+	var resp types.SettingsExportResp
+
+	if err := c.sendRecv(&req, &resp); err != nil {
+		return nil, err
+	}
+
+	return resp.Settings, nil
+}
+
+// ImportSettings applies the settings exported by ExportSettings()
+// Returns client-specific configuration which was stored together with the daemon settings
+func (c *Client) ImportSettings(settings json.RawMessage) (clientConfig json.RawMessage, err error) {
+	if err := c.ensureConnected(); err != nil {
+		return nil, err
+	}
+
+	req := types.ImportSettings{Settings: settings}
+	var resp types.SettingsImportResp
+
+	if err := c.sendRecv(&req, &resp); err != nil {
+		return nil, err
+	}
+
+	return resp.ClientConfig, nil
+}
+
 // DisconnectVPN disconnect active VPN connection
 func (c *Client) DisconnectVPN() error {
 	if err := c.ensureConnected(); err != nil {
@@ -643,6 +954,128 @@ func (c *Client) SetManualDNS(dnsCfg dns.DnsSettings) error {
 	return nil
 }
 
+// GetSplitDnsRules - returns split DNS rules and 'true' when the rules are applied at the moment
+func (c *Client) GetSplitDnsRules() (rules []dns.DomainRule, isActive bool, err error) {
+	if err := c.ensureConnected(); err != nil {
+		return nil, false, err
+	}
+
+	req := types.GetSplitDnsRules{}
+	var resp types.SplitDnsRulesResp
+	if err := c.sendRecv(&req, &resp); err != nil {
+		return nil, false, err
+	}
+
+	return resp.Rules, resp.IsActive, nil
+}
+
+// SetSplitDnsRules - sets split DNS rules (domains resolved by specific DNS servers)
+func (c *Client) SetSplitDnsRules(rules []dns.DomainRule) (isActive bool, err error) {
+	if err := c.ensureConnected(); err != nil {
+		return false, err
+	}
+
+	req := types.SetSplitDnsRules{Rules: rules}
+	var resp types.SplitDnsRulesResp
+	if err := c.sendRecv(&req, &resp); err != nil {
+		return false, err
+	}
+
+	return resp.IsActive, nil
+}
+
+// AntiTrackerFilter - returns configuration and state of the local DNS filtering (custom AntiTracker lists)
+// 'topBlockedCount' - max number of the most blocked domains to return
+func (c *Client) AntiTrackerFilter(topBlockedCount int) (cfg dns.FilterConfig, status dns.FilterStatus, err error) {
+	if err := c.ensureConnected(); err != nil {
+		return cfg, status, err
+	}
+
+	req := types.AntiTrackerFilterGet{TopBlockedCount: topBlockedCount}
+	var resp types.AntiTrackerFilterResp
+	if err := c.sendRecv(&req, &resp); err != nil {
+		return cfg, status, err
+	}
+
+	return resp.Config, resp.Status, nil
+}
+
+// AntiTrackerFilterSet - sets configuration of the local DNS filtering (custom AntiTracker lists)
+func (c *Client) AntiTrackerFilterSet(cfg dns.FilterConfig) (dns.FilterStatus, error) {
+	if err := c.ensureConnected(); err != nil {
+		return dns.FilterStatus{}, err
+	}
+
+	req := types.AntiTrackerFilterSet{Config: cfg}
+	var resp types.AntiTrackerFilterResp
+	if err := c.sendRecv(&req, &resp); err != nil {
+		return dns.FilterStatus{}, err
+	}
+
+	return resp.Status, nil
+}
+
+// DnsQueryStats - get the configuration of the DNS query statistics and the collected data
+func (c *Client) DnsQueryStats() (types.DnsQueryStatsResp, error) {
+	if err := c.ensureConnected(); err != nil {
+		return types.DnsQueryStatsResp{}, err
+	}
+
+	req := types.DnsQueryStatsGet{}
+	var resp types.DnsQueryStatsResp
+	if err := c.sendRecv(&req, &resp); err != nil {
+		return types.DnsQueryStatsResp{}, err
+	}
+
+	return resp, nil
+}
+
+// DnsQueryStatsSet - set the configuration of the DNS query statistics
+func (c *Client) DnsQueryStatsSet(cfg querystats.Config) (types.DnsQueryStatsResp, error) {
+	if err := c.ensureConnected(); err != nil {
+		return types.DnsQueryStatsResp{}, err
+	}
+
+	req := types.DnsQueryStatsSet{Config: cfg}
+	var resp types.DnsQueryStatsResp
+	if err := c.sendRecv(&req, &resp); err != nil {
+		return types.DnsQueryStatsResp{}, err
+	}
+
+	return resp, nil
+}
+
+// DnsQueryStatsReset - erase the collected DNS query statistics
+func (c *Client) DnsQueryStatsReset() (types.DnsQueryStatsResp, error) {
+	if err := c.ensureConnected(); err != nil {
+		return types.DnsQueryStatsResp{}, err
+	}
+
+	req := types.DnsQueryStatsReset{}
+	var resp types.DnsQueryStatsResp
+	if err := c.sendRecv(&req, &resp); err != nil {
+		return types.DnsQueryStatsResp{}, err
+	}
+
+	return resp, nil
+}
+
+// RunLeakTest - checks that DNS requests and outbound traffic go through the VPN tunnel
+// 'testZone' - (optional) the DNS zone to resolve the unique probe names in
+func (c *Client) RunLeakTest(testZone string) (types.LeakTestResp, error) {
+	if err := c.ensureConnected(); err != nil {
+		return types.LeakTestResp{}, err
+	}
+
+	req := types.RunLeakTest{TestZone: testZone}
+	var resp types.LeakTestResp
+	if err := c.sendRecv(&req, &resp); err != nil {
+		return types.LeakTestResp{}, err
+	}
+
+	return resp, nil
+}
+
 // SetParanoidModePassword - set password for ParanoidMode (empty string -> disable ParanoidMode)
 func (c *Client) SetParanoidModePassword(secret string) error {
 	if err := c.ensureConnected(); err != nil {
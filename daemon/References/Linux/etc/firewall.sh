@@ -55,6 +55,16 @@ OUT_IVPN_STAT_USER_EXP=IVPN-OUT-STAT-USER-EXP
 # chain for non-VPN depended exceptios: only for ICMP protocol (ping)
 IN_IVPN_ICMP_EXP=IVPN-IN-ICMP-EXP
 OUT_IVPN_ICMP_EXP=IVPN-OUT-ICMP-EXP
+# chain for logging blocked packets (NFLOG); processing just before the final DROP rule
+IN_IVPN_LOG=IVPN-IN-LOG
+OUT_IVPN_LOG=IVPN-OUT-LOG
+# chains for VPN gateway mode (forwarding the traffic from LAN through the VPN tunnel)
+FORWARD_IVPN_GW=IVPN-FORWARD
+PREROUTING_IVPN_GW=IVPN-PREROUTING
+POSTROUTING_IVPN_GW=IVPN-POSTROUTING
+# IPv6 chains for IPv6 leak protection (independent from the IVPN firewall; applicable when VPN connected without IPv6 in tunnel)
+IN_IVPN_IPV6LEAK=IVPN-IN-IPV6LEAK
+OUT_IVPN_IPV6LEAK=IVPN-OUT-IPV6LEAK
 
 # returns 0 if chain exists
 function chain_exists()
@@ -112,6 +122,8 @@ function enable_firewall {
       create_chain ${IPv6BIN} ${OUT_IVPN_IF1}
       create_chain ${IPv6BIN} ${IN_IVPN_STAT_USER_EXP}
       create_chain ${IPv6BIN} ${OUT_IVPN_STAT_USER_EXP}
+      create_chain ${IPv6BIN} ${IN_IVPN_LOG}
+      create_chain ${IPv6BIN} ${OUT_IVPN_LOG}
 
       # IPv6: allow  local (lo) interface
       ${IPv6BIN} -w ${LOCKWAITTIME} -A ${OUT_IVPN} -o lo -j ACCEPT
@@ -122,8 +134,8 @@ function enable_firewall {
       ${IPv6BIN} -w ${LOCKWAITTIME} -A ${OUT_IVPN} -d FE80::/10 -j ACCEPT
 
       # allow unique-local addresses
-      ${IPv6BIN} -w ${LOCKWAITTIME} -A ${IN_IVPN} -s FD00::/8 -j ACCEPT
-      ${IPv6BIN} -w ${LOCKWAITTIME} -A ${OUT_IVPN} -d FD00::/8 -j ACCEPT
+      ${IPv6BIN} -w ${LOCKWAITTIME} -A ${IN_IVPN} -s FC00::/7 -j ACCEPT
+      ${IPv6BIN} -w ${LOCKWAITTIME} -A ${OUT_IVPN} -d FC00::/7 -j ACCEPT
 
       # allow DHCP port (547out 546in)
       # ${IPv6BIN} -w ${LOCKWAITTIME} -A ${OUT_IVPN} -p udp --dport 547 -j ACCEPT
@@ -157,6 +169,8 @@ function enable_firewall {
       # Note! If the packet does not match any IVPN rule - DROP it.
       # It prevents traversing packet analysis to the rest rules (if defined) and avoids any leaks
       # This will block all user-defined firewall rules!
+      ${IPv6BIN} -w ${LOCKWAITTIME} -A ${OUT_IVPN} -j ${OUT_IVPN_LOG}
+      ${IPv6BIN} -w ${LOCKWAITTIME} -A ${IN_IVPN} -j ${IN_IVPN_LOG}
       ${IPv6BIN} -w ${LOCKWAITTIME} -A ${OUT_IVPN} -j DROP
       ${IPv6BIN} -w ${LOCKWAITTIME} -A ${IN_IVPN}  -j DROP
 
@@ -187,6 +201,9 @@ function enable_firewall {
     create_chain ${IPv4BIN} ${IN_IVPN_ICMP_EXP}
     create_chain ${IPv4BIN} ${OUT_IVPN_ICMP_EXP}
 
+    create_chain ${IPv4BIN} ${IN_IVPN_LOG}
+    create_chain ${IPv4BIN} ${OUT_IVPN_LOG}
+
     # allow  local (lo) interface
     ${IPv4BIN} -w ${LOCKWAITTIME} -A ${OUT_IVPN} -o lo -j ACCEPT
     ${IPv4BIN} -w ${LOCKWAITTIME} -A ${IN_IVPN} -i lo -j ACCEPT
@@ -234,6 +251,8 @@ function enable_firewall {
     # Note! If the packet does not match any IVPN rule - DROP it.
     # It prevents traversing packet analysis to the rest rules (if defined) and avoids any leaks
     # This will block all user-defined firewall rules!
+    ${IPv4BIN} -w ${LOCKWAITTIME} -A ${OUT_IVPN} -j ${OUT_IVPN_LOG}
+    ${IPv4BIN} -w ${LOCKWAITTIME} -A ${IN_IVPN} -j ${IN_IVPN_LOG}
     ${IPv4BIN} -w ${LOCKWAITTIME} -A ${OUT_IVPN} -j DROP
     ${IPv4BIN} -w ${LOCKWAITTIME} -A ${IN_IVPN}  -j DROP
 
@@ -244,14 +263,54 @@ function enable_firewall {
 
 # Remove all rules
 function disable_firewall {
-    # Flush rules and delete custom chains
-
     ### allow everything by default ###
     ${IPv4BIN} -w ${LOCKWAITTIME} -P INPUT ACCEPT
     ${IPv4BIN} -w ${LOCKWAITTIME} -P OUTPUT ACCEPT
     ${IPv6BIN} -w ${LOCKWAITTIME} -P INPUT ACCEPT
     ${IPv6BIN} -w ${LOCKWAITTIME} -P OUTPUT ACCEPT
 
+    remove_firewall_rules
+
+    echo "IVPN Firewall disabled"
+}
+
+# Block all traffic (except local interface) while the IVPN rules are being re-created
+# (the rule is inserted on the top of INPUT/OUTPUT; the default policy could be tampered to ACCEPT)
+function reenable_block_add {
+    local bin=$1
+    ${bin} -w ${LOCKWAITTIME} -P INPUT DROP
+    ${bin} -w ${LOCKWAITTIME} -P OUTPUT DROP
+    ${bin} -w ${LOCKWAITTIME} -I OUTPUT ! -o lo -j DROP
+    ${bin} -w ${LOCKWAITTIME} -I INPUT ! -i lo -j DROP
+}
+
+function reenable_block_remove {
+    local bin=$1
+    ${bin} -w ${LOCKWAITTIME} -D OUTPUT ! -o lo -j DROP
+    ${bin} -w ${LOCKWAITTIME} -D INPUT ! -i lo -j DROP
+}
+
+# Re-create all rules (e.g. when the rules were modified by third-party software)
+# All traffic is blocked in the meantime, so nothing is leaking even if the default policies were changed.
+# If re-creation fails - the blocking rules are kept.
+function reenable_firewall {
+    reenable_block_add ${IPv4BIN}
+    if [ -f /proc/net/if_inet6 ]; then
+      reenable_block_add ${IPv6BIN}
+    fi
+
+    remove_firewall_rules 2> /dev/null
+    enable_firewall
+
+    # IVPN chains are inserted on the top of INPUT/OUTPUT: the blocking rules are not in use anymore
+    reenable_block_remove ${IPv4BIN}
+    if [ -f /proc/net/if_inet6 ]; then
+      reenable_block_remove ${IPv6BIN}
+    fi
+}
+
+# Flush rules and delete custom chains
+function remove_firewall_rules {
     ### IPv4 ###
     # '-D' Delete matching rule from chain
     ${IPv4BIN} -w ${LOCKWAITTIME} -D OUTPUT -j ${OUT_IVPN}
@@ -267,6 +326,8 @@ function disable_firewall {
     ${IPv4BIN} -w ${LOCKWAITTIME} -D ${IN_IVPN} -j ${IN_IVPN_STAT_USER_EXP}
     ${IPv4BIN} -w ${LOCKWAITTIME} -D ${OUT_IVPN} -j ${OUT_IVPN_ICMP_EXP}
     ${IPv4BIN} -w ${LOCKWAITTIME} -D ${IN_IVPN} -j ${IN_IVPN_ICMP_EXP}
+    ${IPv4BIN} -w ${LOCKWAITTIME} -D ${OUT_IVPN} -j ${OUT_IVPN_LOG}
+    ${IPv4BIN} -w ${LOCKWAITTIME} -D ${IN_IVPN} -j ${IN_IVPN_LOG}
     # '-F' Delete all rules in  chain or all chains
     ${IPv4BIN} -w ${LOCKWAITTIME} -F ${OUT_IVPN_IF0}
     ${IPv4BIN} -w ${LOCKWAITTIME} -F ${IN_IVPN_IF0}
@@ -281,6 +342,8 @@ function disable_firewall {
     ${IPv4BIN} -w ${LOCKWAITTIME} -F ${IN_IVPN_STAT_USER_EXP}
     ${IPv4BIN} -w ${LOCKWAITTIME} -F ${OUT_IVPN_ICMP_EXP}
     ${IPv4BIN} -w ${LOCKWAITTIME} -F ${IN_IVPN_ICMP_EXP}
+    ${IPv4BIN} -w ${LOCKWAITTIME} -F ${OUT_IVPN_LOG}
+    ${IPv4BIN} -w ${LOCKWAITTIME} -F ${IN_IVPN_LOG}
     # '-X' Delete a user-defined chain
     ${IPv4BIN} -w ${LOCKWAITTIME} -X ${OUT_IVPN_IF0}
     ${IPv4BIN} -w ${LOCKWAITTIME} -X ${IN_IVPN_IF0}
@@ -295,6 +358,8 @@ function disable_firewall {
     ${IPv4BIN} -w ${LOCKWAITTIME} -X ${IN_IVPN_STAT_USER_EXP}
     ${IPv4BIN} -w ${LOCKWAITTIME} -X ${OUT_IVPN_ICMP_EXP}
     ${IPv4BIN} -w ${LOCKWAITTIME} -X ${IN_IVPN_ICMP_EXP}
+    ${IPv4BIN} -w ${LOCKWAITTIME} -X ${OUT_IVPN_LOG}
+    ${IPv4BIN} -w ${LOCKWAITTIME} -X ${IN_IVPN_LOG}
 
     ### IPv6 ###
     ${IPv6BIN} -w ${LOCKWAITTIME} -D OUTPUT -j ${OUT_IVPN}
@@ -308,6 +373,8 @@ function disable_firewall {
     ${IPv6BIN} -w ${LOCKWAITTIME} -D ${IN_IVPN} -j ${IN_IVPN_STAT_EXP}
     ${IPv6BIN} -w ${LOCKWAITTIME} -D ${OUT_IVPN} -j ${OUT_IVPN_STAT_USER_EXP}
     ${IPv6BIN} -w ${LOCKWAITTIME} -D ${IN_IVPN} -j ${IN_IVPN_STAT_USER_EXP}
+    ${IPv6BIN} -w ${LOCKWAITTIME} -D ${OUT_IVPN} -j ${OUT_IVPN_LOG}
+    ${IPv6BIN} -w ${LOCKWAITTIME} -D ${IN_IVPN} -j ${IN_IVPN_LOG}
 
     ${IPv6BIN} -w ${LOCKWAITTIME} -F ${OUT_IVPN_IF0}
     ${IPv6BIN} -w ${LOCKWAITTIME} -F ${IN_IVPN_IF0}
@@ -320,6 +387,8 @@ function disable_firewall {
     ${IPv6BIN} -w ${LOCKWAITTIME} -F ${IN_IVPN_STAT_EXP}
     ${IPv6BIN} -w ${LOCKWAITTIME} -F ${OUT_IVPN_STAT_USER_EXP}
     ${IPv6BIN} -w ${LOCKWAITTIME} -F ${IN_IVPN_STAT_USER_EXP}
+    ${IPv6BIN} -w ${LOCKWAITTIME} -F ${OUT_IVPN_LOG}
+    ${IPv6BIN} -w ${LOCKWAITTIME} -F ${IN_IVPN_LOG}
 
     ${IPv6BIN} -w ${LOCKWAITTIME} -X ${OUT_IVPN_IF0}
     ${IPv6BIN} -w ${LOCKWAITTIME} -X ${IN_IVPN_IF0}
@@ -332,7 +401,8 @@ function disable_firewall {
     ${IPv6BIN} -w ${LOCKWAITTIME} -X ${IN_IVPN_STAT_EXP}
     ${IPv6BIN} -w ${LOCKWAITTIME} -X ${OUT_IVPN_STAT_USER_EXP}
     ${IPv6BIN} -w ${LOCKWAITTIME} -X ${IN_IVPN_STAT_USER_EXP}
-    echo "IVPN Firewall disabled"
+    ${IPv6BIN} -w ${LOCKWAITTIME} -X ${OUT_IVPN_LOG}
+    ${IPv6BIN} -w ${LOCKWAITTIME} -X ${IN_IVPN_LOG}
 }
 
 function client_connected {
@@ -389,6 +459,60 @@ function remove_exceptions {
   ${BIN} -w ${LOCKWAITTIME} -D ${OUT_CH} -d $@ -j ACCEPT
 }
 
+# Add exception restricted by protocol, ports and direction
+# Arguments:
+#   BIN       - iptables binary (IPv4 or IPv6)
+#   IN_CH     - chain for incoming packets
+#   OUT_CH    - chain for outgoing packets
+#   PROTO     - tcp|udp|icmp|any
+#   PORTS     - port range in format 'N:M' (port of the service: remote port for outgoing connections, local port for incoming connections) or 'any'
+#   DIRECTION - out|in|any (direction of the connection initiation)
+#   HOST      - IP address or network (CIDR)
+function add_user_exception {
+  BIN=$1
+  IN_CH=$2
+  OUT_CH=$3
+  PROTO=$4
+  PORTS=$5
+  DIRECTION=$6
+  HOST=$7
+
+  create_chain ${BIN} ${IN_CH}
+  create_chain ${BIN} ${OUT_CH}
+
+  local PROTOCOLS=${PROTO}
+  if [[ ${PROTO} = "any" ]]; then
+    if [[ ${PORTS} = "any" ]]; then
+      PROTOCOLS="all"
+    else
+      # ports are applicable only for TCP and UDP
+      PROTOCOLS="tcp udp"
+    fi
+  elif [[ ${PROTO} = "icmp" ]] && [[ ${BIN} = ${IPv6BIN} ]]; then
+    PROTOCOLS="ipv6-icmp"
+  fi
+
+  for P in ${PROTOCOLS}; do
+    local DPORT=""
+    local SPORT=""
+    if [[ ${PORTS} != "any" ]]; then
+      DPORT="--dport ${PORTS}"
+      SPORT="--sport ${PORTS}"
+    fi
+
+    if [[ ${DIRECTION} = "out" ]] || [[ ${DIRECTION} = "any" ]]; then
+      # outgoing connections to the remote service (and replies to them)
+      ${BIN} -w ${LOCKWAITTIME} -A ${OUT_CH} -d ${HOST} -p ${P} ${DPORT} -j ACCEPT
+      ${BIN} -w ${LOCKWAITTIME} -A ${IN_CH}  -s ${HOST} -p ${P} ${SPORT} -m state --state ESTABLISHED,RELATED -j ACCEPT
+    fi
+    if [[ ${DIRECTION} = "in" ]] || [[ ${DIRECTION} = "any" ]]; then
+      # incoming connections to the local service (and replies to them)
+      ${BIN} -w ${LOCKWAITTIME} -A ${IN_CH}  -s ${HOST} -p ${P} ${DPORT} -j ACCEPT
+      ${BIN} -w ${LOCKWAITTIME} -A ${OUT_CH} -d ${HOST} -p ${P} ${SPORT} -m state --state ESTABLISHED,RELATED -j ACCEPT
+    fi
+  done
+}
+
 function add_direction_exception {
   IN_CH=$1
   OUT_CH=$2
@@ -407,6 +531,152 @@ function add_direction_exception {
   ${IPv4BIN} -w ${LOCKWAITTIME} -C ${OUT_CH} -d ${DST_ADDR} -p ${PROTOCOL} --dport ${DST_PORT} -j ACCEPT || ${IPv4BIN} -w ${LOCKWAITTIME} -A ${OUT_CH} -d ${DST_ADDR} -p ${PROTOCOL} --dport ${DST_PORT} -j ACCEPT
 }
 
+# Log blocked packets to NFLOG group (the packets are processed by the daemon)
+# (the number of logged packets is limited to avoid overloading)
+function blocked_log_enable {
+  GROUP=$1
+
+  for BIN in ${IPv4BIN} ${IPv6BIN}; do
+    chain_exists ${BIN} ${OUT_IVPN_LOG} || continue
+    clean_chain ${BIN} ${OUT_IVPN_LOG}
+    clean_chain ${BIN} ${IN_IVPN_LOG}
+    ${BIN} -w ${LOCKWAITTIME} -A ${OUT_IVPN_LOG} -m limit --limit 20/sec --limit-burst 50 -j NFLOG --nflog-group ${GROUP} --nflog-prefix "ivpn-out"
+    ${BIN} -w ${LOCKWAITTIME} -A ${IN_IVPN_LOG}  -m limit --limit 20/sec --limit-burst 50 -j NFLOG --nflog-group ${GROUP} --nflog-prefix "ivpn-in" 
+  done
+}
+
+function blocked_log_disable {
+  for BIN in ${IPv4BIN} ${IPv6BIN}; do
+    chain_exists ${BIN} ${OUT_IVPN_LOG} || continue
+    clean_chain ${BIN} ${OUT_IVPN_LOG}
+    clean_chain ${BIN} ${IN_IVPN_LOG}
+  done
+}
+
+# VPN gateway mode: forward the traffic from LAN interface through the VPN tunnel
+# All the other traffic from/to LAN interface is not forwarded (e.g. when VPN is disconnected it never leaks out of the WAN interface)
+# The chains are re-created on each call.
+# Arguments:
+#   LAN_IF - LAN interface
+#   VPN_IF - (optional) VPN interface; when not defined - all forwarded traffic from/to LAN is blocked
+#   DNS    - (optional) DNS server for LAN clients (DNS requests from LAN are redirected to it)
+function gateway_apply {
+  LAN_IF=$1
+  VPN_IF=$2
+  DNS=$3
+
+  local NAT_BIN="${IPv4BIN} -t nat"
+
+  set -e
+
+  ### IPv4 ###
+  create_chain ${IPv4BIN} ${FORWARD_IVPN_GW}
+  create_chain "${NAT_BIN}" ${PREROUTING_IVPN_GW}
+  create_chain "${NAT_BIN}" ${POSTROUTING_IVPN_GW}
+  clean_chain ${IPv4BIN} ${FORWARD_IVPN_GW}
+  clean_chain "${NAT_BIN}" ${PREROUTING_IVPN_GW}
+  clean_chain "${NAT_BIN}" ${POSTROUTING_IVPN_GW}
+
+  if [ ! -z ${VPN_IF} ]; then
+    ${IPv4BIN} -w ${LOCKWAITTIME} -A ${FORWARD_IVPN_GW} -i ${LAN_IF} -o ${VPN_IF} -j ACCEPT
+    ${IPv4BIN} -w ${LOCKWAITTIME} -A ${FORWARD_IVPN_GW} -i ${VPN_IF} -o ${LAN_IF} -m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT
+    ${NAT_BIN} -w ${LOCKWAITTIME} -A ${POSTROUTING_IVPN_GW} -o ${VPN_IF} -j MASQUERADE
+
+    if [ ! -z ${DNS} ]; then
+      ${NAT_BIN} -w ${LOCKWAITTIME} -A ${PREROUTING_IVPN_GW} -i ${LAN_IF} -p udp --dport 53 -j DNAT --to-destination ${DNS}
+      ${NAT_BIN} -w ${LOCKWAITTIME} -A ${PREROUTING_IVPN_GW} -i ${LAN_IF} -p tcp --dport 53 -j DNAT --to-destination ${DNS}
+    fi
+  fi
+  ${IPv4BIN} -w ${LOCKWAITTIME} -A ${FORWARD_IVPN_GW} -i ${LAN_IF} -j DROP
+  ${IPv4BIN} -w ${LOCKWAITTIME} -A ${FORWARD_IVPN_GW} -o ${LAN_IF} -j DROP
+
+  # Note! Using "-I" parameter to process the rules before any other rules
+  ${IPv4BIN} -w ${LOCKWAITTIME} -C FORWARD -j ${FORWARD_IVPN_GW} 2> /dev/null || ${IPv4BIN} -w ${LOCKWAITTIME} -I FORWARD -j ${FORWARD_IVPN_GW}
+  ${NAT_BIN} -w ${LOCKWAITTIME} -C PREROUTING -j ${PREROUTING_IVPN_GW} 2> /dev/null || ${NAT_BIN} -w ${LOCKWAITTIME} -I PREROUTING -j ${PREROUTING_IVPN_GW}
+  ${NAT_BIN} -w ${LOCKWAITTIME} -C POSTROUTING -j ${POSTROUTING_IVPN_GW} 2> /dev/null || ${NAT_BIN} -w ${LOCKWAITTIME} -I POSTROUTING -j ${POSTROUTING_IVPN_GW}
+
+  ### IPv6 ###
+  # IPv6 traffic from LAN is never forwarded
+  if [ -f /proc/net/if_inet6 ]; then
+    create_chain ${IPv6BIN} ${FORWARD_IVPN_GW}
+    clean_chain ${IPv6BIN} ${FORWARD_IVPN_GW}
+    ${IPv6BIN} -w ${LOCKWAITTIME} -A ${FORWARD_IVPN_GW} -i ${LAN_IF} -j DROP
+    ${IPv6BIN} -w ${LOCKWAITTIME} -A ${FORWARD_IVPN_GW} -o ${LAN_IF} -j DROP
+    ${IPv6BIN} -w ${LOCKWAITTIME} -C FORWARD -j ${FORWARD_IVPN_GW} 2> /dev/null || ${IPv6BIN} -w ${LOCKWAITTIME} -I FORWARD -j ${FORWARD_IVPN_GW}
+  fi
+
+  set +e
+}
+
+function gateway_disable {
+  local NAT_BIN="${IPv4BIN} -t nat"
+
+  if chain_exists ${IPv4BIN} ${FORWARD_IVPN_GW}; then
+    ${IPv4BIN} -w ${LOCKWAITTIME} -D FORWARD -j ${FORWARD_IVPN_GW}
+    ${IPv4BIN} -w ${LOCKWAITTIME} -F ${FORWARD_IVPN_GW}
+    ${IPv4BIN} -w ${LOCKWAITTIME} -X ${FORWARD_IVPN_GW}
+  fi
+  for CH in PREROUTING POSTROUTING; do
+    chain_exists "${NAT_BIN}" IVPN-${CH} || continue
+    ${NAT_BIN} -w ${LOCKWAITTIME} -D ${CH} -j IVPN-${CH}
+    ${NAT_BIN} -w ${LOCKWAITTIME} -F IVPN-${CH}
+    ${NAT_BIN} -w ${LOCKWAITTIME} -X IVPN-${CH}
+  done
+  if chain_exists ${IPv6BIN} ${FORWARD_IVPN_GW}; then
+    ${IPv6BIN} -w ${LOCKWAITTIME} -D FORWARD -j ${FORWARD_IVPN_GW}
+    ${IPv6BIN} -w ${LOCKWAITTIME} -F ${FORWARD_IVPN_GW}
+    ${IPv6BIN} -w ${LOCKWAITTIME} -X ${FORWARD_IVPN_GW}
+  fi
+  return 0
+}
+
+# Block all IPv6 traffic except the VPN interface and local addresses (loopback, link-local, unique-local, multicast)
+# The allowed packets are not accepted here ('RETURN'): they are still processed by the rest of the rules
+# (e.g. IVPN firewall decides if LAN/multicast is allowed)
+# Arguments:
+#   IFACE - VPN interface name
+function ipv6leak_protection_enable {
+  IFACE=$1
+
+  [ -f /proc/net/if_inet6 ] || return 0
+
+  create_chain ${IPv6BIN} ${IN_IVPN_IPV6LEAK}
+  create_chain ${IPv6BIN} ${OUT_IVPN_IPV6LEAK}
+  clean_chain ${IPv6BIN} ${IN_IVPN_IPV6LEAK}
+  clean_chain ${IPv6BIN} ${OUT_IVPN_IPV6LEAK}
+
+  ${IPv6BIN} -w ${LOCKWAITTIME} -A ${OUT_IVPN_IPV6LEAK} -o lo -j RETURN
+  ${IPv6BIN} -w ${LOCKWAITTIME} -A ${IN_IVPN_IPV6LEAK} -i lo -j RETURN
+  if [ ! -z ${IFACE} ]; then
+    ${IPv6BIN} -w ${LOCKWAITTIME} -A ${OUT_IVPN_IPV6LEAK} -o ${IFACE} -j RETURN
+    ${IPv6BIN} -w ${LOCKWAITTIME} -A ${IN_IVPN_IPV6LEAK} -i ${IFACE} -j RETURN
+  fi
+  for NET in FE80::/10 FC00::/7; do
+    ${IPv6BIN} -w ${LOCKWAITTIME} -A ${OUT_IVPN_IPV6LEAK} -d ${NET} -j RETURN
+    ${IPv6BIN} -w ${LOCKWAITTIME} -A ${IN_IVPN_IPV6LEAK} -s ${NET} -j RETURN
+  done
+  # multicast (required for Neighbor Discovery)
+  ${IPv6BIN} -w ${LOCKWAITTIME} -A ${OUT_IVPN_IPV6LEAK} -d FF00::/8 -j RETURN
+  ${IPv6BIN} -w ${LOCKWAITTIME} -A ${IN_IVPN_IPV6LEAK} -d FF00::/8 -j RETURN
+  ${IPv6BIN} -w ${LOCKWAITTIME} -A ${OUT_IVPN_IPV6LEAK} -j DROP
+  ${IPv6BIN} -w ${LOCKWAITTIME} -A ${IN_IVPN_IPV6LEAK} -j DROP
+
+  # Note! Using "-I" parameter to process the rules before any other rules (including IVPN firewall)
+  ${IPv6BIN} -w ${LOCKWAITTIME} -C OUTPUT -j ${OUT_IVPN_IPV6LEAK} 2> /dev/null || ${IPv6BIN} -w ${LOCKWAITTIME} -I OUTPUT -j ${OUT_IVPN_IPV6LEAK}
+  ${IPv6BIN} -w ${LOCKWAITTIME} -C INPUT -j ${IN_IVPN_IPV6LEAK} 2> /dev/null || ${IPv6BIN} -w ${LOCKWAITTIME} -I INPUT -j ${IN_IVPN_IPV6LEAK}
+}
+
+function ipv6leak_protection_disable {
+  chain_exists ${IPv6BIN} ${OUT_IVPN_IPV6LEAK} || return 0
+
+  ${IPv6BIN} -w ${LOCKWAITTIME} -D OUTPUT -j ${OUT_IVPN_IPV6LEAK}
+  ${IPv6BIN} -w ${LOCKWAITTIME} -D INPUT -j ${IN_IVPN_IPV6LEAK}
+  ${IPv6BIN} -w ${LOCKWAITTIME} -F ${OUT_IVPN_IPV6LEAK}
+  ${IPv6BIN} -w ${LOCKWAITTIME} -F ${IN_IVPN_IPV6LEAK}
+  ${IPv6BIN} -w ${LOCKWAITTIME} -X ${OUT_IVPN_IPV6LEAK}
+  ${IPv6BIN} -w ${LOCKWAITTIME} -X ${IN_IVPN_IPV6LEAK}
+}
+
 function remove_exceptions_icmp {
   IN_CH=$1
   OUT_CH=$2
@@ -445,6 +715,10 @@ function main {
 
       disable_firewall
 
+    elif [[ $1 = "-reenable" ]] ; then
+
+      reenable_firewall
+
     elif [[ $1 = "-status" ]] ; then
 
       get_firewall_enabled
@@ -457,6 +731,17 @@ function main {
         return 1
       fi
 
+    # print active rules (used to verify that IVPN rules were not modified by third-party software)
+    elif [[ $1 = "-show_rules" ]]; then
+
+      ${IPv4BIN} -w ${LOCKWAITTIME} -S
+
+    elif [[ $1 = "-show_rules_ipv6" ]]; then
+
+      if [ -f /proc/net/if_inet6 ]; then
+        ${IPv6BIN} -w ${LOCKWAITTIME} -S
+      fi
+
     elif [[ $1 = "-add_exceptions" ]]; then
       get_firewall_enabled || return 0
 
@@ -498,7 +783,20 @@ function main {
         add_exceptions ${IPv6BIN} ${IN_IVPN_STAT_USER_EXP} ${OUT_IVPN_STAT_USER_EXP} $@
       fi
 
+    elif [[ $1 = "-add_user_exception_static" ]]; then
+
+      shift
+      add_user_exception ${IPv4BIN} ${IN_IVPN_STAT_USER_EXP} ${OUT_IVPN_STAT_USER_EXP} $@
+
+    elif [[ $1 = "-add_user_exception_static_ipv6" ]]; then
+
+      if [ -f /proc/net/if_inet6 ]; then
+        shift
+        add_user_exception ${IPv6BIN} ${IN_IVPN_STAT_USER_EXP} ${OUT_IVPN_STAT_USER_EXP} $@
+      fi
+
     # DNS rules
+    # Arguments: list of allowed DNS servers (the active one and the fallback servers); empty - block all DNS requests
     elif [[ $1 = "-set_dns" ]]; then
 
       get_firewall_enabled || return 0
@@ -507,15 +805,15 @@ function main {
 
       clean_chain ${IPv4BIN} ${OUT_IVPN_DNS}
 
-      if [[ -z "$@" ]] ; then
-        # block DNS
-        ${IPv4BIN} -w ${LOCKWAITTIME} -A ${OUT_IVPN_DNS} -p udp --dport 53 -j DROP
-        ${IPv4BIN} -w ${LOCKWAITTIME} -A ${OUT_IVPN_DNS} -p tcp --dport 53 -j DROP
-      else
-        # block everything except defined address
-        ${IPv4BIN} -w ${LOCKWAITTIME} -A ${OUT_IVPN_DNS} ! -d $@ -p udp --dport 53 -j DROP
-        ${IPv4BIN} -w ${LOCKWAITTIME} -A ${OUT_IVPN_DNS} ! -d $@ -p tcp --dport 53 -j DROP
-      fi
+      # the allowed servers are not accepted here: they are still processed by the rest of the rules
+      # (so they are reachable only through the VPN interface)
+      for DNS in $@; do
+        ${IPv4BIN} -w ${LOCKWAITTIME} -A ${OUT_IVPN_DNS} -d ${DNS} -p udp --dport 53 -j RETURN
+        ${IPv4BIN} -w ${LOCKWAITTIME} -A ${OUT_IVPN_DNS} -d ${DNS} -p tcp --dport 53 -j RETURN
+      done
+      # block everything else
+      ${IPv4BIN} -w ${LOCKWAITTIME} -A ${OUT_IVPN_DNS} -p udp --dport 53 -j DROP
+      ${IPv4BIN} -w ${LOCKWAITTIME} -A ${OUT_IVPN_DNS} -p tcp --dport 53 -j DROP
 
     # icmp exceptions
     elif [[ $1 = "-add_exceptions_icmp" ]]; then
@@ -528,6 +826,32 @@ function main {
       shift
       remove_exceptions_icmp ${IN_IVPN_ICMP_EXP} ${OUT_IVPN_ICMP_EXP} $@
 
+    elif [[ $1 = "-blocked_log_enable" ]]; then
+
+      get_firewall_enabled || return 0
+      blocked_log_enable $2
+
+    elif [[ $1 = "-blocked_log_disable" ]]; then
+
+      get_firewall_enabled || return 0
+      blocked_log_disable
+
+    elif [[ $1 = "-gateway_apply" ]]; then
+
+      gateway_apply "$2" "$3" "$4"
+
+    elif [[ $1 = "-gateway_disable" ]]; then
+
+      gateway_disable
+
+    elif [[ $1 = "-ipv6leak_protection_enable" ]]; then
+
+      ipv6leak_protection_enable $2
+
+    elif [[ $1 = "-ipv6leak_protection_disable" ]]; then
+
+      ipv6leak_protection_disable
+
     elif [[ $1 = "-connected" ]]; then
 
         get_firewall_enabled || return 0
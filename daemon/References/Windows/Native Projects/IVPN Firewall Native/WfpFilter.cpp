@@ -50,6 +50,11 @@ extern "C" {
 					delete filter->filterCondition[i].conditionValue.v6AddrMask;
 				break;
 
+			case FWP_RANGE_TYPE:
+				if (filter->filterCondition[i].conditionValue.rangeValue != 0)
+					delete filter->filterCondition[i].conditionValue.rangeValue;
+				break;
+
 			case FWP_BYTE_BLOB_TYPE:
 				if (filter->filterCondition[i].conditionValue.byteBlob != 0)
 				{
@@ -184,6 +189,19 @@ extern "C" {
 		return ERROR_SUCCESS;
 	}
 
+	EXPORT DWORD _cdecl FWPM_FILTER_SetConditionUINT8(FWPM_FILTER0 *filter,
+				UINT32 conditionIndex, UINT8 val)
+	{
+		DWORD checkFilterResult = CheckFilter(filter, conditionIndex);
+		if (checkFilterResult != 0)
+			return checkFilterResult;
+
+		filter->filterCondition[conditionIndex].conditionValue.type = FWP_UINT8;
+		filter->filterCondition[conditionIndex].conditionValue.uint8 = val;
+
+		return ERROR_SUCCESS;
+	}
+
 	EXPORT DWORD _cdecl FWPM_FILTER_SetConditionUINT16(FWPM_FILTER0 *filter, 
 				UINT32 conditionIndex, UINT16 port)
 	{
@@ -197,6 +215,24 @@ extern "C" {
 		return ERROR_SUCCESS;
 	}
 
+	EXPORT DWORD _cdecl FWPM_FILTER_SetConditionRangeUINT16(FWPM_FILTER0 *filter,
+				UINT32 conditionIndex, UINT16 low, UINT16 high)
+	{
+		DWORD checkFilterResult = CheckFilter(filter, conditionIndex);
+		if (checkFilterResult != 0)
+			return checkFilterResult;
+
+		// NOTE! The condition match type must be FWP_MATCH_RANGE
+		filter->filterCondition[conditionIndex].conditionValue.type = FWP_RANGE_TYPE;
+		filter->filterCondition[conditionIndex].conditionValue.rangeValue = new FWP_RANGE0{0};
+		filter->filterCondition[conditionIndex].conditionValue.rangeValue->valueLow.type = FWP_UINT16;
+		filter->filterCondition[conditionIndex].conditionValue.rangeValue->valueLow.uint16 = low;
+		filter->filterCondition[conditionIndex].conditionValue.rangeValue->valueHigh.type = FWP_UINT16;
+		filter->filterCondition[conditionIndex].conditionValue.rangeValue->valueHigh.uint16 = high;
+
+		return ERROR_SUCCESS;
+	}
+
 	EXPORT DWORD _cdecl FWPM_FILTER_SetConditionBlobString(FWPM_FILTER0 *filter, 
 		UINT32 conditionIndex, wchar_t *blobString)
 	{
@@ -248,6 +284,16 @@ extern "C" {
 		return FwpmFilterDeleteById0(engineHandle, id);
 	}
 
+	EXPORT bool _cdecl WfpFilterIsInstalledById(HANDLE engineHandle, UINT64 id)
+	{
+		FWPM_FILTER0 *filter = NULL;
+		DWORD result = FwpmFilterGetById0(engineHandle, id, &filter);
+		if (filter != NULL)
+			FwpmFreeMemory0((void **)&filter);
+
+		return result == 0;
+	}
+
 	DWORD FindMatchingCallouts(
 		HANDLE engine,
 		GUID providerKey,
@@ -7,15 +7,22 @@
 #   sudo pfctl -a "ivpn_firewall" -s rules
 #   sudo pfctl -a "ivpn_firewall/tunnel" -s rules
 #   sudo pfctl -a "ivpn_firewall/dns" -s rules
+#   sudo pfctl -a "ivpn_firewall/exceptions" -s rules
 # Show table
 #   sudo pfctl -a "ivpn_firewall" -t ivpn_servers -T show
 #   sudo pfctl -a "ivpn_firewall" -t ivpn_exceptions -T show
+#   sudo pfctl -a "ivpn_firewall/dns" -t ivpn_dns -T show
 
 PATH=/sbin:/usr/sbin:$PATH
 
 ANCHOR_NAME="ivpn_firewall"
 EXCEPTIONS_TABLE="ivpn_servers"
 USER_EXCEPTIONS_TABLE="ivpn_exceptions"
+# allowed DNS servers (in 'dns' anchor)
+DNS_TABLE="ivpn_dns"
+
+# anchor for IPv6 leak protection (independent from the IVPN Firewall; applicable when VPN connected without IPv6 in tunnel)
+IPV6LEAK_ANCHOR_NAME="ivpn_ipv6leak"
 
 # Checks whether anchor is present in the system
 # 0 - if anchor is present
@@ -96,6 +103,7 @@ function enable_firewall {
       pass in proto udp from any to any port = 68
 
       anchor tunnel all
+      anchor exceptions all
       anchor dns all
 _EOF
 
@@ -126,6 +134,8 @@ function disable_firewall {
     pfctl -a ${ANCHOR_NAME}/tunnel -Fr
     # remove all rules in dns anchor
     pfctl -a ${ANCHOR_NAME}/dns -Fr
+    # remove all rules in user exceptions anchor
+    pfctl -a ${ANCHOR_NAME}/exceptions -Fr
 
     # remove all the rules in anchor
     pfctl -a ${ANCHOR_NAME} -Fr 
@@ -159,10 +169,12 @@ function client_disconnected {
     pfctl -a ${ANCHOR_NAME}/tunnel -Fr
 }
 
+# Arguments: list of allowed DNS servers (the active one and the fallback servers); empty - block all DNS requests
 function set_dns {
-  DNS=$1
-  # remove all rules in dns anchor
+  DNS="$@"
+  # remove all rules and tables in dns anchor
   pfctl -a ${ANCHOR_NAME}/dns -Fr
+  pfctl -a ${ANCHOR_NAME}/dns -FT 2> /dev/null
 
   if [[ -z "${DNS}" ]] ; then
       # DNS not defined. Block all connections to port 53
@@ -173,10 +185,64 @@ _EOF
       return 0
   fi
 
+  # Note! The table is in use: the negated list ('! { A, B }') is expanded by pf into several rules which block everything
   pfctl -a ${ANCHOR_NAME}/dns -f - <<_EOF
-        block drop out proto udp from any to ! ${DNS} port = 53
-        block drop out proto tcp from any to ! ${DNS} port = 53
+        table <${DNS_TABLE}> { ${DNS} }
+        block drop out proto udp from any to ! <${DNS_TABLE}> port = 53
+        block drop out proto tcp from any to ! <${DNS_TABLE}> port = 53
+_EOF
+}
+
+# Block all IPv6 traffic except the VPN interface and local addresses (loopback, link-local, unique-local, multicast)
+# Arguments:
+#   IFACE - VPN interface name
+function ipv6leak_protection_enable {
+    IFACE=$1
+
+    pfctl -sr 2> /dev/null | grep -q "anchor.*${IPV6LEAK_ANCHOR_NAME}"
+    if (( $? != 0 )) ; then
+      cat \
+        <(pfctl -sr 2> /dev/null) \
+        <(echo "anchor ${IPV6LEAK_ANCHOR_NAME} all") \
+        | pfctl -f -
+    fi
+
+    local ON_IFACE=""
+    if [[ ! -z "${IFACE}" ]] ; then
+      ON_IFACE="on ! ${IFACE}"
+    fi
+
+    pfctl -a ${IPV6LEAK_ANCHOR_NAME} -f - <<_EOF
+      table <ivpn_ipv6_local> const { ::1, fe80::/10, fc00::/7, ff00::/8 }
+
+      pass quick on lo0 all
+      block drop out quick ${ON_IFACE} inet6 from any to ! <ivpn_ipv6_local>
+      block drop in quick ${ON_IFACE} inet6 from ! <ivpn_ipv6_local> to any
 _EOF
+
+    # ensure pf is enabled (keep the reference until the protection is disabled)
+    local OLD_TOKEN=`echo 'show State:/Network/IVPN/PacketFilterIPv6Leak' | scutil | grep Token | sed -e 's/.*: //' | tr -d ' \n'`
+    if [[ -z "${OLD_TOKEN}" ]] ; then
+      local TOKEN=`pfctl -E 2>&1 | grep -i token | sed -e 's/.*oken.*://' | tr -d ' \n'`
+      scutil <<_EOF
+        d.init
+        d.add Token "${TOKEN}"
+        set State:/Network/IVPN/PacketFilterIPv6Leak
+
+        quit
+_EOF
+    fi
+}
+
+function ipv6leak_protection_disable {
+    pfctl -a ${IPV6LEAK_ANCHOR_NAME} -Fr 2> /dev/null
+    pfctl -a ${IPV6LEAK_ANCHOR_NAME} -FT 2> /dev/null
+
+    local TOKEN=`echo 'show State:/Network/IVPN/PacketFilterIPv6Leak' | scutil | grep Token | sed -e 's/.*: //' | tr -d ' \n'`
+    if [[ ! -z "${TOKEN}" ]] ; then
+      pfctl -X "${TOKEN}"
+      echo 'remove State:/Network/IVPN/PacketFilterIPv6Leak' | scutil
+    fi
 }
 
 function main {
@@ -202,6 +268,22 @@ function main {
         return 1
       fi
 
+    # print active rules (used to verify that IVPN rules were not modified by third-party software)
+    elif [[ $1 = "-show_rules" ]]; then
+
+      pfctl -a "${ANCHOR_NAME}/$2" -sr 2> /dev/null
+
+    elif [[ $1 = "-show_dns_table" ]]; then
+
+      pfctl -a "${ANCHOR_NAME}/dns" -t "${DNS_TABLE}" -T show 2> /dev/null
+      return 0
+
+    elif [[ $1 = "-show_tables" ]]; then
+
+      pfctl -a "${ANCHOR_NAME}" -t "${EXCEPTIONS_TABLE}" -T show 2> /dev/null
+      pfctl -a "${ANCHOR_NAME}" -t "${USER_EXCEPTIONS_TABLE}" -T show 2> /dev/null
+      return 0
+
     elif [[ $1 = "-add_exceptions" ]]; then    
 
       shift
@@ -217,6 +299,24 @@ function main {
       shift
       pfctl -a "${ANCHOR_NAME}" -t "${USER_EXCEPTIONS_TABLE}" -T replace $@
 
+    elif [[ $1 = "-set_user_exceptions_rules" ]]; then
+
+      get_firewall_enabled || return 0
+
+      # remove all rules in user exceptions anchor
+      pfctl -a ${ANCHOR_NAME}/exceptions -Fr
+      [ -z "$2" ] && return 0
+      # rules are separated by new-line characters
+      echo "$2" | pfctl -a ${ANCHOR_NAME}/exceptions -f -
+
+    elif [[ $1 = "-ipv6leak_protection_enable" ]]; then
+
+        ipv6leak_protection_enable $2
+
+    elif [[ $1 = "-ipv6leak_protection_disable" ]]; then
+
+        ipv6leak_protection_disable
+
     elif [[ $1 = "-connected" ]]; then       
         
         IFACE=$2  
@@ -236,7 +336,8 @@ function main {
 
         get_firewall_enabled || return 0
 
-        set_dns $2
+        shift
+        set_dns $@
     else
         echo "Unknown command"
         return 2
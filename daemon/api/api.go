@@ -131,6 +131,12 @@ func (a *API) IsAlternateIPsInitialized(IPv6 bool) bool {
 	return len(a.alternateIPsV4) > 0
 }
 
+// LatencyProbeTarget returns the URL of the API server for the latency measurement (HTTPS HEAD request)
+// and the last good alternate IP of the API server (nil - the host is resolved by DNS)
+func (a *API) LatencyProbeTarget() (url string, ip net.IP) {
+	return "https://" + _apiHost + "/", a.GetLastGoodAlternateIP(false)
+}
+
 func (a *API) GetLastGoodAlternateIP(IPv6 bool) net.IP {
 	if IPv6 {
 		return a.lastGoodAlternateIPv6
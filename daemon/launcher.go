@@ -27,9 +27,11 @@ import (
 	"encoding/binary"
 	"fmt"
 	"os"
+	"os/signal"
 	"runtime"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/ivpn/desktop-app/daemon/api"
@@ -204,6 +206,16 @@ func launchService(secret uint64, startedOnPort chan<- int) {
 		log.Panic("Failed to initialize service:", err)
 	}
 
+	// reload daemon configuration file on SIGHUP (not applicable for Windows)
+	reloadSignal := make(chan os.Signal, 1)
+	signal.Notify(reloadSignal, syscall.SIGHUP)
+	go func() {
+		for range reloadSignal {
+			log.Info("SIGHUP received: reloading daemon configuration")
+			serv.ReloadDaemonConfig() // errors are reported by the service
+		}
+	}()
+
 	// start receiving requests from client (synchronous)
 	if err := protocol.Start(secret, startedOnPort, serv); err != nil {
 		log.Error("Protocol stopped with error:", err)
@@ -103,6 +103,16 @@ func InterfaceByIPAddr(localAddr net.IP) (*net.Interface, error) {
 	return nil, errors.New("not found network interface with address:" + localAddr.String())
 }
 
+// InterfaceTraffic - returns the number of bytes received and sent by the network interface
+// Note: the counters are taken from OS and can be reset (or overflowed) by OS
+func InterfaceTraffic(inf *net.Interface) (rxBytes uint64, txBytes uint64, err error) {
+	if inf == nil {
+		return 0, 0, fmt.Errorf("network interface not defined")
+	}
+	// method should be implemented in platform-specific file
+	return doInterfaceTraffic(inf)
+}
+
 // GetFreePort - get unused local port
 // Note there is no guarantee that port will not be in use right after finding it
 func GetFreePort(isTCP bool) (int, error) {
@@ -27,6 +27,7 @@ import (
 	"net"
 	"os/exec"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -118,3 +119,35 @@ func doGetDefaultRoutes(getAllDefRoutes bool) (routes []route, err error) {
 
 	return routes, nil
 }
+
+// doInterfaceTraffic - returns the number of bytes received and sent by the network interface
+func doInterfaceTraffic(inf *net.Interface) (rxBytes uint64, txBytes uint64, err error) {
+	// Expected output of "netstat -I utun3 -b -n" command:
+	//	Name       Mtu   Network       Address            Ipkts Ierrs     Ibytes    Opkts Oerrs     Obytes  Coll
+	//	utun3      1380  <Link#18>                          1523     0     312852     1740     0     255104     0
+	//	utun3      1380  10.11.12.2/32 10.11.12.2           1523     -     312852     1740     -     255104     -
+	cmd := exec.Command("/usr/sbin/netstat", "-I", inf.Name, "-b", "-n")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read traffic statistics for '%s': %w", inf.Name, err)
+	}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		cols := strings.Fields(line)
+		if len(cols) < 10 || cols[0] != inf.Name || !strings.HasPrefix(cols[2], "<Link#") {
+			continue
+		}
+		// the 'Link' line has no 'Address' column for tunnel interfaces
+		if len(cols) == 10 {
+			cols = append(cols[:3], append([]string{""}, cols[3:]...)...)
+		}
+		if rxBytes, err = strconv.ParseUint(cols[6], 10, 64); err != nil {
+			break
+		}
+		if txBytes, err = strconv.ParseUint(cols[9], 10, 64); err != nil {
+			break
+		}
+		return rxBytes, txBytes, nil
+	}
+	return 0, 0, fmt.Errorf("failed to parse traffic statistics for '%s'", inf.Name)
+}
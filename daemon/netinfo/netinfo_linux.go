@@ -24,9 +24,12 @@ package netinfo
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net"
+	"path/filepath"
 	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/ivpn/desktop-app/daemon/shell"
 )
@@ -78,3 +81,22 @@ func doDefaultGatewayIP() (defGatewayIP net.IP, err error) {
 
 	return defGatewayIP, retErr
 }
+
+// doInterfaceTraffic - returns the number of bytes received and sent by the network interface
+func doInterfaceTraffic(inf *net.Interface) (rxBytes uint64, txBytes uint64, err error) {
+	readCounter := func(name string) (uint64, error) {
+		data, err := ioutil.ReadFile(filepath.Join("/sys/class/net", inf.Name, "statistics", name))
+		if err != nil {
+			return 0, err
+		}
+		return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	}
+
+	if rxBytes, err = readCounter("rx_bytes"); err != nil {
+		return 0, 0, fmt.Errorf("failed to read traffic statistics for '%s': %w", inf.Name, err)
+	}
+	if txBytes, err = readCounter("tx_bytes"); err != nil {
+		return 0, 0, fmt.Errorf("failed to read traffic statistics for '%s': %w", inf.Name, err)
+	}
+	return rxBytes, txBytes, nil
+}
@@ -26,6 +26,8 @@ import (
 	"bytes"
 	"fmt"
 	"net"
+
+	"golang.org/x/sys/windows"
 )
 
 // doDefaultGatewayIP - returns: default gateway IP
@@ -52,3 +54,13 @@ func doDefaultGatewayIP() (defGatewayIP net.IP, err error) {
 
 	return nil, fmt.Errorf("failed to determine default route")
 }
+
+// doInterfaceTraffic - returns the number of bytes received and sent by the network interface
+// Note: MIB_IFROW has 32-bit counters (they are overflowing after 4GB)
+func doInterfaceTraffic(inf *net.Interface) (rxBytes uint64, txBytes uint64, err error) {
+	row := windows.MibIfRow{Index: uint32(inf.Index)}
+	if err := windows.GetIfEntry(&row); err != nil {
+		return 0, 0, fmt.Errorf("failed to read traffic statistics for '%s': %w", inf.Name, err)
+	}
+	return uint64(row.InOctets), uint64(row.OutOctets), nil
+}
@@ -0,0 +1,283 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+// +build linux
+
+package netlink
+
+import (
+	"encoding/binary"
+	"fmt"
+	"syscall"
+	"time"
+)
+
+// NFLOG netlink constants (see: linux/netfilter/nfnetlink.h, linux/netfilter/nfnetlink_log.h)
+const (
+	netlinkNetfilter = 12 // NETLINK_NETFILTER
+
+	nfnlSubsysULog = 4 // NFNL_SUBSYS_ULOG
+
+	nfulnlMsgPacket = 0 // NFULNL_MSG_PACKET
+	nfulnlMsgConfig = 1 // NFULNL_MSG_CONFIG
+
+	nfulaCfgCmd  = 1 // NFULA_CFG_CMD
+	nfulaCfgMode = 2 // NFULA_CFG_MODE
+
+	nfulnlCfgCmdBind   = 1 // NFULNL_CFG_CMD_BIND
+	nfulnlCfgCmdUnbind = 2 // NFULNL_CFG_CMD_UNBIND
+
+	nfulnlCopyPacket = 2 // NFULNL_COPY_PACKET
+
+	nfulaIfIndexIn = 4  // NFULA_IFINDEX_INDEV
+	nfulaIfIndexOu = 5  // NFULA_IFINDEX_OUTDEV
+	nfulaPayload   = 9  // NFULA_PAYLOAD
+	nfulaPrefix    = 10 // NFULA_PREFIX
+
+	nlaTypeMask = 0x3fff // ~(NLA_F_NESTED | NLA_F_NET_BYTEORDER)
+
+	nflogReadTimeout = time.Second
+)
+
+// NflogPacket - packet received from NFLOG group
+type NflogPacket struct {
+	// prefix defined in the iptables rule ('--nflog-prefix')
+	Prefix string
+	// interface indexes (0 - not defined)
+	InIfIndex  uint32
+	OutIfIndex uint32
+	// beginning of the packet (starting from IP header)
+	Payload []byte
+}
+
+// NflogListener provides possibility to receive packets logged by iptables NFLOG target
+//
+// Usage example:
+//
+//	l, err := CreateNflogListener(100, 128)
+//	if err != nil {
+//		return err
+//	}
+//	defer l.Close()
+//	for {
+//		packets, err := l.ReadPackets()
+//		...
+//	}
+type NflogListener struct {
+	fd    int
+	group uint16
+	seq   uint32
+}
+
+// CreateNflogListener creates listener for the NFLOG group
+// 'copyRange' - max number of bytes of the packet to copy to the listener
+func CreateNflogListener(group uint16, copyRange uint32) (*NflogListener, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW, netlinkNetfilter)
+	if err != nil {
+		return nil, fmt.Errorf("socket initialization error: %w", err)
+	}
+
+	l := &NflogListener{fd: fd, group: group}
+
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("socket binding error: %w", err)
+	}
+
+	// read timeout: the reading is not blocked forever (it gives possibility to stop reading routine)
+	tv := syscall.NsecToTimeval(nflogReadTimeout.Nanoseconds())
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("failed to set socket timeout: %w", err)
+	}
+
+	// bind to the group
+	if err := l.sendConfig(syscall.AF_UNSPEC, nfulaCfgCmd, []byte{nfulnlCfgCmdBind}); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("failed to bind to NFLOG group %d: %w", group, err)
+	}
+
+	// copy packets (first 'copyRange' bytes)
+	mode := make([]byte, 6)
+	binary.BigEndian.PutUint32(mode[0:4], copyRange)
+	mode[4] = nfulnlCopyPacket
+	if err := l.sendConfig(syscall.AF_UNSPEC, nfulaCfgMode, mode); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("failed to set NFLOG copy mode: %w", err)
+	}
+
+	return l, nil
+}
+
+// Close unbinds from the group and closes the socket
+func (l *NflogListener) Close() error {
+	if l.fd < 0 {
+		return nil
+	}
+	l.sendConfig(syscall.AF_UNSPEC, nfulaCfgCmd, []byte{nfulnlCfgCmdUnbind})
+	err := syscall.Close(l.fd)
+	l.fd = -1
+	return err
+}
+
+// ReadPackets returns received packets
+// Returns empty list (without error) when there were no packets during read timeout
+func (l *NflogListener) ReadPackets() ([]NflogPacket, error) {
+	buf := make([]byte, 65536)
+
+	n, err := syscall.Read(l.fd, buf)
+	if err != nil {
+		if err == syscall.EAGAIN || err == syscall.EWOULDBLOCK || err == syscall.EINTR {
+			return nil, nil // timeout
+		}
+		if err == syscall.ENOBUFS {
+			return nil, nil // some packets lost (socket buffer overflow); continue reading
+		}
+		return nil, fmt.Errorf("NFLOG read error: %w", err)
+	}
+	if n <= 0 {
+		return nil, nil
+	}
+
+	msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+	if err != nil {
+		return nil, fmt.Errorf("NFLOG parse error: %w", err)
+	}
+
+	var ret []NflogPacket
+	for _, m := range msgs {
+		if m.Header.Type != (nfnlSubsysULog<<8)|nfulnlMsgPacket {
+			continue
+		}
+		if p, ok := parseNflogPacket(m.Data); ok {
+			ret = append(ret, p)
+		}
+	}
+	return ret, nil
+}
+
+func (l *NflogListener) sendConfig(family uint8, attrType uint16, attrData []byte) error {
+	l.seq++
+
+	// nfgenmsg: family, version (NFNETLINK_V0), resource id (group; big-endian)
+	payload := []byte{family, 0, 0, 0}
+	binary.BigEndian.PutUint16(payload[2:4], l.group)
+	payload = append(payload, netlinkAttr(attrType, attrData)...)
+
+	msg := make([]byte, syscall.NLMSG_HDRLEN, syscall.NLMSG_HDRLEN+len(payload))
+	binary.LittleEndian.PutUint32(msg[0:4], uint32(syscall.NLMSG_HDRLEN+len(payload)))
+	binary.LittleEndian.PutUint16(msg[4:6], (nfnlSubsysULog<<8)|nfulnlMsgConfig)
+	binary.LittleEndian.PutUint16(msg[6:8], syscall.NLM_F_REQUEST|syscall.NLM_F_ACK)
+	binary.LittleEndian.PutUint32(msg[8:12], l.seq)
+	msg = append(msg, payload...)
+
+	if err := syscall.Sendto(l.fd, msg, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return err
+	}
+
+	// wait for acknowledgment (skip the packets which can be received before it)
+	buf := make([]byte, 65536)
+	for i := 0; i < 100; i++ {
+		n, err := syscall.Read(l.fd, buf)
+		if err != nil {
+			return err
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return err
+		}
+		for _, m := range msgs {
+			if m.Header.Type != syscall.NLMSG_ERROR || m.Header.Seq != l.seq || len(m.Data) < 4 {
+				continue
+			}
+			if errno := int32(binary.LittleEndian.Uint32(m.Data[0:4])); errno != 0 {
+				return syscall.Errno(-errno)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("acknowledgment not received")
+}
+
+func netlinkAttr(attrType uint16, data []byte) []byte {
+	attrLen := syscall.SizeofRtAttr + len(data)
+	ret := make([]byte, nlaAlign(attrLen))
+	binary.LittleEndian.PutUint16(ret[0:2], uint16(attrLen))
+	binary.LittleEndian.PutUint16(ret[2:4], attrType)
+	copy(ret[syscall.SizeofRtAttr:], data)
+	return ret
+}
+
+func nlaAlign(l int) int {
+	return (l + syscall.NLA_ALIGNTO - 1) & ^(syscall.NLA_ALIGNTO - 1)
+}
+
+// parseNflogPacket parses NFULNL_MSG_PACKET message data (nfgenmsg + attributes)
+func parseNflogPacket(data []byte) (NflogPacket, bool) {
+	const nfgenmsgLen = 4
+	if len(data) < nfgenmsgLen {
+		return NflogPacket{}, false
+	}
+
+	var p NflogPacket
+	attrs := data[nfgenmsgLen:]
+	for len(attrs) >= syscall.SizeofRtAttr {
+		attrLen := int(binary.LittleEndian.Uint16(attrs[0:2]))
+		attrType := binary.LittleEndian.Uint16(attrs[2:4]) & nlaTypeMask
+		if attrLen < syscall.SizeofRtAttr || attrLen > len(attrs) {
+			break
+		}
+		value := attrs[syscall.SizeofRtAttr:attrLen]
+
+		switch attrType {
+		case nfulaPrefix:
+			p.Prefix = string(trimZero(value))
+		case nfulaIfIndexIn:
+			if len(value) >= 4 {
+				p.InIfIndex = binary.BigEndian.Uint32(value)
+			}
+		case nfulaIfIndexOu:
+			if len(value) >= 4 {
+				p.OutIfIndex = binary.BigEndian.Uint32(value)
+			}
+		case nfulaPayload:
+			p.Payload = append([]byte{}, value...)
+		}
+
+		alignedLen := nlaAlign(attrLen)
+		if alignedLen > len(attrs) {
+			break
+		}
+		attrs = attrs[alignedLen:]
+	}
+
+	return p, len(p.Payload) > 0
+}
+
+func trimZero(b []byte) []byte {
+	for i, c := range b {
+		if c == 0 {
+			return b[:i]
+		}
+	}
+	return b
+}
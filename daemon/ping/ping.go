@@ -142,6 +142,9 @@ type Pinger struct {
 	id       int
 	sequence int
 	network  string
+
+	// error of the socket creation (e.g. not enough privileges)
+	listenErr error
 }
 
 type packet struct {
@@ -260,6 +263,12 @@ func (p *Pinger) Privileged() bool {
 	return p.network == "ip"
 }
 
+// ListenError returns the error of the ICMP socket creation (nil - the socket was created successfully).
+// The error means the ping method is not usable (e.g. raw socket requires privileges).
+func (p *Pinger) ListenError() error {
+	return p.listenErr
+}
+
 // Run runs the pinger. This is a blocking function that will exit when it's
 // done. If Count or Interval are not specified, it will run continuously until
 // it is interrupted.
@@ -552,6 +561,7 @@ func (p *Pinger) sendICMP(conn *icmp.PacketConn) error {
 func (p *Pinger) listen(netProto string) *icmp.PacketConn {
 	conn, err := icmp.ListenPacket(netProto, p.Source)
 	if err != nil {
+		p.listenErr = err
 		fmt.Printf("Error listening for ICMP packets: %s\n", err.Error())
 		close(p.done)
 		return nil
@@ -0,0 +1,302 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package ping
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ivpn/desktop-app/daemon/logger"
+)
+
+var log *logger.Logger
+
+func init() {
+	log = logger.NewLogger("ping")
+}
+
+// Method - the way the latency to a host is measured
+type Method int
+
+const (
+	// ICMP - ICMP echo using raw socket (requires privileges)
+	ICMP Method = iota
+	// ICMPUnprivileged - ICMP echo using datagram socket (SOCK_DGRAM); it has to be allowed by OS
+	ICMPUnprivileged
+	// WireGuard - round-trip of the WireGuard handshake initiation to the server UDP port
+	WireGuard
+	// TCP - time of the TCP connection establishment (e.g. to the OpenVPN TCP port)
+	TCP
+	// HTTPS - round-trip of the HTTPS HEAD request (e.g. to the API)
+	HTTPS
+)
+
+// DefaultMethods - the order of the methods in use by default
+var DefaultMethods = []Method{ICMP, ICMPUnprivileged, WireGuard, TCP, HTTPS}
+
+func (m Method) String() string {
+	switch m {
+	case ICMP:
+		return "ICMP"
+	case ICMPUnprivileged:
+		return "ICMP (unprivileged)"
+	case WireGuard:
+		return "WireGuard handshake"
+	case TCP:
+		return "TCP connect"
+	case HTTPS:
+		return "HTTPS HEAD"
+	default:
+		return fmt.Sprintf("method %d", int(m))
+	}
+}
+
+// Target - the host to measure the latency to.
+// The method is skipped when its parameters are not defined.
+type Target struct {
+	IP net.IP
+
+	// TCP port for the 'TCP' method
+	TCPPort int
+
+	// WireGuard server UDP port and keys (base64) for the 'WireGuard' method
+	WgPort            int
+	WgServerPublicKey string
+	WgPrivateKey      string
+
+	// URL for the 'HTTPS' method. When the IP is defined - the connection is established to the IP.
+	URL string
+}
+
+func (t Target) isApplicable(m Method) bool {
+	switch m {
+	case ICMP, ICMPUnprivileged:
+		return t.IP != nil
+	case WireGuard:
+		return t.IP != nil && t.WgPort > 0 && len(t.WgServerPublicKey) > 0 && len(t.WgPrivateKey) > 0
+	case TCP:
+		return t.IP != nil && t.TCPPort > 0
+	case HTTPS:
+		return len(t.URL) > 0
+	default:
+		return false
+	}
+}
+
+// errMethodUnusable - the method can not be used on this host (e.g. not enough privileges to create a socket)
+type errMethodUnusable struct{ err error }
+
+func (e errMethodUnusable) Error() string { return e.err.Error() }
+func (e errMethodUnusable) Unwrap() error { return e.err }
+
+// Measure returns the round-trip time to the target using the defined method
+func Measure(m Method, t Target, timeout time.Duration) (time.Duration, error) {
+	if !t.isApplicable(m) {
+		return 0, fmt.Errorf("%s: not applicable for the target", m)
+	}
+
+	switch m {
+	case ICMP, ICMPUnprivileged:
+		return measureICMP(t.IP, m == ICMP, timeout)
+	case WireGuard:
+		return measureWireGuard(t, timeout)
+	case TCP:
+		return measureTCP(t.IP, t.TCPPort, timeout)
+	case HTTPS:
+		return measureHTTPS(t.URL, t.IP, timeout)
+	default:
+		return 0, fmt.Errorf("unsupported method %d", int(m))
+	}
+}
+
+// Prober measures the latency using the first method which works for the target.
+// The method which succeeded last time is tried first (e.g. when ICMP is filtered by the network,
+// the hosts are measured by TCP/UDP probes without waiting for ICMP timeouts).
+// The methods which are not usable on this host (e.g. no privileges for raw sockets) are not tried anymore.
+type Prober struct {
+	mutex     sync.Mutex
+	methods   []Method
+	preferred int // index of the preferred method
+	unusable  map[Method]error
+}
+
+// NewProber creates the prober. The methods are tried in the defined order (nil - DefaultMethods).
+func NewProber(methods []Method) *Prober {
+	if len(methods) == 0 {
+		methods = DefaultMethods
+	}
+	return &Prober{methods: methods, unusable: make(map[Method]error)}
+}
+
+// Probe returns the round-trip time to the target and the method it was measured by
+func (p *Prober) Probe(t Target, timeout time.Duration) (rtt time.Duration, method Method, err error) {
+	var errs []string
+	for _, m := range p.order() {
+		if !t.isApplicable(m) {
+			continue
+		}
+
+		rtt, err := Measure(m, t, timeout)
+		if err == nil && rtt > 0 {
+			p.setPreferred(m)
+			return rtt, m, nil
+		}
+		if err == nil {
+			err = fmt.Errorf("no response")
+		}
+		var eu errMethodUnusable
+		if errors.As(err, &eu) {
+			p.setUnusable(m, eu.err)
+		}
+		errs = append(errs, fmt.Sprintf("%s: %s", m, err))
+	}
+
+	if len(errs) == 0 {
+		return 0, 0, fmt.Errorf("no applicable latency probe methods")
+	}
+	return 0, 0, fmt.Errorf("%v", errs)
+}
+
+// PreferredMethod returns the method which succeeded last time
+func (p *Prober) PreferredMethod() Method {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.methods[p.preferred]
+}
+
+// order returns the usable methods: the preferred method is the first
+func (p *Prober) order() []Method {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	ret := make([]Method, 0, len(p.methods))
+	if _, ok := p.unusable[p.methods[p.preferred]]; !ok {
+		ret = append(ret, p.methods[p.preferred])
+	}
+	for i, m := range p.methods {
+		if _, ok := p.unusable[m]; !ok && i != p.preferred {
+			ret = append(ret, m)
+		}
+	}
+	return ret
+}
+
+func (p *Prober) setPreferred(m Method) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for i, pm := range p.methods {
+		if pm == m {
+			p.preferred = i
+			return
+		}
+	}
+}
+
+func (p *Prober) setUnusable(m Method, err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if _, ok := p.unusable[m]; !ok {
+		p.unusable[m] = err
+		log.Info(fmt.Sprintf("Latency probe method '%s' is not usable: %s", m, err))
+	}
+}
+
+func measureICMP(ip net.IP, privileged bool, timeout time.Duration) (time.Duration, error) {
+	pinger, err := NewPinger(ip.String())
+	if err != nil {
+		return 0, err
+	}
+	pinger.SetPrivileged(privileged)
+	pinger.Count = 1
+	pinger.Timeout = timeout
+	pinger.Run()
+
+	if err := pinger.ListenError(); err != nil {
+		return 0, errMethodUnusable{err}
+	}
+	return pinger.Statistics().AvgRtt, nil
+}
+
+func measureTCP(ip net.IP, port int, timeout time.Duration) (time.Duration, error) {
+	started := time.Now()
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip.String(), strconv.Itoa(port)), timeout)
+	rtt := time.Since(started)
+	if err != nil {
+		return 0, err
+	}
+	conn.Close()
+	return rtt, nil
+}
+
+// measureHTTPS returns the time between sending the HEAD request and receiving the first byte of the response
+// (the connection establishment and TLS handshake are not taken into account)
+func measureHTTPS(url string, ip net.IP, timeout time.Duration) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var wroteRequest, gotResponse time.Time
+	trace := &httptrace.ClientTrace{
+		WroteRequest:         func(httptrace.WroteRequestInfo) { wroteRequest = time.Now() },
+		GotFirstResponseByte: func() { gotResponse = time.Now() },
+	}
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), "HEAD", url, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	transport := &http.Transport{
+		TLSClientConfig:   &tls.Config{MinVersion: tls.VersionTLS12},
+		DisableKeepAlives: true,
+		Proxy:             nil,
+	}
+	if ip != nil {
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			_, port, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+			var d net.Dialer
+			return d.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		}
+	}
+	defer transport.CloseIdleConnections()
+
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	if wroteRequest.IsZero() || gotResponse.IsZero() {
+		return 0, fmt.Errorf("no response")
+	}
+	return gotResponse.Sub(wroteRequest), nil
+}
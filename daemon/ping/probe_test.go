@@ -0,0 +1,152 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package ping
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/blake2s"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+)
+
+func TestProberFallback(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	// closed TCP port
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	p := NewProber([]Method{TCP, HTTPS})
+	target := Target{IP: net.IPv4(127, 0, 0, 1), TCPPort: closedPort, URL: srv.URL}
+	rtt, m, err := p.Probe(target, time.Second)
+	if err != nil || m != HTTPS || rtt <= 0 {
+		t.Fatalf("unexpected result: %v %v %v", rtt, m, err)
+	}
+	if p.PreferredMethod() != HTTPS {
+		t.Errorf("HTTPS method expected to be preferred")
+	}
+
+	if _, _, err := p.Probe(Target{IP: target.IP, TCPPort: closedPort}, time.Second); err == nil {
+		t.Errorf("error expected")
+	}
+	if _, _, err := p.Probe(Target{}, time.Second); err == nil {
+		t.Errorf("error expected for target without applicable methods")
+	}
+}
+
+func TestWireGuardHandshakeProbe(t *testing.T) {
+	var clientPriv, serverPriv [32]byte
+	rand.Read(clientPriv[:])
+	rand.Read(serverPriv[:])
+	clientPub, _ := curve25519.X25519(clientPriv[:], curve25519.Basepoint)
+	serverPub, _ := curve25519.X25519(serverPriv[:], curve25519.Basepoint)
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// responder: validates the initiation (as the WireGuard server does) and replies by the handshake response
+	go func() {
+		buf := make([]byte, 512)
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		if err := checkInitiation(buf[:n], serverPriv, serverPub, clientPub); err != nil {
+			t.Error(err)
+			return
+		}
+		resp := make([]byte, wgMsgResponseSize)
+		binary.LittleEndian.PutUint32(resp[0:4], wgMsgResponse)
+		copy(resp[8:12], buf[4:8]) // receiver index = initiator sender index
+		conn.WriteToUDP(resp, from)
+	}()
+
+	target := Target{
+		IP:                net.IPv4(127, 0, 0, 1),
+		WgPort:            conn.LocalAddr().(*net.UDPAddr).Port,
+		WgServerPublicKey: base64.StdEncoding.EncodeToString(serverPub),
+		WgPrivateKey:      base64.StdEncoding.EncodeToString(clientPriv[:]),
+	}
+	if rtt, err := Measure(WireGuard, target, time.Second*2); err != nil || rtt <= 0 {
+		t.Fatalf("unexpected result: %v %v", rtt, err)
+	}
+}
+
+// checkInitiation decrypts the handshake initiation by the responder keys
+func checkInitiation(msg []byte, serverPriv [32]byte, serverPub, expectedClientPub []byte) error {
+	if len(msg) != wgMsgInitiationSize || msg[0] != wgMsgInitiation {
+		return fmt.Errorf("bad initiation message")
+	}
+
+	mac1Key := wgHash([]byte(wgLabelMac1), serverPub)
+	mac, _ := blake2s.New128(mac1Key[:])
+	mac.Write(msg[:116])
+	if !bytes.Equal(mac.Sum(nil), msg[116:132]) {
+		return fmt.Errorf("bad mac1")
+	}
+
+	chainKey := blake2s.Sum256([]byte(wgConstruction))
+	h := wgHash(chainKey[:], []byte(wgIdentifier))
+	h = wgHash(h[:], serverPub)
+
+	ephPub := msg[8:40]
+	chainKey = wgKdf1(chainKey[:], ephPub)
+	h = wgHash(h[:], ephPub)
+
+	ss, _ := curve25519.X25519(serverPriv[:], ephPub)
+	chainKey, key := wgKdf2(chainKey[:], ss)
+	aead, _ := chacha20poly1305.New(key[:])
+	var nonce [chacha20poly1305.NonceSize]byte
+	clientPub, err := aead.Open(nil, nonce[:], msg[40:88], h[:])
+	if err != nil || !bytes.Equal(clientPub, expectedClientPub) {
+		return fmt.Errorf("bad static key")
+	}
+	h = wgHash(h[:], msg[40:88])
+
+	ss, _ = curve25519.X25519(serverPriv[:], clientPub)
+	_, key = wgKdf2(chainKey[:], ss)
+	aead, _ = chacha20poly1305.New(key[:])
+	tai64n, err := aead.Open(nil, nonce[:], msg[88:116], h[:])
+	if err != nil || binary.BigEndian.Uint64(tai64n) <= wgTai64Base {
+		return fmt.Errorf("bad timestamp")
+	}
+	return nil
+}
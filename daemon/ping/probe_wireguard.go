@@ -0,0 +1,249 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package ping
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"net"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/blake2s"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+)
+
+// The WireGuard handshake initiation (https://www.wireguard.com/protocol/).
+// The server responds to the valid initiation (the client key must be registered on the server)
+// by the handshake response (or by the cookie reply when it is under load);
+// the time of the response receiving is the round-trip time.
+// The handshake is not completed: no data is sent, the server drops the session after timeout.
+
+const (
+	wgConstruction = "Noise_IKpsk2_25519_ChaChaPoly_BLAKE2s"
+	wgIdentifier   = "WireGuard v1 zx2c4 Jason@zx2c4.com"
+	wgLabelMac1    = "mac1----"
+
+	wgMsgInitiation     = 1
+	wgMsgResponse       = 2
+	wgMsgCookieReply    = 3
+	wgMsgInitiationSize = 148
+	wgMsgResponseSize   = 92
+	wgMsgCookieSize     = 64
+
+	// TAI64 label: 2^62 + 10 (the offset of TAI from UTC)
+	wgTai64Base = uint64(0x400000000000000a)
+)
+
+func measureWireGuard(t Target, timeout time.Duration) (time.Duration, error) {
+	serverPub, err := wgKey(t.WgServerPublicKey)
+	if err != nil {
+		return 0, fmt.Errorf("bad server public key: %w", err)
+	}
+	privKey, err := wgKey(t.WgPrivateKey)
+	if err != nil {
+		return 0, fmt.Errorf("bad private key: %w", err)
+	}
+
+	msg, senderIndex, err := wgInitiation(privKey, serverPub, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	conn, err := net.DialTimeout("udp", net.JoinHostPort(t.IP.String(), strconv.Itoa(t.WgPort)), timeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	started := time.Now()
+	if _, err := conn.Write(msg); err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, 256)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return 0, err
+		}
+		if isWgReply(buf[:n], senderIndex) {
+			return time.Since(started), nil
+		}
+	}
+}
+
+// isWgReply returns 'true' when the packet is the handshake response (or cookie reply) to our initiation
+func isWgReply(pkt []byte, senderIndex uint32) bool {
+	if len(pkt) < 12 {
+		return false
+	}
+	switch binary.LittleEndian.Uint32(pkt[0:4]) {
+	case wgMsgResponse:
+		// type(4) | sender index(4) | receiver index(4) | ...
+		return len(pkt) == wgMsgResponseSize && binary.LittleEndian.Uint32(pkt[8:12]) == senderIndex
+	case wgMsgCookieReply:
+		// type(4) | receiver index(4) | ...
+		return len(pkt) == wgMsgCookieSize && binary.LittleEndian.Uint32(pkt[4:8]) == senderIndex
+	default:
+		return false
+	}
+}
+
+// wgInitiation creates the handshake initiation message
+func wgInitiation(privKey, serverPub [32]byte, now time.Time) (msg []byte, senderIndex uint32, err error) {
+	pubKey, err := curve25519.X25519(privKey[:], curve25519.Basepoint)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var ephPriv [32]byte
+	if _, err := rand.Read(ephPriv[:]); err != nil {
+		return nil, 0, err
+	}
+	ephPub, err := curve25519.X25519(ephPriv[:], curve25519.Basepoint)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var idx [4]byte
+	if _, err := rand.Read(idx[:]); err != nil {
+		return nil, 0, err
+	}
+	senderIndex = binary.LittleEndian.Uint32(idx[:])
+
+	msg = make([]byte, wgMsgInitiationSize)
+	binary.LittleEndian.PutUint32(msg[0:4], wgMsgInitiation) // type and 3 reserved zero bytes
+	binary.LittleEndian.PutUint32(msg[4:8], senderIndex)
+
+	// Ci = HASH(CONSTRUCTION); Hi = HASH(HASH(Ci || IDENTIFIER) || Spub_r)
+	chainKey := blake2s.Sum256([]byte(wgConstruction))
+	h := wgHash(chainKey[:], []byte(wgIdentifier))
+	h = wgHash(h[:], serverPub[:])
+
+	// ephemeral
+	copy(msg[8:40], ephPub)
+	chainKey = wgKdf1(chainKey[:], ephPub)
+	h = wgHash(h[:], ephPub)
+
+	// static
+	ss, err := curve25519.X25519(ephPriv[:], serverPub[:])
+	if err != nil {
+		return nil, 0, err
+	}
+	var key [32]byte
+	chainKey, key = wgKdf2(chainKey[:], ss)
+	static, err := wgSeal(key, pubKey, h[:])
+	if err != nil {
+		return nil, 0, err
+	}
+	copy(msg[40:88], static)
+	h = wgHash(h[:], static)
+
+	// timestamp
+	ss, err = curve25519.X25519(privKey[:], serverPub[:])
+	if err != nil {
+		return nil, 0, err
+	}
+	_, key = wgKdf2(chainKey[:], ss)
+	var tai64n [12]byte
+	binary.BigEndian.PutUint64(tai64n[0:8], wgTai64Base+uint64(now.Unix()))
+	binary.BigEndian.PutUint32(tai64n[8:12], uint32(now.Nanosecond()))
+	timestamp, err := wgSeal(key, tai64n[:], h[:])
+	if err != nil {
+		return nil, 0, err
+	}
+	copy(msg[88:116], timestamp)
+
+	// mac1 = MAC(HASH(LABEL_MAC1 || Spub_r), msg[0:116]); mac2 - zeros (no cookie)
+	mac1Key := wgHash([]byte(wgLabelMac1), serverPub[:])
+	mac, err := blake2s.New128(mac1Key[:])
+	if err != nil {
+		return nil, 0, err
+	}
+	mac.Write(msg[:116])
+	copy(msg[116:132], mac.Sum(nil))
+
+	return msg, senderIndex, nil
+}
+
+func wgKey(b64 string) (ret [32]byte, err error) {
+	data, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		return ret, err
+	}
+	if len(data) != len(ret) {
+		return ret, fmt.Errorf("unexpected key length")
+	}
+	copy(ret[:], data)
+	return ret, nil
+}
+
+func wgHash(a, b []byte) [32]byte {
+	h, _ := blake2s.New256(nil)
+	h.Write(a)
+	h.Write(b)
+	var ret [32]byte
+	h.Sum(ret[:0])
+	return ret
+}
+
+func wgHmac(key []byte, data ...[]byte) [32]byte {
+	mac := hmac.New(func() hash.Hash {
+		h, _ := blake2s.New256(nil)
+		return h
+	}, key)
+	for _, d := range data {
+		mac.Write(d)
+	}
+	var ret [32]byte
+	mac.Sum(ret[:0])
+	return ret
+}
+
+func wgKdf1(key, input []byte) [32]byte {
+	t0 := wgHmac(key, input)
+	return wgHmac(t0[:], []byte{1})
+}
+
+func wgKdf2(key, input []byte) (t1, t2 [32]byte) {
+	t0 := wgHmac(key, input)
+	t1 = wgHmac(t0[:], []byte{1})
+	t2 = wgHmac(t0[:], t1[:], []byte{2})
+	return t1, t2
+}
+
+func wgSeal(key [32]byte, plaintext, ad []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(key[:])
+	if err != nil {
+		return nil, err
+	}
+	var nonce [chacha20poly1305.NonceSize]byte // counter: 0
+	return aead.Seal(nil, nonce[:], plaintext, ad), nil
+}
@@ -33,6 +33,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	apitypes "github.com/ivpn/desktop-app/daemon/api/types"
@@ -41,6 +42,10 @@ import (
 	"github.com/ivpn/desktop-app/daemon/protocol/eaa"
 	"github.com/ivpn/desktop-app/daemon/protocol/types"
 	"github.com/ivpn/desktop-app/daemon/service/dns"
+	"github.com/ivpn/desktop-app/daemon/service/dns/querystats"
+	"github.com/ivpn/desktop-app/daemon/service/firewall"
+	"github.com/ivpn/desktop-app/daemon/service/latency"
+	"github.com/ivpn/desktop-app/daemon/service/localproxy"
 	"github.com/ivpn/desktop-app/daemon/service/platform"
 	"github.com/ivpn/desktop-app/daemon/service/preferences"
 	"github.com/ivpn/desktop-app/daemon/vpn"
@@ -72,6 +77,7 @@ type Service interface {
 
 	ServersList() (*apitypes.ServersInfoResponse, error)
 	PingServers(retryCount int, timeoutMs int) (map[string]int, error)
+	LatencyStats() map[string]latency.HostStats
 
 	APIRequest(apiAlias string, ipTypeRequired types.RequiredIPProtocol) (responseData []byte, err error)
 
@@ -82,6 +88,33 @@ type Service interface {
 	SetKillSwitchAllowLAN(isAllowLan bool) error
 	SetKillSwitchAllowAPIServers(isAllowAPIServers bool) error
 	SetKillSwitchUserExceptions(exceptions string, ignoreParsingErrors bool) error
+	KillSwitchExceptions() []firewall.Exception
+	SetKillSwitchExceptions(exceptions []firewall.Exception) error
+	AddKillSwitchException(exception firewall.Exception) error
+	RemoveKillSwitchException(exception firewall.Exception) error
+	KillSwitchInboundRules() []firewall.InboundRule
+	SetKillSwitchInboundRules(rules []firewall.InboundRule) error
+	AddKillSwitchInboundRule(rule firewall.InboundRule) error
+	RemoveKillSwitchInboundRule(rule firewall.InboundRule) error
+	KillSwitchTempExceptions() []firewall.TemporaryException
+	KillSwitchBlockedTrafficLog(sinceSeq uint64) (isEnabled bool, entries []firewall.BlockedPacket)
+	SetKillSwitchBlockedTrafficLog(enable bool) error
+	KillSwitchVerify(repair bool) (firewall.VerifyReport, error)
+	IPv6LeakProtectionStatus() (isActive bool, bypassInterface string)
+	SetGatewayConfig(cfg firewall.GatewayConfig) error
+	GatewayStatus() firewall.GatewayStatus
+	LocalProxyStatus() types.LocalProxyStatus
+	SetLocalProxyConfig(cfg localproxy.Config, keepCredentials bool) error
+	SplitDnsRules() (rules []dns.DomainRule, isActive bool)
+	SetSplitDnsRules(rules []dns.DomainRule) error
+	AntiTrackerFilter(topBlockedCount int) (cfg dns.FilterConfig, status dns.FilterStatus)
+	SetAntiTrackerFilter(cfg dns.FilterConfig) error
+	DnsQueryStats() (cfg querystats.Config, stats querystats.Stats)
+	SetDnsQueryStatsConfig(cfg querystats.Config) error
+	ResetDnsQueryStats()
+	RunLeakTest(testZone string) (dnsResult dns.LeakTestResult, outboundIPBefore, outboundIP net.IP, err error)
+	AddKillSwitchTempException(host string, ttl time.Duration) error
+	RemoveKillSwitchTempException(host string) error
 
 	SplitTunnelling_SetConfig(isEnabled bool, reset bool) error
 	SplitTunnelling_GetStatus() (types.SplitTunnelStatus, error)
@@ -95,6 +128,8 @@ type Service interface {
 	Preferences() preferences.Preferences
 	SetPreference(key types.ServicePreference, val string) (isChanged bool, err error)
 	ResetPreferences() error
+	ExportSettings(includeSecrets bool, clientConfig json.RawMessage) ([]byte, error)
+	ImportSettings(data []byte) (clientConfig json.RawMessage, err error)
 
 	SetManualDNS(dns dns.DnsSettings) error
 	ResetManualDNS() error
@@ -103,12 +138,22 @@ type Service interface {
 	ConnectWireGuard(connectionParams wireguard.ConnectionParams, manualDNS dns.DnsSettings, firewallOn bool, firewallDuringConnection bool, stateChan chan<- vpn.StateInfo) error
 	Disconnect() error
 	Connected() bool
+	ConnectionHistory() []types.ConnectionHistoryEntry
+
+	CaptivePortalStatus() types.CaptivePortalStatus
+	CaptivePortalCheck() (types.CaptivePortalStatus, error)
+	CaptivePortalModeEnable(duration time.Duration) error
+	CaptivePortalModeDisable() error
+
+	IsDaemonAutoConnect() bool
+	DaemonAutoConnectRequest() (*types.Connect, error)
+	ApplyServerSelector(req *types.Connect) (gateway string, err error)
 
 	Pause() error
 	Resume() error
 	IsPaused() bool
 
-	SessionNew(accountID string, forceLogin bool, captchaID string, captcha string, confirmation2FA string) (
+	SessionNew(accountID string, forceLogin bool, captchaID string, captcha string, confirmation2FA string, keepCurrentSession bool) (
 		apiCode int,
 		apiErrorMsg string,
 		accountInfo preferences.AccountStatus,
@@ -116,6 +161,7 @@ type Service interface {
 		err error)
 
 	SessionDelete(isCanDeleteSessionLocally bool) error
+	SessionSwitch(accountID string) error
 	RequestSessionStatus() (
 		apiCode int,
 		apiErrorMsg string,
@@ -149,6 +195,10 @@ type Protocol struct {
 
 	_vpnConnectMutex     sync.Mutex
 	_disconnectRequested bool
+	// true when any client requested connection or disconnection (in use to cancel daemon-side auto-connect; accessed from different goroutines)
+	_isVpnRequestedByClient atomic.Bool
+	// the last 'Connect' request (in use to re-establish the connection, e.g. on account session change)
+	_lastConnectRequest []byte
 
 	_connectRequestsMutex   sync.Mutex
 	_connectRequests        int
@@ -223,6 +273,11 @@ func (p *Protocol) Start(secret uint64, startedOnPort chan<- int, service Servic
 		log.Info("Listener closed")
 	}()
 
+	// daemon-side auto-connect (if enabled)
+	if p._service.IsDaemonAutoConnect() {
+		go p.autoConnect()
+	}
+
 	// infinite loop of processing IVPN client connection
 	for {
 		conn, err := listener.Accept()
@@ -342,6 +397,39 @@ func normalizeField(s string) string {
 	return fields[0]
 }
 
+// normalizeDnsSettings normalizes the DNS configuration fields (including the fallback servers) and validates it
+func normalizeDnsSettings(d dns.DnsSettings) (dns.DnsSettings, error) {
+	d.DnsHost = normalizeField(d.DnsHost)
+	d.DohTemplate = normalizeField(d.DohTemplate)
+	d.Stamp = normalizeField(d.Stamp)
+	d.RelayStamp = normalizeField(d.RelayStamp)
+
+	if d.Encryption == dns.EncryptionDnsStamp {
+		// the DNS host is defined by the stamp
+		fallbacks := d.Fallbacks
+		var err error
+		if d, err = dns.DnsSettingsCreateFromStamp(d.Stamp, d.RelayStamp); err != nil {
+			return d, err
+		}
+		d.Fallbacks = fallbacks
+	}
+	if err := d.ValidateTemplate(); err != nil {
+		return d, err
+	}
+
+	for i, f := range d.Fallbacks {
+		if len(f.Fallbacks) > 0 {
+			return d, fmt.Errorf("fallback DNS server #%d: nested fallback servers are not allowed", i+1)
+		}
+		nf, err := normalizeDnsSettings(f)
+		if err != nil {
+			return d, fmt.Errorf("fallback DNS server #%d: %w", i+1, err)
+		}
+		d.Fallbacks[i] = nf
+	}
+	return d, d.ValidateFallbacks()
+}
+
 func (p *Protocol) processRequest(conn net.Conn, message string) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -457,15 +545,8 @@ func (p *Protocol) processRequest(conn net.Conn, message string) {
 			sendState(req.Idx, true)
 
 			// send Firewall state
-			if isEnabled, isPersistant, isAllowLAN, isAllowLanMulticast, isAllowApiServers, fwUserExceptions, err := p._service.KillSwitchState(); err == nil {
-				p.sendResponse(conn,
-					&types.KillSwitchStatusResp{
-						IsEnabled:         isEnabled,
-						IsPersistent:      isPersistant,
-						IsAllowLAN:        isAllowLAN,
-						IsAllowMulticast:  isAllowLanMulticast,
-						IsAllowApiServers: isAllowApiServers,
-						UserExceptions:    fwUserExceptions}, reqCmd.Idx)
+			if resp, err := p.createKillSwitchStatusResp(); err == nil {
+				p.sendResponse(conn, resp, reqCmd.Idx)
 			}
 		}
 
@@ -508,6 +589,39 @@ func (p *Protocol) processRequest(conn net.Conn, message string) {
 		// send VPN connection  state
 		sendState(reqCmd.Idx, false)
 
+	case "GetConnectionHistory":
+		p.sendResponse(conn, &types.ConnectionHistoryResp{Entries: p._service.ConnectionHistory()}, reqCmd.Idx)
+
+	case "CaptivePortalGetStatus":
+		p.sendResponse(conn, &types.CaptivePortalStatusResp{Status: p._service.CaptivePortalStatus()}, reqCmd.Idx)
+
+	case "CaptivePortalCheck":
+		status, err := p._service.CaptivePortalCheck()
+		if err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+			break
+		}
+		p.sendResponse(conn, &types.CaptivePortalStatusResp{Status: status}, reqCmd.Idx)
+
+	case "CaptivePortalSetMode":
+		var req types.CaptivePortalSetMode
+		if err := json.Unmarshal(messageData, &req); err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+			break
+		}
+
+		if req.Enable {
+			err = p._service.CaptivePortalModeEnable(time.Second * time.Duration(req.DurationSec))
+		} else {
+			err = p._service.CaptivePortalModeDisable()
+		}
+		if err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+			break
+		}
+		p.sendResponse(conn, &types.CaptivePortalStatusResp{Status: p._service.CaptivePortalStatus()}, req.Idx)
+		// all clients will be notified in case of successfull change by OnCaptivePortalStatusChanged() handler
+
 	case "GetServers":
 		serv, err := p._service.ServersList()
 		if err != nil {
@@ -533,12 +647,7 @@ func (p *Protocol) processRequest(conn net.Conn, message string) {
 			break
 		}
 
-		var results []types.PingResultType
-		for k, v := range retMap {
-			results = append(results, types.PingResultType{Host: k, Ping: v})
-		}
-
-		p.sendResponse(conn, &types.PingServersResp{PingResults: results}, req.Idx)
+		p.sendResponse(conn, p.createPingServersResp(retMap), req.Idx)
 
 	case "APIRequest":
 		var req types.APIRequest
@@ -565,17 +674,10 @@ func (p *Protocol) processRequest(conn net.Conn, message string) {
 		p.sendResponse(conn, &types.EmptyResp{}, reqCmd.Idx)
 
 	case "KillSwitchGetStatus":
-		if isEnabled, isPersistant, isAllowLAN, isAllowLanMulticast, isAllowApiServers, fwUserExceptions, err := p._service.KillSwitchState(); err != nil {
+		if resp, err := p.createKillSwitchStatusResp(); err != nil {
 			p.sendErrorResponse(conn, reqCmd, err)
 		} else {
-			p.sendResponse(conn,
-				&types.KillSwitchStatusResp{
-					IsEnabled:         isEnabled,
-					IsPersistent:      isPersistant,
-					IsAllowLAN:        isAllowLAN,
-					IsAllowMulticast:  isAllowLanMulticast,
-					IsAllowApiServers: isAllowApiServers,
-					UserExceptions:    fwUserExceptions}, reqCmd.Idx)
+			p.sendResponse(conn, resp, reqCmd.Idx)
 		}
 
 	case "KillSwitchSetEnabled":
@@ -631,6 +733,160 @@ func (p *Protocol) processRequest(conn net.Conn, message string) {
 		}
 		// all clients will be notified in case of successfull change by OnKillSwitchStateChanged() handler
 
+	case "KillSwitchAddException":
+		var req types.KillSwitchAddException
+		if err := json.Unmarshal(messageData, &req); err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+			break
+		}
+
+		if err := p._service.AddKillSwitchException(req.Exception); err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+		} else {
+			p.sendResponse(conn, &types.EmptyResp{}, req.Idx)
+		}
+		// all clients will be notified in case of successfull change by OnKillSwitchStateChanged() handler
+
+	case "KillSwitchRemoveException":
+		var req types.KillSwitchRemoveException
+		if err := json.Unmarshal(messageData, &req); err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+			break
+		}
+
+		if err := p._service.RemoveKillSwitchException(req.Exception); err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+		} else {
+			p.sendResponse(conn, &types.EmptyResp{}, req.Idx)
+		}
+		// all clients will be notified in case of successfull change by OnKillSwitchStateChanged() handler
+
+	case "KillSwitchAddInboundRule":
+		var req types.KillSwitchAddInboundRule
+		if err := json.Unmarshal(messageData, &req); err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+			break
+		}
+
+		if err := p._service.AddKillSwitchInboundRule(req.Rule); err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+		} else {
+			p.sendResponse(conn, &types.EmptyResp{}, req.Idx)
+		}
+		// all clients will be notified in case of successfull change by OnKillSwitchStateChanged() handler
+
+	case "KillSwitchRemoveInboundRule":
+		var req types.KillSwitchRemoveInboundRule
+		if err := json.Unmarshal(messageData, &req); err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+			break
+		}
+
+		if err := p._service.RemoveKillSwitchInboundRule(req.Rule); err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+		} else {
+			p.sendResponse(conn, &types.EmptyResp{}, req.Idx)
+		}
+		// all clients will be notified in case of successfull change by OnKillSwitchStateChanged() handler
+
+	case "KillSwitchAddTempException":
+		var req types.KillSwitchAddTempException
+		if err := json.Unmarshal(messageData, &req); err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+			break
+		}
+
+		if err := p._service.AddKillSwitchTempException(req.Host, time.Second*time.Duration(req.DurationSec)); err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+		} else {
+			p.sendResponse(conn, &types.EmptyResp{}, req.Idx)
+		}
+		// all clients will be notified in case of successfull change by OnKillSwitchStateChanged() handler
+
+	case "KillSwitchRemoveTempException":
+		var req types.KillSwitchRemoveTempException
+		if err := json.Unmarshal(messageData, &req); err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+			break
+		}
+
+		if err := p._service.RemoveKillSwitchTempException(req.Host); err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+		} else {
+			p.sendResponse(conn, &types.EmptyResp{}, req.Idx)
+		}
+		// all clients will be notified in case of successfull change by OnKillSwitchStateChanged() handler
+
+	case "KillSwitchGetBlockedLog":
+		var req types.KillSwitchGetBlockedLog
+		if err := json.Unmarshal(messageData, &req); err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+			break
+		}
+
+		isEnabled, entries := p._service.KillSwitchBlockedTrafficLog(req.SinceSeq)
+		p.sendResponse(conn, &types.KillSwitchBlockedLogResp{IsEnabled: isEnabled, Entries: entries}, req.Idx)
+
+	case "KillSwitchSetBlockedLog":
+		var req types.KillSwitchSetBlockedLog
+		if err := json.Unmarshal(messageData, &req); err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+			break
+		}
+
+		if err := p._service.SetKillSwitchBlockedTrafficLog(req.Enable); err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+			break
+		}
+		isEnabled, entries := p._service.KillSwitchBlockedTrafficLog(0)
+		p.sendResponse(conn, &types.KillSwitchBlockedLogResp{IsEnabled: isEnabled, Entries: entries}, req.Idx)
+
+	case "KillSwitchVerify":
+		var req types.KillSwitchVerify
+		if err := json.Unmarshal(messageData, &req); err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+			break
+		}
+
+		report, err := p._service.KillSwitchVerify(req.Repair)
+		if err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+			break
+		}
+		p.sendResponse(conn, &types.KillSwitchVerifyResp{Report: report}, req.Idx)
+
+	case "GatewayGetStatus":
+		p.sendResponse(conn, &types.GatewayStatusResp{Status: p._service.GatewayStatus()}, reqCmd.Idx)
+
+	case "GatewaySetConfig":
+		var req types.GatewaySetConfig
+		if err := json.Unmarshal(messageData, &req); err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+			break
+		}
+
+		if err := p._service.SetGatewayConfig(req.Config); err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+			break
+		}
+		p.sendResponse(conn, &types.GatewayStatusResp{Status: p._service.GatewayStatus()}, req.Idx)
+
+	case "LocalProxyGetStatus":
+		p.sendResponse(conn, &types.LocalProxyStatusResp{Status: p._service.LocalProxyStatus()}, reqCmd.Idx)
+
+	case "LocalProxySetConfig":
+		var req types.LocalProxySetConfig
+		if err := json.Unmarshal(messageData, &req); err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+			break
+		}
+
+		if err := p._service.SetLocalProxyConfig(req.Config, req.KeepCredentials); err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+			break
+		}
+		p.sendResponse(conn, &types.LocalProxyStatusResp{Status: p._service.LocalProxyStatus()}, req.Idx)
+
 	case "KillSwitchSetIsPersistent":
 		var req types.KillSwitchSetIsPersistent
 		if err := json.Unmarshal(messageData, &req); err != nil {
@@ -689,6 +945,48 @@ func (p *Protocol) processRequest(conn net.Conn, message string) {
 			p.sendResponse(conn, &types.EmptyResp{}, req.Idx)
 		}
 
+	case "ExportSettings":
+		var req types.ExportSettings
+		if err := json.Unmarshal(messageData, &req); err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+			break
+		}
+
+		data, err := p._service.ExportSettings(req.IncludeSecrets, req.ClientConfig)
+		if err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+			break
+		}
+		p.sendResponse(conn, &types.SettingsExportResp{Settings: data}, req.Idx)
+
+	case "ImportSettings":
+		var req types.ImportSettings
+		if err := json.Unmarshal(messageData, &req); err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+			break
+		}
+
+		if p._eaa.IsEnabled() {
+			var s struct{ IsAutoconnectOnLaunch bool }
+			if err := json.Unmarshal(req.Settings, &s); err == nil && s.IsAutoconnectOnLaunch {
+				p.sendErrorResponse(conn, reqCmd, fmt.Errorf("the 'Autoconnect on application launch' cannot be enabled whilst Enhanced Application Authentication is enabled"))
+				break
+			}
+		}
+
+		clientConfig, err := p._service.ImportSettings(req.Settings)
+		if err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+			break
+		}
+
+		// notify all connected clients about changed preferences
+		// (firewall changes are notified by OnKillSwitchStateChanged() handler)
+		p.notifyClients(p.createSettingsResponse())
+		p.OnSplitTunnelStatusChanged()
+
+		p.sendResponse(conn, &types.SettingsImportResp{ClientConfig: clientConfig}, req.Idx)
+
 	case "SplitTunnelGetStatus":
 		status, err := p._service.SplitTunnelling_GetStatus()
 		if err != nil {
@@ -786,10 +1084,12 @@ func (p *Protocol) processRequest(conn net.Conn, message string) {
 			p.sendErrorResponse(conn, reqCmd, err)
 			break
 		}
-		req.Dns.DnsHost = normalizeField(req.Dns.DnsHost)
-		req.Dns.DohTemplate = normalizeField(req.Dns.DohTemplate)
-
 		var err error
+		if req.Dns, err = normalizeDnsSettings(req.Dns); err != nil {
+			p.sendResponse(conn, &types.SetAlternateDNSResp{IsSuccess: false, ErrorMessage: err.Error()}, req.Idx)
+			break
+		}
+
 		if req.Dns.IsEmpty() {
 			err = p._service.ResetManualDNS()
 		} else {
@@ -815,6 +1115,88 @@ func (p *Protocol) processRequest(conn net.Conn, message string) {
 			p.sendResponse(conn, &types.SetAlternateDNSResp{IsSuccess: true, ChangedDNS: req.Dns}, req.Idx)
 		}
 
+	case "GetSplitDnsRules":
+		rules, isActive := p._service.SplitDnsRules()
+		p.sendResponse(conn, &types.SplitDnsRulesResp{Rules: rules, IsActive: isActive}, reqCmd.Idx)
+
+	case "SetSplitDnsRules":
+		var req types.SetSplitDnsRules
+		if err := json.Unmarshal(messageData, &req); err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+			break
+		}
+
+		if err := p._service.SetSplitDnsRules(req.Rules); err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+			break
+		}
+		rules, isActive := p._service.SplitDnsRules()
+		p.sendResponse(conn, &types.SplitDnsRulesResp{Rules: rules, IsActive: isActive}, req.Idx)
+
+	case "AntiTrackerFilterGet":
+		var req types.AntiTrackerFilterGet
+		if err := json.Unmarshal(messageData, &req); err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+			break
+		}
+
+		cfg, status := p._service.AntiTrackerFilter(req.TopBlockedCount)
+		p.sendResponse(conn, &types.AntiTrackerFilterResp{Config: cfg, Status: status}, req.Idx)
+
+	case "AntiTrackerFilterSet":
+		var req types.AntiTrackerFilterSet
+		if err := json.Unmarshal(messageData, &req); err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+			break
+		}
+
+		if err := p._service.SetAntiTrackerFilter(req.Config); err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+			break
+		}
+		cfg, status := p._service.AntiTrackerFilter(0)
+		p.sendResponse(conn, &types.AntiTrackerFilterResp{Config: cfg, Status: status}, req.Idx)
+
+	case "DnsQueryStatsGet":
+		p.sendResponse(conn, p.createDnsQueryStatsResp(), reqCmd.Idx)
+
+	case "DnsQueryStatsSet":
+		var req types.DnsQueryStatsSet
+		if err := json.Unmarshal(messageData, &req); err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+			break
+		}
+
+		if err := p._service.SetDnsQueryStatsConfig(req.Config); err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+			break
+		}
+		p.sendResponse(conn, p.createDnsQueryStatsResp(), req.Idx)
+
+	case "DnsQueryStatsReset":
+		p._service.ResetDnsQueryStats()
+		p.sendResponse(conn, p.createDnsQueryStatsResp(), reqCmd.Idx)
+
+	case "RunLeakTest":
+		var req types.RunLeakTest
+		if err := json.Unmarshal(messageData, &req); err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+			break
+		}
+
+		dnsResult, outboundIPBefore, outboundIP, err := p._service.RunLeakTest(req.TestZone)
+		if err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+			break
+		}
+		isOutboundIPChanged := outboundIP != nil && !outboundIP.Equal(outboundIPBefore)
+		p.sendResponse(conn, &types.LeakTestResp{
+			Dns:                 dnsResult,
+			OutboundIPv4Before:  outboundIPBefore,
+			OutboundIPv4:        outboundIP,
+			IsOutboundIPChanged: isOutboundIPChanged,
+			IsLeak:              dnsResult.IsLeak || !isOutboundIPChanged}, req.Idx)
+
 	case "GetDnsPredefinedConfigs":
 		cfgs, err := dns.GetPredefinedDnsConfigurations()
 		if err != nil {
@@ -858,8 +1240,11 @@ func (p *Protocol) processRequest(conn net.Conn, message string) {
 			break
 		}
 
+		isConnected := p._service.Connected()
+		lastConnectRequest := p._lastConnectRequest
+
 		var resp types.SessionNewResp
-		apiCode, apiErrMsg, accountInfo, rawResponse, err := p._service.SessionNew(req.AccountID, req.ForceLogin, req.CaptchaID, req.Captcha, req.Confirmation2FA)
+		apiCode, apiErrMsg, accountInfo, rawResponse, err := p._service.SessionNew(req.AccountID, req.ForceLogin, req.CaptchaID, req.Captcha, req.Confirmation2FA, req.KeepCurrentSession)
 		if err != nil {
 			if apiCode == 0 {
 				// if apiCode == 0 - it is not API error. Sending error response
@@ -889,6 +1274,39 @@ func (p *Protocol) processRequest(conn net.Conn, message string) {
 		// notify all clients about changed session status
 		p.notifyClients(p.createHelloResponse())
 
+		// re-establish the connection using credentials of the new session (the previous session is stored)
+		if err == nil && req.KeepCurrentSession && isConnected && lastConnectRequest != nil && !p._service.Connected() {
+			log.Info("Reconnecting (account session changed)...")
+			p._isVpnRequestedByClient.Store(true)
+			go p.processConnect(lastConnectRequest, nil)
+		}
+
+	case "SessionSwitch":
+		var req types.SessionSwitch
+		if err := json.Unmarshal(messageData, &req); err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+			break
+		}
+
+		isConnected := p._service.Connected()
+		lastConnectRequest := p._lastConnectRequest
+
+		if err := p._service.SessionSwitch(req.AccountID); err != nil {
+			p.sendErrorResponse(conn, reqCmd, err)
+			break
+		}
+
+		p.sendResponse(conn, &types.EmptyResp{}, reqCmd.Idx)
+		// notify all clients about changed session status
+		p.notifyClients(p.createHelloResponse())
+
+		// re-establish active connection using credentials of the new session
+		if isConnected && lastConnectRequest != nil {
+			log.Info("Reconnecting (account session changed)...")
+			p._isVpnRequestedByClient.Store(true)
+			go p.processConnect(lastConnectRequest, nil)
+		}
+
 	case "SessionDelete":
 		var req types.SessionDelete
 		if err := json.Unmarshal(messageData, &req); err != nil {
@@ -925,7 +1343,13 @@ func (p *Protocol) processRequest(conn net.Conn, message string) {
 			// set AllowLan and exceptions according to default values
 			p._service.SetKillSwitchAllowLAN(prefs.IsFwAllowLAN)
 			p._service.SetKillSwitchAllowLANMulticast(prefs.IsFwAllowLANMulticast)
-			p._service.SetKillSwitchUserExceptions(prefs.FwUserExceptions, true)
+			p._service.SetKillSwitchExceptions(prefs.FwExceptions)
+			if oldPrefs.IsFwPersistant {
+				// keep inbound rules for the persistent firewall (otherwise, remote access to the host can be lost)
+				p._service.SetKillSwitchInboundRules(oldPrefs.FwInboundRules)
+			} else {
+				p._service.SetKillSwitchInboundRules(prefs.FwInboundRules)
+			}
 		}
 
 		p.sendResponse(conn, &types.EmptyResp{}, reqCmd.Idx)
@@ -1003,6 +1427,7 @@ func (p *Protocol) processRequest(conn net.Conn, message string) {
 
 	case "Disconnect":
 		p._disconnectRequested = true
+		p._isVpnRequestedByClient.Store(true)
 
 		if !p._service.Connected() {
 			p.sendResponse(conn, &types.DisconnectedResp{Reason: types.DisconnectRequested}, reqCmd.Idx)
@@ -1014,121 +1439,9 @@ func (p *Protocol) processRequest(conn net.Conn, message string) {
 		}
 
 	case "Connect":
-		p._disconnectRequested = false
-		requestTime := p.vpnConnectReqCounterIncrease()
-
-		stateChan := make(chan vpn.StateInfo, 1)
-		isExitChan := make(chan bool, 1)
-		disconnectAuthError := false
-		var connectionError error
-
-		// disconnect active connection (if connected)
-		if err := p._service.Disconnect(); err != nil {
-			log.ErrorTrace(err)
-		}
-
-		p._vpnConnectMutex.Lock()
-		defer p._vpnConnectMutex.Unlock()
-
-		defer p.vpnConnectReqCounterDecrease()
-
-		// skip this request if new connection request available
-		if _, lastRequestTime := p.vpnConnectReqCounter(); !requestTime.Equal(lastRequestTime) {
-			log.Info("Skipping connection request. Newest request received.")
-			return
-		}
-
-		var waiter sync.WaitGroup
-
-		// do not forget to notify that process was stopped (disconnected)
-		defer func() {
-
-			// stop all go-routines related to this connections
-			close(isExitChan)
-
-			// Do not send "Disconnected" notification if we are going to establish new connection immediately
-			if cnt, _ := p.vpnConnectReqCounter(); cnt == 1 || p._disconnectRequested {
-				p._lastVPNState = vpn.NewStateInfo(vpn.DISCONNECTED, "")
-
-				// Sending "Disconnected" only in one place (after VPN process stopped)
-				disconnectionReason := types.Unknown
-				if disconnectAuthError {
-					disconnectionReason = types.AuthenticationError
-					if connectionError == nil {
-						connectionError = fmt.Errorf("authentication failure")
-					}
-				}
-				if p._disconnectRequested {
-					// notify clients that disconnection was manually requested by one of connected clients
-					// (prevent UI clients trying to reconnect)
-					disconnectionReason = types.DisconnectRequested
-				}
-
-				errMsg := ""
-				if connectionError != nil {
-					errMsg = connectionError.Error()
-				}
-				p.notifyClients(&types.DisconnectedResp{Failure: connectionError != nil, Reason: disconnectionReason, ReasonDescription: errMsg})
-			}
-
-			// wait all routines to stop
-			waiter.Wait()
-		}()
-
-		// forwarding VPN state in separate routine
-		waiter.Add(1)
-		go func() {
-			log.Info("Enter VPN status checker")
-			defer func() {
-				if r := recover(); r != nil {
-					log.Error("VPN status checker panic!")
-					if err, ok := r.(error); ok {
-						log.ErrorTrace(err)
-					}
-				}
-				log.Info("Exit VPN status checker")
-				waiter.Done()
-			}()
-
-		state_forward_loop:
-			for {
-				select {
-				case <-isExitChan:
-					break state_forward_loop
-
-				case state := <-stateChan:
-
-					select {
-					case <-isExitChan:
-						// channel closed in defer function (vpn disconnected)
-						break state_forward_loop
-					default:
-					}
-
-					p._lastVPNState = state
-
-					switch state.State {
-					case vpn.CONNECTED:
-						// Do not send "Connected" notification if we are going to establish new connection immediately
-						if cnt, _ := p.vpnConnectReqCounter(); cnt == 1 || p._disconnectRequested {
-							p.notifyClients(p.createConnectedResponse(state))
-						} else {
-							log.Debug("Skip sending 'Connected' notification. New connection request is awaiting ", cnt)
-						}
-					case vpn.EXITING:
-						disconnectAuthError = state.IsAuthError
-					default:
-						p.notifyClients(&types.VpnStateResp{StateVal: state.State, State: state.State.String(), StateAdditionalInfo: state.StateAdditionalInfo})
-					}
-				}
-			}
-		}()
-
-		p.sendResponse(conn, &types.EmptyResp{}, reqCmd.Idx)
+		p._isVpnRequestedByClient.Store(true)
 		// SYNCHRONOUSLY start VPN connection process (wait until it finished)
-		if connectionError = p.processConnectRequest(messageData, stateChan); connectionError != nil {
-			log.ErrorTrace(connectionError)
-		}
+		p.processConnect(messageData, func() { p.sendResponse(conn, &types.EmptyResp{}, reqCmd.Idx) })
 
 	default:
 		log.Warning("!!! Unsupported request type !!! ", reqCmd.Command)
@@ -0,0 +1,113 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ivpn/desktop-app/daemon/netinfo"
+)
+
+const (
+	autoConnectNetworkCheckInterval = time.Second * 2
+	autoConnectRetryDelayMin        = time.Second * 5
+	autoConnectRetryDelayMax        = time.Minute * 5
+)
+
+// autoConnect performs daemon-side automatic connection on daemon launch.
+// It waits for network availability and retries the connection (with increasing delay) until it succeeds.
+// The process is cancelled when any client requests connection or disconnection.
+// Note: the persistent firewall (if enabled) is already active at this moment, so the traffic stays blocked until the tunnel is up.
+func (p *Protocol) autoConnect() {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error("PANIC in auto-connect routine: ", r)
+		}
+	}()
+
+	log.Info("Auto-connect: started")
+
+	isCancelled := func() bool {
+		if p._isVpnRequestedByClient.Load() {
+			log.Info("Auto-connect: cancelled (VPN connection was requested by a client)")
+			return true
+		}
+		return false
+	}
+
+	isNetworkWaitingLogged := false
+	retryDelay := autoConnectRetryDelayMin
+	for {
+		if isCancelled() {
+			return
+		}
+
+		// wait for network availability
+		if _, err := netinfo.GetOutboundIP(false); err != nil {
+			if _, err6 := netinfo.GetOutboundIP(true); err6 != nil {
+				if !isNetworkWaitingLogged {
+					log.Info("Auto-connect: waiting for network availability...")
+					isNetworkWaitingLogged = true
+				}
+				time.Sleep(autoConnectNetworkCheckInterval)
+				continue
+			}
+		}
+
+		err := p.autoConnectAttempt()
+		if err == nil {
+			return
+		}
+		if isCancelled() {
+			return
+		}
+
+		log.Warning(fmt.Sprintf("Auto-connect: connection failed (retry in %v): %v", retryDelay, err))
+		time.Sleep(retryDelay)
+		if retryDelay *= 2; retryDelay > autoConnectRetryDelayMax {
+			retryDelay = autoConnectRetryDelayMax
+		}
+	}
+}
+
+// autoConnectAttempt performs one connection attempt and blocks until the connection is finished
+func (p *Protocol) autoConnectAttempt() error {
+	req, err := p._service.DaemonAutoConnectRequest()
+	if err != nil {
+		return err
+	}
+	req.Command = "Connect"
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to serialize connection request: %w", err)
+	}
+
+	// client could request the connection while we were preparing the request
+	if p._isVpnRequestedByClient.Load() {
+		return nil
+	}
+	return p.processConnect(data, nil)
+}
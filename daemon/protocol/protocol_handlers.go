@@ -25,6 +25,8 @@ package protocol
 import (
 	apitypes "github.com/ivpn/desktop-app/daemon/api/types"
 	"github.com/ivpn/desktop-app/daemon/protocol/types"
+	"github.com/ivpn/desktop-app/daemon/service/dns"
+	"github.com/ivpn/desktop-app/daemon/service/firewall"
 	"github.com/ivpn/desktop-app/daemon/service/preferences"
 )
 
@@ -49,16 +51,10 @@ func (p *Protocol) OnAccountStatus(sessionToken string, accountInfo preferences.
 // OnKillSwitchStateChanged - Firewall change handler
 func (p *Protocol) OnKillSwitchStateChanged() {
 	// notify all clients about KillSwitch status
-	if isEnabled, isPersistant, isAllowLAN, isAllowLanMulticast, isAllowApiServers, fwUserExceptions, err := p._service.KillSwitchState(); err != nil {
+	if resp, err := p.createKillSwitchStatusResp(); err != nil {
 		log.Error(err)
 	} else {
-		p.notifyClients(&types.KillSwitchStatusResp{
-			IsEnabled:         isEnabled,
-			IsPersistent:      isPersistant,
-			IsAllowLAN:        isAllowLAN,
-			IsAllowMulticast:  isAllowLanMulticast,
-			IsAllowApiServers: isAllowApiServers,
-			UserExceptions:    fwUserExceptions})
+		p.notifyClients(resp)
 	}
 }
 
@@ -71,11 +67,7 @@ func (p *Protocol) OnWiFiChanged(ssid string, isInsecureNetwork bool) {
 
 // OnPingStatus - servers ping status
 func (p *Protocol) OnPingStatus(retMap map[string]int) {
-	var results []types.PingResultType
-	for k, v := range retMap {
-		results = append(results, types.PingResultType{Host: k, Ping: v})
-	}
-	p.notifyClients(&types.PingServersResp{PingResults: results})
+	p.notifyClients(p.createPingServersResp(retMap))
 }
 
 func (p *Protocol) OnServersUpdated(serv *apitypes.ServersInfoResponse) {
@@ -95,3 +87,26 @@ func (p *Protocol) OnSplitTunnelStatusChanged() {
 	}
 	p.notifyClients(&status)
 }
+
+// OnKillSwitchBlockedTraffic - handler of new packets blocked by the firewall. Notifying clients.
+func (p *Protocol) OnKillSwitchBlockedTraffic(entries []firewall.BlockedPacket) {
+	p.notifyClients(&types.KillSwitchBlockedTrafficEvent{Entries: entries})
+}
+
+// OnFirewallTampered - handler of the firewall rules modification by third-party software. Notifying clients.
+func (p *Protocol) OnFirewallTampered(report firewall.VerifyReport) {
+	p.notifyClients(&types.FirewallTampered{Report: report})
+}
+
+// OnCaptivePortalStatusChanged - handler of captive portal detection or 'portal mode' status change. Notifying clients.
+func (p *Protocol) OnCaptivePortalStatusChanged() {
+	if p._service == nil {
+		return
+	}
+	p.notifyClients(&types.CaptivePortalStatusResp{Status: p._service.CaptivePortalStatus()})
+}
+
+// OnActiveDnsChanged - handler of the active DNS server change by the failover. Notifying clients.
+func (p *Protocol) OnActiveDnsChanged(active dns.DnsSettings) {
+	p.notifyClients(&types.ActiveDnsChanged{ActiveDNS: active})
+}
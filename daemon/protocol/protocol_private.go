@@ -31,6 +31,7 @@ import (
 	"net"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	apitypes "github.com/ivpn/desktop-app/daemon/api/types"
@@ -171,15 +172,70 @@ func (p *Protocol) vpnConnectReqCounterDecrease() {
 	p._connectRequests--
 }
 
+// createPingServersResp creates the response with ping results (host => ms)
+// extended by the latency statistics of the hosts (if available)
+func (p *Protocol) createPingServersResp(retMap map[string]int) *types.PingServersResp {
+	stats := p._service.LatencyStats()
+
+	var results []types.PingResultType
+	for k, v := range retMap {
+		r := types.PingResultType{Host: k, Ping: v}
+		if s, ok := stats[k]; ok {
+			r.Stats = &s
+		}
+		results = append(results, r)
+	}
+	return &types.PingServersResp{PingResults: results}
+}
+
 func (p *Protocol) createSettingsResponse() *types.SettingsResp {
 	prefs := p._service.Preferences()
 	return &types.SettingsResp{
-		IsAutoconnectOnLaunch: prefs.IsAutoconnectOnLaunch,
-		UserDefinedOvpnFile:   platform.OpenvpnUserParamsFile(),
+		IsAutoconnectOnLaunch:  prefs.IsAutoconnectOnLaunch,
+		IsLatencyThroughTunnel: prefs.IsLatencyThroughTunnel,
+		UserDefinedOvpnFile:    platform.OpenvpnUserParamsFile(),
 		// TODO: implement the rest of daemon settings
 	}
 }
 
+func (p *Protocol) createKillSwitchStatusResp() (*types.KillSwitchStatusResp, error) {
+	isEnabled, isPersistant, isAllowLAN, isAllowLanMulticast, isAllowApiServers, fwUserExceptions, err := p._service.KillSwitchState()
+	if err != nil {
+		return nil, err
+	}
+	isIPv6LeakProtection, ipv6BypassInterface := p._service.IPv6LeakProtectionStatus()
+	return &types.KillSwitchStatusResp{
+		IsEnabled:            isEnabled,
+		IsPersistent:         isPersistant,
+		IsAllowLAN:           isAllowLAN,
+		IsAllowMulticast:     isAllowLanMulticast,
+		IsAllowApiServers:    isAllowApiServers,
+		UserExceptions:       fwUserExceptions,
+		Exceptions:           p._service.KillSwitchExceptions(),
+		InboundRules:         p._service.KillSwitchInboundRules(),
+		TempExceptions:       p.createKillSwitchTempExceptions(),
+		IsIPv6LeakProtection: isIPv6LeakProtection,
+		IPv6BypassInterface:  ipv6BypassInterface}, nil
+}
+
+func (p *Protocol) createKillSwitchTempExceptions() []types.KillSwitchTempException {
+	now := time.Now()
+	exceptions := p._service.KillSwitchTempExceptions()
+	ret := make([]types.KillSwitchTempException, 0, len(exceptions))
+	for _, e := range exceptions {
+		ret = append(ret, types.KillSwitchTempException{
+			Host:         e.Host,
+			ExpiresAt:    e.ExpiresAt.Unix(),
+			RemainingSec: int64(e.RemainingTime(now).Seconds())})
+	}
+	return ret
+}
+
+func (p *Protocol) createDnsQueryStatsResp() *types.DnsQueryStatsResp {
+	cfg, stats := p._service.DnsQueryStats()
+	return &types.DnsQueryStatsResp{Config: cfg, Stats: stats, IsEncryptedDnsSupported: dns.IsQueryStatsSupportedForEncryptedDns()}
+}
+
 func (p *Protocol) createHelloResponse() *types.HelloResp {
 	prefs := p._service.Preferences()
 
@@ -217,6 +273,7 @@ func (p *Protocol) createHelloResponse() *types.HelloResp {
 		Version:             version.Version(),
 		ProcessorArch:       runtime.GOARCH,
 		Session:             types.CreateSessionResp(prefs.Session),
+		StoredAccounts:      prefs.StoredAccounts(),
 		SettingsSessionUUID: prefs.SettingsSessionUUID,
 		DisabledFunctions: types.DisabledFunctionality{
 			WireGuardError:   wgErr,
@@ -226,6 +283,9 @@ func (p *Protocol) createHelloResponse() *types.HelloResp {
 		Dns: types.DnsAbilities{
 			CanUseDnsOverTls:   dnsOverTls,
 			CanUseDnsOverHttps: dnsOverHttps,
+			CanUseDnsStamps:    dns.IsDnsStampsSupported(),
+			CanUseDnsOverQuic:  dns.IsQuicSupported(),
+			CanUseDnsOverHttp3: dns.IsQuicSupported(),
 		},
 		DaemonSettings: *p.createSettingsResponse(),
 	}
@@ -245,12 +305,138 @@ func (p *Protocol) createConnectedResponse(state vpn.StateInfo) *types.Connected
 		VpnType:         state.VpnType,
 		ExitServerID:    state.ExitServerID,
 		ManualDNS:       dns.GetLastManualDNS(),
-		IsCanPause:      state.IsCanPause}
+		ActiveDNS:       dns.GetActiveManualDNS(),
+		IsCanPause:      state.IsCanPause,
+		NetNamespace:    state.NetNamespace}
 
 	return ret
 }
 
 // -------------- processing connection request ---------------
+// processConnect performs VPN connection and blocks until the connection is finished (VPN disconnected).
+// 'onStarted' (if defined) is called right before the connection process started.
+// Returns connection error (if any).
+func (p *Protocol) processConnect(messageData []byte, onStarted func()) (connectionError error) {
+	p._disconnectRequested = false
+	p._lastConnectRequest = messageData
+	requestTime := p.vpnConnectReqCounterIncrease()
+
+	stateChan := make(chan vpn.StateInfo, 1)
+	isExitChan := make(chan bool, 1)
+	disconnectAuthError := false
+
+	// disconnect active connection (if connected)
+	if err := p._service.Disconnect(); err != nil {
+		log.ErrorTrace(err)
+	}
+
+	p._vpnConnectMutex.Lock()
+	defer p._vpnConnectMutex.Unlock()
+
+	defer p.vpnConnectReqCounterDecrease()
+
+	// skip this request if new connection request available
+	if _, lastRequestTime := p.vpnConnectReqCounter(); !requestTime.Equal(lastRequestTime) {
+		log.Info("Skipping connection request. Newest request received.")
+		return nil
+	}
+
+	var waiter sync.WaitGroup
+
+	// do not forget to notify that process was stopped (disconnected)
+	defer func() {
+
+		// stop all go-routines related to this connections
+		close(isExitChan)
+
+		// Do not send "Disconnected" notification if we are going to establish new connection immediately
+		if cnt, _ := p.vpnConnectReqCounter(); cnt == 1 || p._disconnectRequested {
+			p._lastVPNState = vpn.NewStateInfo(vpn.DISCONNECTED, "")
+
+			// Sending "Disconnected" only in one place (after VPN process stopped)
+			disconnectionReason := types.Unknown
+			if disconnectAuthError {
+				disconnectionReason = types.AuthenticationError
+				if connectionError == nil {
+					connectionError = fmt.Errorf("authentication failure")
+				}
+			}
+			if p._disconnectRequested {
+				// notify clients that disconnection was manually requested by one of connected clients
+				// (prevent UI clients trying to reconnect)
+				disconnectionReason = types.DisconnectRequested
+			}
+
+			errMsg := ""
+			if connectionError != nil {
+				errMsg = connectionError.Error()
+			}
+			p.notifyClients(&types.DisconnectedResp{Failure: connectionError != nil, Reason: disconnectionReason, ReasonDescription: errMsg})
+		}
+
+		// wait all routines to stop
+		waiter.Wait()
+	}()
+
+	// forwarding VPN state in separate routine
+	waiter.Add(1)
+	go func() {
+		log.Info("Enter VPN status checker")
+		defer func() {
+			if r := recover(); r != nil {
+				log.Error("VPN status checker panic!")
+				if err, ok := r.(error); ok {
+					log.ErrorTrace(err)
+				}
+			}
+			log.Info("Exit VPN status checker")
+			waiter.Done()
+		}()
+
+	state_forward_loop:
+		for {
+			select {
+			case <-isExitChan:
+				break state_forward_loop
+
+			case state := <-stateChan:
+
+				select {
+				case <-isExitChan:
+					// channel closed in defer function (vpn disconnected)
+					break state_forward_loop
+				default:
+				}
+
+				p._lastVPNState = state
+
+				switch state.State {
+				case vpn.CONNECTED:
+					// Do not send "Connected" notification if we are going to establish new connection immediately
+					if cnt, _ := p.vpnConnectReqCounter(); cnt == 1 || p._disconnectRequested {
+						p.notifyClients(p.createConnectedResponse(state))
+					} else {
+						log.Debug("Skip sending 'Connected' notification. New connection request is awaiting ", cnt)
+					}
+				case vpn.EXITING:
+					disconnectAuthError = state.IsAuthError
+				default:
+					p.notifyClients(&types.VpnStateResp{StateVal: state.State, State: state.State.String(), StateAdditionalInfo: state.StateAdditionalInfo})
+				}
+			}
+		}
+	}()
+
+	if onStarted != nil {
+		onStarted()
+	}
+	// SYNCHRONOUSLY start VPN connection process (wait until it finished)
+	if connectionError = p.processConnectRequest(messageData, stateChan); connectionError != nil {
+		log.ErrorTrace(connectionError)
+	}
+	return connectionError
+}
+
 func (p *Protocol) processConnectRequest(messageData []byte, stateChan chan<- vpn.StateInfo) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -270,7 +456,16 @@ func (p *Protocol) processConnectRequest(messageData []byte, stateChan chan<- vp
 		return fmt.Errorf("failed to unmarshal json 'Connect' request: %w", err)
 	}
 
-	retManualDNS := r.ManualDNS
+	retManualDNS, err := normalizeDnsSettings(r.ManualDNS)
+	if err != nil {
+		return fmt.Errorf("bad DNS configuration: %w", err)
+	}
+
+	if r.ServerSelector.IsDefined() {
+		if _, err := p._service.ApplyServerSelector(&r); err != nil {
+			return fmt.Errorf("unable to select server: %w", err)
+		}
+	}
 
 	if vpn.Type(r.VpnType) == vpn.OpenVPN {
 		// PARAMETERS VALIDATION
@@ -421,6 +616,10 @@ func (p *Protocol) processConnectRequest(messageData []byte, stateChan chan<- vp
 				ipv6Prefix)
 		}
 
+		if r.WireGuardParameters.IsolatedNetns {
+			connectionParams.SetNetNamespace(wireguard.IsolatedNetnsName)
+		}
+
 		return p._service.ConnectWireGuard(connectionParams, retManualDNS, r.FirewallOn, r.FirewallOnDuringConnection, stateChan)
 
 	}
@@ -23,8 +23,14 @@
 package types
 
 import (
+	"encoding/json"
+
 	"github.com/ivpn/desktop-app/daemon/api/types"
 	"github.com/ivpn/desktop-app/daemon/service/dns"
+	"github.com/ivpn/desktop-app/daemon/service/dns/querystats"
+	fwtypes "github.com/ivpn/desktop-app/daemon/service/firewall/types"
+	"github.com/ivpn/desktop-app/daemon/service/localproxy"
+	"github.com/ivpn/desktop-app/daemon/service/serverselector"
 	"github.com/ivpn/desktop-app/daemon/vpn"
 )
 
@@ -91,6 +97,89 @@ type KillSwitchSetUserExceptions struct {
 	FailOnParsingError bool
 }
 
+// KillSwitchAddException adds the firewall exception (host/network with optional protocol, ports and direction)
+type KillSwitchAddException struct {
+	RequestBase
+	Exception fwtypes.Exception
+}
+
+// KillSwitchRemoveException removes the firewall exception (the description of the exception is not taken into account)
+type KillSwitchRemoveException struct {
+	RequestBase
+	Exception fwtypes.Exception
+}
+
+// KillSwitchAddInboundRule adds the firewall rule allowing incoming connections to local service
+type KillSwitchAddInboundRule struct {
+	RequestBase
+	Rule fwtypes.InboundRule
+}
+
+// KillSwitchRemoveInboundRule removes the firewall inbound rule (the description of the rule is not taken into account)
+type KillSwitchRemoveInboundRule struct {
+	RequestBase
+	Rule fwtypes.InboundRule
+}
+
+// KillSwitchAddTempException adds the firewall exception for the host (IP address or network)
+// which is automatically removed by the daemon after 'DurationSec' seconds
+// (if the temporary exception for the host already exists - its expiration time is updated)
+type KillSwitchAddTempException struct {
+	RequestBase
+	Host        string
+	DurationSec int64
+}
+
+// KillSwitchRemoveTempException removes the temporary firewall exception before its expiration
+type KillSwitchRemoveTempException struct {
+	RequestBase
+	Host string
+}
+
+// KillSwitchGetBlockedLog requests the log of packets blocked by the firewall (response: KillSwitchBlockedLogResp)
+type KillSwitchGetBlockedLog struct {
+	RequestBase
+	// only entries with the sequence number bigger than this value will be returned (0 - all entries)
+	SinceSeq uint64
+}
+
+// KillSwitchSetBlockedLog enables/disables logging of the packets blocked by the firewall (response: KillSwitchBlockedLogResp)
+type KillSwitchSetBlockedLog struct {
+	RequestBase
+	Enable bool
+}
+
+// KillSwitchVerify requests verification of the active firewall rules (response: KillSwitchVerifyResp)
+type KillSwitchVerify struct {
+	RequestBase
+	// re-apply the rules if they were modified by third-party software
+	Repair bool
+}
+
+// GatewayGetStatus requests the state of VPN gateway mode (response: GatewayStatusResp)
+type GatewayGetStatus struct {
+	RequestBase
+}
+
+// GatewaySetConfig applies the configuration of VPN gateway mode: sharing the VPN tunnel with a LAN (response: GatewayStatusResp)
+type GatewaySetConfig struct {
+	RequestBase
+	Config fwtypes.GatewayConfig
+}
+
+// LocalProxyGetStatus requests the state of the local SOCKS5/HTTP proxy (response: LocalProxyStatusResp)
+type LocalProxyGetStatus struct {
+	RequestBase
+}
+
+// LocalProxySetConfig changes the configuration of the local SOCKS5/HTTP proxy (response: LocalProxyStatusResp)
+type LocalProxySetConfig struct {
+	RequestBase
+	Config localproxy.Config
+	// keep the username/password configured before (Config.Username and Config.Password are ignored)
+	KeepCredentials bool
+}
+
 type KillSwitchSetAllowApiServers struct {
 	RequestBase
 	IsAllowApiServers bool
@@ -126,6 +215,54 @@ type SetAlternateDns struct {
 	Dns dns.DnsSettings
 }
 
+// GetSplitDnsRules requests the split DNS rules (response: SplitDnsRulesResp)
+type GetSplitDnsRules struct {
+	RequestBase
+}
+
+// SetSplitDnsRules request to set split DNS rules: domains resolved by specific DNS servers (response: SplitDnsRulesResp)
+type SetSplitDnsRules struct {
+	RequestBase
+	Rules []dns.DomainRule
+}
+
+// AntiTrackerFilterGet requests the configuration and the state of the local DNS filtering (response: AntiTrackerFilterResp)
+type AntiTrackerFilterGet struct {
+	RequestBase
+	// max number of the most blocked domains to return
+	TopBlockedCount int
+}
+
+// AntiTrackerFilterSet request to set the configuration of the local DNS filtering:
+// custom AntiTracker blocklists, allowlist and overrides (response: AntiTrackerFilterResp)
+type AntiTrackerFilterSet struct {
+	RequestBase
+	Config dns.FilterConfig
+}
+
+// DnsQueryStatsGet requests the DNS query statistics (response: DnsQueryStatsResp)
+type DnsQueryStatsGet struct {
+	RequestBase
+}
+
+// DnsQueryStatsSet request to set the configuration of the DNS query statistics (response: DnsQueryStatsResp)
+type DnsQueryStatsSet struct {
+	RequestBase
+	Config querystats.Config
+}
+
+// DnsQueryStatsReset request to erase the collected DNS query statistics (response: DnsQueryStatsResp)
+type DnsQueryStatsReset struct {
+	RequestBase
+}
+
+// RunLeakTest request to check that DNS requests and outbound traffic go through the VPN tunnel (response: LeakTestResp)
+type RunLeakTest struct {
+	RequestBase
+	// (optional) the DNS zone to resolve the unique probe names in
+	TestZone string
+}
+
 // GetDnsPredefinedConfigs request to get list of predefined DoH/DoT configurations (if exists)
 type GetDnsPredefinedConfigs struct {
 	RequestBase
@@ -143,6 +280,11 @@ type Connect struct {
 	VpnType   vpn.Type
 	ManualDNS dns.DnsSettings
 
+	// (optional) the rule of the entry server selection (fastest, nearest, random...)
+	// When defined, the daemon selects the server itself and the 'EntryVpnServer' parameters are ignored.
+	// The Multi-Hop exit server (if required) has to be defined explicitly.
+	ServerSelector serverselector.Selector
+
 	// Enable firewall before connection
 	// (if true - the parameter 'firewallDuringConnection' will be ignored)
 	FirewallOn bool
@@ -166,6 +308,10 @@ type Connect struct {
 			ExitSrvID string
 			Hosts     []types.WireGuardServerHostInfo
 		}
+
+		// (Linux only) create WireGuard interface in isolated network namespace;
+		// the host network stays untouched, the applications can be started in the namespace by 'ivpn exec'
+		IsolatedNetns bool
 	}
 
 	OpenVpnParameters struct {
@@ -198,6 +344,26 @@ type GetVPNState struct {
 	RequestBase
 }
 
+// GetConnectionHistory request daemon to provide the journal of VPN connections
+type GetConnectionHistory struct {
+	RequestBase
+}
+
+// ExportSettings request daemon to export settings in a portable format (response: SettingsExportResp)
+type ExportSettings struct {
+	RequestBase
+	// include account credentials (session token, WireGuard keys ...)
+	IncludeSecrets bool
+	// client-specific configuration to be stored together with the daemon settings
+	ClientConfig json.RawMessage
+}
+
+// ImportSettings request daemon to apply settings exported by 'ExportSettings' request (response: SettingsImportResp)
+type ImportSettings struct {
+	RequestBase
+	Settings json.RawMessage
+}
+
 // SessionNew - create new session
 //
 // When force is set to true - all active sessions will be deleted prior to creating a new one if user reached session limit.
@@ -211,6 +377,15 @@ type SessionNew struct {
 	CaptchaID       string
 	Captcha         string
 	Confirmation2FA string
+
+	// Do not log out the current session (of another account) but keep it stored for fast switching (see SessionSwitch)
+	KeepCurrentSession bool
+}
+
+// SessionSwitch makes active the stored session of another account
+type SessionSwitch struct {
+	RequestBase
+	AccountID string
 }
 
 // SessionDelete logout from current device
@@ -250,6 +425,25 @@ type WiFiCurrentNetwork struct {
 	RequestBase
 }
 
+// CaptivePortalGetStatus requests the status of captive portal detection and 'portal mode' (response: CaptivePortalStatusResp)
+type CaptivePortalGetStatus struct {
+	RequestBase
+}
+
+// CaptivePortalCheck requests daemon to perform captive portal detection (response: CaptivePortalStatusResp)
+type CaptivePortalCheck struct {
+	RequestBase
+}
+
+// CaptivePortalSetMode enables/disables 'portal mode' (response: CaptivePortalStatusResp)
+// 'Portal mode' is a time-limited firewall configuration which permits only DNS/HTTP(S) to the gateway network.
+// It is closed automatically when expired or when VPN is connected.
+type CaptivePortalSetMode struct {
+	RequestBase
+	Enable      bool
+	DurationSec int64 // 0 - default duration
+}
+
 // IPProtocol - VPN type
 type RequiredIPProtocol int
 
@@ -23,9 +23,15 @@
 package types
 
 import (
+	"encoding/json"
+	"net"
+
 	"github.com/ivpn/desktop-app/daemon/api/types"
 	"github.com/ivpn/desktop-app/daemon/logger"
 	"github.com/ivpn/desktop-app/daemon/service/dns"
+	"github.com/ivpn/desktop-app/daemon/service/dns/querystats"
+	fwtypes "github.com/ivpn/desktop-app/daemon/service/firewall/types"
+	"github.com/ivpn/desktop-app/daemon/service/latency"
 	"github.com/ivpn/desktop-app/daemon/service/preferences"
 	"github.com/ivpn/desktop-app/daemon/vpn"
 )
@@ -78,6 +84,9 @@ type DisabledFunctionality struct {
 type DnsAbilities struct {
 	CanUseDnsOverTls   bool
 	CanUseDnsOverHttps bool
+	CanUseDnsStamps    bool // DNS server can be defined by DNS stamp: DNSCrypt, DoH, ODoH (dns.EncryptionDnsStamp)
+	CanUseDnsOverQuic  bool // DNS-over-QUIC (dns.EncryptionDnsOverQuic)
+	CanUseDnsOverHttp3 bool // DNS-over-HTTPS over HTTP/3 (dns.EncryptionDnsOverHttp3)
 }
 
 type ParanoidModeStatus struct {
@@ -88,6 +97,8 @@ type SettingsResp struct {
 	CommandBase
 
 	IsAutoconnectOnLaunch bool
+	// the servers latency is measured through the VPN tunnel while connected
+	IsLatencyThroughTunnel bool
 
 	// TODO: implement the rest of daemon settings
 	// IsLogging             bool
@@ -106,9 +117,11 @@ type SettingsResp struct {
 // HelloResp response on initial request
 type HelloResp struct {
 	CommandBase
-	Version           string
-	ProcessorArch     string
-	Session           SessionResp
+	Version       string
+	ProcessorArch string
+	Session       SessionResp
+	// IDs of the accounts which sessions are stored (available for 'SessionSwitch' request)
+	StoredAccounts    []string
 	DisabledFunctions DisabledFunctionality
 	Dns               DnsAbilities
 
@@ -170,6 +183,57 @@ type KillSwitchStatusResp struct {
 	IsAllowMulticast  bool
 	IsAllowApiServers bool
 	UserExceptions    string // Firewall exceptions: comma separated list of IP addresses (masks) in format: x.x.x.x[/xx]
+	// All user-defined firewall exceptions (including the exceptions restricted by protocol/ports/direction)
+	Exceptions []fwtypes.Exception
+	// Rules allowing incoming connections to local services
+	InboundRules []fwtypes.InboundRule
+	// Temporary exceptions (automatically removed by the daemon when expired)
+	TempExceptions []KillSwitchTempException
+	// IPv6 leak protection: all non-tunnel IPv6 traffic is blocked (independent from the kill-switch;
+	// active when VPN is connected without IPv6 in the tunnel)
+	IsIPv6LeakProtection bool
+	// Network interface of the native (non-tunnel) global IPv6 route when VPN is connected (empty - no such route)
+	IPv6BypassInterface string
+}
+
+// KillSwitchBlockedLogResp contains the log of packets blocked by the firewall
+type KillSwitchBlockedLogResp struct {
+	CommandBase
+	IsEnabled bool
+	Entries   []fwtypes.BlockedPacket
+}
+
+// KillSwitchBlockedTrafficEvent notifies clients about new packets blocked by the firewall
+// (sent only when blocked traffic logging is enabled; the packets are grouped)
+type KillSwitchBlockedTrafficEvent struct {
+	CommandBase
+	Entries []fwtypes.BlockedPacket
+}
+
+// KillSwitchVerifyResp contains the result of the firewall rules verification
+type KillSwitchVerifyResp struct {
+	CommandBase
+	Report fwtypes.VerifyReport
+}
+
+// GatewayStatusResp contains the state of VPN gateway mode
+type GatewayStatusResp struct {
+	CommandBase
+	Status fwtypes.GatewayStatus
+}
+
+// FirewallTampered notifies clients that the active firewall rules were modified by third-party software
+// (e.g. chains flushed or reordered) and were re-applied by the daemon
+type FirewallTampered struct {
+	CommandBase
+	Report fwtypes.VerifyReport
+}
+
+// KillSwitchTempException - information about temporary firewall exception
+type KillSwitchTempException struct {
+	Host         string
+	ExpiresAt    int64 // Unix time
+	RemainingSec int64 // seconds left until expiration
 }
 
 // KillSwitchGetIsPestistentResp returns kill-switch persistance status
@@ -196,6 +260,47 @@ type SetAlternateDNSResp struct {
 	ErrorMessage string
 }
 
+// SplitDnsRulesResp contains the split DNS rules
+type SplitDnsRulesResp struct {
+	CommandBase
+	Rules []dns.DomainRule
+	// the rules are applied at the moment (VPN connected; not applied for encrypted DNS)
+	IsActive bool
+}
+
+// AntiTrackerFilterResp contains the configuration and the state of the local DNS filtering (custom AntiTracker lists)
+type AntiTrackerFilterResp struct {
+	CommandBase
+	Config dns.FilterConfig
+	Status dns.FilterStatus
+}
+
+// ActiveDnsChanged notifies that the active DNS server was changed by the failover (manual DNS with fallback servers)
+type ActiveDnsChanged struct {
+	CommandBase
+	ActiveDNS dns.DnsSettings
+}
+
+// DnsQueryStatsResp contains the configuration of the DNS query statistics and the collected data
+type DnsQueryStatsResp struct {
+	CommandBase
+	Config querystats.Config
+	Stats  querystats.Stats
+	// 'false' when the queries to encrypted DNS (DoH, DNS stamps) can not be accounted on this platform
+	IsEncryptedDnsSupported bool
+}
+
+// LeakTestResp contains the result of the leak test
+type LeakTestResp struct {
+	CommandBase
+	Dns dns.LeakTestResult
+	// the outbound IP before the VPN connection and the current one (they must differ when connected)
+	OutboundIPv4Before  net.IP
+	OutboundIPv4        net.IP
+	IsOutboundIPChanged bool
+	IsLeak              bool
+}
+
 // DnsPredefinedConfigsResp list of predefined DoH/DoT configurations (if exists)
 type DnsPredefinedConfigsResp struct {
 	CommandBase
@@ -212,7 +317,11 @@ type ConnectedResp struct {
 	ServerIP        string
 	ExitServerID    string
 	ManualDNS       dns.DnsSettings
-	IsCanPause      bool
+	// the DNS server in use from ManualDNS configuration (it differs from the primary server when a fallback server is activated)
+	ActiveDNS  dns.DnsSettings
+	IsCanPause bool
+	// network namespace of the VPN interface (empty - host namespace)
+	NetNamespace string `json:",omitempty"`
 }
 
 // DisconnectionReason - disconnection reason
@@ -233,6 +342,87 @@ type DisconnectedResp struct {
 	ReasonDescription string
 }
 
+// ConnectionHistoryEntry - information about one VPN connection session
+// (the session starts on 'Connect' request and ends when the VPN is disconnected;
+// automatic reconnections are the part of the same session)
+type ConnectionHistoryEntry struct {
+	StartTime int64 // unix time (seconds)
+	EndTime   int64 // unix time (seconds); 0 - the session is still active
+	// the time when the connection was established at first; 0 - connection was not established
+	ConnectedTime int64
+
+	VpnType      vpn.Type
+	Gateway      string // e.g. "us-tx.wg.ivpn.net"
+	Hostname     string // e.g. "us-tx1.wg.ivpn.net"
+	ServerIP     string
+	IsTCP        bool
+	Port         int
+	ExitServerID string // Multi-Hop exit server ID (if applicable)
+
+	Reconnects int
+
+	Failure           bool
+	Reason            DisconnectionReason
+	ReasonDescription string
+
+	BytesReceived uint64
+	BytesSent     uint64
+}
+
+// ConnectionHistoryResp contains the journal of VPN connections (the newest entries are at the end)
+type ConnectionHistoryResp struct {
+	CommandBase
+	Entries []ConnectionHistoryEntry
+}
+
+// CaptivePortalStatus - status of captive portal detection and 'portal mode'
+type CaptivePortalStatus struct {
+	IsDetected  bool
+	RedirectURL string `json:",omitempty"` // URL of the captive portal login page (if known)
+	LastCheck   int64  // unix time of the last detection; 0 - detection was not performed
+
+	IsPortalMode           bool
+	PortalModeNetwork      string `json:",omitempty"` // gateway network allowed by 'portal mode'
+	PortalModeRemainingSec int64
+}
+
+// CaptivePortalStatusResp contains the status of captive portal detection and 'portal mode'
+// (it is also sent to all clients when the status changes)
+type CaptivePortalStatusResp struct {
+	CommandBase
+	Status CaptivePortalStatus
+}
+
+// LocalProxyStatus - configuration and state of the local SOCKS5/HTTP proxy
+type LocalProxyStatus struct {
+	IsEnabled bool
+	Port      int
+	Username  string `json:",omitempty"` // empty - authentication is not required
+
+	IsRunning     bool   // the proxy is running only when VPN is connected
+	ListenAddress string `json:",omitempty"`
+	BindIP        string `json:",omitempty"` // local IP of the VPN interface (empty - tunnel is down: connections are refused)
+}
+
+// LocalProxyStatusResp contains the configuration and state of the local SOCKS5/HTTP proxy
+type LocalProxyStatusResp struct {
+	CommandBase
+	Status LocalProxyStatus
+}
+
+// SettingsExportResp contains the exported daemon settings
+type SettingsExportResp struct {
+	CommandBase
+	Settings json.RawMessage
+}
+
+// SettingsImportResp is a response on successful settings import
+type SettingsImportResp struct {
+	CommandBase
+	// client-specific configuration which was stored together with the daemon settings
+	ClientConfig json.RawMessage
+}
+
 // VpnStateResp returns VPN connection state
 type VpnStateResp struct {
 	CommandBase
@@ -248,10 +438,12 @@ type ServerListResp struct {
 	VpnServers types.ServersInfoResponse
 }
 
-//PingResultType represents information ping TTL for a host (is a part of 'PingServersResp')
+// PingResultType represents information ping TTL for a host (is a part of 'PingServersResp')
 type PingResultType struct {
 	Host string
 	Ping int
+	// (optional) latency statistics from the recent measurements
+	Stats *latency.HostStats `json:",omitempty"`
 }
 
 // PingServersResp returns average ping time for servers
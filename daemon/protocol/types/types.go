@@ -53,6 +53,7 @@ const (
 	Prefs_IsStopServerOnClientDisconnect ServicePreference = "is_stop_server_on_client_disconnect"
 	Prefs_IsEnableObfsproxy              ServicePreference = "enable_obfsproxy"
 	Prefs_IsAutoconnectOnLaunch          ServicePreference = "autoconnect_on_launch"
+	Prefs_IsLatencyThroughTunnel         ServicePreference = "latency_through_tunnel"
 )
 
 func (sp ServicePreference) Equals(key string) bool {
@@ -0,0 +1,157 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+// Package captiveportal is detecting captive portals (hotel/airport Wi-Fi login pages).
+// The detection is performed by probing the well-known HTTP endpoint:
+// when the response differs from the expected one (e.g. redirect to the login page) - the captive portal is detected.
+package captiveportal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ivpn/desktop-app/daemon/logger"
+)
+
+var log *logger.Logger
+
+func init() {
+	log = logger.NewLogger("cport")
+}
+
+const (
+	// ProbeHost - host name of the well-known captive portal detection endpoint
+	ProbeHost         = "detectportal.firefox.com"
+	probeURL          = "http://" + ProbeHost + "/success.txt"
+	probeExpectedBody = "success"
+	// max size of the response body to read
+	probeMaxBodySize = 1024
+)
+
+// Result - result of the captive portal detection
+type Result struct {
+	IsDetected bool
+	// URL of the captive portal login page (if known)
+	RedirectURL string
+}
+
+// Resolve resolves host name using the specified DNS server.
+// If 'dnsServer' is not defined - the system resolver is in use.
+func Resolve(host string, dnsServer net.IP, timeout time.Duration) ([]net.IP, error) {
+	resolver := net.DefaultResolver
+	if dnsServer != nil {
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				d := net.Dialer{}
+				return d.DialContext(ctx, network, net.JoinHostPort(dnsServer.String(), "53"))
+			},
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	addrs, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]net.IP, 0, len(addrs))
+	for _, a := range addrs {
+		if ip4 := a.IP.To4(); ip4 != nil {
+			ret = append(ret, ip4)
+		}
+	}
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("no IPv4 addresses for '%s'", host)
+	}
+	return ret, nil
+}
+
+// Probe sends request to the captive portal detection endpoint (connecting to 'probeIP')
+// and checks the response
+func Probe(probeIP net.IP, timeout time.Duration) (Result, error) {
+	return probe(probeURL, net.JoinHostPort(probeIP.String(), "80"), timeout)
+}
+
+func probe(urlStr string, dialAddr string, timeout time.Duration) (Result, error) {
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy: nil,
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				d := net.Dialer{}
+				return d.DialContext(ctx, "tcp4", dialAddr)
+			},
+			DisableKeepAlives: true,
+		},
+		// do not follow redirects: the redirect itself is a sign of the captive portal
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Get(urlStr)
+	if err != nil {
+		return Result{}, fmt.Errorf("captive portal probe failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		redirect := resp.Header.Get("Location")
+		if u, err := resp.Request.URL.Parse(redirect); err == nil {
+			redirect = u.String()
+		}
+		log.Info(fmt.Sprintf("Captive portal detected (redirect to '%s')", redirect))
+		return Result{IsDetected: true, RedirectURL: redirect}, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, probeMaxBodySize))
+	if err != nil {
+		return Result{}, fmt.Errorf("captive portal probe failed: %w", err)
+	}
+	if resp.StatusCode == http.StatusOK && strings.TrimSpace(string(body)) == probeExpectedBody {
+		return Result{}, nil
+	}
+
+	log.Info(fmt.Sprintf("Captive portal detected (unexpected response: HTTP %d)", resp.StatusCode))
+	return Result{IsDetected: true}, nil
+}
+
+// RedirectHost returns the host name (or IP) of the captive portal login page
+func (r Result) RedirectHost() string {
+	if len(r.RedirectURL) == 0 {
+		return ""
+	}
+	u, err := url.Parse(r.RedirectURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
@@ -0,0 +1,56 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package captiveportal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProbe(t *testing.T) {
+	var handler http.HandlerFunc
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { handler(w, r) }))
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "http://")
+
+	handler = func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("success\n")) }
+	if r, err := probe(probeURL, addr, time.Second*5); err != nil || r.IsDetected {
+		t.Error("captive portal not expected:", r, err)
+	}
+
+	handler = func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://login.portal.example/auth?x=1", http.StatusFound)
+	}
+	r, err := probe(probeURL, addr, time.Second*5)
+	if err != nil || !r.IsDetected || r.RedirectHost() != "login.portal.example" {
+		t.Error("captive portal with redirect expected:", r, err)
+	}
+
+	handler = func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("<html>Login</html>")) }
+	if r, err := probe(probeURL, addr, time.Second*5); err != nil || !r.IsDetected || len(r.RedirectURL) > 0 {
+		t.Error("captive portal without redirect expected:", r, err)
+	}
+}
@@ -0,0 +1,426 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+// Package config implements the declarative daemon configuration file.
+//
+// The file (e.g. '/etc/ivpn/daemon.conf' on Linux) is optional. It is created by administrator
+// and is intended for headless provisioning (servers, kiosk machines...).
+// It is read on daemon start and on SIGHUP (Linux/macOS).
+// The values defined in the file are applied to the daemon preferences; the parameters
+// which are not defined in the file stay untouched.
+//
+// Example (YAML):
+//
+//	version: 1
+//	mode: override          # 'override' - apply on each daemon start; 'seed' - apply only when the file was changed
+//	logging: false
+//	firewall:
+//	  persistent: true
+//	  allow_lan: true
+//	  allow_lan_multicast: false
+//	  allow_api_servers: true
+//	  exceptions: [ "192.168.0.0/16", "10.10.0.1" ]
+//	dns:
+//	  antitracker: hardcore # 'off', 'on' or 'hardcore'
+//	  custom: ""            # custom DNS server IP (can not be used together with AntiTracker)
+//	  encryption: none      # 'none', 'dot' (DNS-over-TLS), 'doh' (DNS-over-HTTPS), 'doq' (DNS-over-QUIC) or 'doh3' (DoH over HTTP/3)
+//	  template: ""          # DoT/DoH URI template ('https://...'); DoQ template: 'quic://host[:port]'
+//	split_tunnel:
+//	  enabled: false
+//	  apps: []
+//	connection:
+//	  protocol: wireguard   # 'wireguard' or 'openvpn'
+//	  transport: udp        # 'udp' or 'tcp' (OpenVPN only)
+//	  port: 2049            # 0 - default port
+//	  obfsproxy: false      # OpenVPN only
+//	  autoconnect: true     # connect automatically on daemon start
+//	  target: fastest       # 'last', 'fastest' or 'server'
+//	  server: us-tx         # server gateway ID (when target is 'server')
+package config
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+
+	"github.com/ivpn/desktop-app/daemon/service/dns"
+	"github.com/ivpn/desktop-app/daemon/service/firewall"
+	"github.com/ivpn/desktop-app/daemon/service/preferences"
+	"github.com/ivpn/desktop-app/daemon/vpn"
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentVersion - the latest supported version of the configuration file format
+const CurrentVersion = 1
+
+// Mode - defines how the configuration file is applied to the stored daemon preferences
+type Mode string
+
+const (
+	// ModeOverride - the configuration is applied on each daemon start (or reload)
+	// and overrides the changes made by user (e.g. from CLI)
+	ModeOverride Mode = "override"
+	// ModeSeed - the configuration is applied only once (when the content of the file changed);
+	// user is able to change the preferences later
+	ModeSeed Mode = "seed"
+)
+
+// Config - daemon configuration file
+// All parameters are optional (nil - the value is not defined in configuration file)
+type Config struct {
+	Version int   `yaml:"version"`
+	Mode    Mode  `yaml:"mode"`
+	Logging *bool `yaml:"logging"`
+
+	Firewall    *Firewall    `yaml:"firewall"`
+	Dns         *Dns         `yaml:"dns"`
+	SplitTunnel *SplitTunnel `yaml:"split_tunnel"`
+	Connection  *Connection  `yaml:"connection"`
+}
+
+// Firewall - firewall (kill-switch) configuration
+type Firewall struct {
+	Persistent        *bool     `yaml:"persistent"`
+	AllowLan          *bool     `yaml:"allow_lan"`
+	AllowLanMulticast *bool     `yaml:"allow_lan_multicast"`
+	AllowApiServers   *bool     `yaml:"allow_api_servers"`
+	Exceptions        *[]string `yaml:"exceptions"` // IP addresses (masks) in format: x.x.x.x[/xx]
+}
+
+// Dns - DNS configuration for connections performed by the daemon
+type Dns struct {
+	AntiTracker *string `yaml:"antitracker"` // "off", "on", "hardcore"
+	Custom      *string `yaml:"custom"`      // custom DNS IP address ("" - default DNS)
+	Encryption  *string `yaml:"encryption"`  // "none", "dot", "doh", "doq", "doh3"
+	Template    *string `yaml:"template"`    // DoT/DoH/DoQ URI template
+}
+
+// SplitTunnel - split tunnel configuration
+type SplitTunnel struct {
+	Enabled *bool     `yaml:"enabled"`
+	Apps    *[]string `yaml:"apps"`
+}
+
+// Connection - parameters of VPN connections performed by the daemon
+type Connection struct {
+	Protocol    *string `yaml:"protocol"`  // "wireguard", "openvpn"
+	Transport   *string `yaml:"transport"` // "udp", "tcp" (OpenVPN only)
+	Port        *int    `yaml:"port"`      // 0 - default port
+	Obfsproxy   *bool   `yaml:"obfsproxy"` // OpenVPN only
+	AutoConnect *bool   `yaml:"autoconnect"`
+	Target      *string `yaml:"target"` // "last", "fastest", "server"
+	Server      *string `yaml:"server"` // server gateway ID (when target is "server")
+}
+
+// ValidationError - describes wrong value in the configuration file
+type ValidationError struct {
+	Field   string // e.g. "firewall.exceptions[1]"
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationErrors - list of all problems found in the configuration file
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	lines := make([]string, 0, len(e))
+	for _, v := range e {
+		lines = append(lines, v.Error())
+	}
+	return "invalid configuration: " + strings.Join(lines, "; ")
+}
+
+// Load reads, migrates (if necessary) and validates the configuration file
+// Returns the configuration object and the hash of the file content
+func Load(file string) (cfg *Config, hash string, err error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read daemon configuration '%s': %w", file, err)
+	}
+
+	cfg, err = Parse(data)
+	if err != nil {
+		return nil, "", fmt.Errorf("daemon configuration '%s': %w", file, err)
+	}
+
+	h := sha256.Sum256(data)
+	return cfg, hex.EncodeToString(h[:]), nil
+}
+
+// Parse parses, migrates (if necessary) and validates the configuration data
+func Parse(data []byte) (*Config, error) {
+	cfg := &Config{}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true) // unknown parameters are errors (e.g. typo in parameter name)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse: %w", err)
+	}
+
+	if err := cfg.migrate(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// migrate converts configuration of an old format version to the current version
+func (c *Config) migrate() error {
+	if c.Version <= 0 {
+		return ValidationErrors{{Field: "version", Message: fmt.Sprintf("not defined (current version is %d)", CurrentVersion)}}
+	}
+	if c.Version > CurrentVersion {
+		return ValidationErrors{{Field: "version", Message: fmt.Sprintf("version %d is not supported (the latest supported version is %d)", c.Version, CurrentVersion)}}
+	}
+
+	// Note: when the format will be changed - the conversion from the old versions should be implemented here
+	// (e.g. 'if c.Version == 1 { ...; c.Version = 2 }')
+
+	return nil
+}
+
+// Validate checks the configuration values
+func (c *Config) Validate() error {
+	var errs ValidationErrors
+	addErr := func(field string, format string, a ...interface{}) {
+		errs = append(errs, ValidationError{Field: field, Message: fmt.Sprintf(format, a...)})
+	}
+
+	switch c.Mode {
+	case "", ModeOverride, ModeSeed:
+	default:
+		addErr("mode", "unexpected value '%s' (expected: '%s' or '%s')", c.Mode, ModeOverride, ModeSeed)
+	}
+
+	if fw := c.Firewall; fw != nil && fw.Exceptions != nil {
+		for i, e := range *fw.Exceptions {
+			if !isValidIPOrNetwork(e) {
+				addErr(fmt.Sprintf("firewall.exceptions[%d]", i), "'%s' is not an IP address or network mask (x.x.x.x[/xx])", e)
+			}
+		}
+	}
+
+	if d := c.Dns; d != nil {
+		isAntiTracker := false
+		if d.AntiTracker != nil {
+			switch *d.AntiTracker {
+			case "off":
+			case "on", "hardcore":
+				isAntiTracker = true
+			default:
+				addErr("dns.antitracker", "unexpected value '%s' (expected: 'off', 'on' or 'hardcore')", *d.AntiTracker)
+			}
+		}
+
+		isCustomDns := false
+		if d.Custom != nil && len(*d.Custom) > 0 {
+			isCustomDns = true
+			if net.ParseIP(*d.Custom) == nil {
+				addErr("dns.custom", "'%s' is not an IP address", *d.Custom)
+			}
+		}
+		if isAntiTracker && isCustomDns {
+			addErr("dns", "custom DNS can not be used together with AntiTracker")
+		}
+
+		encryption := dns.EncryptionNone
+		if d.Encryption != nil {
+			if v, err := parseDnsEncryption(*d.Encryption); err != nil {
+				addErr("dns.encryption", err.Error())
+			} else {
+				encryption = v
+			}
+		}
+		if encryption != dns.EncryptionNone {
+			if !isCustomDns {
+				addErr("dns.encryption", "encryption is applicable only for custom DNS")
+			}
+			if d.Template == nil || len(strings.TrimSpace(*d.Template)) == 0 {
+				addErr("dns.template", "DoT/DoH/DoQ template is not defined")
+			} else if err := (dns.DnsSettings{Encryption: encryption, DohTemplate: *d.Template}).ValidateTemplate(); err != nil {
+				addErr("dns.template", err.Error())
+			}
+		}
+	}
+
+	if cn := c.Connection; cn != nil {
+		if cn.Protocol != nil {
+			if _, err := parseVpnType(*cn.Protocol); err != nil {
+				addErr("connection.protocol", err.Error())
+			}
+		}
+		if cn.Transport != nil && *cn.Transport != "udp" && *cn.Transport != "tcp" {
+			addErr("connection.transport", "unexpected value '%s' (expected: 'udp' or 'tcp')", *cn.Transport)
+		}
+		if cn.Port != nil && (*cn.Port < 0 || *cn.Port > 65535) {
+			addErr("connection.port", "port %d is out of range", *cn.Port)
+		}
+		if cn.Target != nil {
+			switch preferences.ConnectionTarget(*cn.Target) {
+			case preferences.ConnectionTargetLast, preferences.ConnectionTargetFastest:
+			case preferences.ConnectionTargetServer:
+				if cn.Server == nil || len(strings.TrimSpace(*cn.Server)) == 0 {
+					addErr("connection.server", "server is not defined (required for target 'server')")
+				}
+			default:
+				addErr("connection.target", "unexpected value '%s' (expected: 'last', 'fastest' or 'server')", *cn.Target)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// IsSeed returns 'true' when the configuration must be applied only once (when the file content changed)
+func (c *Config) IsSeed() bool {
+	return c.Mode == ModeSeed
+}
+
+// Apply applies the configuration to the preferences object
+// (only the parameters defined in configuration are changed)
+// Note: the configuration must be validated before
+func (c *Config) Apply(p *preferences.Preferences) {
+	if c.Logging != nil {
+		p.IsLogging = *c.Logging
+	}
+
+	if fw := c.Firewall; fw != nil {
+		if fw.Persistent != nil {
+			p.IsFwPersistant = *fw.Persistent
+		}
+		if fw.AllowLan != nil {
+			p.IsFwAllowLAN = *fw.AllowLan
+		}
+		if fw.AllowLanMulticast != nil {
+			p.IsFwAllowLANMulticast = *fw.AllowLanMulticast
+		}
+		if fw.AllowApiServers != nil {
+			p.IsFwAllowApiServers = *fw.AllowApiServers
+		}
+		if fw.Exceptions != nil {
+			exceptions, _ := firewall.ParseUserExceptions(strings.Join(*fw.Exceptions, ","), true)
+			p.FwExceptions = firewall.ReplaceHostOnlyExceptions(p.FwExceptions, exceptions)
+		}
+	}
+
+	if d := c.Dns; d != nil {
+		conn := &p.DaemonConnection
+		if d.AntiTracker != nil {
+			conn.IsAntiTracker = *d.AntiTracker != "off"
+			conn.IsAntiTrackerHardcore = *d.AntiTracker == "hardcore"
+		}
+		if d.Custom != nil {
+			conn.ManualDNS = dns.DnsSettings{DnsHost: *d.Custom}
+		}
+		if d.Encryption != nil {
+			conn.ManualDNS.Encryption, _ = parseDnsEncryption(*d.Encryption)
+		}
+		if d.Template != nil {
+			conn.ManualDNS.DohTemplate = *d.Template
+		}
+	}
+
+	if st := c.SplitTunnel; st != nil {
+		if st.Enabled != nil {
+			p.IsSplitTunnel = *st.Enabled
+		}
+		if st.Apps != nil {
+			p.SplitTunnelApps = append([]string{}, *st.Apps...)
+		}
+	}
+
+	if cn := c.Connection; cn != nil {
+		conn := &p.DaemonConnection
+		if cn.Protocol != nil {
+			conn.VpnType, _ = parseVpnType(*cn.Protocol)
+		}
+		if cn.Transport != nil {
+			conn.IsTCP = *cn.Transport == "tcp"
+		}
+		if cn.Port != nil {
+			conn.Port = *cn.Port
+		}
+		if cn.Obfsproxy != nil {
+			p.IsObfsproxy = *cn.Obfsproxy
+		}
+		if cn.AutoConnect != nil {
+			conn.IsAutoconnectOnLaunch = *cn.AutoConnect
+		}
+		if cn.Target != nil {
+			conn.Target = preferences.ConnectionTarget(*cn.Target)
+		}
+		if cn.Server != nil {
+			conn.Gateway = strings.TrimSpace(*cn.Server)
+		}
+	}
+}
+
+func isValidIPOrNetwork(s string) bool {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "/") {
+		_, _, err := net.ParseCIDR(s)
+		return err == nil
+	}
+	return net.ParseIP(s) != nil
+}
+
+func parseDnsEncryption(s string) (dns.DnsEncryption, error) {
+	switch s {
+	case "none":
+		return dns.EncryptionNone, nil
+	case "dot":
+		return dns.EncryptionDnsOverTls, nil
+	case "doh":
+		return dns.EncryptionDnsOverHttps, nil
+	case "doq":
+		return dns.EncryptionDnsOverQuic, nil
+	case "doh3":
+		return dns.EncryptionDnsOverHttp3, nil
+	}
+	return dns.EncryptionNone, fmt.Errorf("unexpected value '%s' (expected: 'none', 'dot', 'doh', 'doq' or 'doh3')", s)
+}
+
+func parseVpnType(s string) (vpn.Type, error) {
+	switch s {
+	case "wireguard":
+		return vpn.WireGuard, nil
+	case "openvpn":
+		return vpn.OpenVPN, nil
+	}
+	return vpn.WireGuard, fmt.Errorf("unexpected value '%s' (expected: 'wireguard' or 'openvpn')", s)
+}
@@ -0,0 +1,126 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package config_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ivpn/desktop-app/daemon/service/config"
+	"github.com/ivpn/desktop-app/daemon/service/firewall"
+	"github.com/ivpn/desktop-app/daemon/service/preferences"
+	"github.com/ivpn/desktop-app/daemon/vpn"
+)
+
+func TestParseAndApply(t *testing.T) {
+	data := []byte(`
+version: 1
+mode: seed
+firewall:
+  persistent: true
+  exceptions: [ "192.168.0.0/16", "10.10.0.1" ]
+dns:
+  antitracker: hardcore
+connection:
+  protocol: openvpn
+  transport: tcp
+  port: 443
+  autoconnect: true
+  target: server
+  server: us-tx
+`)
+	cfg, err := config.Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.IsSeed() {
+		t.Error("expected 'seed' mode")
+	}
+
+	prefs := preferences.Create()
+	prefs.IsFwAllowLAN = true
+	cfg.Apply(prefs)
+
+	if !prefs.IsFwPersistant || !prefs.IsFwAllowLAN {
+		t.Error("firewall preferences applied incorrectly")
+	}
+	if exps := firewall.UserExceptionsString(prefs.FwExceptions); exps != "192.168.0.0/16,10.10.0.1/32" {
+		t.Error("unexpected exceptions:", exps)
+	}
+	conn := prefs.DaemonConnection
+	if !conn.IsAntiTracker || !conn.IsAntiTrackerHardcore {
+		t.Error("AntiTracker preferences applied incorrectly")
+	}
+	if conn.VpnType != vpn.OpenVPN || !conn.IsTCP || conn.Port != 443 {
+		t.Error("connection preferences applied incorrectly")
+	}
+	if !conn.IsAutoconnectOnLaunch || conn.Target != preferences.ConnectionTargetServer || conn.Gateway != "us-tx" {
+		t.Error("auto-connect preferences applied incorrectly")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		fields []string // expected fields with validation errors
+	}{
+		{"no version", "logging: true", []string{"version"}},
+		{"future version", "version: 100", []string{"version"}},
+		{"wrong values", `
+version: 1
+mode: always
+firewall:
+  exceptions: [ "1.1.1.1", "1.1.1.300" ]
+dns:
+  antitracker: on
+  custom: 1.1.1.1
+connection:
+  protocol: ipsec
+  target: server
+`, []string{"mode", "firewall.exceptions[1]", "dns", "connection.protocol", "connection.server"}},
+	}
+
+	for _, test := range tests {
+		_, err := config.Parse([]byte(test.data))
+
+		var verrs config.ValidationErrors
+		if !errors.As(err, &verrs) {
+			t.Errorf("%s: expected validation errors, got: %v", test.name, err)
+			continue
+		}
+		if len(verrs) != len(test.fields) {
+			t.Errorf("%s: unexpected errors: %v", test.name, verrs)
+			continue
+		}
+		for i, f := range test.fields {
+			if verrs[i].Field != f {
+				t.Errorf("%s: expected error for '%s', got: %v", test.name, f, verrs[i])
+			}
+		}
+	}
+
+	if _, err := config.Parse([]byte("version: 1\nfirewal:\n  persistent: true")); err == nil {
+		t.Error("expected error for unknown parameter")
+	}
+}
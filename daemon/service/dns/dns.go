@@ -30,6 +30,7 @@ import (
 
 	"github.com/ivpn/desktop-app/daemon/logger"
 	"github.com/ivpn/desktop-app/daemon/service/dns/dnscryptproxy"
+	"github.com/ivpn/desktop-app/daemon/service/dns/querystats"
 	"github.com/ivpn/desktop-app/daemon/service/platform"
 )
 
@@ -38,6 +39,7 @@ type FuncDnsChangeFirewallNotify func(dns *DnsSettings) error
 var (
 	log                         *logger.Logger
 	lastManualDNS               DnsSettings
+	lastSystemDNS               DnsSettings // DNS configuration applied to the OS (can be the local resolver or dnscrypt-proxy)
 	funcDnsChangeFirewallNotify FuncDnsChangeFirewallNotify
 )
 
@@ -73,12 +75,19 @@ const (
 	EncryptionNone         DnsEncryption = 0
 	EncryptionDnsOverTls   DnsEncryption = 1
 	EncryptionDnsOverHttps DnsEncryption = 2
+	EncryptionDnsStamp     DnsEncryption = 3 // DNS server defined by DNS stamp ('sdns://...'): DNSCrypt, DoH or ODoH
+	EncryptionDnsOverQuic  DnsEncryption = 4 // DNS-over-QUIC (RFC 9250); processed by the local resolver of the daemon
+	EncryptionDnsOverHttp3 DnsEncryption = 5 // DNS-over-HTTPS over HTTP/3; processed by the local resolver of the daemon
 )
 
 type DnsSettings struct {
 	DnsHost     string // DNS host IP address
 	Encryption  DnsEncryption
-	DohTemplate string // DoH/DoT template URI (for Encryption = DnsOverHttps or Encryption = DnsOverTls)
+	DohTemplate string // DoH/DoT/DoQ template URI (for Encryption = DnsOverHttps, DnsOverHttp3, DnsOverTls or DnsOverQuic)
+	Stamp       string `json:",omitempty"` // DNS stamp of the server (for Encryption = DnsStamp)
+	RelayStamp  string `json:",omitempty"` // DNS stamp of the DNSCrypt/ODoH relay (for Encryption = DnsStamp; optional for DNSCrypt server)
+	// Ordered list of fallback DNS servers (plain, DoH, DoT, DoQ, DoH3 or DNS stamp) in use when the primary server is not responding
+	Fallbacks []DnsSettings `json:",omitempty"`
 }
 
 // create  DnsSettings object with no encryption
@@ -92,9 +101,17 @@ func DnsSettingsCreate(ip net.IP) DnsSettings {
 func (d DnsSettings) Equal(x DnsSettings) bool {
 	if d.Encryption != x.Encryption ||
 		d.DohTemplate != x.DohTemplate ||
-		d.DnsHost != x.DnsHost {
+		d.Stamp != x.Stamp ||
+		d.RelayStamp != x.RelayStamp ||
+		d.DnsHost != x.DnsHost ||
+		len(d.Fallbacks) != len(x.Fallbacks) {
 		return false
 	}
+	for i := range d.Fallbacks {
+		if !d.Fallbacks[i].Equal(x.Fallbacks[i]) {
+			return false
+		}
+	}
 	return true
 }
 
@@ -125,6 +142,14 @@ func (d DnsSettings) InfoString() string {
 	if d.IsEmpty() {
 		return "<none>"
 	}
+	if len(d.Fallbacks) > 0 {
+		servers := d.Servers()
+		info := make([]string, 0, len(servers))
+		for _, s := range servers {
+			info = append(info, s.InfoString())
+		}
+		return strings.Join(info, "; fallback: ")
+	}
 	host := strings.TrimSpace(d.DnsHost)
 	template := strings.TrimSpace(d.DohTemplate)
 
@@ -133,6 +158,12 @@ func (d DnsSettings) InfoString() string {
 		return host + " (DoT " + template + ")"
 	case EncryptionDnsOverHttps:
 		return host + " (DoH " + template + ")"
+	case EncryptionDnsOverQuic:
+		return host + " (DoQ " + template + ")"
+	case EncryptionDnsOverHttp3:
+		return host + " (DoH3 " + template + ")"
+	case EncryptionDnsStamp:
+		return host + " (" + d.stampInfoString() + ")"
 	case EncryptionNone:
 		return host
 	default:
@@ -140,6 +171,38 @@ func (d DnsSettings) InfoString() string {
 	}
 }
 
+// ValidateTemplate checks the template URI of the encrypted DNS server (DoH, DoH over HTTP/3 or DoQ)
+func (d DnsSettings) ValidateTemplate() error {
+	_, err := d.templateURL()
+	return err
+}
+
+// templateURL returns the parsed template URI of the encrypted DNS server (nil - the template is not in use).
+// DoH (including HTTP/3) template: 'https://host[:port]/path'; DoQ template: 'quic://host[:port]' (default port 853).
+func (d DnsSettings) templateURL() (*url.URL, error) {
+	var scheme string
+	switch d.Encryption {
+	case EncryptionDnsOverHttps, EncryptionDnsOverHttp3:
+		scheme = "https"
+	case EncryptionDnsOverQuic:
+		scheme = "quic"
+	default:
+		return nil, nil
+	}
+
+	u, err := url.Parse(strings.TrimSpace(d.DohTemplate))
+	if err != nil {
+		return nil, fmt.Errorf("bad template URL: %w", err)
+	}
+	if u.Scheme != scheme {
+		return nil, fmt.Errorf("bad template URL scheme: '%s' (expected '%s')", u.Scheme, scheme)
+	}
+	if len(u.Hostname()) == 0 {
+		return nil, fmt.Errorf("bad template URL: host name is not defined")
+	}
+	return u, nil
+}
+
 // Initialize is doing initialization stuff
 // Must be called on application start
 func Initialize(fwNotifyDnsChangeFunc FuncDnsChangeFirewallNotify) error {
@@ -185,16 +248,55 @@ func notifyFirewall(dnsCfg DnsSettings) error {
 }
 
 // SetManual - set manual DNS.
-// 'dnsCfg' parameter - DNS configuration
+// 'dnsCfg' parameter - DNS configuration (the fallback servers are activated when the primary server is not responding)
 // 'localInterfaceIP' (obligatory only for Windows implementation) - local IP of VPN interface
 func SetManual(dnsCfg DnsSettings, localInterfaceIP net.IP) error {
-	dnsForFirewallRules, err := implSetManual(dnsCfg, localInterfaceIP)
+	manualDnsMutex.Lock()
+	defer manualDnsMutex.Unlock()
+
+	// start the failover (if fallback servers defined) and get the server to apply
+	active := upstreamsSet(dnsCfg, localInterfaceIP)
+	err := setManual(dnsCfg, active, localInterfaceIP)
+	if err != nil {
+		upstreamsStop()
+	}
+	return err
+}
+
+// setManual applies the 'active' server of the 'dnsCfg' configuration to the OS.
+// Must be called under manualDnsMutex.
+func setManual(dnsCfg DnsSettings, active DnsSettings, localInterfaceIP net.IP) error {
+	// start local resolver (if split DNS rules, local filtering or DoQ/DoH3 server are defined)
+	cfgToApply, isLocalResolver, err := localResolverStart(active)
+	if err != nil {
+		return wrapErrorIfFailed(err)
+	}
+
+	dnsForFirewallRules, err := implSetManual(cfgToApply, localInterfaceIP)
 	if err == nil {
 		lastManualDNS = dnsCfg
+		lastSystemDNS = dnsForFirewallRules
 	} else {
+		if isLocalResolver {
+			localResolverStop()
+		}
 		return wrapErrorIfFailed(err)
 	}
 
+	if isLocalResolver && !dnsForFirewallRules.IsEmpty() {
+		// the local resolver forwards queries to the DNS server: it must be allowed by firewall
+		dnsForFirewallRules = active
+	}
+	if !dnsForFirewallRules.IsEmpty() {
+		// the inactive servers must be reachable for the health checks and the failover
+		dnsForFirewallRules.Fallbacks = nil
+		for _, s := range dnsCfg.Servers() {
+			if !s.Equal(active) {
+				dnsForFirewallRules.Fallbacks = append(dnsForFirewallRules.Fallbacks, s)
+			}
+		}
+	}
+
 	// notify firewall about DNS configuration
 	return wrapErrorIfFailed(notifyFirewall(dnsForFirewallRules))
 }
@@ -202,10 +304,22 @@ func SetManual(dnsCfg DnsSettings, localInterfaceIP net.IP) error {
 // DeleteManual - reset manual DNS configuration to default (DHCP)
 // 'localInterfaceIP' (obligatory only for Windows implementation) - local IP of VPN interface
 func DeleteManual(defaultDns net.IP, localInterfaceIP net.IP) error {
+	if defaultDns != nil && isLocalResolverRequired() {
+		// the local resolver is in use: it forwards the queries to the default DNS
+		return SetDefault(DnsSettingsCreate(defaultDns), localInterfaceIP)
+	}
+
+	manualDnsMutex.Lock()
+	defer manualDnsMutex.Unlock()
+
+	upstreamsStop()
+	localResolverStop()
+
 	// reset custom DNS
 	ret := implDeleteManual(localInterfaceIP)
 	if ret == nil {
 		lastManualDNS = DnsSettings{}
+		lastSystemDNS = DnsSettings{}
 	} else {
 		return wrapErrorIfFailed(ret)
 	}
@@ -241,10 +355,6 @@ func dnscryptProxyProcessStart(dnsCfg DnsSettings) (retErr error) {
 		}
 	}()
 
-	if dnsCfg.Encryption != EncryptionDnsOverHttps {
-		return fmt.Errorf("unsupported DNS encryption type")
-	}
-
 	binPath, configPathTemplate, configPathMutable, logfile := platform.DnsCryptProxyInfo()
 	if len(binPath) == 0 || len(configPathTemplate) == 0 || len(configPathMutable) == 0 {
 		return fmt.Errorf("configuration not defined")
@@ -252,32 +362,45 @@ func dnscryptProxyProcessStart(dnsCfg DnsSettings) (retErr error) {
 
 	// Configure + start dnscrypt-proxy
 
-	stamp := dnscryptproxy.ServerStamp{Proto: dnscryptproxy.StampProtoTypeDoH}
-	//stamp.Props |= dnscryptproxy.ServerInformalPropertyDNSSEC
-	//stamp.Props |= dnscryptproxy.ServerInformalPropertyNoLog
-	//stamp.Props |= dnscryptproxy.ServerInformalPropertyNoFilter
+	var serverStamp, relayStamp string
+	switch dnsCfg.Encryption {
+	case EncryptionDnsOverHttps:
+		stamp := dnscryptproxy.ServerStamp{Proto: dnscryptproxy.StampProtoTypeDoH}
+		//stamp.Props |= dnscryptproxy.ServerInformalPropertyDNSSEC
+		//stamp.Props |= dnscryptproxy.ServerInformalPropertyNoLog
+		//stamp.Props |= dnscryptproxy.ServerInformalPropertyNoFilter
 
-	stamp.ServerAddrStr = dnsCfg.DnsHost
+		stamp.ServerAddrStr = dnsCfg.DnsHost
 
-	u, err := url.Parse(dnsCfg.DohTemplate)
-	if err != nil {
-		return err
-	}
+		u, err := dnsCfg.templateURL()
+		if err != nil {
+			return err
+		}
+		stamp.ProviderName = u.Host
+		stamp.Path = u.Path
+		serverStamp = stamp.String()
+
+	case EncryptionDnsStamp:
+		if _, _, err := parseStamps(dnsCfg.Stamp, dnsCfg.RelayStamp); err != nil {
+			return err
+		}
+		serverStamp, relayStamp = dnsCfg.Stamp, dnsCfg.RelayStamp
 
-	if u.Scheme != "https" {
-		return fmt.Errorf("bad template URL scheme: " + u.Scheme)
+	default:
+		return fmt.Errorf("unsupported DNS encryption type")
 	}
-	stamp.ProviderName = u.Host
-	stamp.Path = u.Path
 
 	// generate dnscrypt-proxy configuration
-	if err = dnscryptproxy.SaveConfigFile(stamp.String(), configPathTemplate, configPathMutable); err != nil {
+	// the query log is enabled only when the query statistics are enabled
+	isQueryLog := querystats.IsEnabled()
+	if err := dnscryptproxy.SaveConfigFile(serverStamp, relayStamp, isQueryLog, configPathTemplate, configPathMutable); err != nil {
 		return err
 	}
+	setDnscryptProxyUpstream(dnsCfg.DnsHost)
 
 	dnscryptproxy.Init(binPath, configPathMutable, logfile)
 
-	if err = dnscryptproxy.Start(); err != nil {
+	if err := dnscryptproxy.Start(); err != nil {
 		dnscryptproxy.Stop()
 		return err
 	}
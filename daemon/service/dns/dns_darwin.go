@@ -25,6 +25,7 @@ package dns
 import (
 	"fmt"
 	"net"
+	"strings"
 
 	"github.com/ivpn/desktop-app/daemon/service/dns/dnscryptproxy"
 	"github.com/ivpn/desktop-app/daemon/service/platform"
@@ -112,3 +113,34 @@ func IsPrimaryInterfaceFound() bool {
 	}
 	return true
 }
+
+func implGetSystemResolvers() ([]net.IP, error) {
+	outText, _, _, err := shell.ExecAndGetOutput(log, 1024*64, "", "/usr/sbin/scutil", "--dns")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get DNS configuration: %w", err)
+	}
+	return parseScutilDnsOutput(outText), nil
+}
+
+// parseScutilDnsOutput returns the nameservers of the primary resolver ('resolver #1') from the 'scutil --dns' output
+func parseScutilDnsOutput(text string) []net.IP {
+	var ret []net.IP
+	isPrimaryResolver := false
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "resolver #") {
+			if isPrimaryResolver {
+				break
+			}
+			isPrimaryResolver = line == "resolver #1"
+			continue
+		}
+		if !isPrimaryResolver || !strings.HasPrefix(line, "nameserver[") {
+			continue
+		}
+		if idx := strings.Index(line, ":"); idx > 0 {
+			ret = append(ret, parseIPsFromText(line[idx+1:])...)
+		}
+	}
+	return ret
+}
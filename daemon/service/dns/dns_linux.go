@@ -31,6 +31,7 @@ import (
 	"github.com/fsnotify/fsnotify"
 	"github.com/ivpn/desktop-app/daemon/helpers"
 	"github.com/ivpn/desktop-app/daemon/service/dns/dnscryptproxy"
+	"github.com/ivpn/desktop-app/daemon/shell"
 )
 
 var (
@@ -312,3 +313,35 @@ func restoreBackup(backupFName string, isDeleteBackup bool) error {
 
 	return nil
 }
+
+func implGetSystemResolvers() ([]net.IP, error) {
+	file, err := os.Open(resolvFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DNS configuration: %w", err)
+	}
+	defer file.Close()
+
+	servers := parseResolvConf(file)
+
+	// systemd-resolved stub resolver: the real DNS servers are known only by the systemd-resolved
+	isStubResolver := len(servers) > 0
+	for _, s := range servers {
+		if !s.Equal(net.IPv4(127, 0, 0, 53)) {
+			isStubResolver = false
+			break
+		}
+	}
+	if !isStubResolver {
+		return servers, nil
+	}
+
+	outText, _, _, err := shell.ExecAndGetOutput(log, 1024*10, "", "resolvectl", "dns")
+	if err != nil {
+		log.Warning(fmt.Sprintf("failed to get systemd-resolved DNS configuration: %v", err))
+		return servers, nil
+	}
+	if resolvedServers := parseIPsFromText(outText); len(resolvedServers) > 0 {
+		return resolvedServers, nil
+	}
+	return servers, nil
+}
@@ -35,6 +35,7 @@ import (
 	"github.com/ivpn/desktop-app/daemon/netinfo"
 	"github.com/ivpn/desktop-app/daemon/service/dns/dnscryptproxy"
 	"github.com/ivpn/desktop-app/daemon/service/platform"
+	"golang.org/x/sys/windows"
 )
 
 var (
@@ -202,7 +203,8 @@ func implSetManual(dnsCfg DnsSettings, localInterfaceIP net.IP) (dnsInfoForFirew
 	var err error
 
 	// start encrypted DNS configuration (if required)
-	if dnsCfg.Encryption != EncryptionNone && !fIsCanUseNativeDnsOverHttps() {
+	// (DNS stamps are always applied by dnscrypt-proxy: not supported by the native DoH implementation)
+	if dnsCfg.Encryption == EncryptionDnsStamp || (dnsCfg.Encryption != EncryptionNone && !fIsCanUseNativeDnsOverHttps()) {
 		if err := dnscryptProxyProcessStart(dnsCfg); err != nil {
 			return DnsSettings{}, err
 		}
@@ -348,3 +350,34 @@ func getInterfacesIPsWhichContainsIP(addr net.IP, localAddrToSkip net.IP) (ret [
 
 	return ret, nil
 }
+
+func implGetSystemResolvers() ([]net.IP, error) {
+	var buf []byte
+	size := uint32(15 * 1024)
+	for {
+		buf = make([]byte, size)
+		err := windows.GetAdaptersAddresses(windows.AF_UNSPEC, 0, 0, (*windows.IpAdapterAddresses)(unsafe.Pointer(&buf[0])), &size)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, windows.ERROR_BUFFER_OVERFLOW) || size <= uint32(len(buf)) {
+			return nil, fmt.Errorf("failed to get network adapters info: %w", err)
+		}
+	}
+
+	var ret []net.IP
+	for adapter := (*windows.IpAdapterAddresses)(unsafe.Pointer(&buf[0])); adapter != nil; adapter = adapter.Next {
+		if adapter.OperStatus != windows.IfOperStatusUp {
+			continue
+		}
+		for dnsAddr := adapter.FirstDnsServerAddress; dnsAddr != nil; dnsAddr = dnsAddr.Next {
+			ip := dnsAddr.Address.IP()
+			// skip the deprecated site-local addresses (fec0:0:0:ffff::1) which Windows assigns when IPv6 DNS is not configured
+			if ip == nil || (ip.To4() == nil && ip[0] == 0xfe && ip[1]&0xc0 == 0xc0) {
+				continue
+			}
+			ret = appendUniqueIP(ret, ip)
+		}
+	}
+	return ret, nil
+}
@@ -33,8 +33,17 @@ const configSvrName = "ivpnmanualconfig"
 
 // SaveConfigFile - update template file 'configFileTemplate's with required data
 // and save result into 'configFileOut'
+// 'relayStamp' (optional) - the relay for the server: DNSCrypt relay (Anonymized DNSCrypt) or ODoH relay
+// 'isQueryLog' - enable the query log (LTSV format) to the standard output; it is processed by the QueryLogHandler
 // The implementation is very simple and based in replacing specific lines in template.
-func SaveConfigFile(dnsSvrStamp, configFileTemplate, configFileOut string) error {
+func SaveConfigFile(dnsSvrStamp, relayStamp string, isQueryLog bool, configFileTemplate, configFileOut string) error {
+	stamp, err := NewServerStampFromString(dnsSvrStamp)
+	if err != nil {
+		return fmt.Errorf("bad server stamp: %w", err)
+	}
+	isODoH := stamp.Proto == StampProtoTypeODoHTarget
+	isQueryLog = isQueryLog && IsQueryLogSupported()
+
 	if _, err := os.Stat(configFileTemplate); err != nil {
 		return err
 	}
@@ -49,11 +58,25 @@ func SaveConfigFile(dnsSvrStamp, configFileTemplate, configFileOut string) error
 	isUpdated_server_names := false
 	isUpdated_static_myserver := false
 	isUpdated_stamp := false
+	isUpdated_routes := len(relayStamp) == 0
+	isUpdated_odoh := !isODoH
+	isUpdated_queryLogFile := !isQueryLog
+	isUpdated_queryLogFormat := !isQueryLog
 
+	section := ""
 	for i, line := range lines {
 		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			section = line
+		}
 
-		if strings.HasPrefix(line, "# server_names = ") {
+		if isQueryLog && section == "[query_log]" && strings.HasPrefix(line, "# file = ") {
+			lines[i] = fmt.Sprintf("file = '%s'", queryLogFile)
+			isUpdated_queryLogFile = true
+		} else if isQueryLog && section == "[query_log]" && strings.HasPrefix(line, "format = ") {
+			lines[i] = "format = 'ltsv'"
+			isUpdated_queryLogFormat = true
+		} else if strings.HasPrefix(line, "# server_names = ") {
 			lines[i] = fmt.Sprintf("server_names = ['%s']", configSvrName)
 			isUpdated_server_names = true
 		} else if strings.HasPrefix(line, "# [static.'myserver']") {
@@ -62,10 +85,16 @@ func SaveConfigFile(dnsSvrStamp, configFileTemplate, configFileOut string) error
 		} else if strings.HasPrefix(line, "#") && strings.Contains(line, "stamp =") {
 			lines[i] = fmt.Sprintf("stamp = '%s'", dnsSvrStamp)
 			isUpdated_stamp = true
+		} else if len(relayStamp) > 0 && strings.HasPrefix(line, "# routes = [") {
+			lines[i] = fmt.Sprintf("routes = [ { server_name='%s', via=['%s'] } ]", configSvrName, relayStamp)
+			isUpdated_routes = true
+		} else if isODoH && strings.HasPrefix(line, "odoh_servers = ") {
+			lines[i] = "odoh_servers = true"
+			isUpdated_odoh = true
 		}
 	}
 
-	if !isUpdated_server_names || !isUpdated_static_myserver || !isUpdated_stamp {
+	if !isUpdated_server_names || !isUpdated_static_myserver || !isUpdated_stamp || !isUpdated_routes || !isUpdated_odoh || !isUpdated_queryLogFile || !isUpdated_queryLogFormat {
 		return fmt.Errorf("failed to update configuration from template file")
 	}
 
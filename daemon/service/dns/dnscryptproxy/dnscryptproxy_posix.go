@@ -34,6 +34,14 @@ import (
 	"github.com/ivpn/desktop-app/daemon/shell"
 )
 
+// the query log is written to the standard output of the process: it is processed in memory (never saved to disk)
+const queryLogFile = "/dev/stdout"
+
+// IsQueryLogSupported returns 'true' when the query log can be processed (see SetQueryLogHandler)
+func IsQueryLogSupported() bool {
+	return true
+}
+
 type startedCmd struct {
 	command   *exec.Cmd
 	stopped   <-chan struct{}
@@ -87,6 +95,10 @@ func (p *dnsCryptProxy) start() (command *startedCmd, err error) {
 	// output example:
 	// 	[NOTICE] [ivpnmanualconfig] OK
 	outputParseFunc := func(text string, isError bool) {
+		// the query log lines are not written to the log
+		if !isError && processQueryLogLine(text) {
+			return
+		}
 		log.Info("[OUT] ", text)
 		// check if dnscrypt-proxy ready to use
 		if strings.Contains(text, "[NOTICE] Now listening to") {
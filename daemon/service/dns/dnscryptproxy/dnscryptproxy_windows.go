@@ -44,6 +44,14 @@ type dnsCryptProxy struct {
 	logFilePath    string
 }
 
+// dnscrypt-proxy is running as a service: the query log can not be processed in memory
+const queryLogFile = ""
+
+// IsQueryLogSupported returns 'true' when the query log can be processed (see SetQueryLogHandler)
+func IsQueryLogSupported() bool {
+	return false
+}
+
 func implInit(theBinaryPath, configFilePath, logFilePath string) *dnsCryptProxy {
 	return &dnsCryptProxy{binaryPath: theBinaryPath, configFilePath: configFilePath, logFilePath: logFilePath}
 }
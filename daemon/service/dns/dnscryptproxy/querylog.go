@@ -0,0 +1,120 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2022 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package dnscryptproxy
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QueryLogEntry - the query information from the dnscrypt-proxy query log
+type QueryLogEntry struct {
+	Time     time.Time
+	Name     string
+	Type     string
+	Return   string // e.g. "PASS", "NXDOMAIN", "SERVFAIL", "SERVER_TIMEOUT", "NETWORK_ERROR"
+	IsCached bool
+	Duration time.Duration
+	Server   string // the name of the upstream server
+}
+
+// IsFailed returns 'true' if the query was not resolved because of an error
+func (e QueryLogEntry) IsFailed() bool {
+	switch e.Return {
+	case "SERVER_ERROR", "SERVER_TIMEOUT", "NETWORK_ERROR", "RESPONSE_ERROR", "PARSE_ERROR", "NOT_READY", "SERVFAIL":
+		return true
+	}
+	return false
+}
+
+var (
+	_queryLogMutex   sync.Mutex
+	_queryLogHandler func(QueryLogEntry)
+)
+
+// SetQueryLogHandler sets the handler for the dnscrypt-proxy query log entries (nil - no handler)
+// Note: the query log is enabled only when the configuration file is saved with 'isQueryLog' parameter
+func SetQueryLogHandler(handler func(QueryLogEntry)) {
+	_queryLogMutex.Lock()
+	defer _queryLogMutex.Unlock()
+	_queryLogHandler = handler
+}
+
+// processQueryLogLine returns 'true' if the text is the query log line (it is passed to the handler)
+func processQueryLogLine(text string) bool {
+	entry, ok := parseQueryLogLine(text)
+	if !ok {
+		return false
+	}
+
+	_queryLogMutex.Lock()
+	handler := _queryLogHandler
+	_queryLogMutex.Unlock()
+
+	if handler != nil {
+		handler(entry)
+	}
+	return true
+}
+
+// parseQueryLogLine parses the query log line in LTSV format. Example:
+// time:1620000000	host:127.0.0.1	message:example.com	type:A	return:PASS	cached:0	duration:12	server:ivpnmanualconfig
+func parseQueryLogLine(text string) (entry QueryLogEntry, ok bool) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "time:") {
+		return entry, false
+	}
+
+	for _, field := range strings.Split(text, "\t") {
+		kv := strings.SplitN(field, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		val := strings.Trim(kv[1], "\"")
+		switch kv[0] {
+		case "time":
+			if t, err := strconv.ParseInt(val, 10, 64); err == nil {
+				entry.Time = time.Unix(t, 0)
+			}
+		case "message":
+			entry.Name = strings.TrimSuffix(strings.ToLower(val), ".")
+		case "type":
+			entry.Type = val
+		case "return":
+			entry.Return = val
+		case "cached":
+			entry.IsCached = val == "1"
+		case "duration":
+			if d, err := strconv.ParseInt(val, 10, 64); err == nil {
+				entry.Duration = time.Duration(d) * time.Millisecond
+			}
+		case "server":
+			if val != "-" {
+				entry.Server = val
+			}
+		}
+	}
+	return entry, len(entry.Name) > 0
+}
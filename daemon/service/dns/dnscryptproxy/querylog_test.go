@@ -0,0 +1,60 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2022 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package dnscryptproxy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseQueryLogLine(t *testing.T) {
+	entry, ok := parseQueryLogLine("time:1620000000\thost:127.0.0.1\tmessage:\"Example.COM.\"\ttype:AAAA\treturn:SERVER_TIMEOUT\tcached:0\tduration:1500\tserver:ivpnmanualconfig")
+	if !ok {
+		t.Fatal("line not parsed")
+	}
+	expected := QueryLogEntry{
+		Time:     time.Unix(1620000000, 0),
+		Name:     "example.com",
+		Type:     "AAAA",
+		Return:   "SERVER_TIMEOUT",
+		Duration: 1500 * time.Millisecond,
+		Server:   "ivpnmanualconfig",
+	}
+	if entry != expected {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+	if !entry.IsFailed() {
+		t.Error("the entry expected to be failed")
+	}
+
+	entry, ok = parseQueryLogLine("time:1620000000\thost:127.0.0.1\tmessage:example.com\ttype:A\treturn:PASS\tcached:1\tduration:0\tserver:-")
+	if !ok || !entry.IsCached || len(entry.Server) != 0 || entry.IsFailed() {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+
+	for _, line := range []string{"[2021-05-01 10:00:00] [NOTICE] Now listening to 127.0.0.1:53 [UDP]", "time:1620000000\tmessage:"} {
+		if _, ok := parseQueryLogLine(line); ok {
+			t.Errorf("line must not be parsed: %s", line)
+		}
+	}
+}
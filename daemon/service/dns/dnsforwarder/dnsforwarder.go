@@ -0,0 +1,336 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+// Package dnsforwarder implements a local forwarding DNS resolver.
+// It receives DNS queries on a local address and forwards them to the upstream DNS server:
+// the queries for domains defined by the rules are forwarded to the rule-specific servers (split DNS),
+// all other queries are forwarded to the default server.
+// Optionally, the queries are filtered (blocked/allowed/overridden) according to the local lists.
+package dnsforwarder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ivpn/desktop-app/daemon/logger"
+	"github.com/ivpn/desktop-app/daemon/service/dns/querystats"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var log *logger.Logger
+
+func init() {
+	log = logger.NewLogger("dnsfwd")
+}
+
+// DnsPort - port number of the local resolver and the upstream servers
+const DnsPort = 53
+
+// Rule - queries for the Domain (and all its subdomains) have to be forwarded to the Server
+type Rule struct {
+	Domain string
+	Server net.IP
+}
+
+// Config - configuration of the forwarder
+type Config struct {
+	// local IP address to listen on (UDP and TCP)
+	ListenIP net.IP
+	// the server for all queries which are not matching any rule
+	DefaultServer net.IP
+	// (optional) the transport to the DefaultServer (e.g. DNS-over-QUIC); nil - plain DNS.
+	// The forwarder takes ownership of the object: it is closed when the forwarder is stopped or the upstream is replaced.
+	DefaultUpstream Upstream
+	Rules           []Rule
+
+	// local filtering rules (nil - no filtering)
+	Filter *Filter
+	// the server for domains from the Filter allowlist (nil - DefaultServer is in use)
+	// (e.g. the DNS server which is not blocking anything, when the DefaultServer is AntiTracker)
+	AllowServer net.IP
+}
+
+type forwarder struct {
+	mutex sync.RWMutex
+	cfg   Config
+
+	udpConn  *net.UDPConn
+	tcpListn *net.TCPListener
+	wg       sync.WaitGroup
+}
+
+var (
+	_mutex sync.Mutex
+	_fwd   *forwarder
+)
+
+// Start starts the local resolver.
+// If it is already running on the same listen address - only the configuration is updated.
+func Start(cfg Config) (retErr error) {
+	defer func() {
+		if retErr != nil && cfg.DefaultUpstream != nil {
+			cfg.DefaultUpstream.Close()
+		}
+	}()
+
+	if cfg.ListenIP == nil || cfg.DefaultServer == nil {
+		return fmt.Errorf("local DNS resolver configuration is not defined")
+	}
+
+	_mutex.Lock()
+	defer _mutex.Unlock()
+
+	if _fwd != nil {
+		if _fwd.config().ListenIP.Equal(cfg.ListenIP) {
+			_fwd.setConfig(cfg)
+			return nil
+		}
+		_fwd.stop()
+		_fwd = nil
+	}
+
+	f := &forwarder{cfg: cfg}
+	if err := f.start(); err != nil {
+		return fmt.Errorf("failed to start local DNS resolver: %w", err)
+	}
+	_fwd = f
+	log.Info(fmt.Sprintf("Local DNS resolver started on %s (default server: %s; rules: %d)", cfg.ListenIP, cfg.DefaultServer, len(cfg.Rules)))
+	return nil
+}
+
+// Stop stops the local resolver (if running)
+func Stop() {
+	_mutex.Lock()
+	defer _mutex.Unlock()
+
+	if _fwd == nil {
+		return
+	}
+	_fwd.stop()
+	_fwd = nil
+	log.Info("Local DNS resolver stopped")
+}
+
+// IsRunning returns 'true' when the local resolver is running
+func IsRunning() bool {
+	_mutex.Lock()
+	defer _mutex.Unlock()
+	return _fwd != nil
+}
+
+// NormalizeDomain converts the domain name to a form used for rules matching:
+// lower case, without leading wildcard ('*.') and without the trailing dot
+func NormalizeDomain(domain string) string {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	domain = strings.TrimPrefix(domain, "*.")
+	return strings.TrimSuffix(domain, ".")
+}
+
+// MatchRule returns the rule for the domain name.
+// The rule with the longest domain is selected when there are few rules matching the name.
+func MatchRule(rules []Rule, name string) (rule Rule, found bool) {
+	name = NormalizeDomain(name)
+	for _, r := range rules {
+		d := NormalizeDomain(r.Domain)
+		if len(d) == 0 || len(d) <= len(rule.Domain) {
+			continue
+		}
+		if name == d || strings.HasSuffix(name, "."+d) {
+			rule = Rule{Domain: d, Server: r.Server}
+			found = true
+		}
+	}
+	return rule, found
+}
+
+func (f *forwarder) config() Config {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	return f.cfg
+}
+
+func (f *forwarder) setConfig(cfg Config) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.cfg.DefaultUpstream != nil && f.cfg.DefaultUpstream != cfg.DefaultUpstream {
+		f.cfg.DefaultUpstream.Close()
+	}
+	f.cfg = cfg
+}
+
+func (f *forwarder) start() error {
+	addr := &net.UDPAddr{IP: f.cfg.ListenIP, Port: DnsPort}
+	udpConn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return err
+	}
+	tcpListn, err := net.ListenTCP("tcp", &net.TCPAddr{IP: f.cfg.ListenIP, Port: DnsPort})
+	if err != nil {
+		udpConn.Close()
+		return err
+	}
+	f.udpConn = udpConn
+	f.tcpListn = tcpListn
+
+	f.wg.Add(2)
+	go f.serveUDP()
+	go f.serveTCP()
+	return nil
+}
+
+func (f *forwarder) stop() {
+	f.udpConn.Close()
+	f.tcpListn.Close()
+	f.wg.Wait()
+
+	if upstream := f.config().DefaultUpstream; upstream != nil {
+		upstream.Close()
+	}
+}
+
+func (f *forwarder) serveUDP() {
+	defer f.wg.Done()
+
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, from, err := f.udpConn.ReadFromUDP(buf)
+		if err != nil {
+			if isClosedConnError(err) {
+				return
+			}
+			log.Debug("UDP read error: ", err)
+			continue
+		}
+
+		query := make([]byte, n)
+		copy(query, buf[:n])
+		go func() {
+			if resp := f.processQuery(query, false); resp != nil {
+				f.udpConn.WriteToUDP(resp, from)
+			}
+		}()
+	}
+}
+
+func (f *forwarder) serveTCP() {
+	defer f.wg.Done()
+
+	for {
+		conn, err := f.tcpListn.Accept()
+		if err != nil {
+			if isClosedConnError(err) {
+				return
+			}
+			log.Debug("TCP accept error: ", err)
+			continue
+		}
+
+		go func() {
+			defer conn.Close()
+			for {
+				query, err := readTCPMessage(conn)
+				if err != nil {
+					return
+				}
+				resp := f.processQuery(query, true)
+				if resp == nil {
+					return
+				}
+				if err := writeTCPMessage(conn, resp); err != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+// processQuery returns the response to the query (nil - when the query is malformed and has to be dropped)
+func (f *forwarder) processQuery(query []byte, isTCP bool) []byte {
+	var p dnsmessage.Parser
+	hdr, err := p.Start(query)
+	if err != nil {
+		return nil
+	}
+	q, err := p.Question()
+	if err != nil {
+		return nil
+	}
+
+	cfg := f.config()
+	server := cfg.DefaultServer
+	upstream := cfg.DefaultUpstream
+
+	if cfg.Filter != nil {
+		action, ip := cfg.Filter.Check(q.Name.String())
+		statsCountQuery(q.Name.String(), action == FilterBlock)
+		switch action {
+		case FilterBlock:
+			queryStatsAdd(q, "", "BLOCKED", 0, false)
+			return buildResponse(hdr, q, dnsmessage.RCodeNameError, nil)
+		case FilterOverride:
+			queryStatsAdd(q, "", "OVERRIDDEN", 0, false)
+			return buildResponse(hdr, q, dnsmessage.RCodeSuccess, ip)
+		case FilterAllow:
+			if cfg.AllowServer != nil {
+				server, upstream = cfg.AllowServer, nil
+			}
+		}
+	} else {
+		statsCountQuery(q.Name.String(), false)
+	}
+
+	if rule, ok := MatchRule(cfg.Rules, q.Name.String()); ok {
+		server, upstream = rule.Server, nil
+	}
+	notifyWatchers(q.Name.String(), server)
+
+	started := time.Now()
+	var resp []byte
+	if upstream != nil {
+		resp, err = upstream.Exchange(query)
+	} else {
+		resp, err = exchange(query, server, isTCP)
+	}
+	if err != nil {
+		log.Debug(fmt.Sprintf("Failed to forward query for '%s' to %s: %s", q.Name.String(), server, err))
+		result := "ERROR"
+		if netErr, ok := err.(net.Error); (ok && netErr.Timeout()) || errors.Is(err, context.DeadlineExceeded) {
+			result = "TIMEOUT"
+		}
+		queryStatsAdd(q, server.String(), result, time.Since(started), true)
+		return serverFailure(query)
+	}
+	if querystats.IsEnabled() {
+		rcode := responseRCode(resp)
+		queryStatsAdd(q, server.String(), rcodeString(rcode), time.Since(started), rcode == dnsmessage.RCodeServerFailure)
+	}
+	return resp
+}
+
+func isClosedConnError(err error) bool {
+	return errors.Is(err, net.ErrClosed)
+}
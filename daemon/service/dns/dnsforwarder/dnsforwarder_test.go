@@ -0,0 +1,174 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package dnsforwarder
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestMatchRule(t *testing.T) {
+	rules := []Rule{
+		{Domain: "example.com", Server: net.ParseIP("10.0.0.1")},
+		{Domain: "*.Corp.Example.com.", Server: net.ParseIP("10.0.0.53")},
+	}
+
+	tests := []struct {
+		name   string
+		server string // empty - no rule expected
+	}{
+		{"corp.example.com.", "10.0.0.53"},
+		{"host.corp.example.com.", "10.0.0.53"},
+		{"HOST.CORP.EXAMPLE.COM", "10.0.0.53"},
+		{"www.example.com.", "10.0.0.1"},
+		{"example.com", "10.0.0.1"},
+		{"notexample.com.", ""},
+		{"example.org.", ""},
+		{"com.", ""},
+	}
+
+	for _, tc := range tests {
+		r, found := MatchRule(rules, tc.name)
+		if len(tc.server) == 0 {
+			if found {
+				t.Errorf("%s: unexpected rule %v", tc.name, r)
+			}
+			continue
+		}
+		if !found || !r.Server.Equal(net.ParseIP(tc.server)) {
+			t.Errorf("%s: expected server %s; got %v (found=%v)", tc.name, tc.server, r.Server, found)
+		}
+	}
+}
+
+func TestServerFailure(t *testing.T) {
+	query := []byte{0x12, 0x34, 0x01, 0x20, 0, 1, 0, 0, 0, 0, 0, 0}
+	resp := serverFailure(query)
+	if resp[0] != 0x12 || resp[1] != 0x34 {
+		t.Error("ID is not preserved")
+	}
+	if resp[2]&0x80 == 0 {
+		t.Error("QR bit is not set")
+	}
+	if resp[3]&0x0F != 2 {
+		t.Errorf("expected SERVFAIL; got rcode %d", resp[3]&0x0F)
+	}
+	if serverFailure([]byte{1, 2, 3}) != nil {
+		t.Error("expected nil for malformed query")
+	}
+}
+
+func TestFilter(t *testing.T) {
+	list := `# hosts-file
+0.0.0.0 ads.example.com tracker.example.com
+127.0.0.1 localhost
+! adblock
+||adnetwork.com^
+@@||good.adnetwork.com^
+||example.org/path
+plain-list.net
+`
+	f := NewFilter()
+	cnt, err := f.LoadList(strings.NewReader(list))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cnt != 5 {
+		t.Errorf("expected 5 entries loaded; got %d", cnt)
+	}
+	f.AddAllowed("tracker.example.com")
+	f.AddOverride("intranet.adnetwork.com", net.ParseIP("10.1.1.1"))
+
+	tests := []struct {
+		name   string
+		action FilterAction
+	}{
+		{"ads.example.com.", FilterBlock},
+		{"sub.ads.example.com.", FilterNone}, // hosts-file entries are blocking only the domain itself
+		{"tracker.example.com.", FilterAllow},
+		{"adnetwork.com.", FilterBlock},
+		{"x.y.adnetwork.com.", FilterBlock},
+		{"good.adnetwork.com.", FilterAllow},
+		{"www.good.adnetwork.com.", FilterAllow},
+		{"intranet.adnetwork.com.", FilterOverride},
+		{"example.org.", FilterNone},
+		{"cdn.plain-list.net.", FilterBlock},
+		{"example.com.", FilterNone},
+	}
+	for _, tc := range tests {
+		if action, _ := f.Check(tc.name); action != tc.action {
+			t.Errorf("%s: expected action %d; got %d", tc.name, tc.action, action)
+		}
+	}
+}
+
+func TestBuildResponse(t *testing.T) {
+	q := dnsmessage.Question{Name: dnsmessage.MustNewName("host.example.com."), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}
+	resp := buildResponse(dnsmessage.Header{ID: 0x1234, RecursionDesired: true}, q, dnsmessage.RCodeSuccess, net.ParseIP("10.1.1.1"))
+
+	var msg dnsmessage.Message
+	if err := msg.Unpack(resp); err != nil {
+		t.Fatal(err)
+	}
+	if msg.ID != 0x1234 || !msg.Response || msg.RCode != dnsmessage.RCodeSuccess || len(msg.Answers) != 1 {
+		t.Fatalf("unexpected response: %v", msg.Header)
+	}
+	if a, ok := msg.Answers[0].Body.(*dnsmessage.AResource); !ok || !net.IP(a.A[:]).Equal(net.ParseIP("10.1.1.1")) {
+		t.Errorf("unexpected answer: %v", msg.Answers[0].Body)
+	}
+
+	// no answer when the IP version is not matching the question type
+	q.Type = dnsmessage.TypeAAAA
+	if err := msg.Unpack(buildResponse(dnsmessage.Header{}, q, dnsmessage.RCodeSuccess, net.ParseIP("10.1.1.1"))); err != nil || len(msg.Answers) != 0 {
+		t.Errorf("unexpected AAAA response: %v %v", msg.Answers, err)
+	}
+}
+
+func TestWatchQuery(t *testing.T) {
+	observed, stop := WatchQuery("Probe.Example.com.")
+	defer stop()
+
+	notifyWatchers("other.example.com.", net.ParseIP("10.0.0.1"))
+	notifyWatchers("probe.example.com.", net.ParseIP("10.0.0.2"))
+	notifyWatchers("probe.example.com.", net.ParseIP("10.0.0.3")) // must not block
+
+	select {
+	case o := <-observed:
+		if o.Name != "probe.example.com" || !o.Server.Equal(net.ParseIP("10.0.0.2")) {
+			t.Errorf("unexpected observation: %+v", o)
+		}
+	default:
+		t.Fatal("query not observed")
+	}
+
+	stop()
+	notifyWatchers("probe.example.com.", net.ParseIP("10.0.0.2"))
+	select {
+	case o := <-observed:
+		t.Errorf("unexpected observation after stop: %+v", o)
+	default:
+	}
+}
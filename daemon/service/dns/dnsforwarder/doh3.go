@@ -0,0 +1,127 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package dnsforwarder
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+const dnsMessageContentType = "application/dns-message"
+
+type doh3Upstream struct {
+	tlsConfig *tls.Config
+	transport *http3.Transport
+	client    *http.Client
+	url       string
+}
+
+// NewDoH3Upstream creates the DNS-over-HTTPS transport over HTTP/3 to the server.
+// 'template' - DoH URI template ('https://...'); the port from the template or 443 is in use.
+// The connection is established on the first query.
+func NewDoH3Upstream(server net.IP, template *url.URL) Upstream {
+	port, _ := strconv.Atoi(template.Port())
+	if port <= 0 {
+		port = 443
+	}
+	// RFC 8484 template variables are not in use for POST requests
+	u := *template
+	u.RawQuery, u.Fragment = "", ""
+	u.Path = strings.SplitN(u.Path, "{", 2)[0]
+	u.RawPath = ""
+	if len(u.Path) == 0 {
+		u.Path = "/"
+	}
+
+	// the host name from the template is used only for the TLS verification and the HTTP ':authority':
+	// the connection is established to the known server IP (the host name is never resolved)
+	serverAddr := net.JoinHostPort(server.String(), strconv.Itoa(port))
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS13}
+	transport := &http3.Transport{
+		TLSClientConfig: tlsConfig,
+		Dial: func(ctx context.Context, _ string, tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlyConnection, error) {
+			return quic.DialAddrEarly(ctx, serverAddr, tlsCfg, cfg)
+		},
+	}
+
+	return &doh3Upstream{
+		tlsConfig: tlsConfig,
+		transport: transport,
+		client:    &http.Client{Transport: transport, Timeout: exchangeTimeout},
+		url:       u.String(),
+	}
+}
+
+func (u *doh3Upstream) Close() {
+	u.transport.Close()
+}
+
+// Exchange sends the query as POST request (RFC 8484 4.1)
+func (u *doh3Upstream) Exchange(query []byte) ([]byte, error) {
+	if len(query) < 12 {
+		return nil, fmt.Errorf("bad query")
+	}
+
+	// DoH requests should use the ID = 0 (RFC 8484 4.1)
+	msg := make([]byte, len(query))
+	copy(msg, query)
+	msg[0], msg[1] = 0, 0
+
+	req, err := http.NewRequest(http.MethodPost, u.url, bytes.NewReader(msg))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", dnsMessageContentType)
+	req.Header.Set("Accept", dnsMessageContentType)
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH server responded with status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxMessageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) < 12 || len(body) > maxMessageSize {
+		return nil, fmt.Errorf("bad DoH response")
+	}
+	// restore the ID of the original query
+	body[0], body[1] = query[0], query[1]
+	return body, nil
+}
@@ -0,0 +1,94 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package dnsforwarder
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/quic-go/quic-go"
+)
+
+// DoQPort - default port of the DNS-over-QUIC server (RFC 9250)
+const DoQPort = 853
+
+// DOQ_NO_ERROR (RFC 9250 4.3)
+const doqNoError = 0
+
+type doqUpstream struct {
+	client *quicClient
+}
+
+// NewDoQUpstream creates the DNS-over-QUIC (RFC 9250) transport to the server.
+// 'serverName' - the name to verify the server certificate.
+// The connection is established on the first query.
+func NewDoQUpstream(server net.IP, port int, serverName string) Upstream {
+	if port <= 0 {
+		port = DoQPort
+	}
+	return &doqUpstream{client: newQuicClient(server, port, serverName, "doq")}
+}
+
+func (u *doqUpstream) Close() {
+	u.client.close()
+}
+
+// Exchange sends the query in the new stream of the QUIC connection
+func (u *doqUpstream) Exchange(query []byte) ([]byte, error) {
+	if len(query) < 12 {
+		return nil, fmt.Errorf("bad query")
+	}
+	return u.client.exchange(func(ctx context.Context, conn quic.Connection) ([]byte, error) {
+		stream, err := conn.OpenStreamSync(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer stream.CancelRead(doqNoError)
+		if deadline, ok := ctx.Deadline(); ok {
+			stream.SetDeadline(deadline)
+		}
+
+		// the message ID must be 0 (RFC 9250 4.2.1): the stream identifies the query
+		msg := make([]byte, len(query))
+		copy(msg, query)
+		msg[0], msg[1] = 0, 0
+
+		// the client must indicate the end of the query by STREAM FIN
+		if err := writeTCPMessage(stream, msg); err != nil {
+			return nil, err
+		}
+		stream.Close()
+
+		resp, err := readTCPMessage(stream)
+		if err != nil {
+			return nil, err
+		}
+		if len(resp) < 12 {
+			return nil, newResponseError("bad DoQ response")
+		}
+		// restore the ID of the original query
+		resp[0], resp[1] = query[0], query[1]
+		return resp, nil
+	})
+}
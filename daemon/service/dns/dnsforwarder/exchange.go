@@ -0,0 +1,167 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package dnsforwarder
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	maxMessageSize  = 65535
+	exchangeTimeout = time.Second * 5
+
+	// TTL of the locally generated answers (seconds)
+	localAnswerTTL = 60
+)
+
+// exchange sends the query to the upstream server and returns the response
+func exchange(query []byte, server net.IP, isTCP bool) ([]byte, error) {
+	if len(query) < 2 {
+		return nil, fmt.Errorf("bad query")
+	}
+
+	network := "udp"
+	if isTCP {
+		network = "tcp"
+	}
+	conn, err := net.DialTimeout(network, net.JoinHostPort(server.String(), strconv.Itoa(DnsPort)), exchangeTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(exchangeTimeout))
+
+	if isTCP {
+		if err := writeTCPMessage(conn, query); err != nil {
+			return nil, err
+		}
+		return readTCPMessage(conn)
+	}
+
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		// skip responses which are not related to our query (the ID is not matching)
+		if n >= 2 && buf[0] == query[0] && buf[1] == query[1] {
+			return buf[:n], nil
+		}
+	}
+}
+
+// readTCPMessage reads DNS message prefixed by two-byte length field (RFC1035 4.2.2)
+func readTCPMessage(conn io.Reader) ([]byte, error) {
+	var l [2]byte
+	if _, err := io.ReadFull(conn, l[:]); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(l[:]))
+	if _, err := io.ReadFull(conn, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// writeTCPMessage writes DNS message prefixed by two-byte length field (RFC1035 4.2.2)
+func writeTCPMessage(conn io.Writer, msg []byte) error {
+	if len(msg) > maxMessageSize {
+		return fmt.Errorf("message too long")
+	}
+	buf := make([]byte, 2+len(msg))
+	binary.BigEndian.PutUint16(buf, uint16(len(msg)))
+	copy(buf[2:], msg)
+	_, err := conn.Write(buf)
+	return err
+}
+
+// serverFailure converts the query to the response with SERVFAIL code
+func serverFailure(query []byte) []byte {
+	if len(query) < 12 {
+		return nil
+	}
+	resp := make([]byte, len(query))
+	copy(resp, query)
+	resp[2] |= 0x80                       // QR: response
+	resp[3] = (resp[3] & 0x70) | 0x80 | 2 // RA: recursion available; RCODE: SERVFAIL
+	return resp
+}
+
+// buildResponse creates the response to the query locally (without forwarding it to the upstream server).
+// The 'ip' (if defined) is added to the answer when it is matching the type of the question (A/AAAA).
+func buildResponse(query dnsmessage.Header, q dnsmessage.Question, rcode dnsmessage.RCode, ip net.IP) []byte {
+	hdr := dnsmessage.Header{
+		ID:                 query.ID,
+		Response:           true,
+		OpCode:             query.OpCode,
+		RecursionDesired:   query.RecursionDesired,
+		RecursionAvailable: true,
+		RCode:              rcode,
+	}
+
+	b := dnsmessage.NewBuilder(nil, hdr)
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil
+	}
+	if err := b.Question(q); err != nil {
+		return nil
+	}
+
+	if ip != nil {
+		if err := b.StartAnswers(); err != nil {
+			return nil
+		}
+		rh := dnsmessage.ResourceHeader{Name: q.Name, Class: q.Class, TTL: localAnswerTTL}
+		if ip4 := ip.To4(); ip4 != nil && q.Type == dnsmessage.TypeA {
+			var a dnsmessage.AResource
+			copy(a.A[:], ip4)
+			if err := b.AResource(rh, a); err != nil {
+				return nil
+			}
+		} else if ip4 == nil && q.Type == dnsmessage.TypeAAAA {
+			var aaaa dnsmessage.AAAAResource
+			copy(aaaa.AAAA[:], ip.To16())
+			if err := b.AAAAResource(rh, aaaa); err != nil {
+				return nil
+			}
+		}
+	}
+
+	resp, err := b.Finish()
+	if err != nil {
+		return nil
+	}
+	return resp
+}
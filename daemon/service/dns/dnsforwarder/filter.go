@@ -0,0 +1,201 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package dnsforwarder
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+)
+
+// FilterAction - result of checking the domain name by filter
+type FilterAction int
+
+const (
+	FilterNone     FilterAction = iota // no filtering rules for the domain
+	FilterBlock                        // the domain is blocked
+	FilterAllow                        // the domain is in allowlist (never blocked)
+	FilterOverride                     // the domain is resolved to the predefined IP address
+)
+
+// Filter - the rules of local DNS filtering.
+// Priority: override > allow > block.
+// Not thread-safe for modification: the filter must not be changed after passing it to the forwarder.
+type Filter struct {
+	blockedExact  map[string]struct{} // only the domain itself (hosts-file entries)
+	blockedSuffix map[string]struct{} // the domain and all its subdomains
+	allowed       map[string]struct{} // the domain and all its subdomains
+	overrides     map[string]net.IP   // the domain and all its subdomains
+}
+
+// NewFilter creates empty filter
+func NewFilter() *Filter {
+	return &Filter{
+		blockedExact:  make(map[string]struct{}),
+		blockedSuffix: make(map[string]struct{}),
+		allowed:       make(map[string]struct{}),
+		overrides:     make(map[string]net.IP),
+	}
+}
+
+// BlockedCount returns number of blocked domains
+func (f *Filter) BlockedCount() int {
+	return len(f.blockedExact) + len(f.blockedSuffix)
+}
+
+// AddBlocked adds the domain to the blocklist
+func (f *Filter) AddBlocked(domain string, withSubdomains bool) {
+	domain = NormalizeDomain(domain)
+	if len(domain) == 0 {
+		return
+	}
+	if withSubdomains {
+		f.blockedSuffix[domain] = struct{}{}
+	} else {
+		f.blockedExact[domain] = struct{}{}
+	}
+}
+
+// AddAllowed adds the domain (and all its subdomains) to the allowlist
+func (f *Filter) AddAllowed(domain string) {
+	if domain = NormalizeDomain(domain); len(domain) > 0 {
+		f.allowed[domain] = struct{}{}
+	}
+}
+
+// AddOverride forces the domain (and all its subdomains) to be resolved to the IP address
+func (f *Filter) AddOverride(domain string, ip net.IP) {
+	if domain = NormalizeDomain(domain); len(domain) > 0 && ip != nil {
+		f.overrides[domain] = ip
+	}
+}
+
+// Check returns the filtering action for the domain name
+// (for FilterOverride action the 'ip' contains the address to respond with)
+func (f *Filter) Check(name string) (action FilterAction, ip net.IP) {
+	name = NormalizeDomain(name)
+	if len(name) == 0 {
+		return FilterNone, nil
+	}
+
+	if _, ok := f.blockedExact[name]; ok {
+		action = FilterBlock
+	}
+	// check the name and all its parent domains
+	for d := name; len(d) > 0; d = parentDomain(d) {
+		if ip, ok := f.overrides[d]; ok {
+			return FilterOverride, ip
+		}
+		if _, ok := f.allowed[d]; ok {
+			action = FilterAllow
+		}
+		if _, ok := f.blockedSuffix[d]; ok && action == FilterNone {
+			action = FilterBlock
+		}
+	}
+	return action, nil
+}
+
+func parentDomain(domain string) string {
+	idx := strings.IndexByte(domain, '.')
+	if idx < 0 {
+		return ""
+	}
+	return domain[idx+1:]
+}
+
+// LoadList reads the list of domains. Supported formats (can be mixed):
+//   - hosts-file:    "0.0.0.0 example.com" (only the domain itself is blocked)
+//   - adblock:       "||example.com^" (the domain and its subdomains are blocked); "@@||example.com^" - allowed
+//   - domains list:  "example.com" (the domain and its subdomains are blocked)
+//
+// Comments ('#', '!') and unsupported rules are ignored.
+// Returns number of loaded entries.
+func (f *Filter) LoadList(r io.Reader) (int, error) {
+	cnt := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if idx := strings.IndexByte(line, '#'); idx >= 0 {
+			line = strings.TrimSpace(line[:idx])
+		}
+		if len(line) == 0 || line[0] == '!' || line[0] == '[' {
+			continue
+		}
+
+		// adblock
+		if strings.HasPrefix(line, "||") || strings.HasPrefix(line, "@@||") {
+			isAllow := strings.HasPrefix(line, "@@")
+			rule := strings.TrimPrefix(strings.TrimPrefix(line, "@@"), "||")
+			if !strings.HasSuffix(rule, "^") {
+				continue // only domain rules are supported
+			}
+			domain := strings.TrimSuffix(rule, "^")
+			if !isValidDomain(domain) {
+				continue
+			}
+			if isAllow {
+				f.AddAllowed(domain)
+			} else {
+				f.AddBlocked(domain, true)
+			}
+			cnt++
+			continue
+		}
+
+		fields := strings.Fields(line)
+		switch len(fields) {
+		case 1: // domains list
+			if isValidDomain(fields[0]) {
+				f.AddBlocked(fields[0], true)
+				cnt++
+			}
+		default: // hosts-file
+			if net.ParseIP(fields[0]) == nil {
+				continue
+			}
+			for _, d := range fields[1:] {
+				if d == "localhost" || !isValidDomain(d) {
+					continue
+				}
+				f.AddBlocked(d, false)
+				cnt++
+			}
+		}
+	}
+	return cnt, scanner.Err()
+}
+
+func isValidDomain(domain string) bool {
+	domain = NormalizeDomain(domain)
+	if len(domain) == 0 || len(domain) > 253 || !strings.Contains(domain, ".") || net.ParseIP(domain) != nil {
+		return false
+	}
+	for _, c := range domain {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '.' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,147 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package dnsforwarder
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/quic-go/quic-go"
+)
+
+// Upstream - the transport to the upstream DNS server other than plain DNS (e.g. DNS-over-QUIC)
+type Upstream interface {
+	// Exchange sends the query to the upstream server and returns the response
+	Exchange(query []byte) ([]byte, error)
+	// Close closes the connection to the upstream server
+	Close()
+}
+
+// responseError - the server is reachable but the response is not acceptable
+// (the QUIC connection is still usable)
+type responseError struct {
+	msg string
+}
+
+func (e *responseError) Error() string { return e.msg }
+
+func newResponseError(format string, a ...interface{}) error {
+	return &responseError{msg: fmt.Sprintf(format, a...)}
+}
+
+// quicClient keeps the QUIC connection to the server and re-establishes it when required.
+// The queries are sent in separate streams of the same connection.
+type quicClient struct {
+	addr      string
+	tlsConfig *tls.Config
+
+	mutex sync.Mutex
+	conn  quic.Connection
+}
+
+func newQuicClient(server net.IP, port int, serverName string, alpn string) *quicClient {
+	return &quicClient{
+		addr: net.JoinHostPort(server.String(), strconv.Itoa(port)),
+		tlsConfig: &tls.Config{
+			ServerName: serverName,
+			NextProtos: []string{alpn},
+			MinVersion: tls.VersionTLS13,
+		},
+	}
+}
+
+// exchange calls 'f' for the QUIC connection to the server.
+// If the existing connection is not usable anymore (e.g. closed by the server on idle timeout),
+// the request is repeated once using the new connection.
+func (c *quicClient) exchange(f func(ctx context.Context, conn quic.Connection) ([]byte, error)) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), exchangeTimeout)
+	defer cancel()
+
+	for {
+		conn, isNew, err := c.connection(ctx)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := f(ctx, conn)
+		if err == nil {
+			return resp, nil
+		}
+		var respErr *responseError
+		if errors.As(err, &respErr) {
+			return nil, err
+		}
+		c.drop(conn)
+		if isNew || ctx.Err() != nil {
+			return nil, err
+		}
+	}
+}
+
+// connection returns the current connection to the server or establishes the new one
+func (c *quicClient) connection(ctx context.Context) (conn quic.Connection, isNew bool, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.conn != nil {
+		select {
+		case <-c.conn.Context().Done():
+			// closed by the server or by the idle timeout
+		default:
+			return c.conn, false, nil
+		}
+	}
+
+	// the connection uses its own UDP socket (it is closed together with the connection)
+	conn, err = quic.DialAddr(ctx, c.addr, c.tlsConfig, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	c.conn = conn
+	return conn, true, nil
+}
+
+// drop closes the connection (if it is still the current one); the next request will establish the new connection
+func (c *quicClient) drop(conn quic.Connection) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.conn == conn {
+		c.conn = nil
+	}
+	conn.CloseWithError(0, "")
+}
+
+func (c *quicClient) close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.conn != nil {
+		c.conn.CloseWithError(0, "")
+		c.conn = nil
+	}
+}
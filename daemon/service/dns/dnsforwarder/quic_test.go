@@ -0,0 +1,231 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package dnsforwarder
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// testTLSConfig returns the server TLS configuration with the self-signed certificate for 'dns.test'
+func testTLSConfig(t *testing.T, alpn string) (tlsConfig *tls.Config, roots *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "dns.test"},
+		DNSNames:     []string{"dns.test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots = x509.NewCertPool()
+	roots.AddCert(cert)
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		NextProtos:   []string{alpn},
+		MinVersion:   tls.VersionTLS13,
+	}, roots
+}
+
+// startTestQuicServer starts QUIC server on localhost; 'handle' is called for each stream opened by the client
+func startTestQuicServer(t *testing.T, handle func(s quic.Stream)) (port int, roots *x509.CertPool) {
+	tlsConfig, roots := testTLSConfig(t, "doq")
+	listener, err := quic.ListenAddr("127.0.0.1:0", tlsConfig, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			go func() {
+				for {
+					s, err := conn.AcceptStream(context.Background())
+					if err != nil {
+						return
+					}
+					go handle(s)
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().(*net.UDPAddr).Port, roots
+}
+
+func testQuery(t *testing.T, id uint16) []byte {
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	b.StartQuestions()
+	b.Question(dnsmessage.Question{Name: dnsmessage.MustNewName("example.com."), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET})
+	query, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return query
+}
+
+// testAnswer converts the query to the response; the message ID must be 0 (RFC 9250, RFC 8484)
+func testAnswer(t *testing.T, query []byte) []byte {
+	if len(query) < 12 || query[0] != 0 || query[1] != 0 {
+		t.Errorf("bad query received by server: %v", query)
+		return nil
+	}
+	var p dnsmessage.Parser
+	hdr, err := p.Start(query)
+	if err != nil {
+		t.Error(err)
+		return nil
+	}
+	q, err := p.Question()
+	if err != nil {
+		t.Error(err)
+		return nil
+	}
+	return buildResponse(hdr, q, dnsmessage.RCodeSuccess, net.IPv4(192, 0, 2, 1))
+}
+
+func checkTestAnswer(t *testing.T, resp []byte, id uint16) {
+	var p dnsmessage.Parser
+	hdr, err := p.Start(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.ID != id || !hdr.Response || hdr.RCode != dnsmessage.RCodeSuccess {
+		t.Fatalf("unexpected response header: %v", hdr)
+	}
+	p.SkipAllQuestions()
+	if _, err := p.AnswerHeader(); err != nil {
+		t.Fatal(err)
+	}
+	a, err := p.AResource()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !net.IP(a.A[:]).Equal(net.IPv4(192, 0, 2, 1)) {
+		t.Fatalf("unexpected answer: %v", a)
+	}
+}
+
+func TestDoQUpstream(t *testing.T) {
+	port, roots := startTestQuicServer(t, func(s quic.Stream) {
+		defer s.Close()
+		query, err := readTCPMessage(s)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if resp := testAnswer(t, query); resp != nil {
+			writeTCPMessage(s, resp)
+		}
+	})
+
+	u := NewDoQUpstream(net.IPv4(127, 0, 0, 1), port, "dns.test").(*doqUpstream)
+	u.client.tlsConfig.RootCAs = roots
+	defer u.Close()
+
+	// few queries: the connection is reused
+	for id := uint16(1); id <= 3; id++ {
+		resp, err := u.Exchange(testQuery(t, id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkTestAnswer(t, resp, id)
+	}
+}
+
+func TestDoH3Upstream(t *testing.T) {
+	tlsConfig, roots := testTLSConfig(t, http3.NextProtoH3)
+	udpConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := udpConn.LocalAddr().(*net.UDPAddr).Port
+
+	server := &http3.Server{
+		TLSConfig: tlsConfig,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost || r.Host != "dns.test:"+strconv.Itoa(port) || r.URL.Path != "/dns-query" || len(r.URL.RawQuery) > 0 ||
+				r.Header.Get("Content-Type") != dnsMessageContentType {
+				t.Errorf("unexpected request: %s %s %s %v", r.Method, r.Host, r.URL, r.Header)
+			}
+			body, _ := io.ReadAll(r.Body)
+			resp := testAnswer(t, body)
+			if resp == nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", dnsMessageContentType)
+			w.Write(resp)
+		}),
+	}
+	go server.Serve(udpConn)
+	t.Cleanup(func() {
+		server.Close()
+		udpConn.Close()
+	})
+
+	template, _ := url.Parse("https://dns.test:" + strconv.Itoa(port) + "/dns-query{?dns}")
+	u := NewDoH3Upstream(net.IPv4(127, 0, 0, 1), template).(*doh3Upstream)
+	u.tlsConfig.RootCAs = roots
+	defer u.Close()
+
+	for id := uint16(1); id <= 3; id++ {
+		resp, err := u.Exchange(testQuery(t, id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkTestAnswer(t, resp, id)
+	}
+}
@@ -0,0 +1,145 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package dnsforwarder
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ivpn/desktop-app/daemon/service/dns/querystats"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// maximum number of domains for which the blocked queries are counted
+const maxBlockedDomainsCounted = 1000
+
+// DomainCount - number of queries for the domain
+type DomainCount struct {
+	Domain string
+	Count  uint64
+}
+
+// Stats - the counters of the local resolver
+type Stats struct {
+	Queries    uint64        // total number of processed queries
+	Blocked    uint64        // number of blocked queries
+	TopBlocked []DomainCount // the most blocked domains
+}
+
+var (
+	_statsMutex     sync.Mutex
+	_statsQueries   uint64
+	_statsBlocked   uint64
+	_statsBlockedBy = make(map[string]uint64)
+)
+
+// GetStats returns the counters ('topCount' - max number of elements in Stats.TopBlocked)
+func GetStats(topCount int) Stats {
+	_statsMutex.Lock()
+	defer _statsMutex.Unlock()
+
+	ret := Stats{Queries: _statsQueries, Blocked: _statsBlocked}
+	for d, c := range _statsBlockedBy {
+		ret.TopBlocked = append(ret.TopBlocked, DomainCount{Domain: d, Count: c})
+	}
+	sort.Slice(ret.TopBlocked, func(i, j int) bool {
+		if ret.TopBlocked[i].Count == ret.TopBlocked[j].Count {
+			return ret.TopBlocked[i].Domain < ret.TopBlocked[j].Domain
+		}
+		return ret.TopBlocked[i].Count > ret.TopBlocked[j].Count
+	})
+	if len(ret.TopBlocked) > topCount {
+		ret.TopBlocked = ret.TopBlocked[:topCount]
+	}
+	return ret
+}
+
+// ResetStats resets all counters
+func ResetStats() {
+	_statsMutex.Lock()
+	defer _statsMutex.Unlock()
+	_statsQueries = 0
+	_statsBlocked = 0
+	_statsBlockedBy = make(map[string]uint64)
+}
+
+func statsCountQuery(name string, isBlocked bool) {
+	_statsMutex.Lock()
+	defer _statsMutex.Unlock()
+
+	_statsQueries++
+	if !isBlocked {
+		return
+	}
+	_statsBlocked++
+	name = NormalizeDomain(name)
+	if _, ok := _statsBlockedBy[name]; ok || len(_statsBlockedBy) < maxBlockedDomainsCounted {
+		_statsBlockedBy[name]++
+	}
+}
+
+// queryStatsAdd accounts the query in the query statistics (if enabled)
+// 'upstream' - the server the query was forwarded to (empty - the query was processed locally)
+func queryStatsAdd(q dnsmessage.Question, upstream, result string, duration time.Duration, isFailed bool) {
+	if !querystats.IsEnabled() {
+		return
+	}
+	querystats.Add(querystats.Query{
+		Domain:   NormalizeDomain(q.Name.String()),
+		Type:     strings.TrimPrefix(q.Type.String(), "Type"),
+		Upstream: upstream,
+		Result:   result,
+		Duration: duration,
+		IsFailed: isFailed,
+		IsLocal:  len(upstream) == 0,
+	})
+}
+
+func responseRCode(resp []byte) dnsmessage.RCode {
+	var p dnsmessage.Parser
+	hdr, err := p.Start(resp)
+	if err != nil {
+		return dnsmessage.RCodeFormatError
+	}
+	return hdr.RCode
+}
+
+func rcodeString(rcode dnsmessage.RCode) string {
+	switch rcode {
+	case dnsmessage.RCodeSuccess:
+		return "NOERROR"
+	case dnsmessage.RCodeFormatError:
+		return "FORMERR"
+	case dnsmessage.RCodeServerFailure:
+		return "SERVFAIL"
+	case dnsmessage.RCodeNameError:
+		return "NXDOMAIN"
+	case dnsmessage.RCodeNotImplemented:
+		return "NOTIMP"
+	case dnsmessage.RCodeRefused:
+		return "REFUSED"
+	}
+	return strings.TrimPrefix(rcode.String(), "RCode")
+}
@@ -0,0 +1,78 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package dnsforwarder
+
+import (
+	"net"
+	"sync"
+)
+
+// QueryObservation - information about the watched query processed by the local resolver
+type QueryObservation struct {
+	Name   string // normalized domain name
+	Server net.IP // the upstream DNS server the query was forwarded to
+}
+
+var (
+	_watchMutex sync.Mutex
+	_watchers   = make(map[string]chan QueryObservation)
+)
+
+// WatchQuery registers a watcher for the domain name.
+// The returned channel receives the observation when the local resolver forwards the query for this name.
+// The 'stop' function must be called when the watcher is not required anymore.
+// Note: only one watcher per domain name is supported (the previous watcher for the same name is replaced).
+func WatchQuery(name string) (observed <-chan QueryObservation, stop func()) {
+	name = NormalizeDomain(name)
+	ch := make(chan QueryObservation, 1)
+
+	_watchMutex.Lock()
+	_watchers[name] = ch
+	_watchMutex.Unlock()
+
+	return ch, func() {
+		_watchMutex.Lock()
+		defer _watchMutex.Unlock()
+		if _watchers[name] == ch {
+			delete(_watchers, name)
+		}
+	}
+}
+
+func notifyWatchers(name string, server net.IP) {
+	_watchMutex.Lock()
+	defer _watchMutex.Unlock()
+
+	if len(_watchers) == 0 {
+		return
+	}
+	name = NormalizeDomain(name)
+	ch, ok := _watchers[name]
+	if !ok {
+		return
+	}
+	select {
+	case ch <- QueryObservation{Name: name, Server: server}:
+	default: // already notified
+	}
+}
@@ -0,0 +1,182 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package dns
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ivpn/desktop-app/daemon/service/dns/dnsforwarder"
+)
+
+// DomainOverride - the Domain (and all its subdomains) has to be resolved to the IP address
+type DomainOverride struct {
+	Domain string
+	IP     string
+}
+
+// FilterConfig - configuration of the local DNS filtering (custom AntiTracker lists).
+// The filtering is applied by the local resolver on top of the upstream DNS server.
+type FilterConfig struct {
+	// paths to local files with the blocked domains (hosts-file or adblock-domain format)
+	Blocklists []string `json:",omitempty"`
+	// domains (and all their subdomains) which are never blocked
+	// (resolved by the unfiltered DNS server, if it is defined; see SetUnfilteredDns())
+	Allowlist []string `json:",omitempty"`
+	// domains (and all their subdomains) resolved to the predefined IP addresses
+	Overrides []DomainOverride `json:",omitempty"`
+}
+
+// IsEmpty returns 'true' when there are no filtering rules
+func (c FilterConfig) IsEmpty() bool {
+	return len(c.Blocklists) == 0 && len(c.Allowlist) == 0 && len(c.Overrides) == 0
+}
+
+// FilterStatus - state of the local DNS filtering
+type FilterStatus struct {
+	BlockedDomains int // number of domains loaded from the blocklists
+	IsActive       bool
+	dnsforwarder.Stats
+}
+
+var (
+	filterMutex  sync.Mutex
+	filterConfig FilterConfig
+	filter       *dnsforwarder.Filter // nil - filtering is not defined
+)
+
+func getFilter() *dnsforwarder.Filter {
+	filterMutex.Lock()
+	defer filterMutex.Unlock()
+	return filter
+}
+
+// GetFilterConfig returns the configuration of the local DNS filtering
+func GetFilterConfig() FilterConfig {
+	filterMutex.Lock()
+	defer filterMutex.Unlock()
+	return filterConfig
+}
+
+// GetFilterStatus returns the state and the counters of the local DNS filtering
+// ('topBlockedCount' - max number of the most blocked domains to return)
+func GetFilterStatus(topBlockedCount int) FilterStatus {
+	f := getFilter()
+	if f == nil {
+		return FilterStatus{}
+	}
+	return FilterStatus{
+		BlockedDomains: f.BlockedCount(),
+		IsActive:       IsLocalResolverActive(),
+		Stats:          dnsforwarder.GetStats(topBlockedCount),
+	}
+}
+
+// SetFilterConfig sets the configuration of the local DNS filtering: the blocklists are (re)loaded from the files.
+// If 'ignoreErrors' is true - the blocklists which can not be loaded are skipped (the error is only logged).
+// Returns the normalized configuration.
+// The running local resolver is updated immediately; but if the local resolver has to be started (or stopped)
+// the filtering is applied only on the next DNS change (SetManual/SetDefault).
+func SetFilterConfig(cfg FilterConfig, ignoreErrors bool) (FilterConfig, error) {
+	onError := func(err error) error {
+		if !ignoreErrors {
+			return err
+		}
+		log.Error(err)
+		return nil
+	}
+
+	normalized := FilterConfig{}
+	f := dnsforwarder.NewFilter()
+
+	for _, path := range cfg.Blocklists {
+		if !filepath.IsAbs(path) {
+			if err := onError(fmt.Errorf("blocklist path must be absolute: '%s'", path)); err != nil {
+				return cfg, err
+			}
+			continue
+		}
+		path = filepath.Clean(path)
+		// keep the path in configuration even if the list can not be loaded now (e.g. on daemon start)
+		normalized.Blocklists = append(normalized.Blocklists, path)
+		if cnt, err := loadBlocklist(f, path); err != nil {
+			if err := onError(fmt.Errorf("failed to load blocklist '%s': %w", path, err)); err != nil {
+				return cfg, err
+			}
+		} else {
+			log.Info(fmt.Sprintf("Blocklist '%s' loaded (%d entries)", path, cnt))
+		}
+	}
+
+	for _, d := range cfg.Allowlist {
+		domain := dnsforwarder.NormalizeDomain(d)
+		if len(domain) == 0 || net.ParseIP(domain) != nil {
+			return cfg, fmt.Errorf("bad domain name '%s'", d)
+		}
+		normalized.Allowlist = append(normalized.Allowlist, domain)
+		f.AddAllowed(domain)
+	}
+
+	for _, o := range cfg.Overrides {
+		domain := dnsforwarder.NormalizeDomain(o.Domain)
+		ip := net.ParseIP(o.IP)
+		if len(domain) == 0 || net.ParseIP(domain) != nil {
+			return cfg, fmt.Errorf("bad domain name '%s'", o.Domain)
+		}
+		if ip == nil {
+			return cfg, fmt.Errorf("bad IP address '%s' for domain '%s'", o.IP, o.Domain)
+		}
+		normalized.Overrides = append(normalized.Overrides, DomainOverride{Domain: domain, IP: ip.String()})
+		f.AddOverride(domain, ip)
+	}
+
+	filterMutex.Lock()
+	filterConfig = normalized
+	if normalized.IsEmpty() {
+		filter = nil
+	} else {
+		filter = f
+	}
+	filterMutex.Unlock()
+
+	localResolverUpdate()
+	return normalized, nil
+}
+
+func loadBlocklist(f *dnsforwarder.Filter, path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	if fi, err := file.Stat(); err != nil {
+		return 0, err
+	} else if !fi.Mode().IsRegular() {
+		return 0, fmt.Errorf("not a regular file")
+	}
+	return f.LoadList(file)
+}
@@ -0,0 +1,159 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package dns
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/ivpn/desktop-app/daemon/service/dns/dnsforwarder"
+)
+
+// The zone of the unique domain names resolved during the leak test (when the test zone is not defined by user).
+// The names do not exist: the response is expected to be NXDOMAIN.
+const leakTestDefaultZone = "ivpn.net"
+
+// timeout of the probe query
+const leakTestTimeout = 5 * time.Second
+
+// LeakTestResult - the result of the DNS leak test
+type LeakTestResult struct {
+	// the DNS configuration expected to be in use (IVPN or custom DNS)
+	ExpectedDns DnsSettings
+	// the DNS configuration applied to the OS by the daemon (it can be the local resolver or the dnscrypt-proxy)
+	AppliedDns DnsSettings
+	// DNS servers in use by the OS at the moment
+	SystemDns []net.IP
+	// 'true' when the OS uses the DNS server applied by the daemon
+	IsSystemDnsOk bool
+
+	// the unique domain name resolved during the test
+	ProbeName  string
+	ProbeError string
+	// 'true' when the probe query was processed by the local resolver (it is possible to check only when the local resolver is active)
+	IsProbeObserved bool
+	// the upstream DNS server the probe query was forwarded to by the local resolver
+	ProbeUpstream net.IP
+	// IP addresses returned for the probe name (the test zone can report the egress IP of the resolver which performed the query)
+	ProbeAddresses []net.IP
+
+	IsLeak   bool
+	Problems []string
+}
+
+// RunLeakTest checks that the OS resolves the domain names using the expected DNS configuration.
+// 'expectedDns' - the DNS configuration which is expected to be in use (IVPN or custom DNS)
+// 'testZone' - (optional) the DNS zone to resolve the unique names in; the zone can respond with the IP of the resolver which performed the query
+func RunLeakTest(expectedDns DnsSettings, testZone string) LeakTestResult {
+	ret := LeakTestResult{ExpectedDns: expectedDns, AppliedDns: AppliedSystemDns()}
+
+	problem := func(isLeak bool, format string, a ...interface{}) {
+		ret.Problems = append(ret.Problems, fmt.Sprintf(format, a...))
+		if isLeak {
+			ret.IsLeak = true
+		}
+	}
+
+	// check which DNS servers are in use by the OS
+	if ret.AppliedDns.IsEmpty() {
+		problem(true, "DNS configuration is not applied to the OS")
+	} else if sysDns, err := GetSystemResolvers(); err != nil {
+		problem(false, "Unable to get DNS configuration of the OS: %v", err)
+	} else {
+		ret.SystemDns = sysDns
+		for _, ip := range sysDns {
+			if ip.Equal(ret.AppliedDns.Ip()) {
+				ret.IsSystemDnsOk = true
+				continue
+			}
+			problem(false, "The OS has additional DNS server configured: %s", ip)
+		}
+		if !ret.IsSystemDnsOk {
+			problem(true, "The OS does not use the expected DNS server %s", ret.AppliedDns.InfoString())
+		}
+	}
+
+	// resolve the unique domain name
+	name, err := leakTestProbeName(testZone)
+	if err != nil {
+		problem(false, "Unable to generate probe name: %v", err)
+		return ret
+	}
+	ret.ProbeName = name
+
+	var observed <-chan dnsforwarder.QueryObservation
+	if IsLocalResolverActive() {
+		var stop func()
+		observed, stop = dnsforwarder.WatchQuery(name)
+		defer stop()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), leakTestTimeout)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", name)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+			// NXDOMAIN is expected: the DNS server is reachable; other errors are reported
+			ret.ProbeError = err.Error()
+			problem(false, "Failed to resolve probe name: %v", err)
+		}
+	}
+	ret.ProbeAddresses = ips
+
+	if observed == nil {
+		return ret
+	}
+	select {
+	case o := <-observed:
+		ret.IsProbeObserved = true
+		ret.ProbeUpstream = o.Server
+		// plain DNS, DoQ and DoH3 queries are forwarded by the local resolver directly to the expected server
+		if (expectedDns.Encryption == EncryptionNone || isQuicEncryption(expectedDns.Encryption)) && !o.Server.Equal(expectedDns.Ip()) {
+			problem(true, "The query was forwarded to unexpected DNS server %s (expected %s)", o.Server, expectedDns.Ip())
+		}
+	default:
+		problem(true, "The probe query was not processed by the local resolver")
+	}
+
+	return ret
+}
+
+func leakTestProbeName(testZone string) (string, error) {
+	zone := strings.Trim(strings.TrimSpace(testZone), ".")
+	if len(zone) == 0 {
+		zone = leakTestDefaultZone
+	}
+
+	rnd := make([]byte, 8)
+	if _, err := rand.Read(rnd); err != nil {
+		return "", err
+	}
+	return "ivpn-leaktest-" + hex.EncodeToString(rnd) + "." + zone + ".", nil
+}
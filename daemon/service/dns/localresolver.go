@@ -0,0 +1,160 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package dns
+
+import (
+	"net"
+	"sync"
+
+	"github.com/ivpn/desktop-app/daemon/service/dns/dnscryptproxy"
+	"github.com/ivpn/desktop-app/daemon/service/dns/dnsforwarder"
+	"github.com/ivpn/desktop-app/daemon/service/dns/querystats"
+)
+
+// The local resolver is in use when split DNS rules or local filtering (custom AntiTracker lists) are defined,
+// when the query statistics are enabled, or when the DNS server is DoQ or DoH3 (see quic.go).
+// The OS is configured to use the local resolver and it forwards the queries to the upstream DNS servers.
+
+// local IP address of the resolver
+var localResolverIP = net.IPv4(127, 0, 0, 1)
+
+var (
+	localResolverMutex sync.Mutex
+	// the upstream DNS server of the running local resolver (nil - not running)
+	localResolverUpstream net.IP
+	// the encrypted transport to the upstream server (nil - plain DNS); owned by the running local resolver
+	localResolverTransport dnsforwarder.Upstream
+	// the DNS server for the allowlisted domains (the server which is not blocking anything)
+	unfilteredDns net.IP
+)
+
+// IsLocalResolverActive returns 'true' when the local resolver is running
+func IsLocalResolverActive() bool {
+	return dnsforwarder.IsRunning()
+}
+
+// SetUnfilteredDns sets the DNS server in use for domains from the filtering allowlist
+// (e.g. the default DNS of the VPN server, which is not blocking anything when the AntiTracker is in use).
+// nil - the allowlisted domains are resolved by the current DNS server.
+func SetUnfilteredDns(ip net.IP) {
+	localResolverMutex.Lock()
+	unfilteredDns = ip
+	localResolverMutex.Unlock()
+
+	localResolverUpdate()
+}
+
+// UnfilteredDns returns the DNS server in use for domains from the filtering allowlist (nil - not defined)
+func UnfilteredDns() net.IP {
+	localResolverMutex.Lock()
+	defer localResolverMutex.Unlock()
+	return unfilteredDns
+}
+
+func isLocalResolverRequired() bool {
+	// the query statistics are accounted by the local resolver
+	return len(GetSplitDnsRules()) > 0 || getFilter() != nil || querystats.IsEnabled()
+}
+
+func localResolverConfig(upstream net.IP, transport dnsforwarder.Upstream) dnsforwarder.Config {
+	cfg := dnsforwarder.Config{
+		ListenIP:        localResolverIP,
+		DefaultServer:   upstream,
+		DefaultUpstream: transport,
+		Filter:          getFilter(),
+		AllowServer:     UnfilteredDns(),
+	}
+	for _, r := range GetSplitDnsRules() {
+		cfg.Rules = append(cfg.Rules, dnsforwarder.Rule{Domain: r.Domain, Server: net.ParseIP(r.Server)})
+	}
+	return cfg
+}
+
+// localResolverStart starts the local resolver if it is required (split DNS rules, filtering, query statistics or DoQ/DoH3 server).
+// Returns the DNS configuration which has to be applied to the OS:
+// the local resolver address (it forwards the queries to the 'dnsCfg' server)
+// or the original 'dnsCfg' when the local resolver is not in use.
+// The error is returned only when the local resolver is obligatory (DoQ/DoH3) and it failed to start.
+func localResolverStart(dnsCfg DnsSettings) (cfgToApply DnsSettings, isLocalResolver bool, err error) {
+	isQuic := isQuicEncryption(dnsCfg.Encryption)
+	if dnsCfg.IsEmpty() || (!isLocalResolverRequired() && !isQuic) {
+		localResolverStop()
+		return dnsCfg, false, nil
+	}
+	if dnsCfg.Encryption != EncryptionNone && !isQuic {
+		if len(GetSplitDnsRules()) > 0 || getFilter() != nil {
+			log.Warning("Split DNS rules and local DNS filtering are not applied: not supported for encrypted DNS")
+		}
+		localResolverStop()
+		return dnsCfg, false, nil
+	}
+
+	var transport dnsforwarder.Upstream
+	if isQuic {
+		if transport, err = newQuicUpstream(dnsCfg); err != nil {
+			localResolverStop()
+			return dnsCfg, false, err
+		}
+	}
+
+	// dnscrypt-proxy (if running) is listening on the same address
+	dnscryptproxy.Stop()
+	if err := dnsforwarder.Start(localResolverConfig(dnsCfg.Ip(), transport)); err != nil {
+		localResolverStop()
+		if isQuic {
+			return dnsCfg, false, err
+		}
+		log.Error("Split DNS rules and local DNS filtering are not applied: ", err)
+		return dnsCfg, false, nil
+	}
+
+	localResolverMutex.Lock()
+	localResolverUpstream = dnsCfg.Ip()
+	localResolverTransport = transport
+	localResolverMutex.Unlock()
+
+	return DnsSettings{DnsHost: localResolverIP.String()}, true, nil
+}
+
+// localResolverUpdate updates the configuration of the running local resolver
+func localResolverUpdate() {
+	localResolverMutex.Lock()
+	upstream, transport := localResolverUpstream, localResolverTransport
+	localResolverMutex.Unlock()
+
+	if upstream == nil || !dnsforwarder.IsRunning() || (!isLocalResolverRequired() && transport == nil) {
+		return
+	}
+	if err := dnsforwarder.Start(localResolverConfig(upstream, transport)); err != nil {
+		log.Error("Failed to update local resolver: ", err)
+	}
+}
+
+func localResolverStop() {
+	dnsforwarder.Stop()
+
+	localResolverMutex.Lock()
+	localResolverUpstream = nil
+	localResolverTransport = nil
+	localResolverMutex.Unlock()
+}
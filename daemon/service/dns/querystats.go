@@ -0,0 +1,99 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package dns
+
+import (
+	"sync"
+
+	"github.com/ivpn/desktop-app/daemon/service/dns/dnscryptproxy"
+	"github.com/ivpn/desktop-app/daemon/service/dns/querystats"
+)
+
+// The query statistics are collected from the local DNS services:
+// the local resolver (plain DNS; it is in use for all queries when the statistics are enabled)
+// and the dnscrypt-proxy query log (encrypted DNS; not supported on all platforms).
+
+var (
+	dnscryptProxyUpstreamMutex sync.Mutex
+	// the address of the DNS server in use by dnscrypt-proxy
+	dnscryptProxyUpstream string
+)
+
+func setDnscryptProxyUpstream(upstream string) {
+	dnscryptProxyUpstreamMutex.Lock()
+	defer dnscryptProxyUpstreamMutex.Unlock()
+	dnscryptProxyUpstream = upstream
+}
+
+// IsQueryStatsSupportedForEncryptedDns returns 'true' when the queries to encrypted DNS can be accounted
+func IsQueryStatsSupportedForEncryptedDns() bool {
+	return dnscryptproxy.IsQueryLogSupported()
+}
+
+// SetQueryStatsConfig applies the query statistics configuration. Returns the normalized configuration.
+// Note: the DNS configuration has to be re-applied to start/stop the local services accounting the queries.
+func SetQueryStatsConfig(cfg querystats.Config) querystats.Config {
+	ret := querystats.SetConfig(cfg)
+	if ret.Enabled {
+		dnscryptproxy.SetQueryLogHandler(onDnscryptProxyQuery)
+	} else {
+		dnscryptproxy.SetQueryLogHandler(nil)
+	}
+	return ret
+}
+
+// GetQueryStatsConfig returns the query statistics configuration
+func GetQueryStatsConfig() querystats.Config {
+	return querystats.GetConfig()
+}
+
+// GetQueryStats returns the query statistics
+func GetQueryStats() querystats.Stats {
+	return querystats.Get()
+}
+
+// ResetQueryStats erases the collected query statistics
+func ResetQueryStats() {
+	querystats.Reset()
+}
+
+func onDnscryptProxyQuery(e dnscryptproxy.QueryLogEntry) {
+	q := querystats.Query{
+		Time:     e.Time,
+		Domain:   e.Name,
+		Type:     e.Type,
+		Result:   e.Return,
+		Duration: e.Duration,
+		IsFailed: e.IsFailed(),
+		IsLocal:  e.IsCached || len(e.Server) == 0,
+	}
+	if q.Result == "PASS" {
+		q.Result = "NOERROR"
+	}
+	if !q.IsLocal {
+		dnscryptProxyUpstreamMutex.Lock()
+		q.Upstream = dnscryptProxyUpstream
+		dnscryptProxyUpstreamMutex.Unlock()
+	}
+	querystats.Add(q)
+}
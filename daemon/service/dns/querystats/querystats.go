@@ -0,0 +1,263 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+// Package querystats implements the optional (disabled by default) accounting of DNS queries
+// processed by the local DNS services (the local resolver and dnscrypt-proxy).
+// All data is kept in memory only: it is never saved to disk or written to the log.
+package querystats
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// max number of recent queries to keep in memory
+	MaxRecentQueries = 1000
+	// number of the latest latency samples per upstream used to calculate the percentiles
+	latencySamplesCount = 1000
+	// max number of upstream servers accounted (the upstreams are the DNS servers, the number is expected to be small)
+	maxUpstreamsCount = 64
+)
+
+// Config - the query statistics configuration
+type Config struct {
+	Enabled bool
+	// the number of recent queries to keep in memory (0 - recent queries are not kept)
+	RecentQueriesCount int `json:",omitempty"`
+}
+
+// Query - information about the processed DNS query
+type Query struct {
+	Time     time.Time
+	Domain   string
+	Type     string // e.g. "A", "AAAA"
+	Upstream string // the upstream DNS server (empty when the query was not forwarded: blocked or cached)
+	Result   string // e.g. "NOERROR", "NXDOMAIN", "SERVFAIL", "BLOCKED", "TIMEOUT"
+	Duration time.Duration
+	IsFailed bool
+	// the query was processed without forwarding it to upstream (blocked or overridden by local filtering, or cached)
+	IsLocal bool
+}
+
+// UpstreamStats - the counters of the upstream DNS server
+type UpstreamStats struct {
+	Upstream   string
+	Queries    uint64
+	Failures   uint64
+	LatencyP50 time.Duration
+	LatencyP90 time.Duration
+	LatencyP99 time.Duration
+}
+
+// Stats - the query statistics
+type Stats struct {
+	IsEnabled bool
+	// the time when the accounting started (enabled or reset)
+	Since    time.Time
+	Queries  uint64
+	Failures uint64
+	// number of queries processed locally (blocked, overridden or cached)
+	Local         uint64
+	Upstreams     []UpstreamStats
+	RecentQueries []Query // the latest query is the first
+}
+
+type upstreamCounters struct {
+	queries   uint64
+	failures  uint64
+	latencies []time.Duration // ring of the latest samples
+	next      int
+}
+
+var (
+	_enabled int32 // atomic: 1 - enabled
+
+	_mutex     sync.Mutex
+	_config    Config
+	_since     time.Time
+	_queries   uint64
+	_failures  uint64
+	_local     uint64
+	_upstreams map[string]*upstreamCounters
+	_recent    []Query // ring
+	_recentPos int
+)
+
+// IsEnabled returns 'true' when the queries accounting is enabled
+func IsEnabled() bool {
+	return atomic.LoadInt32(&_enabled) == 1
+}
+
+// GetConfig returns the current configuration
+func GetConfig() Config {
+	_mutex.Lock()
+	defer _mutex.Unlock()
+	return _config
+}
+
+// SetConfig applies the configuration. Returns the normalized configuration.
+// All collected data is erased when the accounting is disabled or the size of the recent queries list is changed.
+func SetConfig(cfg Config) Config {
+	if cfg.RecentQueriesCount < 0 || !cfg.Enabled {
+		cfg.RecentQueriesCount = 0
+	}
+	if cfg.RecentQueriesCount > MaxRecentQueries {
+		cfg.RecentQueriesCount = MaxRecentQueries
+	}
+
+	_mutex.Lock()
+	defer _mutex.Unlock()
+
+	if !cfg.Enabled {
+		atomic.StoreInt32(&_enabled, 0)
+		_config = cfg
+		resetUnsafe()
+		return cfg
+	}
+
+	if !_config.Enabled {
+		resetUnsafe()
+	} else if _config.RecentQueriesCount != cfg.RecentQueriesCount {
+		_recent, _recentPos = nil, 0
+	}
+	_config = cfg
+	atomic.StoreInt32(&_enabled, 1)
+	return cfg
+}
+
+// Reset erases all collected data
+func Reset() {
+	_mutex.Lock()
+	defer _mutex.Unlock()
+	resetUnsafe()
+}
+
+func resetUnsafe() {
+	_since = time.Now()
+	_queries, _failures, _local = 0, 0, 0
+	_upstreams = make(map[string]*upstreamCounters)
+	_recent, _recentPos = nil, 0
+}
+
+// Add accounts the processed query (ignored when the accounting is disabled)
+func Add(q Query) {
+	if !IsEnabled() {
+		return
+	}
+	if q.Time.IsZero() {
+		q.Time = time.Now()
+	}
+
+	_mutex.Lock()
+	defer _mutex.Unlock()
+
+	if _config.RecentQueriesCount > 0 {
+		if len(_recent) < _config.RecentQueriesCount {
+			_recent = append(_recent, q)
+		} else {
+			_recent[_recentPos] = q
+		}
+		_recentPos = (_recentPos + 1) % _config.RecentQueriesCount
+	}
+
+	_queries++
+	if q.IsFailed {
+		_failures++
+	}
+	if q.IsLocal || len(q.Upstream) == 0 {
+		_local++
+		return
+	}
+
+	u, ok := _upstreams[q.Upstream]
+	if !ok {
+		if len(_upstreams) >= maxUpstreamsCount {
+			return
+		}
+		u = &upstreamCounters{}
+		_upstreams[q.Upstream] = u
+	}
+	u.queries++
+	if q.IsFailed {
+		u.failures++
+		return
+	}
+	if len(u.latencies) < latencySamplesCount {
+		u.latencies = append(u.latencies, q.Duration)
+	} else {
+		u.latencies[u.next] = q.Duration
+	}
+	u.next = (u.next + 1) % latencySamplesCount
+}
+
+// Get returns the statistics
+func Get() Stats {
+	_mutex.Lock()
+	defer _mutex.Unlock()
+
+	ret := Stats{
+		IsEnabled: _config.Enabled,
+		Since:     _since,
+		Queries:   _queries,
+		Failures:  _failures,
+		Local:     _local,
+	}
+	if !ret.IsEnabled {
+		return ret
+	}
+
+	for name, u := range _upstreams {
+		us := UpstreamStats{Upstream: name, Queries: u.queries, Failures: u.failures}
+		us.LatencyP50, us.LatencyP90, us.LatencyP99 = percentiles(u.latencies)
+		ret.Upstreams = append(ret.Upstreams, us)
+	}
+	sort.Slice(ret.Upstreams, func(i, j int) bool {
+		return ret.Upstreams[i].Queries > ret.Upstreams[j].Queries
+	})
+
+	// the latest query first
+	for i := 1; i <= len(_recent); i++ {
+		ret.RecentQueries = append(ret.RecentQueries, _recent[(_recentPos-i+len(_recent))%len(_recent)])
+	}
+	return ret
+}
+
+func percentiles(samples []time.Duration) (p50, p90, p99 time.Duration) {
+	if len(samples) == 0 {
+		return 0, 0, 0
+	}
+	sorted := make([]time.Duration, len(samples))
+	copy(sorted, samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	p := func(percent int) time.Duration {
+		idx := (len(sorted)*percent + 99) / 100 // nearest-rank
+		if idx < 1 {
+			idx = 1
+		}
+		return sorted[idx-1]
+	}
+	return p(50), p(90), p(99)
+}
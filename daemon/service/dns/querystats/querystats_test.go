@@ -0,0 +1,74 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package querystats
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDisabledByDefault(t *testing.T) {
+	SetConfig(Config{})
+	Add(Query{Domain: "example.com", Upstream: "10.0.254.1"})
+	if s := Get(); s.IsEnabled || s.Queries != 0 || len(s.Upstreams) != 0 {
+		t.Errorf("unexpected stats when disabled: %+v", s)
+	}
+}
+
+func TestStats(t *testing.T) {
+	defer SetConfig(Config{})
+	if cfg := SetConfig(Config{Enabled: true, RecentQueriesCount: 3}); cfg.RecentQueriesCount != 3 {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+
+	for i := 1; i <= 100; i++ {
+		Add(Query{Domain: fmt.Sprintf("d%d.example.com", i), Upstream: "10.0.254.1", Duration: time.Duration(i) * time.Millisecond})
+	}
+	Add(Query{Domain: "failed.example.com", Upstream: "10.0.254.2", IsFailed: true, Result: "TIMEOUT"})
+	Add(Query{Domain: "blocked.example.com", IsLocal: true, Result: "BLOCKED"})
+
+	s := Get()
+	if s.Queries != 102 || s.Failures != 1 || s.Local != 1 {
+		t.Errorf("unexpected counters: %+v", s)
+	}
+	if len(s.Upstreams) != 2 {
+		t.Fatalf("unexpected upstreams: %+v", s.Upstreams)
+	}
+	u := s.Upstreams[0]
+	if u.Upstream != "10.0.254.1" || u.Queries != 100 || u.LatencyP50 != 50*time.Millisecond || u.LatencyP90 != 90*time.Millisecond || u.LatencyP99 != 99*time.Millisecond {
+		t.Errorf("unexpected upstream stats: %+v", u)
+	}
+	if u := s.Upstreams[1]; u.Queries != 1 || u.Failures != 1 || u.LatencyP50 != 0 {
+		t.Errorf("unexpected upstream stats: %+v", u)
+	}
+
+	if len(s.RecentQueries) != 3 || s.RecentQueries[0].Domain != "blocked.example.com" || s.RecentQueries[2].Domain != "d100.example.com" {
+		t.Errorf("unexpected recent queries: %+v", s.RecentQueries)
+	}
+
+	Reset()
+	if s := Get(); !s.IsEnabled || s.Queries != 0 || len(s.RecentQueries) != 0 {
+		t.Errorf("unexpected stats after reset: %+v", s)
+	}
+}
@@ -0,0 +1,85 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package dns
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/ivpn/desktop-app/daemon/service/dns/dnsforwarder"
+)
+
+// DNS-over-QUIC and DoH over HTTP/3 are not supported by the OS or dnscrypt-proxy.
+// They are implemented by the local resolver of the daemon: the OS is configured to use the local resolver
+// and it forwards the queries to the encrypted DNS server.
+
+// IsQuicSupported returns 'true' if DNS-over-QUIC and DoH over HTTP/3 can be used
+func IsQuicSupported() bool {
+	// the local resolver is available on all platforms
+	return true
+}
+
+// isQuicEncryption returns 'true' for the encryption types processed by the local resolver
+func isQuicEncryption(e DnsEncryption) bool {
+	return e == EncryptionDnsOverQuic || e == EncryptionDnsOverHttp3
+}
+
+// newQuicUpstream creates the transport of the local resolver to the DoQ or DoH3 server
+func newQuicUpstream(dnsCfg DnsSettings) (dnsforwarder.Upstream, error) {
+	ip := dnsCfg.Ip()
+	if ip == nil {
+		return nil, fmt.Errorf("bad DNS server address")
+	}
+	u, err := dnsCfg.templateURL()
+	if err != nil {
+		return nil, err
+	}
+
+	switch dnsCfg.Encryption {
+	case EncryptionDnsOverQuic:
+		port, _ := strconv.Atoi(u.Port())
+		return dnsforwarder.NewDoQUpstream(ip, port, u.Hostname()), nil
+	case EncryptionDnsOverHttp3:
+		return dnsforwarder.NewDoH3Upstream(ip, u), nil
+	}
+	return nil, fmt.Errorf("unsupported DNS encryption type")
+}
+
+// checkUpstreamQuic sends the health check query to the DoQ or DoH3 server
+func checkUpstreamQuic(cfg DnsSettings) error {
+	upstream, err := newQuicUpstream(cfg)
+	if err != nil {
+		return err
+	}
+	defer upstream.Close()
+
+	query, _, err := healthCheckQuery()
+	if err != nil {
+		return err
+	}
+	resp, err := upstream.Exchange(query)
+	if err != nil {
+		return err
+	}
+	return checkHealthCheckResponse(resp)
+}
@@ -0,0 +1,53 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package dns
+
+import "testing"
+
+func TestValidateTemplate(t *testing.T) {
+	tests := []struct {
+		enc      DnsEncryption
+		template string
+		isOk     bool
+	}{
+		{EncryptionDnsOverHttps, "https://cloudflare-dns.com/dns-query", true},
+		{EncryptionDnsOverHttp3, "https://cloudflare-dns.com/dns-query{?dns}", true},
+		{EncryptionDnsOverHttp3, "quic://cloudflare-dns.com", false},
+		{EncryptionDnsOverQuic, "quic://dns.adguard-dns.com", true},
+		{EncryptionDnsOverQuic, " quic://dns.adguard-dns.com:784 ", true},
+		{EncryptionDnsOverQuic, "https://dns.adguard-dns.com", false},
+		{EncryptionDnsOverQuic, "dns.adguard-dns.com", false},
+		{EncryptionDnsOverQuic, "quic://", false},
+		{EncryptionDnsOverQuic, "", false},
+		// the template is not validated for other encryption types
+		{EncryptionDnsOverTls, "dns.quad9.net", true},
+		{EncryptionNone, "", true},
+	}
+
+	for _, tc := range tests {
+		err := DnsSettings{DnsHost: "1.1.1.1", Encryption: tc.enc, DohTemplate: tc.template}.ValidateTemplate()
+		if (err == nil) != tc.isOk {
+			t.Errorf("%d '%s': unexpected result: %v", tc.enc, tc.template, err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package dns
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/ivpn/desktop-app/daemon/service/dns/dnsforwarder"
+)
+
+// DomainRule - split DNS rule: the Domain (and all its subdomains) have to be resolved by the Server
+type DomainRule struct {
+	Domain string // e.g. "corp.example.com"
+	Server string // DNS server IP address
+}
+
+// Validate checks the rule and returns it in normalized form
+func (r DomainRule) Validate() (DomainRule, error) {
+	domain := dnsforwarder.NormalizeDomain(r.Domain)
+	if len(domain) == 0 || len(domain) > 253 || net.ParseIP(domain) != nil {
+		return r, fmt.Errorf("bad domain name '%s'", r.Domain)
+	}
+	ip := net.ParseIP(r.Server)
+	if ip == nil || ip.IsUnspecified() || ip.IsLoopback() {
+		return r, fmt.Errorf("bad DNS server address '%s' for domain '%s'", r.Server, r.Domain)
+	}
+	return DomainRule{Domain: domain, Server: ip.String()}, nil
+}
+
+var (
+	splitDnsMutex sync.Mutex
+	splitDnsRules []DomainRule
+)
+
+// SetSplitDnsRules sets the split DNS rules (the rules are validated first).
+// The running local resolver is updated immediately; but if the local resolver has to be started (or stopped)
+// the rules are applied only on the next DNS change (SetManual/SetDefault).
+// Note: the rules are not applied when the encrypted DNS (DoH/DoT) is in use.
+func SetSplitDnsRules(rules []DomainRule) ([]DomainRule, error) {
+	normalized := make([]DomainRule, 0, len(rules))
+	domains := make(map[string]struct{}, len(rules))
+	for _, r := range rules {
+		nr, err := r.Validate()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := domains[nr.Domain]; ok {
+			return nil, fmt.Errorf("duplicate rule for domain '%s'", nr.Domain)
+		}
+		domains[nr.Domain] = struct{}{}
+		normalized = append(normalized, nr)
+	}
+
+	splitDnsMutex.Lock()
+	splitDnsRules = normalized
+	splitDnsMutex.Unlock()
+
+	localResolverUpdate()
+	return normalized, nil
+}
+
+// GetSplitDnsRules returns the split DNS rules
+func GetSplitDnsRules() []DomainRule {
+	splitDnsMutex.Lock()
+	defer splitDnsMutex.Unlock()
+	return append([]DomainRule{}, splitDnsRules...)
+}
@@ -0,0 +1,128 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package dns
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/ivpn/desktop-app/daemon/service/dns/dnscryptproxy"
+	"github.com/ivpn/desktop-app/daemon/service/platform"
+)
+
+// IsDnsStampsSupported returns 'true' if DNS server can be defined by DNS stamp (dnscrypt-proxy is available)
+func IsDnsStampsSupported() bool {
+	binPath, configPathTemplate, _, _ := platform.DnsCryptProxyInfo()
+	return len(binPath) > 0 && len(configPathTemplate) > 0
+}
+
+// DnsSettingsCreateFromStamp creates DnsSettings object for the DNS server defined by the DNS stamp ('sdns://...').
+// Supported server stamps: DNSCrypt, DoH and ODoH target.
+// 'relayStamp' (optional) - stamp of the relay: DNSCrypt relay (Anonymized DNSCrypt) or ODoH relay (required for ODoH target).
+// The DnsHost of the result is the IP address of the first hop (the server or the relay), so it must be defined in the stamp.
+func DnsSettingsCreateFromStamp(stamp, relayStamp string) (DnsSettings, error) {
+	stamp = strings.TrimSpace(stamp)
+	relayStamp = strings.TrimSpace(relayStamp)
+
+	server, relay, err := parseStamps(stamp, relayStamp)
+	if err != nil {
+		return DnsSettings{}, err
+	}
+
+	firstHop := server
+	if relay != nil {
+		firstHop = *relay
+	}
+	ip := stampAddressIP(firstHop.ServerAddrStr)
+	if ip == nil {
+		return DnsSettings{}, fmt.Errorf("the IP address of the %s is not defined in the stamp", firstHop.Proto.String())
+	}
+
+	return DnsSettings{
+		DnsHost:    ip.String(),
+		Encryption: EncryptionDnsStamp,
+		Stamp:      stamp,
+		RelayStamp: relayStamp,
+	}, nil
+}
+
+// parseStamps validates the server and relay stamps and checks their compatibility
+func parseStamps(stamp, relayStamp string) (server dnscryptproxy.ServerStamp, relay *dnscryptproxy.ServerStamp, err error) {
+	if len(stamp) == 0 {
+		return server, nil, fmt.Errorf("DNS stamp is not defined")
+	}
+	server, err = dnscryptproxy.NewServerStampFromString(stamp)
+	if err != nil {
+		return server, nil, fmt.Errorf("bad DNS stamp: %w", err)
+	}
+
+	switch server.Proto {
+	case dnscryptproxy.StampProtoTypeDNSCrypt, dnscryptproxy.StampProtoTypeDoH, dnscryptproxy.StampProtoTypeODoHTarget:
+	default:
+		return server, nil, fmt.Errorf("unsupported DNS stamp type: %s (expected DNSCrypt, DoH or ODoH target)", server.Proto.String())
+	}
+
+	if len(relayStamp) == 0 {
+		if server.Proto == dnscryptproxy.StampProtoTypeODoHTarget {
+			return server, nil, fmt.Errorf("ODoH target requires ODoH relay")
+		}
+		return server, nil, nil
+	}
+
+	r, err := dnscryptproxy.NewServerStampFromString(relayStamp)
+	if err != nil {
+		return server, nil, fmt.Errorf("bad relay DNS stamp: %w", err)
+	}
+	switch {
+	case server.Proto == dnscryptproxy.StampProtoTypeDNSCrypt && r.Proto == dnscryptproxy.StampProtoTypeDNSCryptRelay:
+	case server.Proto == dnscryptproxy.StampProtoTypeODoHTarget && r.Proto == dnscryptproxy.StampProtoTypeODoHRelay:
+	default:
+		return server, nil, fmt.Errorf("relay type '%s' is not applicable for '%s' server", r.Proto.String(), server.Proto.String())
+	}
+	return server, &r, nil
+}
+
+// stampAddressIP returns IP address from the stamp address string ("IP", "IP:port" or "[IPv6]:port")
+func stampAddressIP(addr string) net.IP {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	return net.ParseIP(strings.Trim(addr, "[]"))
+}
+
+// stampInfoString returns the short description of the DNS stamp configuration
+func (d DnsSettings) stampInfoString() string {
+	server, relay, err := parseStamps(d.Stamp, d.RelayStamp)
+	if err != nil {
+		return "bad DNS stamp"
+	}
+	info := server.Proto.String()
+	if len(server.ProviderName) > 0 && server.Proto != dnscryptproxy.StampProtoTypeDNSCrypt {
+		info += " " + server.ProviderName
+	}
+	if relay != nil {
+		info += " via relay " + strings.TrimSpace(relay.ServerAddrStr)
+	}
+	return info
+}
@@ -0,0 +1,114 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package dns
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ivpn/desktop-app/daemon/service/dns/dnscryptproxy"
+)
+
+func testStamp(t *testing.T, s dnscryptproxy.ServerStamp) string {
+	str := s.String()
+	if _, err := dnscryptproxy.NewServerStampFromString(str); err != nil {
+		t.Fatalf("failed to create test stamp %s: %v", s.Proto.String(), err)
+	}
+	return str
+}
+
+func TestDnsSettingsCreateFromStamp(t *testing.T) {
+	dnscrypt, err := dnscryptproxy.NewDNSCryptServerStampFromLegacy("1.2.3.4", strings.Repeat("ab", 32), "2.dnscrypt-cert.example.com", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dnscryptStamp := testStamp(t, dnscrypt)
+	dnscryptRelay := testStamp(t, dnscryptproxy.ServerStamp{Proto: dnscryptproxy.StampProtoTypeDNSCryptRelay, ServerAddrStr: "5.6.7.8:8443"})
+	odohTarget := testStamp(t, dnscryptproxy.ServerStamp{Proto: dnscryptproxy.StampProtoTypeODoHTarget, ProviderName: "odoh.example.com", Path: "/dns-query"})
+	odohRelay := testStamp(t, dnscryptproxy.ServerStamp{Proto: dnscryptproxy.StampProtoTypeODoHRelay, ServerAddrStr: "9.8.7.6", ProviderName: "relay.example.com", Path: "/proxy"})
+
+	tests := []struct {
+		stamp, relay string
+		host         string // empty - error expected
+	}{
+		{dnscryptStamp, "", "1.2.3.4"},
+		{dnscryptStamp, dnscryptRelay, "5.6.7.8"},
+		{odohTarget, odohRelay, "9.8.7.6"},
+		{odohTarget, "", ""},            // ODoH target requires relay
+		{odohTarget, dnscryptRelay, ""}, // relay type mismatch
+		{dnscryptStamp, odohRelay, ""},  // relay type mismatch
+		{dnscryptRelay, "", ""},         // relay is not a server
+		{"sdns://bad", "", ""},
+		{"", "", ""},
+	}
+
+	for i, tc := range tests {
+		cfg, err := DnsSettingsCreateFromStamp(tc.stamp, tc.relay)
+		if len(tc.host) == 0 {
+			if err == nil {
+				t.Errorf("%d: error expected", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: unexpected error: %v", i, err)
+			continue
+		}
+		if cfg.DnsHost != tc.host || cfg.Encryption != EncryptionDnsStamp || cfg.IsEmpty() {
+			t.Errorf("%d: unexpected result: %+v", i, cfg)
+		}
+	}
+
+	// dnscrypt-proxy configuration for ODoH with relay
+	out := filepath.Join(t.TempDir(), "dnscrypt-proxy.toml")
+	if err := dnscryptproxy.SaveConfigFile(odohTarget, odohRelay, false, "../../References/Linux/etc/dnscrypt-proxy-template.toml", out); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"stamp = '" + odohTarget + "'", "via=['" + odohRelay + "']", "odoh_servers = true"} {
+		if !strings.Contains(string(data), expected) {
+			t.Errorf("configuration does not contain: %s", expected)
+		}
+	}
+
+	// query log (to the standard output, processed in memory)
+	if !dnscryptproxy.IsQueryLogSupported() {
+		return
+	}
+	if err := dnscryptproxy.SaveConfigFile(odohTarget, odohRelay, true, "../../References/Linux/etc/dnscrypt-proxy-template.toml", out); err != nil {
+		t.Fatal(err)
+	}
+	if data, err = ioutil.ReadFile(out); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"\nfile = '/dev/stdout'", "\nformat = 'ltsv'\n\n\n  ## Do not log these query types"} {
+		if !strings.Contains(string(data), expected) {
+			t.Errorf("configuration does not contain: %q", expected)
+		}
+	}
+}
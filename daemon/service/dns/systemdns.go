@@ -0,0 +1,85 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package dns
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+)
+
+// AppliedSystemDns returns the DNS configuration applied to the OS by the last SetManual/SetDefault call
+// (it can be the local resolver or the dnscrypt-proxy address; empty - the default OS configuration in use)
+func AppliedSystemDns() DnsSettings {
+	return lastSystemDNS
+}
+
+// GetSystemResolvers returns the list of DNS servers currently in use by the OS
+// (it is the real OS state, which can differ from the configuration applied by the daemon)
+func GetSystemResolvers() ([]net.IP, error) {
+	ret, err := implGetSystemResolvers()
+	return ret, wrapErrorIfFailed(err)
+}
+
+// parseResolvConf returns the 'nameserver' entries of the resolv.conf formatted data
+func parseResolvConf(r io.Reader) []net.IP {
+	var ret []net.IP
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "nameserver" {
+			continue
+		}
+		if ip := net.ParseIP(fields[1]); ip != nil {
+			ret = appendUniqueIP(ret, ip)
+		}
+	}
+	return ret
+}
+
+// parseIPsFromText returns all IP addresses found in the text (e.g. output of the OS utilities)
+func parseIPsFromText(text string) []net.IP {
+	var ret []net.IP
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == ','
+	}) {
+		// ignore the interface zone ("fe80::1%eth0") or the server name ("1.1.1.1#cloudflare-dns.com")
+		if i := strings.IndexAny(word, "%#"); i > 0 {
+			word = word[:i]
+		}
+		if ip := net.ParseIP(word); ip != nil {
+			ret = appendUniqueIP(ret, ip)
+		}
+	}
+	return ret
+}
+
+func appendUniqueIP(ips []net.IP, ip net.IP) []net.IP {
+	for _, i := range ips {
+		if i.Equal(ip) {
+			return ips
+		}
+	}
+	return append(ips, ip)
+}
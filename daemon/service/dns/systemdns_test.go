@@ -0,0 +1,58 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package dns
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func ipsToString(ips []net.IP) string {
+	var s []string
+	for _, ip := range ips {
+		s = append(s, ip.String())
+	}
+	return strings.Join(s, " ")
+}
+
+func TestParseResolvConf(t *testing.T) {
+	conf := `# Generated by IVPN
+search example.com
+nameserver 10.0.254.1
+ nameserver   10.0.254.1
+nameserver fd00::1
+nameserver bad-address
+options edns0`
+	if got := ipsToString(parseResolvConf(strings.NewReader(conf))); got != "10.0.254.1 fd00::1" {
+		t.Errorf("unexpected nameservers: '%s'", got)
+	}
+}
+
+func TestParseIPsFromText(t *testing.T) {
+	// 'resolvectl dns' output
+	text := "Global: 1.1.1.1#cloudflare-dns.com\nLink 2 (eth0): 192.168.1.1 fe80::1%eth0\nLink 3 (wgivpn): 10.0.254.1\n"
+	if got := ipsToString(parseIPsFromText(text)); got != "1.1.1.1 192.168.1.1 fe80::1 10.0.254.1" {
+		t.Errorf("unexpected IPs: '%s'", got)
+	}
+}
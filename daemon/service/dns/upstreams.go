@@ -0,0 +1,257 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package dns
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// The manual DNS configuration can define the ordered list of DNS servers: the DnsSettings object itself (primary server)
+// and the DnsSettings.Fallbacks. Only one server (the active one) is applied to the OS.
+// The health of the active server is checked periodically: when it stops responding, the first healthy server
+// from the list is activated. When a server with the higher priority becomes healthy again, it is activated back.
+
+const (
+	// max number of servers in the manual DNS configuration (including the primary server)
+	MaxDnsServers = 8
+	// interval between health checks of the active DNS server
+	upstreamCheckInterval = 20 * time.Second
+	// number of failed health checks in a row to consider the active server unavailable
+	upstreamFailuresToSwitch = 2
+)
+
+// FuncActiveDnsChanged - the function is called when the active DNS server is changed by the failover
+type FuncActiveDnsChanged func(active DnsSettings)
+
+type upstreamsState struct {
+	servers          []DnsSettings // ordered list of servers (without fallbacks)
+	activeIdx        int
+	localInterfaceIP net.IP
+	stop             chan struct{}
+}
+
+var (
+	// protects the manual DNS configuration changes (serializes the requests and the failover)
+	manualDnsMutex sync.Mutex
+
+	upstreams            upstreamsState
+	funcActiveDnsChanged FuncActiveDnsChanged
+)
+
+// SetActiveDnsChangedHandler sets the function to be called when the active DNS server is changed by the failover
+func SetActiveDnsChangedHandler(f FuncActiveDnsChanged) {
+	manualDnsMutex.Lock()
+	defer manualDnsMutex.Unlock()
+	funcActiveDnsChanged = f
+}
+
+// Servers returns the ordered list of DNS servers defined by the configuration:
+// the primary server followed by the fallback servers (the Fallbacks of the returned elements are empty)
+func (d DnsSettings) Servers() []DnsSettings {
+	if d.IsEmpty() {
+		return nil
+	}
+	primary := d
+	primary.Fallbacks = nil
+	ret := []DnsSettings{primary}
+	for _, f := range d.Fallbacks {
+		f.Fallbacks = nil
+		ret = append(ret, f)
+	}
+	return ret
+}
+
+// ValidateFallbacks checks the fallback servers of the configuration
+func (d DnsSettings) ValidateFallbacks() error {
+	if len(d.Fallbacks) == 0 {
+		return nil
+	}
+	if d.IsEmpty() {
+		return fmt.Errorf("fallback DNS servers are defined but the primary DNS server is not defined")
+	}
+	servers := d.Servers()
+	if len(servers) > MaxDnsServers {
+		return fmt.Errorf("too many DNS servers (max %d)", MaxDnsServers)
+	}
+	for i, s := range servers {
+		if i > 0 && s.IsEmpty() {
+			return fmt.Errorf("fallback DNS server #%d: bad DNS server address", i)
+		}
+		if i > 0 && len(d.Fallbacks[i-1].Fallbacks) > 0 {
+			return fmt.Errorf("fallback DNS server #%d: nested fallback servers are not allowed", i)
+		}
+		for _, x := range servers[:i] {
+			if s.Equal(x) {
+				return fmt.Errorf("duplicate DNS server: %s", s.InfoString())
+			}
+		}
+	}
+	return nil
+}
+
+// GetActiveManualDNS returns the DNS server in use from the current manual DNS configuration
+// (it differs from the primary server when the failover activated a fallback server)
+func GetActiveManualDNS() DnsSettings {
+	manualDnsMutex.Lock()
+	defer manualDnsMutex.Unlock()
+	if len(upstreams.servers) == 0 {
+		return lastManualDNS
+	}
+	return upstreams.servers[upstreams.activeIdx]
+}
+
+// upstreamsSet initializes the failover for the new manual DNS configuration
+// (starts/stops the health checks) and returns the server which has to be applied.
+// The active server is kept if the list of servers is not changed (e.g. DNS configuration re-applied).
+// Must be called under manualDnsMutex.
+func upstreamsSet(dnsCfg DnsSettings, localInterfaceIP net.IP) (active DnsSettings) {
+	servers := dnsCfg.Servers()
+	if len(servers) <= 1 {
+		upstreamsStop()
+		if len(servers) == 1 {
+			return servers[0]
+		}
+		return dnsCfg
+	}
+
+	upstreams.localInterfaceIP = localInterfaceIP
+	if isServersListEqual(servers, upstreams.servers) && upstreams.stop != nil {
+		return servers[upstreams.activeIdx]
+	}
+
+	upstreamsStop()
+	upstreams.servers = servers
+	upstreams.activeIdx = 0
+	upstreams.stop = make(chan struct{})
+	go upstreamsMonitor(upstreams.stop)
+
+	return servers[0]
+}
+
+// must be called under manualDnsMutex
+func upstreamsStop() {
+	if upstreams.stop != nil {
+		close(upstreams.stop)
+	}
+	upstreams = upstreamsState{}
+}
+
+func isServersListEqual(a, b []DnsSettings) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// upstreamsMonitor performs the health checks of the DNS servers and switches the active server
+func upstreamsMonitor(stop <-chan struct{}) {
+	log.Info("DNS failover: health checks started")
+	defer log.Info("DNS failover: health checks stopped")
+
+	failures := 0
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(upstreamCheckInterval):
+		}
+
+		manualDnsMutex.Lock()
+		servers := upstreams.servers
+		activeIdx := upstreams.activeIdx
+		manualDnsMutex.Unlock()
+		if len(servers) == 0 {
+			return
+		}
+
+		// the checks are performed without locking (it can take time)
+		newIdx := -1
+		if err := checkUpstream(servers[activeIdx]); err != nil {
+			failures++
+			log.Warning(fmt.Sprintf("DNS failover: health check failed for %s (%d): %v", servers[activeIdx].InfoString(), failures, err))
+			if failures >= upstreamFailuresToSwitch {
+				newIdx = firstHealthyUpstream(servers, len(servers), activeIdx)
+			}
+		} else {
+			failures = 0
+			// check if the server with the higher priority is available again
+			newIdx = firstHealthyUpstream(servers, activeIdx, -1)
+		}
+
+		if newIdx < 0 || newIdx == activeIdx {
+			continue
+		}
+		if upstreamsActivate(stop, newIdx) {
+			failures = 0
+		}
+	}
+}
+
+// firstHealthyUpstream returns the index of the first healthy server in range [0, 'limit') excluding 'skipIdx' (-1 - not found)
+func firstHealthyUpstream(servers []DnsSettings, limit int, skipIdx int) int {
+	for i := 0; i < limit && i < len(servers); i++ {
+		if i == skipIdx {
+			continue
+		}
+		if err := checkUpstream(servers[i]); err == nil {
+			return i
+		}
+	}
+	return -1
+}
+
+// upstreamsActivate applies the server from the list as active. Returns 'true' on success.
+func upstreamsActivate(stop <-chan struct{}, idx int) bool {
+	manualDnsMutex.Lock()
+	select {
+	case <-stop:
+		// the configuration was changed while the checks were in progress
+		manualDnsMutex.Unlock()
+		return false
+	default:
+	}
+
+	active := upstreams.servers[idx]
+	log.Info(fmt.Sprintf("DNS failover: switching to %s", active.InfoString()))
+	if err := setManual(lastManualDNS, active, upstreams.localInterfaceIP); err != nil {
+		log.Error("DNS failover: failed to apply DNS server: ", err)
+		manualDnsMutex.Unlock()
+		return false
+	}
+	upstreams.activeIdx = idx
+	notifyFunc := funcActiveDnsChanged
+	manualDnsMutex.Unlock()
+
+	if notifyFunc != nil {
+		notifyFunc(active)
+	}
+	return true
+}
@@ -0,0 +1,249 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package dns
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ivpn/desktop-app/daemon/service/dns/dnscryptproxy"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// timeout of the single health check of the DNS server
+const upstreamCheckTimeout = 3 * time.Second
+
+// checkUpstream checks the DNS server is responding.
+// The query for the root name servers ('. NS') is sent directly to the server (bypassing the OS configuration).
+// Note: for DNSCrypt and ODoH servers only the reachability of the first hop (the server or relay) is checked.
+func checkUpstream(cfg DnsSettings) error {
+	ip := cfg.Ip()
+	if ip == nil {
+		return fmt.Errorf("bad DNS server address")
+	}
+
+	switch cfg.Encryption {
+	case EncryptionNone:
+		return checkUpstreamPlain(ip)
+	case EncryptionDnsOverTls:
+		return checkUpstreamDoT(ip, cfg.DohTemplate)
+	case EncryptionDnsOverHttps:
+		return checkUpstreamDoH(ip, "", cfg.DohTemplate)
+	case EncryptionDnsOverQuic, EncryptionDnsOverHttp3:
+		return checkUpstreamQuic(cfg)
+	case EncryptionDnsStamp:
+		server, relay, err := parseStamps(cfg.Stamp, cfg.RelayStamp)
+		if err != nil {
+			return err
+		}
+		if relay == nil && server.Proto == dnscryptproxy.StampProtoTypeDoH {
+			return checkUpstreamDoH(ip, stampAddressPort(server.ServerAddrStr), "https://"+server.ProviderName+server.Path)
+		}
+		firstHop := server
+		if relay != nil {
+			firstHop = *relay
+		}
+		port := stampAddressPort(firstHop.ServerAddrStr)
+		if len(port) == 0 {
+			port = "443"
+		}
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip.String(), port), upstreamCheckTimeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+	return fmt.Errorf("unsupported DNS encryption type")
+}
+
+func checkUpstreamPlain(ip net.IP) error {
+	query, id, err := healthCheckQuery()
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("udp", net.JoinHostPort(ip.String(), "53"), upstreamCheckTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(upstreamCheckTimeout))
+
+	if _, err := conn.Write(query); err != nil {
+		return err
+	}
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return err
+		}
+		if n >= 2 && binary.BigEndian.Uint16(buf) == id {
+			return checkHealthCheckResponse(buf[:n])
+		}
+		// not our response: continue waiting
+	}
+}
+
+func checkUpstreamDoT(ip net.IP, template string) error {
+	serverName := template
+	if u, err := url.Parse(template); err == nil && len(u.Hostname()) > 0 {
+		serverName = u.Hostname()
+	}
+
+	query, _, err := healthCheckQuery()
+	if err != nil {
+		return err
+	}
+
+	dialer := &net.Dialer{Timeout: upstreamCheckTimeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", net.JoinHostPort(ip.String(), "853"), &tls.Config{ServerName: serverName})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(upstreamCheckTimeout))
+
+	msg := make([]byte, 2+len(query))
+	binary.BigEndian.PutUint16(msg, uint16(len(query)))
+	copy(msg[2:], query)
+	if _, err := conn.Write(msg); err != nil {
+		return err
+	}
+
+	var l uint16
+	if err := binary.Read(conn, binary.BigEndian, &l); err != nil {
+		return err
+	}
+	resp := make([]byte, l)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return err
+	}
+	return checkHealthCheckResponse(resp)
+}
+
+// checkUpstreamDoH sends the DoH request to the server 'ip' ('port' - optional; the port from template or 443 is used by default)
+func checkUpstreamDoH(ip net.IP, port string, template string) error {
+	u, err := url.Parse(template)
+	if err != nil {
+		return fmt.Errorf("bad DoH template: %w", err)
+	}
+	if len(port) == 0 {
+		port = u.Port()
+	}
+	if len(port) == 0 {
+		port = "443"
+	}
+	// RFC 8484 template variables are not in use for POST requests
+	u.RawQuery = ""
+	u.Path = strings.SplitN(u.Path, "{", 2)[0]
+
+	query, _, err := healthCheckQuery()
+	if err != nil {
+		return err
+	}
+	// DoH requests must use the ID = 0 (RFC 8484)
+	binary.BigEndian.PutUint16(query, 0)
+
+	dialer := &net.Dialer{Timeout: upstreamCheckTimeout}
+	client := &http.Client{
+		Timeout: upstreamCheckTimeout,
+		Transport: &http.Transport{
+			// connect to the defined IP address (the DNS resolution is not in use)
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+			},
+			TLSClientConfig:   &tls.Config{ServerName: u.Hostname()},
+			DisableKeepAlives: true,
+		},
+	}
+
+	req, err := http.NewRequest(http.MethodPost, u.String(), bytes.NewReader(query))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected HTTP status: %s", resp.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return err
+	}
+	return checkHealthCheckResponse(body)
+}
+
+// healthCheckQuery returns the query for the root name servers ('. NS')
+func healthCheckQuery() (query []byte, id uint16, err error) {
+	id = uint16(rand.Intn(0xffff) + 1)
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	if err := b.StartQuestions(); err != nil {
+		return nil, 0, err
+	}
+	if err := b.Question(dnsmessage.Question{Name: dnsmessage.MustNewName("."), Type: dnsmessage.TypeNS, Class: dnsmessage.ClassINET}); err != nil {
+		return nil, 0, err
+	}
+	query, err = b.Finish()
+	return query, id, err
+}
+
+func checkHealthCheckResponse(resp []byte) error {
+	var p dnsmessage.Parser
+	hdr, err := p.Start(resp)
+	if err != nil {
+		return fmt.Errorf("bad DNS response: %w", err)
+	}
+	if !hdr.Response {
+		return fmt.Errorf("bad DNS response")
+	}
+	if hdr.RCode == dnsmessage.RCodeServerFailure || hdr.RCode == dnsmessage.RCodeRefused {
+		return fmt.Errorf("DNS server error: %s", hdr.RCode.String())
+	}
+	return nil
+}
+
+// stampAddressPort returns the port from the stamp address string (empty string - the port is not defined)
+func stampAddressPort(addr string) string {
+	if _, port, err := net.SplitHostPort(addr); err == nil {
+		return port
+	}
+	return ""
+}
@@ -0,0 +1,106 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package dns
+
+import (
+	"fmt"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestDnsSettingsFallbacks(t *testing.T) {
+	cfg := DnsSettings{
+		DnsHost: "10.0.254.2",
+		Fallbacks: []DnsSettings{
+			{DnsHost: "9.9.9.9"},
+			{DnsHost: "1.1.1.1", Encryption: EncryptionDnsOverHttps, DohTemplate: "https://cloudflare-dns.com/dns-query"},
+		},
+	}
+	if err := cfg.ValidateFallbacks(); err != nil {
+		t.Fatal(err)
+	}
+
+	servers := cfg.Servers()
+	if len(servers) != 3 || len(servers[0].Fallbacks) != 0 || servers[0].DnsHost != "10.0.254.2" || servers[2].Encryption != EncryptionDnsOverHttps {
+		t.Errorf("unexpected servers: %+v", servers)
+	}
+	if info := cfg.InfoString(); info != "10.0.254.2; fallback: 9.9.9.9; fallback: 1.1.1.1 (DoH https://cloudflare-dns.com/dns-query)" {
+		t.Errorf("unexpected info: %s", info)
+	}
+
+	x := cfg
+	x.Fallbacks = []DnsSettings{cfg.Fallbacks[0]}
+	if cfg.Equal(x) || !cfg.Equal(cfg) {
+		t.Error("fallback servers are not taken into account by Equal()")
+	}
+
+	bad := []DnsSettings{
+		{Fallbacks: []DnsSettings{{DnsHost: "9.9.9.9"}}},                                                  // no primary
+		{DnsHost: "10.0.254.2", Fallbacks: []DnsSettings{{DnsHost: "bad"}}},                               // bad address
+		{DnsHost: "10.0.254.2", Fallbacks: []DnsSettings{{DnsHost: "10.0.254.2"}}},                        // duplicate
+		{DnsHost: "10.0.254.2", Fallbacks: []DnsSettings{{DnsHost: "9.9.9.9", Fallbacks: cfg.Fallbacks}}}, // nested
+	}
+	tooMany := DnsSettings{DnsHost: "10.0.254.2"}
+	for i := 0; i < MaxDnsServers; i++ {
+		tooMany.Fallbacks = append(tooMany.Fallbacks, DnsSettings{DnsHost: fmt.Sprintf("10.0.1.%d", i+1)})
+	}
+	bad = append(bad, tooMany)
+	for i, b := range bad {
+		if err := b.ValidateFallbacks(); err == nil {
+			t.Errorf("%d: error expected", i)
+		}
+	}
+}
+
+func TestHealthCheckResponse(t *testing.T) {
+	query, id, err := healthCheckQuery()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var p dnsmessage.Parser
+	hdr, err := p.Start(query)
+	if err != nil || hdr.ID != id || hdr.Response {
+		t.Fatalf("bad query: %v %+v", err, hdr)
+	}
+	if err := checkHealthCheckResponse(query); err == nil {
+		t.Error("query must not be accepted as response")
+	}
+
+	for rcode, isOk := range map[dnsmessage.RCode]bool{
+		dnsmessage.RCodeSuccess:       true,
+		dnsmessage.RCodeNameError:     true,
+		dnsmessage.RCodeServerFailure: false,
+		dnsmessage.RCodeRefused:       false,
+	} {
+		b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, Response: true, RCode: rcode})
+		resp, err := b.Finish()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := checkHealthCheckResponse(resp); (err == nil) != isOk {
+			t.Errorf("%s: unexpected result: %v", rcode, err)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package firewall
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// max number of entries in the blocked traffic log
+	blockedLogMaxEntries = 500
+	// interval of notifying about new blocked packets (the notifications are grouped)
+	blockedLogNotifyInterval = time.Second
+)
+
+var blockedLog struct {
+	mutex     sync.Mutex
+	isEnabled bool
+	ring      []BlockedPacket
+	next      int // index in the ring for the next entry
+	lastSeq   uint64
+
+	notifier        func(entries []BlockedPacket)
+	notifyTimer     *time.Timer
+	lastNotifiedSeq uint64
+}
+
+// SetBlockedTrafficLog enables/disables logging of the packets blocked by the firewall
+// (the log is kept in memory; it is not preserved after the daemon restart)
+func SetBlockedTrafficLog(enable bool) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if err := implSetBlockedTrafficLog(enable); err != nil {
+		return err
+	}
+
+	blockedLog.mutex.Lock()
+	defer blockedLog.mutex.Unlock()
+	blockedLog.isEnabled = enable
+	if !enable {
+		blockedLog.ring = nil
+		blockedLog.next = 0
+	}
+	return nil
+}
+
+// BlockedTrafficLog returns the blocked packets with the sequence number bigger than 'sinceSeq' (the oldest are first)
+func BlockedTrafficLog(sinceSeq uint64) (isEnabled bool, entries []BlockedPacket) {
+	blockedLog.mutex.Lock()
+	defer blockedLog.mutex.Unlock()
+
+	return blockedLog.isEnabled, blockedLogEntries(sinceSeq)
+}
+
+// SetBlockedTrafficNotifier set the function to be called with new blocked packets
+// (the notifications are grouped: the function is called not more often than once per second)
+func SetBlockedTrafficNotifier(f func(entries []BlockedPacket)) {
+	blockedLog.mutex.Lock()
+	defer blockedLog.mutex.Unlock()
+	blockedLog.notifier = f
+}
+
+func blockedLogIsEnabled() bool {
+	blockedLog.mutex.Lock()
+	defer blockedLog.mutex.Unlock()
+	return blockedLog.isEnabled
+}
+
+// blockedLogAdd saves the packet into the log
+func blockedLogAdd(p BlockedPacket) {
+	blockedLog.mutex.Lock()
+	defer blockedLog.mutex.Unlock()
+
+	if !blockedLog.isEnabled {
+		return
+	}
+
+	blockedLog.lastSeq++
+	p.Seq = blockedLog.lastSeq
+
+	if len(blockedLog.ring) < blockedLogMaxEntries {
+		blockedLog.ring = append(blockedLog.ring, p)
+	} else {
+		blockedLog.ring[blockedLog.next] = p
+	}
+	blockedLog.next = (blockedLog.next + 1) % blockedLogMaxEntries
+
+	if blockedLog.notifier != nil && blockedLog.notifyTimer == nil {
+		blockedLog.notifyTimer = time.AfterFunc(blockedLogNotifyInterval, blockedLogNotify)
+	}
+}
+
+func blockedLogNotify() {
+	blockedLog.mutex.Lock()
+	blockedLog.notifyTimer = nil
+	notifier := blockedLog.notifier
+	entries := blockedLogEntries(blockedLog.lastNotifiedSeq)
+	blockedLog.lastNotifiedSeq = blockedLog.lastSeq
+	blockedLog.mutex.Unlock()
+
+	if notifier != nil && len(entries) > 0 {
+		notifier(entries)
+	}
+}
+
+// blockedLogEntries returns entries from the ring (must be called when the blockedLog.mutex is locked)
+func blockedLogEntries(sinceSeq uint64) []BlockedPacket {
+	ret := make([]BlockedPacket, 0, len(blockedLog.ring))
+	if len(blockedLog.ring) == 0 {
+		return ret
+	}
+
+	start := 0
+	if len(blockedLog.ring) == blockedLogMaxEntries {
+		start = blockedLog.next
+	}
+	for i := 0; i < len(blockedLog.ring); i++ {
+		e := blockedLog.ring[(start+i)%len(blockedLog.ring)]
+		if e.Seq > sinceSeq {
+			ret = append(ret, e)
+		}
+	}
+	return ret
+}
+
+// parseBlockedPacket parses the beginning of IP packet (IPv4 or IPv6)
+func parseBlockedPacket(data []byte, direction ExceptionDirection) (BlockedPacket, error) {
+	p := BlockedPacket{Time: time.Now(), Direction: direction}
+	if len(data) < 1 {
+		return p, fmt.Errorf("empty packet")
+	}
+
+	var (
+		proto     byte
+		transport []byte
+	)
+	switch data[0] >> 4 {
+	case 4:
+		ihl := int(data[0]&0x0f) * 4
+		if len(data) < 20 || ihl < 20 || len(data) < ihl {
+			return p, fmt.Errorf("bad IPv4 header")
+		}
+		proto = data[9]
+		p.Source = net.IP(data[12:16]).String()
+		p.Destination = net.IP(data[16:20]).String()
+		transport = data[ihl:]
+	case 6:
+		if len(data) < 40 {
+			return p, fmt.Errorf("bad IPv6 header")
+		}
+		proto = data[6] // IPv6 extension headers are not analyzed
+		p.Source = net.IP(data[8:24]).String()
+		p.Destination = net.IP(data[24:40]).String()
+		transport = data[40:]
+	default:
+		return p, fmt.Errorf("unknown IP version %d", data[0]>>4)
+	}
+
+	switch proto {
+	case 1:
+		p.Protocol = "icmp"
+	case 6:
+		p.Protocol = "tcp"
+	case 17:
+		p.Protocol = "udp"
+	case 58:
+		p.Protocol = "ipv6-icmp"
+	default:
+		p.Protocol = fmt.Sprintf("%d", proto)
+	}
+
+	if (proto == 6 || proto == 17) && len(transport) >= 4 {
+		p.SourcePort = binary.BigEndian.Uint16(transport[0:2])
+		p.DestinationPort = binary.BigEndian.Uint16(transport[2:4])
+	}
+	return p, nil
+}
@@ -0,0 +1,214 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package firewall
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ivpn/desktop-app/daemon/oshelpers/linux/netlink"
+	"github.com/ivpn/desktop-app/daemon/service/platform"
+	"github.com/ivpn/desktop-app/daemon/shell"
+)
+
+const (
+	// NFLOG group in use by the firewall rules for logging blocked packets
+	blockedLogNflogGroup = 7391
+	// number of bytes of the packet to copy (enough for IP + TCP/UDP headers)
+	blockedLogNflogCopyRange = 128
+	// lifetime of cached info about the process which owns the local port
+	blockedLogProcessCacheTTL = time.Second * 10
+)
+
+var (
+	blockedLogReaderStop chan struct{}
+	blockedLogReaderWg   sync.WaitGroup
+)
+
+func implSetBlockedTrafficLog(enable bool) error {
+	if !enable {
+		err := shell.Exec(nil, platform.FirewallScript(), "-blocked_log_disable")
+		blockedLogStopReader()
+		return err
+	}
+
+	if blockedLogReaderStop == nil {
+		listener, err := netlink.CreateNflogListener(blockedLogNflogGroup, blockedLogNflogCopyRange)
+		if err != nil {
+			return fmt.Errorf("failed to start blocked traffic logging: %w", err)
+		}
+
+		blockedLogReaderStop = make(chan struct{})
+		blockedLogReaderWg.Add(1)
+		go blockedLogReader(listener, blockedLogReaderStop)
+	}
+
+	if err := applyBlockedLogRules(); err != nil {
+		blockedLogStopReader()
+		return err
+	}
+	return nil
+}
+
+// applyBlockedLogRules adds the firewall rules for logging blocked packets
+// (it is necessary to call it each time when the firewall enabled)
+func applyBlockedLogRules() error {
+	return shell.Exec(nil, platform.FirewallScript(), "-blocked_log_enable", strconv.Itoa(blockedLogNflogGroup))
+}
+
+func blockedLogStopReader() {
+	if blockedLogReaderStop == nil {
+		return
+	}
+	close(blockedLogReaderStop)
+	blockedLogReaderStop = nil
+	blockedLogReaderWg.Wait()
+}
+
+func blockedLogReader(listener *netlink.NflogListener, stop <-chan struct{}) {
+	defer blockedLogReaderWg.Done()
+	defer listener.Close()
+
+	log.Info("Blocked traffic logging started")
+	defer log.Info("Blocked traffic logging stopped")
+
+	processes := make(map[string]processInfo)
+
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		packets, err := listener.ReadPackets()
+		if err != nil {
+			log.Error(err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		for _, nfp := range packets {
+			direction := ExceptionDirectionIn
+			if nfp.Prefix == "ivpn-out" {
+				direction = ExceptionDirectionOut
+			}
+
+			p, err := parseBlockedPacket(nfp.Payload, direction)
+			if err != nil {
+				continue
+			}
+
+			if direction == ExceptionDirectionOut && p.SourcePort != 0 {
+				isIPv6 := strings.Contains(p.Source, ":")
+				cacheKey := fmt.Sprintf("%s/%v/%d", p.Protocol, isIPv6, p.SourcePort)
+				pi, ok := processes[cacheKey]
+				if !ok || time.Since(pi.time) > blockedLogProcessCacheTTL {
+					pi = findProcessByLocalPort(p.Protocol, isIPv6, p.SourcePort)
+					if len(processes) > 1000 {
+						processes = make(map[string]processInfo)
+					}
+					processes[cacheKey] = pi
+				}
+				p.Pid, p.Process = pi.pid, pi.name
+			}
+
+			blockedLogAdd(p)
+		}
+	}
+}
+
+type processInfo struct {
+	pid  int
+	name string
+	time time.Time
+}
+
+// findProcessByLocalPort looks for the process which owns the socket bound to the local port
+// (using information from /proc/net/... and /proc/<pid>/fd)
+func findProcessByLocalPort(protocol string, isIPv6 bool, port uint16) processInfo {
+	ret := processInfo{time: time.Now()}
+
+	if protocol != "tcp" && protocol != "udp" {
+		return ret
+	}
+	netFile := "/proc/net/" + protocol
+	if isIPv6 {
+		netFile += "6"
+	}
+
+	inode := findSocketInode(netFile, port)
+	if len(inode) == 0 {
+		return ret
+	}
+	socketLink := "socket:[" + inode + "]"
+
+	fdDirs, _ := filepath.Glob("/proc/[0-9]*/fd")
+	for _, fdDir := range fdDirs {
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			if link, err := os.Readlink(filepath.Join(fdDir, fd.Name())); err == nil && link == socketLink {
+				pidDir := filepath.Dir(fdDir)
+				ret.pid, _ = strconv.Atoi(filepath.Base(pidDir))
+				if comm, err := os.ReadFile(filepath.Join(pidDir, "comm")); err == nil {
+					ret.name = strings.TrimSpace(string(comm))
+				}
+				return ret
+			}
+		}
+	}
+	return ret
+}
+
+// findSocketInode returns inode of the socket bound to the local port
+// File format (/proc/net/tcp): "sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode ..."
+func findSocketInode(netFile string, port uint16) string {
+	f, err := os.Open(netFile)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	portHex := fmt.Sprintf(":%04X", port)
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // skip header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+		if strings.HasSuffix(fields[1], portHex) && fields[9] != "0" {
+			return fields[9]
+		}
+	}
+	return ""
+}
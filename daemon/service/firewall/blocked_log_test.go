@@ -0,0 +1,79 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package firewall
+
+import (
+	"testing"
+)
+
+func TestParseBlockedPacket(t *testing.T) {
+	// IPv4 + UDP: 10.0.0.2:40000 -> 8.8.8.8:53
+	ipv4 := []byte{0x45, 0, 0, 28, 0, 0, 0, 0, 64, 17, 0, 0, 10, 0, 0, 2, 8, 8, 8, 8, 0x9c, 0x40, 0, 53}
+	p, err := parseBlockedPacket(ipv4, ExceptionDirectionOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Protocol != "udp" || p.Source != "10.0.0.2" || p.Destination != "8.8.8.8" || p.SourcePort != 40000 || p.DestinationPort != 53 {
+		t.Error("unexpected IPv4 packet info:", p)
+	}
+
+	// IPv6 + TCP: fd00::1:1234 -> 2001:db8::1:443
+	ipv6 := make([]byte, 44)
+	ipv6[0] = 0x60
+	ipv6[6] = 6
+	ipv6[8], ipv6[23] = 0xfd, 1
+	ipv6[24], ipv6[25], ipv6[26], ipv6[27], ipv6[39] = 0x20, 0x01, 0x0d, 0xb8, 1
+	ipv6[40], ipv6[41], ipv6[42], ipv6[43] = 0x04, 0xd2, 0x01, 0xbb
+	if p, err = parseBlockedPacket(ipv6, ExceptionDirectionIn); err != nil {
+		t.Fatal(err)
+	}
+	if p.Protocol != "tcp" || p.Source != "fd00::1" || p.Destination != "2001:db8::1" || p.SourcePort != 1234 || p.DestinationPort != 443 {
+		t.Error("unexpected IPv6 packet info:", p)
+	}
+
+	if _, err := parseBlockedPacket([]byte{0x45, 0}, ExceptionDirectionOut); err == nil {
+		t.Error("error expected: bad header")
+	}
+}
+
+func TestBlockedLogRing(t *testing.T) {
+	blockedLog.isEnabled = true
+	defer func() {
+		blockedLog.isEnabled = false
+		blockedLog.ring = nil
+		blockedLog.next = 0
+	}()
+
+	for i := 0; i < blockedLogMaxEntries+10; i++ {
+		blockedLogAdd(BlockedPacket{Protocol: "tcp"})
+	}
+
+	_, entries := BlockedTrafficLog(0)
+	if len(entries) != blockedLogMaxEntries || entries[0].Seq != 11 || entries[len(entries)-1].Seq != blockedLogMaxEntries+10 {
+		t.Error("unexpected log entries:", len(entries), entries[0].Seq, entries[len(entries)-1].Seq)
+	}
+
+	if _, entries = BlockedTrafficLog(blockedLogMaxEntries + 5); len(entries) != 5 {
+		t.Error("unexpected number of new entries:", len(entries))
+	}
+}
@@ -25,11 +25,10 @@ package firewall
 import (
 	"fmt"
 	"net"
-	"strings"
 	"sync"
-	"unicode"
 
 	"github.com/ivpn/desktop-app/daemon/logger"
+	"github.com/ivpn/desktop-app/daemon/netinfo"
 	"github.com/ivpn/desktop-app/daemon/service/dns"
 )
 
@@ -49,9 +48,19 @@ var (
 	mutex                        sync.Mutex
 	isClientPaused               bool
 	dnsConfig                    *dns.DnsSettings
-
-	// List of IP masks that are allowed for any communication
-	userExceptions []net.IPNet
+	// Additional plain DNS servers which must be allowed by the DNS rules (e.g. upstream servers of the local resolver)
+	dnsUpstreamIPs []net.IP
+
+	// List of user-defined exceptions (hosts/networks with optional protocol, ports and direction)
+	userExceptions []Exception
+	// List of rules allowing incoming connections to local services
+	inboundRules []InboundRule
+	// List of temporary exceptions (automatically removed by the service when expired)
+	tempExceptions []TemporaryException
+	// Exceptions in use by captive portal detection and 'portal mode'
+	captivePortalExceptions []Exception
+	// IPv6 leak protection state (independent from the firewall state)
+	isIPv6LeakProtection bool
 )
 
 // Initialize is doing initialization stuff
@@ -77,17 +86,13 @@ func SetEnabled(enable bool) error {
 		return fmt.Errorf("failed to change firewall state : %w", err)
 	}
 
+	isEnabledExpected = enable
+
 	if enable {
 		// To fulfill such flow (example): FWEnable -> Connected -> FWDisable -> FWEnable
 		// Here we should notify that client is still connected
-		// We must not do it in Paused state!
-		clientAddr := connectedClientInterfaceIP
-		clientAddrIPv6 := connectedClientInterfaceIPv6
-		if clientAddr != nil && !isClientPaused {
-			e := implClientConnected(clientAddr, clientAddrIPv6, connectedClientPort, connectedHostIP, connectedHostPort, connectedIsTCP)
-			if e != nil {
-				log.Error(e)
-			}
+		if e := reApplyClientConnected(); e != nil {
+			log.Error(e)
 		}
 	}
 	return err
@@ -103,6 +108,8 @@ func SetPersistant(persistant bool) error {
 	err := implSetPersistant(persistant)
 	if err != nil {
 		log.Error(err)
+	} else if persistant {
+		isEnabledExpected = true
 	}
 	return err
 }
@@ -125,19 +132,28 @@ func GetEnabled() (bool, error) {
 
 // ClientPaused saves info about paused state of vpn
 func ClientPaused() {
+	mutex.Lock()
+	defer mutex.Unlock()
+
 	isClientPaused = true
+	// the traffic from LAN must not be forwarded outside the tunnel
+	gatewayUpdate()
 }
 
 // ClientResumed saves info about resumed state of vpn
 func ClientResumed() {
+	mutex.Lock()
+	defer mutex.Unlock()
+
 	isClientPaused = false
+	gatewayUpdate()
 }
 
 // ClientConnected - allow communication for local vpn/client IP address
 func ClientConnected(clientLocalIPAddress net.IP, clientLocalIPv6Address net.IP, clientPort int, serverIP net.IP, serverPort int, isTCP bool) error {
 	mutex.Lock()
 	defer mutex.Unlock()
-	ClientResumed()
+	isClientPaused = false
 
 	log.Info("Client connected: ", clientLocalIPAddress)
 
@@ -152,6 +168,9 @@ func ClientConnected(clientLocalIPAddress net.IP, clientLocalIPv6Address net.IP,
 	if err != nil {
 		log.Error(err)
 	}
+
+	// forward the traffic from LAN through the VPN tunnel (if gateway mode enabled)
+	gatewayUpdate()
 	return err
 }
 
@@ -159,7 +178,7 @@ func ClientConnected(clientLocalIPAddress net.IP, clientLocalIPv6Address net.IP,
 func ClientDisconnected() error {
 	mutex.Lock()
 	defer mutex.Unlock()
-	ClientResumed()
+	isClientPaused = false
 
 	// Remove client interface from exceptions
 	if connectedClientInterfaceIP != nil {
@@ -170,6 +189,17 @@ func ClientDisconnected() error {
 		if err != nil {
 			log.Error(err)
 		}
+
+		// the upstream DNS servers are in use only when VPN is connected
+		if len(dnsUpstreamIPs) > 0 {
+			dnsUpstreamIPs = nil
+			if e := implOnChangeDNS(getDnsIP(), getDnsFallbackIPs()); e != nil {
+				log.Error(e)
+			}
+		}
+
+		// block the traffic from LAN (if gateway mode enabled)
+		gatewayUpdate()
 		return err
 	}
 	return nil
@@ -239,6 +269,82 @@ func getDnsIP() net.IP {
 	return dnsIP
 }
 
+// getDnsFallbackIPs returns the plain DNS fallback servers of the current DNS configuration
+func getDnsFallbackIPs() []net.IP {
+	return dnsPlainFallbacks(dnsConfig)
+}
+
+// expectedDnsIPs returns all DNS servers which must be allowed by the DNS rules (the active one and the plain fallback servers)
+func expectedDnsIPs() []net.IP {
+	var ret []net.IP
+	if ip := getDnsIP(); ip != nil {
+		ret = append(ret, ip)
+	}
+	return append(ret, getDnsFallbackIPs()...)
+}
+
+// dnsPlainFallbacks returns the plain DNS fallback servers which are not active at the moment
+// (they must be reachable for the health checks and the failover) and the upstream DNS servers (see SetDnsUpstreamServers()).
+// The encrypted fallback servers (as well as the encrypted active server) do not require DNS rules:
+// the encrypted DNS traffic goes through the VPN tunnel.
+func dnsPlainFallbacks(cfg *dns.DnsSettings) []net.IP {
+	var active net.IP
+	var ret []net.IP
+	if cfg != nil {
+		if cfg.Encryption == dns.EncryptionNone {
+			active = cfg.Ip()
+		}
+		for _, f := range cfg.Fallbacks {
+			if ip := f.Ip(); ip != nil && f.Encryption == dns.EncryptionNone && !ip.Equal(active) {
+				ret = append(ret, ip)
+			}
+		}
+	}
+	for _, ip := range dnsUpstreamIPs {
+		if !ip.Equal(active) && !containsIP(ret, ip) {
+			ret = append(ret, ip)
+		}
+	}
+	return ret
+}
+
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, i := range ips {
+		if i.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetDnsUpstreamServers sets the additional plain DNS servers which must be allowed by the DNS rules
+// (e.g. the upstream servers of the local resolver). Only the DNS traffic (port 53) through the VPN tunnel is allowed for them.
+// The list is erased on client disconnection (see ClientDisconnected()).
+func SetDnsUpstreamServers(IPs []net.IP) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if len(IPs) == len(dnsUpstreamIPs) {
+		isEqual := true
+		for _, ip := range IPs {
+			if !containsIP(dnsUpstreamIPs, ip) {
+				isEqual = false
+				break
+			}
+		}
+		if isEqual {
+			return nil
+		}
+	}
+
+	dnsUpstreamIPs = IPs
+	err := implOnChangeDNS(getDnsIP(), getDnsFallbackIPs())
+	if err != nil {
+		log.Error(err)
+	}
+	return err
+}
+
 // OnChangeDNS - must be called on each DNS change (to update firewall rules according to new DNS configuration)
 func OnChangeDNS(newDnsCfg *dns.DnsSettings) error {
 	mutex.Lock()
@@ -256,60 +362,227 @@ func OnChangeDNS(newDnsCfg *dns.DnsSettings) error {
 
 	var addr net.IP = nil
 	if newDnsCfg != nil && newDnsCfg.Encryption == dns.EncryptionNone {
-		// for DoH/DoT - no sense to allow DNS port (53)
+		// for DoH/DoT/DoQ - no sense to allow DNS port (53): the encrypted DNS traffic goes through the VPN tunnel
 		addr = net.ParseIP(newDnsCfg.DnsHost)
 	}
 
-	err := implOnChangeDNS(addr)
+	// the plain fallback servers are allowed by the same DNS rules as the active server (port 53 through the VPN tunnel)
+	err := implOnChangeDNS(addr, dnsPlainFallbacks(newDnsCfg))
 	if err != nil {
 		log.Error(err)
 	} else {
 		// remember DNS IP
 		dnsConfig = newDnsCfg
+		// DNS server for LAN clients (if gateway mode enabled)
+		gatewayUpdate()
 	}
 	return err
 }
 
-// SetUserExceptions set ip/mask to be excluded from FW block
-// Parameters:
-//	- exceptions - comma separated list of IP addresses in format: x.x.x.x[/xx]
-func SetUserExceptions(exceptions string, ignoreParseErrors bool) error {
-	userExceptions = []net.IPNet{}
-
-	splitFunc := func(c rune) bool {
-		return !unicode.IsLetter(c) && !unicode.IsNumber(c) && c != rune('/') && c != rune('.') && c != rune(':')
-	}
-	exceptionsArr := strings.FieldsFunc(exceptions, splitFunc)
-	for _, exp := range exceptionsArr {
-		exp = strings.TrimSpace(exp)
-
-		var err error
-		var n *net.IPNet
-
-		if strings.Contains(exp, "/") {
-			_, n, err = net.ParseCIDR(exp)
-		} else {
-			addr := net.ParseIP(exp)
-			if addr == nil {
-				err = fmt.Errorf("%s not a IP address", exp)
-			} else {
-				if addr.To4() == nil {
-					// IPv6 single address
-					_, n, err = net.ParseCIDR(addr.String() + "/128")
-				} else {
-					// IPv4 single address
-					_, n, err = net.ParseCIDR(addr.String() + "/32")
-				}
+// SetUserExceptions set the list of user-defined exceptions (the traffic which must not be blocked by the firewall)
+// Exceptions with bad parameters are skipped (the error is returned for the first of them)
+func SetUserExceptions(exceptions []Exception) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	var retErr error
+	userExceptions = make([]Exception, 0, len(exceptions))
+	for _, e := range exceptions {
+		normalized, err := e.Normalized()
+		if err != nil {
+			log.Error(fmt.Sprintf("skipping firewall exception '%s': %s", e.Host, err))
+			if retErr == nil {
+				retErr = fmt.Errorf("bad firewall exception '%s': %w", e.Host, err)
 			}
+			continue
 		}
+		userExceptions = append(userExceptions, normalized)
+	}
+
+	if err := implOnUserExceptionsUpdated(); err != nil {
+		return err
+	}
+	return retErr
+}
+
+// SetInboundRules set the list of rules allowing incoming connections to local services
+// Rules with bad parameters are skipped (the error is returned for the first of them)
+func SetInboundRules(rules []InboundRule) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	var retErr error
+	inboundRules = make([]InboundRule, 0, len(rules))
+	for _, r := range rules {
+		normalized, err := r.Normalized()
 		if err != nil {
-			if !ignoreParseErrors {
-				return fmt.Errorf("unable to parse firewall exceptions ('%s'): %w", exceptions, err)
+			log.Error(fmt.Sprintf("skipping firewall inbound rule '%s': %s", r.String(), err))
+			if retErr == nil {
+				retErr = fmt.Errorf("bad firewall inbound rule '%s': %w", r.String(), err)
 			}
 			continue
 		}
-		userExceptions = append(userExceptions, *n)
+		inboundRules = append(inboundRules, normalized)
+	}
+
+	if err := implOnUserExceptionsUpdated(); err != nil {
+		return err
+	}
+	return retErr
+}
+
+// AddTemporaryExceptions adds temporary exceptions for the hosts (networks)
+// If the exception for the host already exists - its expiration time is updated.
+// Note: the firewall does not remove the expired exceptions; it is the responsibility of the caller.
+func AddTemporaryExceptions(exceptions []TemporaryException) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	for _, e := range exceptions {
+		normalized, err := e.Normalized()
+		if err != nil {
+			return fmt.Errorf("bad temporary firewall exception '%s': %w", e.Host, err)
+		}
+
+		isUpdated := false
+		for i, te := range tempExceptions {
+			if te.Host == normalized.Host {
+				tempExceptions[i] = normalized
+				isUpdated = true
+				break
+			}
+		}
+		if !isUpdated {
+			tempExceptions = append(tempExceptions, normalized)
+		}
+	}
+
+	err := implOnUserExceptionsUpdated()
+	if err != nil {
+		log.Error("Failed to add temporary exceptions:", err)
+	}
+	return err
+}
+
+// RemoveTemporaryExceptions removes temporary exceptions for the hosts (networks)
+func RemoveTemporaryExceptions(exceptions []TemporaryException) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	toRemove := make(map[string]struct{}, len(exceptions))
+	for _, e := range exceptions {
+		if normalized, err := e.Normalized(); err == nil {
+			toRemove[normalized.Host] = struct{}{}
+		}
+	}
+
+	newList := make([]TemporaryException, 0, len(tempExceptions))
+	for _, te := range tempExceptions {
+		if _, ok := toRemove[te.Host]; !ok {
+			newList = append(newList, te)
+		}
+	}
+	if len(newList) == len(tempExceptions) {
+		return nil // nothing to remove
+	}
+	tempExceptions = newList
+
+	err := implOnUserExceptionsUpdated()
+	if err != nil {
+		log.Error("Failed to remove temporary exceptions:", err)
+	}
+	return err
+}
+
+// SetCaptivePortalExceptions set the list of exceptions in use for captive portal detection or for 'portal mode'
+// (nil or empty list - remove all such exceptions)
+func SetCaptivePortalExceptions(exceptions []Exception) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	newList := make([]Exception, 0, len(exceptions))
+	for _, e := range exceptions {
+		normalized, err := e.Normalized()
+		if err != nil {
+			return fmt.Errorf("bad captive portal firewall exception '%s': %w", e.String(), err)
+		}
+		newList = append(newList, normalized)
 	}
+	captivePortalExceptions = newList
 
-	return implOnUserExceptionsUpdated()
+	err := implOnUserExceptionsUpdated()
+	if err != nil {
+		log.Error("Failed to apply captive portal exceptions:", err)
+	}
+	return err
+}
+
+// SetIPv6LeakProtection enables/disables blocking of all IPv6 traffic except the VPN interface and
+// local addresses (loopback, link-local, unique-local, multicast).
+// The protection is independent from the firewall state: it is in use when VPN is connected
+// but IPv6 is not routed through the tunnel (to avoid leaks over the native IPv6 of the host).
+// Parameters:
+//	- vpnInterfaceIP - local IP address of the VPN interface (IPv6 traffic over this interface is not blocked)
+func SetIPv6LeakProtection(enable bool, vpnInterfaceIP net.IP) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if !enable && !isIPv6LeakProtection {
+		return nil
+	}
+
+	vpnInterfaceName := ""
+	if enable && vpnInterfaceIP != nil {
+		inf, err := netinfo.InterfaceByIPAddr(vpnInterfaceIP)
+		if err != nil {
+			return fmt.Errorf("failed to get local interface by IP: %w", err)
+		}
+		vpnInterfaceName = inf.Name
+	}
+
+	log.Info(fmt.Sprintf("IPv6 leak protection: %t %s", enable, vpnInterfaceName))
+	if err := implSetIPv6LeakProtection(enable, vpnInterfaceName); err != nil {
+		log.Error(err)
+		return fmt.Errorf("failed to change IPv6 leak protection state: %w", err)
+	}
+	isIPv6LeakProtection = enable
+	return nil
+}
+
+// IsIPv6LeakProtection returns 'true' when IPv6 leak protection is active
+func IsIPv6LeakProtection() bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return isIPv6LeakProtection
+}
+
+// getUserExceptions returns user exceptions (including the exceptions for inbound rules, temporary and captive portal exceptions) for the specified IP versions
+// Parameters:
+//	- hostOnly - when 'true': only exceptions without restrictions by protocol/port/direction;
+//				 when 'false': only exceptions with such restrictions
+func getUserExceptions(ipv4, ipv6 bool, hostOnly bool) []Exception {
+	all := append([]Exception{}, userExceptions...)
+	for _, r := range inboundRules {
+		all = append(all, r.Exceptions()...)
+	}
+	for _, te := range tempExceptions {
+		all = append(all, te.Exception())
+	}
+	all = append(all, captivePortalExceptions...)
+
+	ret := []Exception{}
+	for _, e := range all {
+		isIPv6 := e.IsIPv6()
+		isIPv4 := !isIPv6
+
+		if !(isIPv4 && ipv4) && !(isIPv6 && ipv6) {
+			continue
+		}
+		if e.IsHostOnly() != hostOnly {
+			continue
+		}
+
+		ret = append(ret, e)
+	}
+	return ret
 }
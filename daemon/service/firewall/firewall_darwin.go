@@ -62,7 +62,13 @@ func init() {
 	allowedHosts = make(map[string]bool)
 }
 
-func implInitialize() error { return nil }
+func implInitialize() error {
+	// IPv6 leak protection is in use only when VPN is connected: remove the rules which could stay from the previous daemon run
+	if err := implSetIPv6LeakProtection(false, ""); err != nil {
+		log.Warning("Failed to remove IPv6 leak protection rules: ", err)
+	}
+	return nil
+}
 
 func implGetEnabled() (bool, error) {
 	err := shell.Exec(nil, platform.FirewallScript(), "-status")
@@ -244,23 +250,81 @@ func implRemoveHostsFromExceptions(IPs []net.IP, onlyForICMP bool, isPersistent
 }
 
 // OnChangeDNS - must be called on each DNS change (to update firewall rules according to new DNS configuration)
-func implOnChangeDNS(addr net.IP) error {
-	var dnsVal string
-	if addr != nil {
-		dnsVal = addr.String()
+func implOnChangeDNS(addr net.IP, fallbacks []net.IP) error {
+	var addrs []string
+	for _, a := range append([]net.IP{addr}, fallbacks...) {
+		if a != nil {
+			addrs = append(addrs, a.String())
+		}
+	}
+	log.Info("-set_dns ", strings.Join(addrs, " "))
+	return shell.Exec(nil, platform.FirewallScript(), append([]string{"-set_dns"}, addrs...)...)
+}
+
+func implSetIPv6LeakProtection(enable bool, vpnInterfaceName string) error {
+	if enable {
+		return shell.Exec(nil, platform.FirewallScript(), "-ipv6leak_protection_enable", vpnInterfaceName)
 	}
-	log.Info("-set_dns ", dnsVal)
-	return shell.Exec(nil, platform.FirewallScript(), "-set_dns", dnsVal)
+	return shell.Exec(nil, platform.FirewallScript(), "-ipv6leak_protection_disable")
 }
 
 // implOnUserExceptionsUpdated() called when 'userExceptions' value were updated. Necessary to update firewall rules.
 func implOnUserExceptionsUpdated() error {
 	var expMasks []string
-	for _, mask := range userExceptions {
-		expMasks = append(expMasks, mask.String())
+	for _, e := range getUserExceptions(true, true, true) {
+		expMasks = append(expMasks, e.Host)
+	}
+
+	err := applySetUserExceptions(expMasks)
+
+	// exceptions restricted by protocol/ports/direction
+	var rules []string
+	for _, e := range getUserExceptions(true, true, false) {
+		rules = append(rules, userExceptionRules(e)...)
+	}
+	if errRules := applySetUserExceptionsRules(rules); errRules != nil && err == nil {
+		err = errRules
+	}
+	return err
+}
+
+// userExceptionRules returns PF rules for the exception (which is restricted by protocol/ports/direction)
+func userExceptionRules(e Exception) []string {
+	proto := ""
+	switch e.Protocol {
+	case ExceptionProtocolTCP, ExceptionProtocolUDP:
+		proto = " proto " + string(e.Protocol)
+	case ExceptionProtocolICMP:
+		if e.IsIPv6() {
+			proto = " proto icmp6"
+		} else {
+			proto = " proto icmp"
+		}
+	default:
+		if e.PortFrom != 0 {
+			// ports are applicable only for TCP and UDP
+			proto = " proto { tcp udp }"
+		}
 	}
 
-	return applySetUserExceptions(expMasks)
+	// port of the service: remote port for outgoing connections, local port for incoming connections
+	port := ""
+	if from, to := e.Ports(); from != 0 {
+		if from == to {
+			port = fmt.Sprintf(" port = %d", from)
+		} else {
+			port = fmt.Sprintf(" port %d:%d", from, to)
+		}
+	}
+
+	var rules []string
+	if e.Direction != ExceptionDirectionIn {
+		rules = append(rules, fmt.Sprintf("pass out quick%s from any to %s%s", proto, e.Host, port))
+	}
+	if e.Direction != ExceptionDirectionOut {
+		rules = append(rules, fmt.Sprintf("pass in quick%s from %s to any%s", proto, e.Host, port))
+	}
+	return rules
 }
 
 //---------------------------------------------------------------------
@@ -277,6 +341,11 @@ func applySetUserExceptions(hostsIPs []string) error { //
 	return shell.Exec(nil, platform.FirewallScript(), "-set_user_exceptions", ipList)
 }
 
+func applySetUserExceptionsRules(rules []string) error {
+	log.Info(fmt.Sprintf("-set_user_exceptions_rules <%d rules>", len(rules)))
+	return shell.Exec(nil, platform.FirewallScript(), "-set_user_exceptions_rules", strings.Join(rules, "\n"))
+}
+
 func applyAddHostsToExceptions(hostsIPs []string) error { //
 	ipList := strings.Join(hostsIPs, " ")
 
@@ -322,7 +391,7 @@ func reApplyExceptions() error {
 		log.Error(err)
 	}
 
-	err1 := implOnChangeDNS(getDnsIP())
+	err1 := implOnChangeDNS(getDnsIP(), getDnsFallbackIPs())
 	if err1 != nil {
 		log.Error(err1)
 		if err == nil {
@@ -81,6 +81,15 @@ func implInitialize() error {
 		return nil
 	}
 
+	// the blocked traffic logging is disabled on daemon start: remove the rules which could stay from the previous daemon run
+	if err := shell.Exec(nil, platform.FirewallScript(), "-blocked_log_disable"); err != nil {
+		log.Warning("Failed to remove blocked traffic logging rules: ", err)
+	}
+	// the same for IPv6 leak protection (it is in use only when VPN is connected)
+	if err := implSetIPv6LeakProtection(false, ""); err != nil {
+		log.Warning("Failed to remove IPv6 leak protection rules: ", err)
+	}
+
 	return startLanChangeMonitor()
 }
 
@@ -109,6 +118,13 @@ func implSetEnabled(isEnabled bool) error {
 			return fmt.Errorf("failed to execute shell command: %w", err)
 		}
 
+		// logging of blocked packets (if enabled)
+		if blockedLogIsEnabled() {
+			if err := applyBlockedLogRules(); err != nil {
+				log.Error("Failed to apply blocked traffic logging rules: ", err)
+			}
+		}
+
 		// To fulfill such flow (example): Connected -> FWDisable -> FWEnable
 		// Here we should restore all exceptions (all hosts which are allowed)
 		return reApplyExceptions()
@@ -321,28 +337,42 @@ func implRemoveHostsFromExceptions(IPs []net.IP, onlyForICMP bool, isPersistent
 }
 
 // OnChangeDNS - must be called on each DNS change (to update firewall rules according to new DNS configuration)
-func implOnChangeDNS(addr net.IP) error {
-	addrStr := ""
+func implOnChangeDNS(addr net.IP, fallbacks []net.IP) error {
+	var addrs []string
 	if addr != nil {
 		if addr.To4() == nil {
 			return fmt.Errorf("DNS is not IPv4 address")
 		}
-		addrStr = addr.String()
+		addrs = append(addrs, addr.String())
+	}
+	for _, f := range fallbacks {
+		if f.To4() == nil {
+			log.Warning(fmt.Sprintf("DNS fallback server %s skipped: not IPv4 address", f))
+			continue
+		}
+		addrs = append(addrs, f.String())
 	}
 
-	log.Info("-set_dns", " ", addrStr)
-	return shell.Exec(nil, platform.FirewallScript(), "-set_dns", addrStr)
+	log.Info("-set_dns", " ", strings.Join(addrs, " "))
+	return shell.Exec(nil, platform.FirewallScript(), append([]string{"-set_dns"}, addrs...)...)
+}
+
+func implSetIPv6LeakProtection(enable bool, vpnInterfaceName string) error {
+	if enable {
+		return shell.Exec(nil, platform.FirewallScript(), "-ipv6leak_protection_enable", vpnInterfaceName)
+	}
+	return shell.Exec(nil, platform.FirewallScript(), "-ipv6leak_protection_disable")
 }
 
 // implOnUserExceptionsUpdated() called when 'userExceptions' value were updated. Necessary to update firewall rules.
 func implOnUserExceptionsUpdated() error {
 
 	applyFunc := func(isIpv4 bool) error {
-		userExceptions := getUserExceptions(isIpv4, !isIpv4)
+		userExceptions := getUserExceptions(isIpv4, !isIpv4, true)
 
 		var expMasks []string
-		for _, mask := range userExceptions {
-			expMasks = append(expMasks, mask.String())
+		for _, e := range userExceptions {
+			expMasks = append(expMasks, e.Host)
 		}
 
 		scriptCommand := "-set_user_exceptions_static"
@@ -358,7 +388,35 @@ func implOnUserExceptionsUpdated() error {
 			log.Info(scriptCommand, " ", ipList)
 		}
 
-		return shell.Exec(nil, platform.FirewallScript(), scriptCommand, ipList)
+		if err := shell.Exec(nil, platform.FirewallScript(), scriptCommand, ipList); err != nil {
+			return err
+		}
+
+		// exceptions restricted by protocol/ports/direction (added one by one to the same chains)
+		scriptCommand = "-add_user_exception_static"
+		if !isIpv4 {
+			scriptCommand = "-add_user_exception_static_ipv6"
+		}
+		for _, e := range getUserExceptions(isIpv4, !isIpv4, false) {
+			protocol := string(e.Protocol)
+			if len(protocol) == 0 {
+				protocol = "any"
+			}
+			ports := "any"
+			if from, to := e.Ports(); from != 0 {
+				ports = fmt.Sprintf("%d:%d", from, to)
+			}
+			direction := string(e.Direction)
+			if len(direction) == 0 {
+				direction = "any"
+			}
+
+			log.Info(scriptCommand, " ", protocol, " ", ports, " ", direction, " ", e.Host)
+			if err := shell.Exec(nil, platform.FirewallScript(), scriptCommand, protocol, ports, direction, e.Host); err != nil {
+				return fmt.Errorf("failed to apply firewall exception '%s': %w", e.String(), err)
+			}
+		}
+		return nil
 	}
 
 	err := applyFunc(false)
@@ -446,7 +504,7 @@ func reApplyExceptions() error {
 	const onlyIcmpFALSE = false
 
 	// define DNS rules
-	err := implOnChangeDNS(getDnsIP())
+	err := implOnChangeDNS(getDnsIP(), getDnsFallbackIPs())
 	if err != nil {
 		log.Error(err)
 	}
@@ -595,18 +653,3 @@ func getLanIPs() ([]string, error) {
 
 	return retIps, nil
 }
-
-func getUserExceptions(ipv4, ipv6 bool) []net.IPNet {
-	ret := []net.IPNet{}
-	for _, e := range userExceptions {
-		isIPv6 := e.IP.To4() == nil
-		isIPv4 := !isIPv6
-
-		if !(isIPv4 && ipv4) && !(isIPv6 && ipv6) {
-			continue
-		}
-
-		ret = append(ret, e)
-	}
-	return ret
-}
@@ -44,12 +44,19 @@ var (
 	manager                winlib.Manager
 	clientLocalIPFilterIDs []uint64
 	customDNS              net.IP
+	// filters added by the daemon (in use to verify that the filters were not removed by a third-party)
+	installedFilters []installedFilter
 
 	isPersistant        bool
 	isAllowLAN          bool
 	isAllowLANMulticast bool
 )
 
+type installedFilter struct {
+	id          uint64
+	description string
+}
+
 const (
 	providerDName = "IVPN Kill Switch"
 	sublayerDName = "IVPN Kill Switch Sub-Layer"
@@ -70,6 +77,11 @@ func implInitialize() error {
 	// save initial persistant state into package-variable
 	isPersistant = pInfo.IsPersistent
 
+	// IPv6 leak protection is in use only when VPN is connected: remove the filters which could stay from the previous daemon run
+	if err := implSetIPv6LeakProtection(false, ""); err != nil {
+		log.Warning("Failed to remove IPv6 leak protection filters: ", err)
+	}
+
 	return nil
 }
 
@@ -136,12 +148,14 @@ func implClientConnected(clientLocalIPAddress net.IP, clientLocalIPv6Address net
 	if err := manager.TransactionStart(); err != nil {
 		return fmt.Errorf("failed to start transaction: %w", err)
 	}
+	filtersBefore, clientFiltersBefore := installedFilters, clientLocalIPFilterIDs
 	defer func() {
 		if retErr == nil {
 			manager.TransactionCommit()
 		} else {
 			// abort transaction if there was an error
 			manager.TransactionAbort()
+			installedFilters, clientLocalIPFilterIDs = filtersBefore, clientFiltersBefore
 		}
 	}()
 
@@ -158,12 +172,14 @@ func implClientDisconnected() (retErr error) {
 	if err := manager.TransactionStart(); err != nil {
 		return fmt.Errorf("failed to start transaction: %w", err)
 	}
+	filtersBefore, clientFiltersBefore := installedFilters, clientLocalIPFilterIDs
 	defer func() {
 		if retErr == nil {
 			manager.TransactionCommit()
 		} else {
 			// abort transaction if there was an error
 			manager.TransactionAbort()
+			installedFilters, clientLocalIPFilterIDs = filtersBefore, clientFiltersBefore
 		}
 	}()
 
@@ -202,7 +218,9 @@ func implAllowLAN(allowLan bool, allowLanMulticast bool) error {
 }
 
 // OnChangeDNS - must be called on each DNS change (to update firewall rules according to new DNS configuration)
-func implOnChangeDNS(addr net.IP) error {
+// The fallback servers do not require additional filters: the traffic through the VPN tunnel is permitted
+// by the VPN interface filter (it has higher weight than 'block DNS' filter); outside the tunnel they are blocked.
+func implOnChangeDNS(addr net.IP, fallbacks []net.IP) error {
 	if addr.Equal(customDNS) {
 		return nil
 	}
@@ -238,12 +256,14 @@ func reEnable() (retErr error) {
 	if err := manager.TransactionStart(); err != nil {
 		return fmt.Errorf("failed to start transaction: %w", err)
 	}
+	filtersBefore, clientFiltersBefore := installedFilters, clientLocalIPFilterIDs
 	defer func() {
 		if retErr == nil {
 			manager.TransactionCommit()
 		} else {
 			// abort transaction if there was an error
 			manager.TransactionAbort()
+			installedFilters, clientLocalIPFilterIDs = filtersBefore, clientFiltersBefore
 		}
 	}()
 
@@ -309,13 +329,13 @@ func doEnable() (retErr error) {
 	// IPv6 filters
 	for _, layer := range v6Layers {
 		// block all
-		_, err := manager.AddFilter(winlib.NewFilterBlockAll(providerKey, layer, sublayerKey, filterDName, "", true, isPersistant))
+		_, err := addFilter(winlib.NewFilterBlockAll(providerKey, layer, sublayerKey, filterDName, "", true, isPersistant), "block all IPv6")
 		if err != nil {
 			return fmt.Errorf("failed to add filter 'block all IPv6': %w", err)
 		}
 
 		// block DNS
-		_, err = manager.AddFilter(winlib.NewFilterBlockDNS(providerKey, layer, sublayerKey, sublayerDName, "", nil, isPersistant))
+		_, err = addFilter(winlib.NewFilterBlockDNS(providerKey, layer, sublayerKey, sublayerDName, "", nil, isPersistant), "block DNS IPv6")
 		if err != nil {
 			return fmt.Errorf("failed to add filter 'block dns': %w", err)
 		}
@@ -324,11 +344,11 @@ func doEnable() (retErr error) {
 		ipv6llocal := net.IP{0xfe, 0x80, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0} // LINKLOCAL		fe80::/10
 		// ipv6slocal := net.IP{0xfe, 0xc0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0} // SITELOCAL	fec0::/10
 		// ipv6ulocal := net.IP{0xfd, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}    // UNIQUELOCAL	fd00::/8
-		_, err = manager.AddFilter(winlib.NewFilterAllowRemoteIPV6(providerKey, layer, sublayerKey, filterDName, "", ipv6loopback, 128, isPersistant))
+		_, err = addFilter(winlib.NewFilterAllowRemoteIPV6(providerKey, layer, sublayerKey, filterDName, "", ipv6loopback, 128, isPersistant), "allow IPv6 loopback")
 		if err != nil {
 			return fmt.Errorf("failed to add filter 'allow remote IP' for ipv6loopback: %w", err)
 		}
-		_, err = manager.AddFilter(winlib.NewFilterAllowRemoteIPV6(providerKey, layer, sublayerKey, filterDName, "", ipv6llocal, 10, isPersistant))
+		_, err = addFilter(winlib.NewFilterAllowRemoteIPV6(providerKey, layer, sublayerKey, filterDName, "", ipv6llocal, 10, isPersistant), "allow IPv6 link-local")
 		if err != nil {
 			return fmt.Errorf("failed to add filter 'allow remote IP' for ipv6llocal: %w", err)
 		}
@@ -337,7 +357,7 @@ func doEnable() (retErr error) {
 		if isAllowLAN {
 			for _, ip := range localAddressesV6 {
 				prefixLen, _ := ip.Mask.Size()
-				_, err = manager.AddFilter(winlib.NewFilterAllowRemoteIPV6(providerKey, layer, sublayerKey, filterDName, "", ip.IP, byte(prefixLen), isPersistant))
+				_, err = addFilter(winlib.NewFilterAllowRemoteIPV6(providerKey, layer, sublayerKey, filterDName, "", ip.IP, byte(prefixLen), isPersistant), "allow LAN "+ip.String())
 				if err != nil {
 					return fmt.Errorf("failed to add filter 'allow lan IPv6': %w", err)
 				}
@@ -345,37 +365,32 @@ func doEnable() (retErr error) {
 		}
 
 		// user exceptions
-		userExpsNets := getUserExceptions(false, true)
-		for _, n := range userExpsNets {
-			prefixLen, _ := n.Mask.Size()
-			_, err = manager.AddFilter(winlib.NewFilterAllowRemoteIPV6(providerKey, layer, sublayerKey, filterDName, "", n.IP, byte(prefixLen), isPersistant))
-			if err != nil {
-				return fmt.Errorf("failed to add filter 'user exception': %w", err)
-			}
+		if err = addUserExceptionsFilters(layer, false, true); err != nil {
+			return err
 		}
 	}
 
 	// IPv4 filters
 	for _, layer := range v4Layers {
 		// block all
-		_, err := manager.AddFilter(winlib.NewFilterBlockAll(providerKey, layer, sublayerKey, filterDName, "", false, isPersistant))
+		_, err := addFilter(winlib.NewFilterBlockAll(providerKey, layer, sublayerKey, filterDName, "", false, isPersistant), "block all")
 		if err != nil {
 			return fmt.Errorf("failed to add filter 'block all': %w", err)
 		}
 
 		// block DNS
-		_, err = manager.AddFilter(winlib.NewFilterBlockDNS(providerKey, layer, sublayerKey, sublayerDName, "", customDNS, isPersistant))
+		_, err = addFilter(winlib.NewFilterBlockDNS(providerKey, layer, sublayerKey, sublayerDName, "", customDNS, isPersistant), "block DNS")
 		if err != nil {
 			return fmt.Errorf("failed to add filter 'block dns': %w", err)
 		}
 		// allow DNS requests to 127.0.0.1:53
-		_, err = manager.AddFilter(winlib.AllowRemoteLocalhostDNS(providerKey, layer, sublayerKey, sublayerDName, "", isPersistant))
+		_, err = addFilter(winlib.AllowRemoteLocalhostDNS(providerKey, layer, sublayerKey, sublayerDName, "", isPersistant), "allow localhost DNS")
 		if err != nil {
 			return fmt.Errorf("failed to add filter 'block dns': %w", err)
 		}
 
 		// allow DHCP port
-		_, err = manager.AddFilter(winlib.NewFilterAllowLocalPort(providerKey, layer, sublayerKey, sublayerDName, "", 68, isPersistant))
+		_, err = addFilter(winlib.NewFilterAllowLocalPort(providerKey, layer, sublayerKey, sublayerDName, "", 68, isPersistant), "allow DHCP")
 		if err != nil {
 			return fmt.Errorf("failed to add filter 'allow dhcp': %w", err)
 		}
@@ -385,34 +400,34 @@ func doEnable() (retErr error) {
 		if err != nil {
 			return fmt.Errorf("failed to obtain executable info: %w", err)
 		}
-		_, err = manager.AddFilter(winlib.NewFilterAllowApplication(providerKey, layer, sublayerKey, sublayerDName, "", binaryPath, isPersistant))
+		_, err = addFilter(winlib.NewFilterAllowApplication(providerKey, layer, sublayerKey, sublayerDName, "", binaryPath, isPersistant), "allow application - daemon")
 		if err != nil {
 			return fmt.Errorf("failed to add filter 'allow application': %w", err)
 		}
 
 		// allow OpenVPN executable
-		_, err = manager.AddFilter(winlib.NewFilterAllowApplication(providerKey, layer, sublayerKey, sublayerDName, "", platform.OpenVpnBinaryPath(), isPersistant))
+		_, err = addFilter(winlib.NewFilterAllowApplication(providerKey, layer, sublayerKey, sublayerDName, "", platform.OpenVpnBinaryPath(), isPersistant), "allow application - openvpn")
 		if err != nil {
 			return fmt.Errorf("failed to add filter 'allow application - openvpn': %w", err)
 		}
 		// allow WireGuard executable
-		_, err = manager.AddFilter(winlib.NewFilterAllowApplication(providerKey, layer, sublayerKey, sublayerDName, "", platform.WgBinaryPath(), isPersistant))
+		_, err = addFilter(winlib.NewFilterAllowApplication(providerKey, layer, sublayerKey, sublayerDName, "", platform.WgBinaryPath(), isPersistant), "allow application - wireguard")
 		if err != nil {
 			return fmt.Errorf("failed to add filter 'allow application - wireguard': %w", err)
 		}
 		// allow obfsproxy
-		_, err = manager.AddFilter(winlib.NewFilterAllowApplication(providerKey, layer, sublayerKey, sublayerDName, "", platform.ObfsproxyStartScript(), isPersistant))
+		_, err = addFilter(winlib.NewFilterAllowApplication(providerKey, layer, sublayerKey, sublayerDName, "", platform.ObfsproxyStartScript(), isPersistant), "allow application - obfsproxy")
 		if err != nil {
 			return fmt.Errorf("failed to add filter 'allow application - obfsproxy': %w", err)
 		}
 		// allow dnscrypt-proxy
 		dnscryptProxyBin, _, _, _ := platform.DnsCryptProxyInfo()
-		_, err = manager.AddFilter(winlib.NewFilterAllowApplication(providerKey, layer, sublayerKey, sublayerDName, "", dnscryptProxyBin, isPersistant))
+		_, err = addFilter(winlib.NewFilterAllowApplication(providerKey, layer, sublayerKey, sublayerDName, "", dnscryptProxyBin, isPersistant), "allow application - dnscrypt-proxy")
 		if err != nil {
 			return fmt.Errorf("failed to add filter 'allow application - dnscrypt-proxy': %w", err)
 		}
 
-		_, err = manager.AddFilter(winlib.NewFilterAllowRemoteIP(providerKey, layer, sublayerKey, filterDName, "", net.ParseIP("127.0.0.1"), net.IPv4(255, 255, 255, 255), isPersistant))
+		_, err = addFilter(winlib.NewFilterAllowRemoteIP(providerKey, layer, sublayerKey, filterDName, "", net.ParseIP("127.0.0.1"), net.IPv4(255, 255, 255, 255), isPersistant), "allow localhost")
 		if err != nil {
 			return fmt.Errorf("failed to add filter 'allow remote IP': %w", err)
 		}
@@ -420,7 +435,7 @@ func doEnable() (retErr error) {
 		// LAN
 		if isAllowLAN {
 			for _, ip := range localAddressesV4 {
-				_, err = manager.AddFilter(winlib.NewFilterAllowRemoteIP(providerKey, layer, sublayerKey, filterDName, "", ip.IP, net.IP(ip.Mask), isPersistant))
+				_, err = addFilter(winlib.NewFilterAllowRemoteIP(providerKey, layer, sublayerKey, filterDName, "", ip.IP, net.IP(ip.Mask), isPersistant), "allow LAN "+ip.String())
 				if err != nil {
 					return fmt.Errorf("failed to add filter 'allow LAN': %w", err)
 				}
@@ -429,23 +444,108 @@ func doEnable() (retErr error) {
 
 		// Multicast
 		if isAllowLANMulticast {
-			_, err = manager.AddFilter(winlib.NewFilterAllowRemoteIP(providerKey, layer, sublayerKey, filterDName, "",
-				net.IPv4(224, 0, 0, 0), net.IPv4(240, 0, 0, 0), isPersistant))
+			_, err = addFilter(winlib.NewFilterAllowRemoteIP(providerKey, layer, sublayerKey, filterDName, "",
+				net.IPv4(224, 0, 0, 0), net.IPv4(240, 0, 0, 0), isPersistant), "allow LAN multicast")
 			if err != nil {
 				return fmt.Errorf("failed to add filter 'allow lan-multicast': %w", err)
 			}
 		}
 
 		// user exceptions
-		userExpsNets := getUserExceptions(true, false)
-		for _, n := range userExpsNets {
-			_, err = manager.AddFilter(winlib.NewFilterAllowRemoteIP(providerKey, layer, sublayerKey, filterDName, "", n.IP, net.IP(n.Mask), isPersistant))
-			if err != nil {
-				return fmt.Errorf("failed to add filter 'allow LAN': %w", err)
+		if err = addUserExceptionsFilters(layer, true, false); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addUserExceptionsFilters adds filters for user exceptions into the layer
+func addUserExceptionsFilters(layer syscall.GUID, ipv4, ipv6 bool) error {
+	// ALE_AUTH_CONNECT layers - outgoing connections; ALE_AUTH_RECV_ACCEPT layers - incoming connections
+	isOutboundLayer := layer == winlib.FwpmLayerAleAuthConnectV4 || layer == winlib.FwpmLayerAleAuthConnectV6
+
+	for _, e := range getUserExceptions(ipv4, ipv6, true) {
+		if err := addUserExceptionFilter(layer, e, isOutboundLayer); err != nil {
+			return err
+		}
+	}
+	for _, e := range getUserExceptions(ipv4, ipv6, false) {
+		if (e.Direction == ExceptionDirectionOut && !isOutboundLayer) || (e.Direction == ExceptionDirectionIn && isOutboundLayer) {
+			continue
+		}
+		if err := addUserExceptionFilter(layer, e, isOutboundLayer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addUserExceptionFilter(layer syscall.GUID, e Exception, isOutboundLayer bool) error {
+	n, err := e.Network()
+	if err != nil {
+		return fmt.Errorf("failed to add filter 'user exception': %w", err)
+	}
+
+	var f winlib.Filter
+	if n.IP.To4() != nil {
+		f = winlib.NewFilterAllowRemoteIP(providerKey, layer, sublayerKey, filterDName, "", n.IP, net.IP(n.Mask), isPersistant)
+	} else {
+		prefixLen, _ := n.Mask.Size()
+		f = winlib.NewFilterAllowRemoteIPV6(providerKey, layer, sublayerKey, filterDName, "", n.IP, byte(prefixLen), isPersistant)
+	}
+
+	// protocol
+	var protocols []uint8
+	switch e.Protocol {
+	case ExceptionProtocolTCP:
+		protocols = []uint8{6}
+	case ExceptionProtocolUDP:
+		protocols = []uint8{17}
+	case ExceptionProtocolICMP:
+		if n.IP.To4() != nil {
+			protocols = []uint8{1}
+		} else {
+			protocols = []uint8{58}
+		}
+	default:
+		if e.PortFrom != 0 {
+			// ports are applicable only for TCP and UDP
+			protocols = []uint8{6, 17}
+		}
+	}
+	from, to := e.Ports()
+	if (len(protocols) > 0 || from != to) && !winlib.IsProtocolAndPortRangeConditionsSupported() {
+		// The native library is outdated. Skip the exception rather than allowing more than it was requested.
+		log.Warning(fmt.Sprintf("Firewall exception '%s' is not applied: protocol and port range restrictions are not supported by the firewall library (the library must be updated)", e.String()))
+		return nil
+	}
+
+	// NOTE: conditions with the same field key are combined by WFP with 'OR'
+	for _, p := range protocols {
+		f.AddCondition(&winlib.ConditionIPProtocol{Match: winlib.FwpMatchEqual, Protocol: p})
+	}
+
+	// ports (port of the service: remote port for outgoing connections, local port for incoming connections)
+	if from != 0 {
+		if isOutboundLayer {
+			if from == to {
+				f.AddCondition(&winlib.ConditionIPRemotePort{Match: winlib.FwpMatchEqual, Port: from})
+			} else {
+				f.AddCondition(&winlib.ConditionIPRemotePortRange{PortFrom: from, PortTo: to})
+			}
+		} else {
+			if from == to {
+				f.AddCondition(&winlib.ConditionIPLocalPort{Match: winlib.FwpMatchEqual, Port: from})
+			} else {
+				f.AddCondition(&winlib.ConditionIPLocalPortRange{PortFrom: from, PortTo: to})
 			}
 		}
 	}
 
+	if _, err := addFilter(f, "exception "+e.String()); err != nil {
+		return fmt.Errorf("failed to add filter 'user exception' (%s): %w", e.String(), err)
+	}
 	return nil
 }
 
@@ -496,6 +596,7 @@ func doDisable() error {
 	}
 
 	clientLocalIPFilterIDs = nil
+	installedFilters = nil
 
 	return nil
 }
@@ -516,7 +617,7 @@ func doAddClientIPFilters(clientLocalIP net.IP, clientLocalIPv6 net.IP) (retErr
 	filters := make([]uint64, 0, len(v4Layers))
 	for _, layer := range v4Layers {
 		f := winlib.NewFilterAllowLocalIP(providerKey, layer, sublayerKey, filterDName, "", clientLocalIP, net.IPv4(255, 255, 255, 255), false)
-		id, err := manager.AddFilter(f)
+		id, err := addFilter(f, "allow VPN interface")
 		if err != nil {
 			return fmt.Errorf("failed to add filter : %w", err)
 		}
@@ -527,7 +628,7 @@ func doAddClientIPFilters(clientLocalIP net.IP, clientLocalIPv6 net.IP) (retErr
 	if clientLocalIPv6 != nil {
 		for _, layer := range v6Layers {
 			f := winlib.NewFilterAllowLocalIPV6(providerKey, layer, sublayerKey, filterDName, "", clientLocalIPv6, byte(128), false)
-			id, err := manager.AddFilter(f)
+			id, err := addFilter(f, "allow VPN interface IPv6")
 			if err != nil {
 				return fmt.Errorf("failed to add IPv6 filter : %w", err)
 			}
@@ -558,22 +659,30 @@ func doRemoveClientIPFilters() (retErr error) {
 		if err != nil {
 			return fmt.Errorf("failed to delete filter : %w", err)
 		}
+		forgetFilter(filterID)
 	}
 
 	return nil
 }
 
-func getUserExceptions(ipv4, ipv6 bool) []net.IPNet {
-	ret := []net.IPNet{}
-	for _, e := range userExceptions {
-		isIPv6 := e.IP.To4() == nil
-		isIPv4 := !isIPv6
+// addFilter adds WFP filter and keeps its ID (in use to verify that the filter was not removed by a third-party)
+func addFilter(f winlib.Filter, description string) (uint64, error) {
+	id, err := manager.AddFilter(f)
+	if err != nil {
+		return id, err
+	}
+	installedFilters = append(installedFilters, installedFilter{id: id, description: description})
+	return id, nil
+}
 
-		if !(isIPv4 && ipv4) && !(isIPv6 && ipv6) {
-			continue
+// forgetFilter removes the filter from the list of installed filters
+// (the new list is created: the previous one can be in use to restore the state when the transaction is aborted)
+func forgetFilter(id uint64) {
+	filters := make([]installedFilter, 0, len(installedFilters))
+	for _, f := range installedFilters {
+		if f.id != id {
+			filters = append(filters, f)
 		}
-
-		ret = append(ret, e)
 	}
-	return ret
+	installedFilters = filters
 }
@@ -0,0 +1,99 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package firewall
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/ivpn/desktop-app/daemon/netinfo"
+)
+
+var (
+	gatewayConfig GatewayConfig
+	gatewayStatus GatewayStatus
+)
+
+// SetGatewayConfig applies the configuration of VPN gateway mode.
+// When gateway mode is enabled the traffic from LAN interface is forwarded (NAT) only through the VPN tunnel;
+// when VPN is not connected - all forwarded traffic is blocked.
+func SetGatewayConfig(cfg GatewayConfig) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if cfg.IsEnabled() {
+		if _, err := net.InterfaceByName(cfg.LanInterface); err != nil {
+			return fmt.Errorf("LAN interface '%s' not found: %w", cfg.LanInterface, err)
+		}
+	}
+
+	prevConfig := gatewayConfig
+	gatewayConfig = cfg
+	if err := gatewayApply(); err != nil {
+		gatewayConfig = prevConfig
+		return err
+	}
+	return nil
+}
+
+// GetGatewayStatus returns the current state of VPN gateway mode
+func GetGatewayStatus() GatewayStatus {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return gatewayStatus
+}
+
+// gatewayApply updates the rules of gateway mode according to the configuration and the VPN connection state
+// (must be called under locked mutex)
+func gatewayApply() error {
+	status := GatewayStatus{Config: gatewayConfig}
+	if gatewayConfig.IsEnabled() && isConnectedExpected() {
+		inf, err := netinfo.InterfaceByIPAddr(connectedClientInterfaceIP)
+		if err != nil {
+			return fmt.Errorf("failed to get local interface by IP: %w", err)
+		}
+		status.VpnInterface = inf.Name
+
+		// it is not possible to redirect DNS requests to the local resolver (e.g. DNS-over-HTTPS proxy)
+		if dnsIP := getDnsIP(); gatewayConfig.IsRedirectDNS && dnsIP != nil && dnsIP.To4() != nil && !dnsIP.IsLoopback() {
+			status.DnsIP = dnsIP.String()
+		}
+	}
+
+	if err := implGatewayApply(status); err != nil {
+		return fmt.Errorf("failed to apply gateway mode rules: %w", err)
+	}
+	gatewayStatus = status
+	return nil
+}
+
+// gatewayUpdate re-applies the rules of gateway mode on VPN connection state change
+// (must be called under locked mutex)
+func gatewayUpdate() {
+	if !gatewayConfig.IsEnabled() {
+		return
+	}
+	if err := gatewayApply(); err != nil {
+		log.Error(err)
+	}
+}
@@ -0,0 +1,73 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package firewall
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ivpn/desktop-app/daemon/service/platform"
+	"github.com/ivpn/desktop-app/daemon/shell"
+)
+
+const ipForwardFile = "/proc/sys/net/ipv4/ip_forward"
+
+// original value of 'ip_forward' (nil - it was not changed by the gateway mode)
+var gatewayIPForwardOrig []byte
+
+func implGatewayApply(status GatewayStatus) error {
+	if !status.Config.IsEnabled() {
+		err := shell.Exec(nil, platform.FirewallScript(), "-gateway_disable")
+
+		// restore IP forwarding state
+		if gatewayIPForwardOrig != nil {
+			if e := ioutil.WriteFile(ipForwardFile, gatewayIPForwardOrig, 0644); e != nil {
+				log.Error("Failed to restore IP forwarding state: ", e)
+			}
+			gatewayIPForwardOrig = nil
+		}
+		return err
+	}
+
+	log.Info(fmt.Sprintf("-gateway_apply LAN='%s' VPN='%s' DNS='%s'", status.Config.LanInterface, status.VpnInterface, status.DnsIP))
+	// Note: the rules blocking the forwarded traffic must be applied before enabling IP forwarding
+	if err := shell.Exec(nil, platform.FirewallScript(), "-gateway_apply", status.Config.LanInterface, status.VpnInterface, status.DnsIP); err != nil {
+		return err
+	}
+
+	// enable IP forwarding
+	if gatewayIPForwardOrig == nil {
+		orig, err := ioutil.ReadFile(ipForwardFile)
+		if err != nil {
+			return fmt.Errorf("failed to read IP forwarding state: %w", err)
+		}
+		if strings.TrimSpace(string(orig)) != "1" {
+			if err := ioutil.WriteFile(ipForwardFile, []byte("1"), 0644); err != nil {
+				return fmt.Errorf("failed to enable IP forwarding: %w", err)
+			}
+			gatewayIPForwardOrig = orig
+		}
+	}
+	return nil
+}
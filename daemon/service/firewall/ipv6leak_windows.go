@@ -0,0 +1,145 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package firewall
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/ivpn/desktop-app/daemon/service/firewall/winlib"
+)
+
+// IPv6 leak protection is using its own provider and sublayer
+// (it is independent from the IVPN Kill Switch: the kill-switch filters can be removed/re-created at any time)
+var (
+	ipv6LeakProviderKey = syscall.GUID{Data1: 0xfed0afd4, Data2: 0x98d4, Data3: 0x4233, Data4: [8]byte{0xa4, 0xf3, 0x8b, 0x7c, 0x02, 0x44, 0x50, 0x03}}
+	ipv6LeakSublayerKey = syscall.GUID{Data1: 0xfed0afd4, Data2: 0x98d4, Data3: 0x4233, Data4: [8]byte{0xa4, 0xf3, 0x8b, 0x7c, 0x02, 0x44, 0x50, 0x04}}
+)
+
+const (
+	ipv6LeakProviderDName = "IVPN IPv6 Leak Protection"
+	ipv6LeakSublayerDName = "IVPN IPv6 Leak Protection Sub-Layer"
+	ipv6LeakFilterDName   = "IVPN IPv6 Leak Protection filter"
+)
+
+// implSetIPv6LeakProtection blocks all IPv6 traffic except local addresses
+// Note: the protection is in use only when IPv6 is not routed through the tunnel,
+// so there is no IPv6 traffic to allow over the VPN interface ('vpnInterfaceName' is ignored)
+func implSetIPv6LeakProtection(enable bool, vpnInterfaceName string) (retErr error) {
+	// start transaction
+	if err := manager.TransactionStart(); err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	// do not forget to stop transaction
+	defer func() {
+		if r := recover(); r == nil && retErr == nil {
+			manager.TransactionCommit() // commit WFP transaction
+		} else {
+			manager.TransactionAbort() // abort WFPtransaction
+
+			if r != nil {
+				log.Error("PANIC (recovered): ", r)
+				if e, ok := r.(error); ok {
+					retErr = e
+				} else {
+					retErr = errors.New(fmt.Sprint(r))
+				}
+			}
+		}
+	}()
+
+	if err := doDisableIPv6LeakProtection(); err != nil {
+		return err
+	}
+	if !enable {
+		return nil
+	}
+
+	const isPersistent = false
+	if err := manager.AddProvider(winlib.CreateProvider(ipv6LeakProviderKey, ipv6LeakProviderDName, "", isPersistent)); err != nil {
+		return fmt.Errorf("failed to add provider : %w", err)
+	}
+	sublayer := winlib.CreateSubLayer(ipv6LeakSublayerKey, ipv6LeakProviderKey, ipv6LeakSublayerDName, "",
+		0xFFE0, // smaller than the weight of the IVPN Kill Switch sublayer
+		isPersistent)
+	if err := manager.AddSubLayer(sublayer); err != nil {
+		return fmt.Errorf("failed to add sublayer: %w", err)
+	}
+
+	allowed := []struct {
+		ip        net.IP
+		prefixLen byte
+	}{
+		{net.IPv6loopback, 128},     // LOOPBACK 		::1/128
+		{net.ParseIP("fe80::"), 10}, // LINKLOCAL		fe80::/10
+		{net.ParseIP("fc00::"), 7},  // UNIQUELOCAL	fc00::/7
+		{net.ParseIP("ff00::"), 8},  // MULTICAST		ff00::/8
+	}
+
+	for _, layer := range v6Layers {
+		_, err := manager.AddFilter(winlib.NewFilterBlockAll(ipv6LeakProviderKey, layer, ipv6LeakSublayerKey, ipv6LeakFilterDName, "", true, isPersistent))
+		if err != nil {
+			return fmt.Errorf("failed to add filter 'block all IPv6': %w", err)
+		}
+		for _, a := range allowed {
+			_, err = manager.AddFilter(winlib.NewFilterAllowRemoteIPV6(ipv6LeakProviderKey, layer, ipv6LeakSublayerKey, ipv6LeakFilterDName, "", a.ip, a.prefixLen, isPersistent))
+			if err != nil {
+				return fmt.Errorf("failed to add filter 'allow remote IP' for %s/%d: %w", a.ip, a.prefixLen, err)
+			}
+		}
+	}
+	return nil
+}
+
+func doDisableIPv6LeakProtection() error {
+	pinfo, err := manager.GetProviderInfo(ipv6LeakProviderKey)
+	if err != nil {
+		return fmt.Errorf("failed to get provider info : %w", err)
+	}
+	if !pinfo.IsInstalled {
+		return nil
+	}
+
+	for _, l := range v6Layers {
+		if err := manager.DeleteFilterByProviderKey(ipv6LeakProviderKey, l); err != nil {
+			return fmt.Errorf("failed to delete filter : %w", err)
+		}
+	}
+
+	installed, err := manager.IsSubLayerInstalled(ipv6LeakSublayerKey)
+	if err != nil {
+		return fmt.Errorf("failed to check is sublayer installed : %w", err)
+	}
+	if installed {
+		if err := manager.DeleteSubLayer(ipv6LeakSublayerKey); err != nil {
+			return fmt.Errorf("failed to delete sublayer : %w", err)
+		}
+	}
+
+	if err := manager.DeleteProvider(ipv6LeakProviderKey); err != nil {
+		return fmt.Errorf("failed to delete provider : %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package firewall
+
+import (
+	fwtypes "github.com/ivpn/desktop-app/daemon/service/firewall/types"
+)
+
+// The firewall configuration types are defined in the dependency-free package 'firewall/types'
+// (it is in use by the clients and by the preferences; the firewall implementation is not required there)
+
+type (
+	ExceptionProtocol  = fwtypes.ExceptionProtocol
+	ExceptionDirection = fwtypes.ExceptionDirection
+	Exception          = fwtypes.Exception
+	InboundRule        = fwtypes.InboundRule
+	TemporaryException = fwtypes.TemporaryException
+	GatewayConfig      = fwtypes.GatewayConfig
+	GatewayStatus      = fwtypes.GatewayStatus
+	VerifyReport       = fwtypes.VerifyReport
+	BlockedPacket      = fwtypes.BlockedPacket
+)
+
+const (
+	ExceptionProtocolAny  = fwtypes.ExceptionProtocolAny
+	ExceptionProtocolTCP  = fwtypes.ExceptionProtocolTCP
+	ExceptionProtocolUDP  = fwtypes.ExceptionProtocolUDP
+	ExceptionProtocolICMP = fwtypes.ExceptionProtocolICMP
+
+	ExceptionDirectionBoth = fwtypes.ExceptionDirectionBoth
+	ExceptionDirectionOut  = fwtypes.ExceptionDirectionOut
+	ExceptionDirectionIn   = fwtypes.ExceptionDirectionIn
+)
+
+var (
+	ParseUserExceptions       = fwtypes.ParseUserExceptions
+	UserExceptionsString      = fwtypes.UserExceptionsString
+	ReplaceHostOnlyExceptions = fwtypes.ReplaceHostOnlyExceptions
+)
@@ -0,0 +1,46 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package types
+
+import (
+	"time"
+)
+
+// BlockedPacket - information about the packet blocked by the firewall
+type BlockedPacket struct {
+	Seq       uint64 // sequence number of the entry (increasing)
+	Time      time.Time
+	Direction ExceptionDirection // 'out' or 'in'
+	Protocol  string             // e.g. "tcp", "udp", "icmp" ...
+
+	Source          string
+	SourcePort      uint16 `json:",omitempty"`
+	Destination     string
+	DestinationPort uint16 `json:",omitempty"`
+
+	// local process which sent the packet (if resolvable; only for outbound packets)
+	Pid     int    `json:",omitempty"`
+	Process string `json:",omitempty"`
+}
+
+// blockedLog - bounded in-memory ring of the blocked packets
@@ -0,0 +1,230 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package types
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"unicode"
+)
+
+// ExceptionProtocol - protocol of the firewall exception
+type ExceptionProtocol string
+
+const (
+	ExceptionProtocolAny  ExceptionProtocol = ""
+	ExceptionProtocolTCP  ExceptionProtocol = "tcp"
+	ExceptionProtocolUDP  ExceptionProtocol = "udp"
+	ExceptionProtocolICMP ExceptionProtocol = "icmp"
+)
+
+// ExceptionDirection - direction of the connections allowed by the firewall exception
+type ExceptionDirection string
+
+const (
+	ExceptionDirectionBoth ExceptionDirection = ""
+	ExceptionDirectionOut  ExceptionDirection = "out" // connections initiated by the local host
+	ExceptionDirectionIn   ExceptionDirection = "in"  // connections initiated by the remote host
+)
+
+// Exception - user-defined firewall exception (the traffic which is allowed even when the firewall is blocking everything else)
+type Exception struct {
+	// IP address or network (CIDR) in format: x.x.x.x[/xx] (IPv6 addresses are also supported)
+	Host     string
+	Protocol ExceptionProtocol `json:",omitempty"`
+	// Range of ports (0 - any port). If 'PortTo' is not defined - only 'PortFrom' port is allowed.
+	// It is a port of the service: remote port for outgoing connections and local port for incoming connections.
+	// Applicable only for TCP and UDP protocols ('any' protocol means TCP+UDP when port is defined)
+	PortFrom    uint16             `json:",omitempty"`
+	PortTo      uint16             `json:",omitempty"`
+	Direction   ExceptionDirection `json:",omitempty"`
+	Description string             `json:",omitempty"`
+}
+
+// Network returns IP network of the exception
+func (e Exception) Network() (*net.IPNet, error) {
+	host := strings.TrimSpace(e.Host)
+	if strings.Contains(host, "/") {
+		_, n, err := net.ParseCIDR(host)
+		return n, err
+	}
+
+	addr := net.ParseIP(host)
+	if addr == nil {
+		return nil, fmt.Errorf("%s not a IP address", host)
+	}
+	if addr.To4() == nil {
+		// IPv6 single address
+		return &net.IPNet{IP: addr, Mask: net.CIDRMask(128, 128)}, nil
+	}
+	// IPv4 single address
+	return &net.IPNet{IP: addr.To4(), Mask: net.CIDRMask(32, 32)}, nil
+}
+
+// IsIPv6 returns 'true' when the exception is defined for IPv6 network
+func (e Exception) IsIPv6() bool {
+	n, err := e.Network()
+	return err == nil && n.IP.To4() == nil
+}
+
+// Ports returns the range of ports (0,0 - any port)
+func (e Exception) Ports() (from, to uint16) {
+	if e.PortFrom == 0 {
+		return 0, 0
+	}
+	if e.PortTo == 0 {
+		return e.PortFrom, e.PortFrom
+	}
+	return e.PortFrom, e.PortTo
+}
+
+// IsHostOnly returns 'true' when the exception allows any communication with the host
+// (no restrictions by protocol, ports or direction)
+func (e Exception) IsHostOnly() bool {
+	return e.Protocol == ExceptionProtocolAny && e.PortFrom == 0 && e.Direction == ExceptionDirectionBoth
+}
+
+// Validate checks the exception parameters
+func (e Exception) Validate() error {
+	if _, err := e.Network(); err != nil {
+		return fmt.Errorf("bad host '%s': %w", e.Host, err)
+	}
+
+	switch e.Protocol {
+	case ExceptionProtocolAny, ExceptionProtocolTCP, ExceptionProtocolUDP, ExceptionProtocolICMP:
+	default:
+		return fmt.Errorf("unsupported protocol '%s'", e.Protocol)
+	}
+
+	switch e.Direction {
+	case ExceptionDirectionBoth, ExceptionDirectionOut, ExceptionDirectionIn:
+	default:
+		return fmt.Errorf("unsupported direction '%s'", e.Direction)
+	}
+
+	if e.PortFrom == 0 && e.PortTo != 0 {
+		return fmt.Errorf("bad port range: start port not defined")
+	}
+	if from, to := e.Ports(); from > to {
+		return fmt.Errorf("bad port range %d-%d", from, to)
+	}
+	if e.PortFrom != 0 && e.Protocol == ExceptionProtocolICMP {
+		return fmt.Errorf("ports are not applicable for ICMP protocol")
+	}
+	return nil
+}
+
+// Normalized returns the copy of exception with the host in canonical CIDR notation
+func (e Exception) Normalized() (Exception, error) {
+	if err := e.Validate(); err != nil {
+		return e, err
+	}
+	n, _ := e.Network()
+	e.Host = n.String()
+	if e.PortTo == e.PortFrom {
+		e.PortTo = 0
+	}
+	return e, nil
+}
+
+// String returns the human-readable representation of the exception
+func (e Exception) String() string {
+	ret := e.Host
+
+	proto := string(e.Protocol)
+	if len(proto) == 0 {
+		proto = "any"
+	}
+	ret += " " + proto
+
+	if from, to := e.Ports(); from != 0 {
+		if from == to {
+			ret += fmt.Sprintf(":%d", from)
+		} else {
+			ret += fmt.Sprintf(":%d-%d", from, to)
+		}
+	}
+
+	switch e.Direction {
+	case ExceptionDirectionOut:
+		ret += " outbound"
+	case ExceptionDirectionIn:
+		ret += " inbound"
+	default:
+		ret += " in/out"
+	}
+
+	if len(e.Description) > 0 {
+		ret += fmt.Sprintf(" (%s)", e.Description)
+	}
+	return ret
+}
+
+// ParseUserExceptions parses the list of host-only exceptions
+// Parameters:
+//	- exceptions - comma separated list of IP addresses in format: x.x.x.x[/xx]
+func ParseUserExceptions(exceptions string, ignoreParseErrors bool) ([]Exception, error) {
+	ret := []Exception{}
+
+	splitFunc := func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsNumber(c) && c != rune('/') && c != rune('.') && c != rune(':')
+	}
+	exceptionsArr := strings.FieldsFunc(exceptions, splitFunc)
+	for _, exp := range exceptionsArr {
+		e, err := Exception{Host: strings.TrimSpace(exp)}.Normalized()
+		if err != nil {
+			if !ignoreParseErrors {
+				return nil, fmt.Errorf("unable to parse firewall exceptions ('%s'): %w", exceptions, err)
+			}
+			continue
+		}
+		ret = append(ret, e)
+	}
+
+	return ret, nil
+}
+
+// UserExceptionsString returns comma separated list of host-only exceptions (in format: x.x.x.x[/xx])
+func UserExceptionsString(exceptions []Exception) string {
+	hosts := make([]string, 0, len(exceptions))
+	for _, e := range exceptions {
+		if e.IsHostOnly() {
+			hosts = append(hosts, e.Host)
+		}
+	}
+	return strings.Join(hosts, ",")
+}
+
+// ReplaceHostOnlyExceptions returns the list of exceptions where all host-only exceptions are replaced by 'hostOnly'
+// (exceptions restricted by protocol/ports/direction are kept)
+func ReplaceHostOnlyExceptions(exceptions []Exception, hostOnly []Exception) []Exception {
+	ret := make([]Exception, 0, len(exceptions)+len(hostOnly))
+	ret = append(ret, hostOnly...)
+	for _, e := range exceptions {
+		if !e.IsHostOnly() {
+			ret = append(ret, e)
+		}
+	}
+	return ret
+}
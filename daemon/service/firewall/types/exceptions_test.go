@@ -0,0 +1,123 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package types_test
+
+import (
+	"testing"
+	"time"
+
+	fwtypes "github.com/ivpn/desktop-app/daemon/service/firewall/types"
+)
+
+func TestParseUserExceptions(t *testing.T) {
+	exps, err := fwtypes.ParseUserExceptions("192.168.0.0/16, 10.10.0.1;fe80::1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := fwtypes.UserExceptionsString(exps); s != "192.168.0.0/16,10.10.0.1/32,fe80::1/128" {
+		t.Error("unexpected exceptions:", s)
+	}
+
+	if _, err := fwtypes.ParseUserExceptions("1.1.1.1, bad_host", false); err == nil {
+		t.Error("error expected")
+	}
+	if exps, err := fwtypes.ParseUserExceptions("1.1.1.1, bad_host", true); err != nil || len(exps) != 1 {
+		t.Error("bad host must be skipped")
+	}
+}
+
+func TestExceptionValidate(t *testing.T) {
+	tests := []struct {
+		e     fwtypes.Exception
+		valid bool
+	}{
+		{fwtypes.Exception{Host: "10.0.0.0/8"}, true},
+		{fwtypes.Exception{Host: "10.0.0.1", Protocol: fwtypes.ExceptionProtocolTCP, PortFrom: 22, Direction: fwtypes.ExceptionDirectionIn}, true},
+		{fwtypes.Exception{Host: "10.0.0.1", Protocol: fwtypes.ExceptionProtocolUDP, PortFrom: 5000, PortTo: 5010}, true},
+		{fwtypes.Exception{Host: "10.0.0.1", PortFrom: 443}, true},
+		{fwtypes.Exception{Host: "10.0.0.1", PortFrom: 5010, PortTo: 5000}, false},
+		{fwtypes.Exception{Host: "10.0.0.1", PortTo: 5000}, false},
+		{fwtypes.Exception{Host: "10.0.0.1", Protocol: fwtypes.ExceptionProtocolICMP, PortFrom: 1}, false},
+		{fwtypes.Exception{Host: "10.0.0.1", Protocol: "sctp"}, false},
+		{fwtypes.Exception{Host: "10.0.0.1", Direction: "forward"}, false},
+		{fwtypes.Exception{Host: "host.example.com"}, false},
+	}
+
+	for _, test := range tests {
+		if err := test.e.Validate(); (err == nil) != test.valid {
+			t.Errorf("%v: unexpected validation result: %v", test.e, err)
+		}
+	}
+}
+
+func TestReplaceHostOnlyExceptions(t *testing.T) {
+	exps := []fwtypes.Exception{
+		{Host: "1.1.1.1/32"},
+		{Host: "2.2.2.2/32", Protocol: fwtypes.ExceptionProtocolTCP, PortFrom: 443},
+	}
+	ret := fwtypes.ReplaceHostOnlyExceptions(exps, []fwtypes.Exception{{Host: "3.3.3.3/32"}})
+	if len(ret) != 2 || ret[0].Host != "3.3.3.3/32" || ret[1].Host != "2.2.2.2/32" {
+		t.Error("unexpected result:", ret)
+	}
+}
+
+func TestInboundRuleExceptions(t *testing.T) {
+	r := fwtypes.InboundRule{Protocol: fwtypes.ExceptionProtocolTCP, PortFrom: 22}
+	if err := r.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	exps := r.Exceptions()
+	if len(exps) != 2 || exps[0].Host != "0.0.0.0/0" || exps[1].Host != "::/0" || exps[0].Direction != fwtypes.ExceptionDirectionIn {
+		t.Error("unexpected exceptions for the rule without source:", exps)
+	}
+
+	r.Source = "10.1.0.0/16"
+	if exps := r.Exceptions(); len(exps) != 1 || exps[0].Host != "10.1.0.0/16" || exps[0].PortFrom != 22 {
+		t.Error("unexpected exceptions for the rule with source:", exps)
+	}
+
+	if err := (fwtypes.InboundRule{Source: "10.1.0.0/16"}).Validate(); err == nil {
+		t.Error("error expected: port not defined")
+	}
+}
+
+func TestTemporaryException(t *testing.T) {
+	now := time.Now()
+	e, err := fwtypes.TemporaryException{Host: "10.0.0.1", ExpiresAt: now.Add(time.Minute)}.Normalized()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Host != "10.0.0.1/32" {
+		t.Error("unexpected host:", e.Host)
+	}
+	if e.IsExpired(now) || e.RemainingTime(now) != time.Minute {
+		t.Error("unexpected remaining time:", e.RemainingTime(now))
+	}
+	if !e.IsExpired(now.Add(time.Minute)) || e.RemainingTime(now.Add(time.Hour)) != 0 {
+		t.Error("exception expected to be expired")
+	}
+
+	if _, err := (fwtypes.TemporaryException{Host: "bad_host"}).Normalized(); err == nil {
+		t.Error("error expected: bad host")
+	}
+}
@@ -0,0 +1,46 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package types
+
+// GatewayConfig - configuration of VPN gateway mode (sharing the VPN tunnel with the devices in LAN)
+type GatewayConfig struct {
+	// LAN interface: the traffic from this interface is forwarded through the VPN tunnel (empty - gateway mode is disabled)
+	LanInterface string
+	// IsRedirectDNS - redirect DNS requests of LAN clients to the DNS server in use by VPN connection (VPN, AntiTracker or custom DNS)
+	IsRedirectDNS bool
+}
+
+// IsEnabled returns 'true' when gateway mode is enabled
+func (c GatewayConfig) IsEnabled() bool {
+	return len(c.LanInterface) > 0
+}
+
+// GatewayStatus - current state of VPN gateway mode
+type GatewayStatus struct {
+	Config GatewayConfig
+	// VPN interface the traffic from LAN is forwarded to
+	// (empty - VPN is not connected: all the traffic from LAN is blocked)
+	VpnInterface string
+	// DNS server for LAN clients (empty - DNS requests are not redirected)
+	DnsIP string
+}
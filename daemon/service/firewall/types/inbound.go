@@ -0,0 +1,112 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package types
+
+import (
+	"fmt"
+)
+
+// InboundRule - allows incoming connections to the local service (listening port) from the source network.
+// The rule is in use by the firewall both when VPN is connected and when it is disconnected.
+type InboundRule struct {
+	// Protocol: TCP or UDP ('any' means TCP+UDP)
+	Protocol ExceptionProtocol `json:",omitempty"`
+	// Local (listening) port or range of ports. If 'PortTo' is not defined - only 'PortFrom' port is allowed.
+	PortFrom uint16
+	PortTo   uint16 `json:",omitempty"`
+	// Source network (CIDR) or IP address. Empty - any source (IPv4 and IPv6).
+	Source      string `json:",omitempty"`
+	Description string `json:",omitempty"`
+}
+
+// Validate checks the rule parameters
+func (r InboundRule) Validate() error {
+	if r.PortFrom == 0 {
+		return fmt.Errorf("listening port not defined")
+	}
+	if r.Protocol == ExceptionProtocolICMP {
+		return fmt.Errorf("protocol '%s' is not applicable for inbound rules", r.Protocol)
+	}
+	for _, e := range r.Exceptions() {
+		if err := e.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Normalized returns the copy of the rule with the source in canonical CIDR notation
+func (r InboundRule) Normalized() (InboundRule, error) {
+	if err := r.Validate(); err != nil {
+		return r, err
+	}
+	if len(r.Source) > 0 {
+		n, _ := Exception{Host: r.Source}.Network()
+		r.Source = n.String()
+	}
+	if r.PortTo == r.PortFrom {
+		r.PortTo = 0
+	}
+	return r, nil
+}
+
+// Exceptions converts the rule to the firewall exceptions (one exception per IP version when the source is not defined)
+func (r InboundRule) Exceptions() []Exception {
+	e := Exception{
+		Protocol:    r.Protocol,
+		PortFrom:    r.PortFrom,
+		PortTo:      r.PortTo,
+		Direction:   ExceptionDirectionIn,
+		Description: r.Description}
+
+	if len(r.Source) > 0 {
+		e.Host = r.Source
+		return []Exception{e}
+	}
+
+	e4, e6 := e, e
+	e4.Host = "0.0.0.0/0"
+	e6.Host = "::/0"
+	return []Exception{e4, e6}
+}
+
+// String returns the human-readable representation of the rule
+func (r InboundRule) String() string {
+	proto := string(r.Protocol)
+	if len(proto) == 0 {
+		proto = "tcp/udp"
+	}
+	ret := fmt.Sprintf("%s:%d", proto, r.PortFrom)
+	if r.PortTo != 0 && r.PortTo != r.PortFrom {
+		ret += fmt.Sprintf("-%d", r.PortTo)
+	}
+	if len(r.Source) > 0 {
+		ret += " from " + r.Source
+	} else {
+		ret += " from any"
+	}
+	if len(r.Description) > 0 {
+		ret += fmt.Sprintf(" (%s)", r.Description)
+	}
+	return ret
+}
@@ -0,0 +1,68 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package types
+
+import (
+	"fmt"
+	"time"
+)
+
+// TemporaryException - exception for the host (network) which is automatically removed by the daemon
+// when the expiration time comes. The exception is in use by the firewall both when VPN is connected and when it is disconnected.
+type TemporaryException struct {
+	// IP address or network (CIDR)
+	Host      string
+	ExpiresAt time.Time
+}
+
+// Normalized returns the copy of the exception with the host in canonical CIDR notation
+func (e TemporaryException) Normalized() (TemporaryException, error) {
+	n, err := e.Exception().Normalized()
+	if err != nil {
+		return e, err
+	}
+	e.Host = n.Host
+	return e, nil
+}
+
+// Exception returns the firewall exception for the host
+func (e TemporaryException) Exception() Exception {
+	return Exception{Host: e.Host, Description: "temporary"}
+}
+
+// IsExpired returns 'true' when the exception is expired at the specified time
+func (e TemporaryException) IsExpired(t time.Time) bool {
+	return !t.Before(e.ExpiresAt)
+}
+
+// RemainingTime returns the time left until expiration (zero, if the exception is already expired)
+func (e TemporaryException) RemainingTime(t time.Time) time.Duration {
+	if e.IsExpired(t) {
+		return 0
+	}
+	return e.ExpiresAt.Sub(t)
+}
+
+func (e TemporaryException) String() string {
+	return fmt.Sprintf("%s (expires %s)", e.Host, e.ExpiresAt.Format(time.RFC3339))
+}
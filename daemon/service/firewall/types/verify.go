@@ -0,0 +1,43 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package types
+
+import (
+	"time"
+)
+
+// VerifyReport - result of comparison the active firewall rules with the expected state
+type VerifyReport struct {
+	Time time.Time
+	// IsEnabled - expected state of the firewall (when it is disabled - the rules are not verified)
+	IsEnabled bool
+	// Problems - description of the detected differences (empty when the rules are intact)
+	Problems []string
+	// IsRepaired - 'true' when the rules were re-applied
+	IsRepaired bool
+}
+
+// IsTampered returns 'true' when the active firewall rules are not corresponding to the expected state
+func (r VerifyReport) IsTampered() bool {
+	return len(r.Problems) > 0
+}
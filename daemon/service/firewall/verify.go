@@ -0,0 +1,99 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package firewall
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// isEnabledExpected - 'true' when the firewall was enabled by the daemon (the rules are expected to be active)
+var isEnabledExpected bool
+
+// Verify reads back the active firewall rules and compares them with the expected state
+// (enabled, LAN, exceptions, connected server, DNS).
+// When 'repair' is true and the rules were modified by a third-party - the rules are re-applied.
+func Verify(repair bool) (VerifyReport, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	report := VerifyReport{Time: time.Now(), IsEnabled: isEnabledExpected}
+	if !isEnabledExpected {
+		return report, nil
+	}
+
+	problems, err := implVerify()
+	if err != nil {
+		return report, fmt.Errorf("failed to verify firewall rules: %w", err)
+	}
+	report.Problems = problems
+
+	if !report.IsTampered() || !repair {
+		return report, nil
+	}
+
+	log.Warning("Firewall rules were modified externally: ", strings.Join(problems, "; "))
+	log.Info("Re-applying firewall rules...")
+	if err := implRepair(); err != nil {
+		log.Error(err)
+		return report, fmt.Errorf("failed to re-apply firewall rules: %w", err)
+	}
+	report.IsRepaired = true
+
+	return report, nil
+}
+
+// reApplyClientConnected restores the rules for the current VPN connection
+// We must not do it in Paused state!
+func reApplyClientConnected() error {
+	clientAddr := connectedClientInterfaceIP
+	clientAddrIPv6 := connectedClientInterfaceIPv6
+	if clientAddr == nil || isClientPaused {
+		return nil
+	}
+	return implClientConnected(clientAddr, clientAddrIPv6, connectedClientPort, connectedHostIP, connectedHostPort, connectedIsTCP)
+}
+
+// isConnectedExpected returns 'true' when the rules for the VPN connection are expected to be active
+func isConnectedExpected() bool {
+	return connectedClientInterfaceIP != nil && !isClientPaused
+}
+
+// expectedExceptionHosts returns the list of hosts (in CIDR notation) which must be allowed by the firewall rules
+// (LAN, exceptions required by the daemon and the host-only user exceptions)
+func expectedExceptionHosts(allowed []string, isIPv6 bool) []string {
+	var ret []string
+	for _, h := range allowed {
+		// e.g. "1.2.3.4" -> "1.2.3.4/32"; "192.168.1.5/24" -> "192.168.1.0/24"
+		if n, err := (Exception{Host: h}).Network(); err == nil && (n.IP.To4() == nil) == isIPv6 {
+			ret = append(ret, n.String())
+		}
+	}
+	for _, e := range getUserExceptions(!isIPv6, isIPv6, true) {
+		if n, err := e.Network(); err == nil {
+			ret = append(ret, n.String())
+		}
+	}
+	return ret
+}
@@ -0,0 +1,127 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package firewall
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ivpn/desktop-app/daemon/service/platform"
+	"github.com/ivpn/desktop-app/daemon/shell"
+)
+
+func implVerify() ([]string, error) {
+	enabled, err := implGetEnabled()
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		// no sense to check the rest
+		return []string{"IVPN anchor is not active (pf is disabled or the rules were removed)"}, nil
+	}
+
+	getOutput := func(args ...string) (string, error) {
+		outText, outErrText, _, err := shell.ExecAndGetOutput(nil, 1024*1024, "", platform.FirewallScript(), args...)
+		if err != nil {
+			return "", fmt.Errorf("failed to get active rules: %w (%s)", err, strings.TrimSpace(outErrText))
+		}
+		return outText, nil
+	}
+
+	var problems []string
+
+	// DNS
+	dnsRules, err := getOutput("-show_rules", "dns")
+	if err != nil {
+		return nil, err
+	}
+	if len(strings.TrimSpace(dnsRules)) == 0 {
+		problems = append(problems, "DNS rules not found")
+	} else if dnsIPs := expectedDnsIPs(); len(dnsIPs) > 0 {
+		dnsTable, err := getOutput("-show_dns_table")
+		if err != nil {
+			return nil, err
+		}
+		allowedDNS := make(map[string]struct{})
+		for _, l := range strings.Split(dnsTable, "\n") {
+			allowedDNS[strings.TrimSpace(l)] = struct{}{}
+		}
+		for _, dnsIP := range dnsIPs {
+			if _, ok := allowedDNS[dnsIP.String()]; !ok {
+				problems = append(problems, fmt.Sprintf("DNS rules are not corresponding to the DNS server %s", dnsIP))
+			}
+		}
+	}
+
+	// VPN connection
+	if isConnectedExpected() {
+		tunnelRules, err := getOutput("-show_rules", "tunnel")
+		if err != nil {
+			return nil, err
+		}
+		if len(strings.TrimSpace(tunnelRules)) == 0 {
+			problems = append(problems, "rules for VPN interface not found")
+		}
+	}
+
+	// exceptions (both the daemon and the user-defined ones)
+	tables, err := getOutput("-show_tables")
+	if err != nil {
+		return nil, err
+	}
+	active := make(map[string]struct{})
+	for _, line := range strings.Split(tables, "\n") {
+		if n, err := (Exception{Host: strings.TrimSpace(line)}).Network(); err == nil {
+			active[n.String()] = struct{}{}
+		}
+	}
+	var allowed []string
+	for ipStr := range allowedHosts {
+		allowed = append(allowed, ipStr)
+	}
+	for _, h := range append(expectedExceptionHosts(allowed, false), expectedExceptionHosts(allowed, true)...) {
+		if _, ok := active[h]; !ok {
+			problems = append(problems, fmt.Sprintf("exception for %s not found", h))
+		}
+	}
+
+	return problems, nil
+}
+
+func implRepair() error {
+	// re-create IVPN anchor (if it was removed)
+	enabled, err := implGetEnabled()
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		if err := shell.Exec(nil, platform.FirewallScript(), "-enable"); err != nil {
+			return fmt.Errorf("failed to execute shell command: %w", err)
+		}
+	}
+
+	if err := reApplyExceptions(); err != nil {
+		return err
+	}
+	return reApplyClientConnected()
+}
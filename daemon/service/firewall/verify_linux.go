@@ -0,0 +1,214 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package firewall
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ivpn/desktop-app/daemon/service/platform"
+	"github.com/ivpn/desktop-app/daemon/shell"
+)
+
+// names of the IVPN chains (see firewall.sh)
+const (
+	chainIvpnIn     = "IVPN-IN"
+	chainIvpnOut    = "IVPN-OUT"
+	chainIvpnOutDNS = "IVPN-OUT-DNS"
+	chainIvpnOutVPN = "IVPN-OUT-VPN"
+)
+
+// iptablesRules - active rules in the format of 'iptables -S' output
+type iptablesRules struct {
+	// chain name -> default policy (only for built-in chains)
+	policies map[string]string
+	// user-defined chains
+	chains map[string]struct{}
+	// chain name -> rules specification (without '-A <chain>' prefix)
+	rules map[string][]string
+}
+
+func parseIptablesRules(text string) iptablesRules {
+	ret := iptablesRules{
+		policies: make(map[string]string),
+		chains:   make(map[string]struct{}),
+		rules:    make(map[string][]string),
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "-P":
+			if len(fields) >= 3 {
+				ret.policies[fields[1]] = fields[2]
+			}
+		case "-N":
+			ret.chains[fields[1]] = struct{}{}
+		case "-A":
+			ret.rules[fields[1]] = append(ret.rules[fields[1]], strings.Join(fields[2:], " "))
+		}
+	}
+	return ret
+}
+
+// checkIptablesRules compares the active rules with the expected state
+// Arguments:
+//	* hosts			-	networks (CIDR) which must be allowed
+//	* dnsIPs		-	allowed DNS servers (empty - all DNS requests must be blocked)
+//	* isConnected	-	the rules for VPN interface must exist
+func checkIptablesRules(r iptablesRules, isIPv6 bool, hosts []string, dnsIPs []string, isConnected bool) []string {
+	prefix := "IPv4: "
+	if isIPv6 {
+		prefix = "IPv6: "
+	}
+
+	var problems []string
+	addProblem := func(format string, a ...interface{}) {
+		problems = append(problems, prefix+fmt.Sprintf(format, a...))
+	}
+
+	for _, ch := range []string{chainIvpnIn, chainIvpnOut} {
+		if _, ok := r.chains[ch]; !ok {
+			addProblem("chain '%s' not found", ch)
+		}
+	}
+	if len(problems) > 0 {
+		// no sense to check the rest
+		return problems
+	}
+
+	for _, ch := range []string{"INPUT", "OUTPUT"} {
+		if p := r.policies[ch]; p != "DROP" {
+			addProblem("default policy of chain '%s' is '%s' (expected 'DROP')", ch, p)
+		}
+	}
+
+	for ch, ivpnCh := range map[string]string{"INPUT": chainIvpnIn, "OUTPUT": chainIvpnOut} {
+		// the jump must be the first rule (only other IVPN chains are allowed before it, e.g. IPv6 leak protection)
+		firstRule := ""
+		for _, rule := range r.rules[ch] {
+			if rule == "-j "+ivpnCh || !strings.HasPrefix(rule, "-j IVPN-") {
+				firstRule = rule
+				break
+			}
+		}
+		if firstRule != "-j "+ivpnCh {
+			addProblem("jump to '%s' is not the first rule of chain '%s'", ivpnCh, ch)
+		}
+		if rules := r.rules[ivpnCh]; len(rules) == 0 || rules[len(rules)-1] != "-j DROP" {
+			addProblem("'DROP' is not the last rule of chain '%s'", ivpnCh)
+		}
+	}
+
+	dnsRules := r.rules[chainIvpnOutDNS]
+	if len(dnsRules) == 0 || !strings.HasSuffix(dnsRules[len(dnsRules)-1], "-j DROP") {
+		addProblem("DNS rules not found")
+	} else if !isIPv6 {
+		for _, dnsIP := range dnsIPs {
+			found := false
+			for _, rule := range dnsRules {
+				if strings.HasPrefix(rule, "-d "+dnsIP+"/32 ") && strings.HasSuffix(rule, "-j RETURN") {
+					found = true
+					break
+				}
+			}
+			if !found {
+				addProblem("DNS rules are not corresponding to the DNS server %s", dnsIP)
+			}
+		}
+	}
+
+	if isConnected && len(r.rules[chainIvpnOutVPN]) == 0 {
+		addProblem("rules for VPN interface not found")
+	}
+
+	allRules := make(map[string]struct{})
+	for ch, rules := range r.rules {
+		if !strings.HasPrefix(ch, "IVPN-") {
+			continue
+		}
+		for _, rule := range rules {
+			allRules[rule] = struct{}{}
+		}
+	}
+	for _, h := range hosts {
+		if _, ok := allRules["-d "+h+" -j ACCEPT"]; !ok {
+			addProblem("exception for %s not found", h)
+		}
+	}
+
+	return problems
+}
+
+func implVerify() ([]string, error) {
+	var allowed []string
+	for ipStr := range allowedHosts {
+		allowed = append(allowed, ipStr)
+	}
+
+	var dnsIPs []string
+	for _, ip := range expectedDnsIPs() {
+		if ip.To4() != nil {
+			dnsIPs = append(dnsIPs, ip.String())
+		}
+	}
+
+	var problems []string
+	for _, isIPv6 := range []bool{false, true} {
+		scriptCommand := "-show_rules"
+		if isIPv6 {
+			scriptCommand = "-show_rules_ipv6"
+		}
+
+		outText, outErrText, _, err := shell.ExecAndGetOutput(nil, 1024*1024, "", platform.FirewallScript(), scriptCommand)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get active rules: %w (%s)", err, strings.TrimSpace(outErrText))
+		}
+		if isIPv6 && len(strings.TrimSpace(outText)) == 0 {
+			continue // IPv6 is disabled in the system
+		}
+
+		problems = append(problems, checkIptablesRules(parseIptablesRules(outText), isIPv6, expectedExceptionHosts(allowed, isIPv6), dnsIPs, isConnectedExpected())...)
+	}
+	return problems, nil
+}
+
+func implRepair() error {
+	if err := shell.Exec(nil, platform.FirewallScript(), "-reenable"); err != nil {
+		return fmt.Errorf("failed to execute shell command: %w", err)
+	}
+
+	if blockedLogIsEnabled() {
+		if err := applyBlockedLogRules(); err != nil {
+			log.Error("Failed to apply blocked traffic logging rules: ", err)
+		}
+	}
+
+	if err := reApplyExceptions(); err != nil {
+		return err
+	}
+	return reApplyClientConnected()
+}
@@ -0,0 +1,85 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package firewall
+
+import (
+	"testing"
+)
+
+const testIptablesRules = `-P INPUT DROP
+-P FORWARD ACCEPT
+-P OUTPUT DROP
+-N IVPN-IN
+-N IVPN-OUT
+-N IVPN-OUT-DNS
+-N IVPN-OUT-VPN
+-N IVPN-OUT-STAT-USER-EXP
+-A INPUT -j IVPN-IN
+-A INPUT -j ufw-before-input
+-A OUTPUT -j IVPN-OUT
+-A IVPN-IN -i lo -j ACCEPT
+-A IVPN-IN -j DROP
+-A IVPN-OUT -o lo -j ACCEPT
+-A IVPN-OUT -j IVPN-OUT-DNS
+-A IVPN-OUT -j IVPN-OUT-VPN
+-A IVPN-OUT -j IVPN-OUT-STAT-USER-EXP
+-A IVPN-OUT -j DROP
+-A IVPN-OUT-DNS -d 10.0.254.1/32 -p udp -m udp --dport 53 -j RETURN
+-A IVPN-OUT-DNS -d 10.0.254.1/32 -p tcp -m tcp --dport 53 -j RETURN
+-A IVPN-OUT-DNS -d 9.9.9.9/32 -p udp -m udp --dport 53 -j RETURN
+-A IVPN-OUT-DNS -d 9.9.9.9/32 -p tcp -m tcp --dport 53 -j RETURN
+-A IVPN-OUT-DNS -p udp -m udp --dport 53 -j DROP
+-A IVPN-OUT-DNS -p tcp -m tcp --dport 53 -j DROP
+-A IVPN-OUT-VPN -o wgivpn -j ACCEPT
+-A IVPN-OUT-STAT-USER-EXP -d 192.168.1.0/24 -j ACCEPT
+`
+
+func TestCheckIptablesRules(t *testing.T) {
+	hosts := []string{"192.168.1.0/24"}
+
+	if p := checkIptablesRules(parseIptablesRules(testIptablesRules), false, hosts, []string{"10.0.254.1", "9.9.9.9"}, true); len(p) > 0 {
+		t.Error("unexpected problems:", p)
+	}
+
+	// different DNS server, missing exception
+	if p := checkIptablesRules(parseIptablesRules(testIptablesRules), false, []string{"1.2.3.4/32"}, []string{"10.0.0.1"}, true); len(p) != 2 {
+		t.Error("expected 2 problems, got:", p)
+	}
+
+	// third-party rule inserted on the top; default policy changed
+	r := parseIptablesRules("-A OUTPUT -j ufw-before-output\n" + testIptablesRules)
+	r.policies["OUTPUT"] = "ACCEPT"
+	if p := checkIptablesRules(r, false, hosts, []string{"10.0.254.1"}, true); len(p) != 2 {
+		t.Error("expected 2 problems, got:", p)
+	}
+
+	// IPv6 leak protection chain is processed before IVPN firewall
+	if p := checkIptablesRules(parseIptablesRules("-A OUTPUT -j IVPN-OUT-IPV6LEAK\n"+testIptablesRules), true, nil, nil, true); len(p) > 0 {
+		t.Error("unexpected problems:", p)
+	}
+
+	// chains removed (e.g. 'iptables -F; iptables -X')
+	if p := checkIptablesRules(parseIptablesRules("-P INPUT ACCEPT\n-P OUTPUT ACCEPT\n"), false, hosts, nil, false); len(p) != 2 {
+		t.Error("expected 2 problems, got:", p)
+	}
+}
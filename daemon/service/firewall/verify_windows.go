@@ -0,0 +1,83 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package firewall
+
+import (
+	"fmt"
+
+	"github.com/ivpn/desktop-app/daemon/service/firewall/winlib"
+)
+
+// isFilterCheckWarned - 'true' when the warning about outdated firewall library was already logged
+var isFilterCheckWarned bool
+
+func implVerify() ([]string, error) {
+	pInfo, err := manager.GetProviderInfo(providerKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get provider info: %w", err)
+	}
+	if !pInfo.IsInstalled {
+		return []string{"IVPN WFP provider not found"}, nil
+	}
+
+	installed, err := manager.IsSubLayerInstalled(sublayerKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check sublayer is installed: %w", err)
+	}
+	if !installed {
+		return []string{"IVPN WFP sublayer not found"}, nil
+	}
+
+	if !winlib.IsFilterCheckSupported() {
+		if !isFilterCheckWarned {
+			isFilterCheckWarned = true
+			log.Warning("Unable to verify firewall filters: not supported by the firewall library (the library must be updated)")
+		}
+		return nil, nil
+	}
+
+	// WFP filters can not be modified: a third-party can only remove them (and add another ones).
+	// So, checking that all the filters added by the daemon (block-all, LAN, exceptions, VPN interface, DNS ...) are still installed.
+	// NOTE: the list is empty when the filters were created by the previous daemon run (persistent firewall).
+	var problems []string
+	for _, f := range installedFilters {
+		installed, err := manager.IsFilterInstalled(f.id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check filter is installed: %w", err)
+		}
+		if !installed {
+			problems = append(problems, fmt.Sprintf("filter '%s' not found", f.description))
+		}
+	}
+
+	if isConnectedExpected() && len(clientLocalIPFilterIDs) == 0 {
+		problems = append(problems, "filters for the VPN interface not found")
+	}
+
+	return problems, nil
+}
+
+func implRepair() error {
+	// remove the rest of IVPN filters (if any) and create them again
+	return reEnable()
+}
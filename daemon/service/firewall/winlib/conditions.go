@@ -155,3 +155,51 @@ func (c *ConditionIPLocalAddressV6) Apply(filter syscall.Handle, conditionIndex
 }
 
 // ------------------------------------------------------------------------------------------------------
+
+// ConditionIPProtocol - new condition type implementation
+type ConditionIPProtocol struct {
+	Match    FwpMatchType
+	Protocol uint8 // IANA protocol number (e.g. 6 - TCP; 17 - UDP; 1 - ICMP; 58 - ICMPv6)
+}
+
+// Apply applies the filter
+func (c *ConditionIPProtocol) Apply(filter syscall.Handle, conditionIndex uint32) error {
+	if err := preApply(c.Match, filter, conditionIndex, FwpmConditionIPProtocol); err != nil {
+		return fmt.Errorf("condition pre-apply error: %w", err)
+	}
+	return FWPMFILTERSetConditionUINT8(filter, conditionIndex, c.Protocol)
+}
+
+// ------------------------------------------------------------------------------------------------------
+
+// ConditionIPRemotePortRange - new condition type implementation
+type ConditionIPRemotePortRange struct {
+	PortFrom uint16
+	PortTo   uint16
+}
+
+// Apply applies the filter
+func (c *ConditionIPRemotePortRange) Apply(filter syscall.Handle, conditionIndex uint32) error {
+	if err := preApply(FwpMatchRange, filter, conditionIndex, FwpmConditionIPRemotePort); err != nil {
+		return fmt.Errorf("condition pre-apply error: %w", err)
+	}
+	return FWPMFILTERSetConditionRangeUINT16(filter, conditionIndex, c.PortFrom, c.PortTo)
+}
+
+// ------------------------------------------------------------------------------------------------------
+
+// ConditionIPLocalPortRange - new condition type implementation
+type ConditionIPLocalPortRange struct {
+	PortFrom uint16
+	PortTo   uint16
+}
+
+// Apply applies the filter
+func (c *ConditionIPLocalPortRange) Apply(filter syscall.Handle, conditionIndex uint32) error {
+	if err := preApply(FwpMatchRange, filter, conditionIndex, FwpmConditionIPLocalPort); err != nil {
+		return fmt.Errorf("condition pre-apply error: %w", err)
+	}
+	return FWPMFILTERSetConditionRangeUINT16(filter, conditionIndex, c.PortFrom, c.PortTo)
+}
+
+// ------------------------------------------------------------------------------------------------------
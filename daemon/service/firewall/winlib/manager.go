@@ -348,6 +348,15 @@ func (m *Manager) DeleteFilterByID(filterID uint64) error {
 	return WfpFilterDeleteByID(m.engine, filterID)
 }
 
+// IsFilterInstalled returns true if WFP filter is installed
+func (m *Manager) IsFilterInstalled(filterID uint64) (bool, error) {
+	if err := m.Initialize(); err != nil {
+		return false, fmt.Errorf("failed to initialize manager: %w", err)
+	}
+
+	return WfpFilterIsInstalledByID(m.engine, filterID)
+}
+
 // DeleteFilterByProviderKey removes WFP filter by provider key
 func (m *Manager) DeleteFilterByProviderKey(providerKey syscall.GUID, layerKey syscall.GUID) error {
 	if !m.isInitialized() {
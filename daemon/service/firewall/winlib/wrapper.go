@@ -74,22 +74,25 @@ var (
 	fFWPMSUBLAYER0SetFlags       *syscall.LazyProc
 	fFWPMSUBLAYER0Delete         *syscall.LazyProc
 
-	fFWPMFILTERCreate                 *syscall.LazyProc
-	fFWPMFILTERDelete                 *syscall.LazyProc
-	fFWPMFILTERSetProviderKey         *syscall.LazyProc
-	fFWPMFILTERSetDisplayData         *syscall.LazyProc
-	fFWPMFILTERAllocateConditions     *syscall.LazyProc
-	fFWPMFILTERSetConditionFieldKey   *syscall.LazyProc
-	fFWPMFILTERSetConditionMatchType  *syscall.LazyProc
-	fFWPMFILTERSetConditionV4AddrMask *syscall.LazyProc
-	fFWPMFILTERSetConditionV6AddrMask *syscall.LazyProc
-	fFWPMFILTERSetConditionUINT16     *syscall.LazyProc
-	fFWPMFILTERSetConditionBlobString *syscall.LazyProc
-	fFWPMFILTERSetAction              *syscall.LazyProc
-	fFWPMFILTERSetFlags               *syscall.LazyProc
-	fWfpFilterAdd                     *syscall.LazyProc
-	fWfpFilterDeleteByID              *syscall.LazyProc
-	fWfpFiltersDeleteByProviderKey    *syscall.LazyProc
+	fFWPMFILTERCreate                  *syscall.LazyProc
+	fFWPMFILTERDelete                  *syscall.LazyProc
+	fFWPMFILTERSetProviderKey          *syscall.LazyProc
+	fFWPMFILTERSetDisplayData          *syscall.LazyProc
+	fFWPMFILTERAllocateConditions      *syscall.LazyProc
+	fFWPMFILTERSetConditionFieldKey    *syscall.LazyProc
+	fFWPMFILTERSetConditionMatchType   *syscall.LazyProc
+	fFWPMFILTERSetConditionV4AddrMask  *syscall.LazyProc
+	fFWPMFILTERSetConditionV6AddrMask  *syscall.LazyProc
+	fFWPMFILTERSetConditionUINT8       *syscall.LazyProc
+	fFWPMFILTERSetConditionUINT16      *syscall.LazyProc
+	fFWPMFILTERSetConditionRangeUINT16 *syscall.LazyProc
+	fFWPMFILTERSetConditionBlobString  *syscall.LazyProc
+	fFWPMFILTERSetAction               *syscall.LazyProc
+	fFWPMFILTERSetFlags                *syscall.LazyProc
+	fWfpFilterAdd                      *syscall.LazyProc
+	fWfpFilterDeleteByID               *syscall.LazyProc
+	fWfpFilterIsInstalledByID          *syscall.LazyProc
+	fWfpFiltersDeleteByProviderKey     *syscall.LazyProc
 )
 
 // Initialize doing initialization stuff (called on application start)
@@ -140,17 +143,37 @@ func Initialize(wfpDllPath string) error {
 	fFWPMFILTERSetConditionMatchType = dll.NewProc("FWPM_FILTER_SetConditionMatchType")
 	fFWPMFILTERSetConditionV4AddrMask = dll.NewProc("FWPM_FILTER_SetConditionV4AddrMask")
 	fFWPMFILTERSetConditionV6AddrMask = dll.NewProc("FWPM_FILTER_SetConditionV6AddrMask")
+	// NOTE: 'FWPM_FILTER_SetConditionUINT8' and 'FWPM_FILTER_SetConditionRangeUINT16' were added to the native library
+	// with support of protocol/ports restrictions for firewall exceptions: the native DLL must be rebuilt.
+	// When an old DLL is in use - these functions are not available (see IsProtocolAndPortRangeConditionsSupported())
+	fFWPMFILTERSetConditionUINT8 = dll.NewProc("FWPM_FILTER_SetConditionUINT8")
 	fFWPMFILTERSetConditionUINT16 = dll.NewProc("FWPM_FILTER_SetConditionUINT16")
+	fFWPMFILTERSetConditionRangeUINT16 = dll.NewProc("FWPM_FILTER_SetConditionRangeUINT16")
 	fFWPMFILTERSetConditionBlobString = dll.NewProc("FWPM_FILTER_SetConditionBlobString")
 	fFWPMFILTERSetAction = dll.NewProc("FWPM_FILTER_SetAction")
 	fFWPMFILTERSetFlags = dll.NewProc("FWPM_FILTER_SetFlags")
 	fWfpFilterAdd = dll.NewProc("WfpFilterAdd")
 	fWfpFilterDeleteByID = dll.NewProc("WfpFilterDeleteById")
+	// NOTE: 'WfpFilterIsInstalledById' was added to the native library with the firewall rules verification
+	// (see IsFilterCheckSupported())
+	fWfpFilterIsInstalledByID = dll.NewProc("WfpFilterIsInstalledById")
 	fWfpFiltersDeleteByProviderKey = dll.NewProc("WfpFiltersDeleteByProviderKeyPtr")
 
 	return nil
 }
 
+// IsProtocolAndPortRangeConditionsSupported returns 'true' when the native library exports the functions
+// for filter conditions by IP protocol and by range of ports (they are not available in old versions of the library)
+func IsProtocolAndPortRangeConditionsSupported() bool {
+	return fFWPMFILTERSetConditionUINT8.Find() == nil && fFWPMFILTERSetConditionRangeUINT16.Find() == nil
+}
+
+// IsFilterCheckSupported returns 'true' when the native library exports the function
+// to check if the filter is installed (it is not available in old versions of the library)
+func IsFilterCheckSupported() bool {
+	return fWfpFilterIsInstalledByID.Find() == nil
+}
+
 func checkDefaultAPIResp(retval uintptr, err error) error {
 
 	if err != syscall.Errno(0) {
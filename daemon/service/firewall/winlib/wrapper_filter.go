@@ -190,6 +190,16 @@ func FWPMFILTERSetConditionV6AddrMask(filter syscall.Handle, conditionIndex uint
 	return checkDefaultAPIResp(retval, err)
 }
 
+// FWPMFILTERSetConditionUINT8 sets conditions parameters
+func FWPMFILTERSetConditionUINT8(filter syscall.Handle, conditionIndex uint32, val uint8) (err error) {
+	defer catchPanic(&err)
+
+	retval, _, err := fFWPMFILTERSetConditionUINT8.Call(uintptr(filter),
+		uintptr(conditionIndex),
+		uintptr(val))
+	return checkDefaultAPIResp(retval, err)
+}
+
 // FWPMFILTERSetConditionUINT16 sets conditions parameters
 func FWPMFILTERSetConditionUINT16(filter syscall.Handle, conditionIndex uint32, val uint16) (err error) {
 	defer catchPanic(&err)
@@ -200,6 +210,17 @@ func FWPMFILTERSetConditionUINT16(filter syscall.Handle, conditionIndex uint32,
 	return checkDefaultAPIResp(retval, err)
 }
 
+// FWPMFILTERSetConditionRangeUINT16 sets conditions parameters (range of values; the condition match type must be FwpMatchRange)
+func FWPMFILTERSetConditionRangeUINT16(filter syscall.Handle, conditionIndex uint32, low uint16, high uint16) (err error) {
+	defer catchPanic(&err)
+
+	retval, _, err := fFWPMFILTERSetConditionRangeUINT16.Call(uintptr(filter),
+		uintptr(conditionIndex),
+		uintptr(low),
+		uintptr(high))
+	return checkDefaultAPIResp(retval, err)
+}
+
 // FWPMFILTERSetConditionBlobString sets conditions parameters
 func FWPMFILTERSetConditionBlobString(filter syscall.Handle, conditionIndex uint32, val string) (err error) {
 	defer catchPanic(&err)
@@ -254,6 +275,18 @@ func WfpFilterDeleteByID(engine syscall.Handle, id uint64) (err error) {
 	return checkDefaultAPIResp(retval, err)
 }
 
+// WfpFilterIsInstalledByID returns true if filter is installed
+func WfpFilterIsInstalledByID(engine syscall.Handle, id uint64) (isInstalled bool, err error) {
+	defer catchPanic(&err)
+
+	retval, _, err := fWfpFilterIsInstalledByID.Call(uintptr(engine), uintptr(id))
+	if err != syscall.Errno(0) {
+		return false, err
+	}
+
+	return byte(retval) != 0, nil
+}
+
 // WfpFiltersDeleteByProviderKey remove filter by provider
 func WfpFiltersDeleteByProviderKey(engine syscall.Handle, providerGUID syscall.GUID, layerGUID syscall.GUID) (err error) {
 	defer catchPanic(&err)
@@ -27,6 +27,8 @@ import (
 	"time"
 
 	"github.com/ivpn/desktop-app/daemon/api/types"
+	"github.com/ivpn/desktop-app/daemon/service/dns"
+	"github.com/ivpn/desktop-app/daemon/service/firewall"
 	"github.com/ivpn/desktop-app/daemon/service/preferences"
 	"github.com/ivpn/desktop-app/daemon/service/wgkeys"
 )
@@ -66,4 +68,8 @@ type IServiceEventsReceiver interface {
 	OnPingStatus(retMap map[string]int)
 	OnServersUpdated(*types.ServersInfoResponse)
 	OnSplitTunnelStatusChanged()
+	OnCaptivePortalStatusChanged()
+	OnKillSwitchBlockedTraffic(entries []firewall.BlockedPacket)
+	OnFirewallTampered(report firewall.VerifyReport)
+	OnActiveDnsChanged(active dns.DnsSettings)
 }
@@ -0,0 +1,255 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+// Package latency keeps the history of the round-trip times to the VPN servers.
+// The statistics (min/avg/jitter/loss) are calculated from the recent measurements,
+// so the clients get the latency info immediately, without waiting for servers pinging.
+package latency
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ivpn/desktop-app/daemon/helpers"
+	"github.com/ivpn/desktop-app/daemon/service/platform/filerights"
+)
+
+// MaxSamples - max number of the measurements kept for a host
+const MaxSamples = 10
+
+// HostStats - latency statistics of a host
+type HostStats struct {
+	MinMs    int // the lowest RTT
+	AvgMs    int // average RTT
+	JitterMs int // average difference between the consecutive RTTs
+	Loss     int // percentage of the lost probes
+	Samples  int // number of the measurements the statistics are calculated from
+	Updated  int64
+	// true when the host was measured through the VPN tunnel
+	ThroughTunnel bool `json:",omitempty"`
+}
+
+// sample - a single measurement
+type sample struct {
+	RttMs  int   `json:"rtt"` // 0 - the probe is lost
+	Time   int64 `json:"t"`   // unix time
+	Tunnel bool  `json:"tun,omitempty"`
+}
+
+// Tracker - the history of the measurements. The object is safe for concurrent use.
+type Tracker struct {
+	mutex sync.Mutex
+	hosts map[string][]sample
+}
+
+// for testing
+var now = time.Now
+
+// NewTracker creates an empty tracker
+func NewTracker() *Tracker {
+	return &Tracker{hosts: make(map[string][]sample)}
+}
+
+// Add adds the measurement result of the host ('rtt' <= 0 - the probe is lost).
+// The measurements through the VPN tunnel are not mixed with the direct ones:
+// the history is reset when the measurement method changes.
+func (t *Tracker) Add(host string, rtt time.Duration, throughTunnel bool) {
+	if len(host) == 0 {
+		return
+	}
+
+	rttMs := 0
+	if rtt > 0 {
+		rttMs = int(rtt / time.Millisecond)
+		if rttMs == 0 {
+			rttMs = 1
+		}
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	samples := t.hosts[host]
+	if len(samples) > 0 && samples[len(samples)-1].Tunnel != throughTunnel {
+		samples = nil
+	}
+	samples = append(samples, sample{RttMs: rttMs, Time: now().Unix(), Tunnel: throughTunnel})
+	if len(samples) > MaxSamples {
+		samples = samples[len(samples)-MaxSamples:]
+	}
+	t.hosts[host] = samples
+}
+
+// Stats returns the latency statistics of the host
+func (t *Tracker) Stats(host string) (HostStats, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	samples, ok := t.hosts[host]
+	if !ok || len(samples) == 0 {
+		return HostStats{}, false
+	}
+	return calcStats(samples), true
+}
+
+// AllStats returns the latency statistics of all known hosts
+func (t *Tracker) AllStats() map[string]HostStats {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	ret := make(map[string]HostStats, len(t.hosts))
+	for h, samples := range t.hosts {
+		if len(samples) > 0 {
+			ret[h] = calcStats(samples)
+		}
+	}
+	return ret
+}
+
+// Results returns the average RTT (ms) of the reachable hosts measured during the last 'maxAge' (0 - any age)
+func (t *Tracker) Results(maxAge time.Duration) map[string]int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	ret := make(map[string]int)
+	for h, samples := range t.hosts {
+		if len(samples) == 0 || (maxAge > 0 && isOutdated(samples, maxAge)) {
+			continue
+		}
+		if s := calcStats(samples); s.AvgMs > 0 {
+			ret[h] = s.AvgMs
+		}
+	}
+	return ret
+}
+
+// Stale returns the hosts which were not measured during the last 'maxAge'
+func (t *Tracker) Stale(hosts []string, maxAge time.Duration) []string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var ret []string
+	for _, h := range hosts {
+		if samples := t.hosts[h]; len(samples) == 0 || isOutdated(samples, maxAge) {
+			ret = append(ret, h)
+		}
+	}
+	return ret
+}
+
+// Retain removes the history of all hosts except defined (e.g. the hosts which are not in the servers list anymore)
+func (t *Tracker) Retain(hosts []string) {
+	keep := make(map[string]struct{}, len(hosts))
+	for _, h := range hosts {
+		keep[h] = struct{}{}
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for h := range t.hosts {
+		if _, ok := keep[h]; !ok {
+			delete(t.hosts, h)
+		}
+	}
+}
+
+// Load reads the history from the file
+func (t *Tracker) Load(file string) error {
+	if !helpers.FileExists(file) {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read latency cache: %w", err)
+	}
+	hosts := make(map[string][]sample)
+	if err := json.Unmarshal(data, &hosts); err != nil {
+		os.Remove(file)
+		return fmt.Errorf("failed to parse latency cache (file removed): %w", err)
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.hosts = hosts
+	return nil
+}
+
+// Save writes the history into the file
+func (t *Tracker) Save(file string) error {
+	t.mutex.Lock()
+	data, err := json.Marshal(t.hosts)
+	t.mutex.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("failed to save latency cache (json marshal error): %w", err)
+	}
+	if err := helpers.WriteFile(file, data, filerights.DefaultFilePermissionsForConfig()); err != nil {
+		return fmt.Errorf("failed to save latency cache: %w", err)
+	}
+	return nil
+}
+
+func isOutdated(samples []sample, maxAge time.Duration) bool {
+	return now().Sub(time.Unix(samples[len(samples)-1].Time, 0)) > maxAge
+}
+
+func calcStats(samples []sample) HostStats {
+	last := samples[len(samples)-1]
+	ret := HostStats{Samples: len(samples), Updated: last.Time, ThroughTunnel: last.Tunnel}
+
+	lost, sum, received := 0, 0, 0
+	jitterSum, jitterCnt, prevRtt := 0, 0, 0
+	for _, s := range samples {
+		if s.RttMs <= 0 {
+			lost++
+			continue
+		}
+		received++
+		sum += s.RttMs
+		if ret.MinMs == 0 || s.RttMs < ret.MinMs {
+			ret.MinMs = s.RttMs
+		}
+		if prevRtt > 0 {
+			diff := s.RttMs - prevRtt
+			if diff < 0 {
+				diff = -diff
+			}
+			jitterSum += diff
+			jitterCnt++
+		}
+		prevRtt = s.RttMs
+	}
+
+	ret.Loss = lost * 100 / len(samples)
+	if received > 0 {
+		ret.AvgMs = sum / received
+	}
+	if jitterCnt > 0 {
+		ret.JitterMs = jitterSum / jitterCnt
+	}
+	return ret
+}
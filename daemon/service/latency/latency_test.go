@@ -0,0 +1,92 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package latency
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTracker(t *testing.T) {
+	current := time.Unix(1700000000, 0)
+	now = func() time.Time { return current }
+	defer func() { now = time.Now }()
+
+	tr := NewTracker()
+	for _, rtt := range []int{40, 0, 60, 50} { // 0 - lost
+		tr.Add("10.0.0.1", time.Duration(rtt)*time.Millisecond, false)
+	}
+	tr.Add("10.0.0.2", 0, false)
+
+	expected := HostStats{MinMs: 40, AvgMs: 50, JitterMs: 15, Loss: 25, Samples: 4, Updated: current.Unix()}
+	if s, ok := tr.Stats("10.0.0.1"); !ok || s != expected {
+		t.Errorf("unexpected stats: %+v", s)
+	}
+	if res := tr.Results(0); !reflect.DeepEqual(res, map[string]int{"10.0.0.1": 50}) {
+		t.Errorf("unexpected results: %v", res) // unreachable host must not be in results
+	}
+
+	// history is limited
+	for i := 0; i < MaxSamples+5; i++ {
+		tr.Add("10.0.0.2", 10*time.Millisecond, false)
+	}
+	if s, _ := tr.Stats("10.0.0.2"); s.Samples != MaxSamples || s.Loss != 0 || s.AvgMs != 10 {
+		t.Errorf("unexpected stats: %+v", s)
+	}
+
+	// measurements through the tunnel are not mixed with the direct ones
+	tr.Add("10.0.0.2", 100*time.Millisecond, true)
+	if s, _ := tr.Stats("10.0.0.2"); s.Samples != 1 || s.AvgMs != 100 || !s.ThroughTunnel {
+		t.Errorf("unexpected stats: %+v", s)
+	}
+
+	// staleness
+	current = current.Add(time.Minute * 10)
+	tr.Add("10.0.0.2", 20*time.Millisecond, true)
+	if stale := tr.Stale([]string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}, time.Minute*5); !reflect.DeepEqual(stale, []string{"10.0.0.1", "10.0.0.3"}) {
+		t.Errorf("unexpected stale hosts: %v", stale)
+	}
+	if res := tr.Results(time.Minute * 5); !reflect.DeepEqual(res, map[string]int{"10.0.0.2": 60}) {
+		t.Errorf("unexpected results: %v", res)
+	}
+
+	// persistence
+	file := filepath.Join(t.TempDir(), "latency.json")
+	if err := tr.Save(file); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewTracker()
+	if err := loaded.Load(file); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.AllStats(), tr.AllStats()) {
+		t.Errorf("loaded stats differ: %v != %v", loaded.AllStats(), tr.AllStats())
+	}
+
+	loaded.Retain([]string{"10.0.0.2"})
+	if _, ok := loaded.Stats("10.0.0.1"); ok || len(loaded.AllStats()) != 1 {
+		t.Errorf("unexpected hosts after Retain: %v", loaded.AllStats())
+	}
+}
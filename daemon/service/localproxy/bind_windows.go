@@ -0,0 +1,38 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package localproxy
+
+import (
+	"encoding/binary"
+	"syscall"
+)
+
+// IP_UNICAST_IF socket option (ws2ipdef.h)
+const ipUnicastIf = 31
+
+func bindToInterface(fd uintptr, ifName string, ifIndex int) error {
+	// for IPv4 sockets the interface index must be in network byte order
+	idx := make([]byte, 4)
+	binary.BigEndian.PutUint32(idx, uint32(ifIndex))
+	return syscall.SetsockoptInt(syscall.Handle(fd), syscall.IPPROTO_IP, ipUnicastIf, int(binary.LittleEndian.Uint32(idx)))
+}
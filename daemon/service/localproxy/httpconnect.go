@@ -0,0 +1,75 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package localproxy
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// handleHTTPConnect processes HTTP CONNECT request (with optional 'Basic' proxy authentication)
+func (p *Proxy) handleHTTPConnect(conn net.Conn, reader *bufio.Reader, cfg Config) (net.Conn, error) {
+	req, err := http.ReadRequest(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Method != http.MethodConnect {
+		httpReply(conn, http.StatusMethodNotAllowed, "")
+		return nil, fmt.Errorf("HTTP: method '%s' not supported", req.Method)
+	}
+
+	if cfg.IsAuth() {
+		// 'Proxy-Authorization' header has the same format as 'Authorization' header
+		authReq := http.Request{Header: http.Header{"Authorization": req.Header.Values("Proxy-Authorization")}}
+		user, pass, ok := authReq.BasicAuth()
+		if !ok || !isCredentialsValid(cfg, user, pass) {
+			httpReply(conn, http.StatusProxyAuthRequired, "Proxy-Authenticate: Basic realm=\"IVPN\"\r\n")
+			return nil, fmt.Errorf("HTTP: authentication failed")
+		}
+	}
+
+	remote, err := p.dial(req.Host)
+	if err != nil {
+		status := http.StatusBadGateway
+		if err == errTunnelDown {
+			status = http.StatusServiceUnavailable
+		}
+		httpReply(conn, status, "")
+		return nil, fmt.Errorf("HTTP: failed to connect '%s': %w", req.Host, err)
+	}
+
+	if err := httpReply(conn, http.StatusOK, ""); err != nil {
+		remote.Close()
+		p.untrack(remote)
+		return nil, err
+	}
+	return remote, nil
+}
+
+func httpReply(conn net.Conn, status int, headers string) error {
+	_, err := fmt.Fprintf(conn, "HTTP/1.1 %d %s\r\n%s\r\n", status, http.StatusText(status), headers)
+	return err
+}
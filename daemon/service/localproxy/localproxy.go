@@ -0,0 +1,378 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+// Package localproxy implements a local SOCKS5 and HTTP CONNECT proxy which binds all outgoing connections to the VPN interface.
+// It allows to route the traffic of the proxy-aware applications through the VPN tunnel
+// (e.g. when the rest of the system goes direct).
+// Both protocols are served on the same localhost port (the protocol is detected by the first byte of the request).
+package localproxy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ivpn/desktop-app/daemon/logger"
+)
+
+var log *logger.Logger
+
+func init() {
+	log = logger.NewLogger("lproxy")
+}
+
+const (
+	// DefaultPort - default port of the local proxy
+	DefaultPort = 1080
+
+	handshakeTimeout = time.Second * 30
+	dialTimeout      = time.Second * 30
+)
+
+// Config - configuration of the local proxy
+type Config struct {
+	IsEnabled bool
+	// local port to listen on (0 - DefaultPort)
+	Port int
+	// credentials (empty Username - authentication is not required)
+	Username string
+	Password string
+}
+
+// ListenPort returns the port number the proxy listens on
+func (c Config) ListenPort() int {
+	if c.Port == 0 {
+		return DefaultPort
+	}
+	return c.Port
+}
+
+// IsAuth returns 'true' when the authentication is required
+func (c Config) IsAuth() bool {
+	return len(c.Username) > 0
+}
+
+// Validate checks the configuration
+func (c Config) Validate() error {
+	if c.Port < 0 || c.Port > 65535 {
+		return fmt.Errorf("bad port number: %d", c.Port)
+	}
+	if len(c.Username) > 255 || len(c.Password) > 255 {
+		return fmt.Errorf("username or password is too long (max 255 characters)")
+	}
+	if len(c.Username) == 0 && len(c.Password) > 0 {
+		return fmt.Errorf("password defined without username")
+	}
+	return nil
+}
+
+// Proxy - local SOCKS5/HTTP CONNECT proxy
+type Proxy struct {
+	mutex    sync.Mutex
+	config   Config
+	listener net.Listener
+	// local IP of the VPN interface (nil - tunnel is down: all connections are refused)
+	bindIP     net.IP
+	bindIfName string
+	bindIfIdx  int
+	// returns the DNS server for resolving the requested domain names
+	dnsServerFunc func() net.IP
+	// active connections (client and remote sides)
+	conns map[net.Conn]struct{}
+}
+
+// Start starts the proxy (or restarts it if the configuration was changed)
+// and binds the outgoing connections to the interface 'bindIf' with local IP 'bindIP'.
+func (p *Proxy) Start(cfg Config, bindIP net.IP, bindIf *net.Interface) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.listener != nil && p.config.ListenPort() != cfg.ListenPort() {
+		p.stop()
+	}
+	p.config = cfg
+
+	p.setBindIP(bindIP, bindIf)
+
+	if p.listener != nil {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(cfg.ListenPort())))
+	if err != nil {
+		return fmt.Errorf("failed to start local proxy: %w", err)
+	}
+	p.listener = listener
+	log.Info(fmt.Sprintf("Local proxy started on %s (outgoing IP: %s)", listener.Addr(), bindIP))
+
+	go p.serve(listener)
+	return nil
+}
+
+// Stop stops the proxy and closes all active connections
+func (p *Proxy) Stop() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.stop()
+}
+
+// SetBindIP changes the VPN interface and its local IP (nil - tunnel is down: all connections are refused).
+// The active connections are closed if the IP is changed.
+func (p *Proxy) SetBindIP(bindIP net.IP, bindIf *net.Interface) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.setBindIP(bindIP, bindIf)
+}
+
+// SetDnsServerFunc sets the function which returns the DNS server for resolving the requested domain names
+// (the server of the VPN connection or the local resolver). The domain names are never resolved by the system resolver.
+func (p *Proxy) SetDnsServerFunc(f func() net.IP) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.dnsServerFunc = f
+}
+
+// State returns the local address the proxy listens on (empty - not running) and the local IP of the VPN interface
+func (p *Proxy) State() (listenAddress string, bindIP net.IP) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.listener == nil {
+		return "", nil
+	}
+	return p.listener.Addr().String(), p.bindIP
+}
+
+func (p *Proxy) stop() {
+	if p.listener == nil {
+		return
+	}
+	p.listener.Close()
+	p.listener = nil
+	p.bindIP = nil
+	p.closeConnections()
+	log.Info("Local proxy stopped")
+}
+
+func (p *Proxy) setBindIP(bindIP net.IP, bindIf *net.Interface) {
+	if bindIP.Equal(p.bindIP) {
+		return
+	}
+
+	p.closeConnections()
+	p.bindIP, p.bindIfName, p.bindIfIdx = nil, "", 0
+	if bindIP == nil || bindIf == nil {
+		return
+	}
+	p.bindIP, p.bindIfName, p.bindIfIdx = bindIP, bindIf.Name, bindIf.Index
+}
+
+func (p *Proxy) closeConnections() {
+	for c := range p.conns {
+		c.Close()
+	}
+	p.conns = nil
+}
+
+func (p *Proxy) track(c net.Conn) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.listener == nil {
+		return false
+	}
+	if p.conns == nil {
+		p.conns = make(map[net.Conn]struct{})
+	}
+	p.conns[c] = struct{}{}
+	return true
+}
+
+func (p *Proxy) untrack(c net.Conn) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	delete(p.conns, c)
+}
+
+func (p *Proxy) serve(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(time.Millisecond * 100)
+				continue
+			}
+			return
+		}
+		go p.handle(conn)
+	}
+}
+
+func (p *Proxy) handle(conn net.Conn) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error("PANIC in local proxy connection handler!: ", r)
+		}
+	}()
+	defer conn.Close()
+
+	if !p.track(conn) {
+		return
+	}
+	defer p.untrack(conn)
+
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	reader := bufio.NewReader(conn)
+	first, err := reader.Peek(1)
+	if err != nil {
+		return
+	}
+
+	p.mutex.Lock()
+	cfg := p.config
+	p.mutex.Unlock()
+
+	var remote net.Conn
+	if first[0] == socks5Version {
+		remote, err = p.handleSocks5(conn, reader, cfg)
+	} else {
+		remote, err = p.handleHTTPConnect(conn, reader, cfg)
+	}
+	if err != nil {
+		log.Debug("Connection refused: ", err)
+		return
+	}
+	defer remote.Close()
+	defer p.untrack(remote)
+
+	conn.SetDeadline(time.Time{})
+	relay(&bufferedConn{Conn: conn, reader: reader}, remote)
+}
+
+// dial establishes the outgoing connection through the VPN interface
+// (the domain name is resolved by the DNS server of the VPN connection)
+func (p *Proxy) dial(address string) (net.Conn, error) {
+	p.mutex.Lock()
+	bindIP, ifName, ifIdx, dnsServerFunc := p.bindIP, p.bindIfName, p.bindIfIdx, p.dnsServerFunc
+	p.mutex.Unlock()
+
+	if bindIP == nil {
+		return nil, errTunnelDown
+	}
+
+	dial := func(network, address string) (net.Conn, error) {
+		dialer := net.Dialer{
+			Timeout: dialTimeout,
+			Control: func(network, address string, c syscall.RawConn) error {
+				var bindErr error
+				if err := c.Control(func(fd uintptr) {
+					bindErr = bindToInterface(fd, ifName, ifIdx)
+				}); err != nil {
+					return err
+				}
+				return bindErr
+			},
+		}
+		if network == "udp4" {
+			dialer.LocalAddr = &net.UDPAddr{IP: bindIP}
+		} else {
+			dialer.LocalAddr = &net.TCPAddr{IP: bindIP}
+		}
+		return dialer.Dial(network, address)
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+		// the outgoing connections are bound to the IPv4 address of the VPN interface
+		return nil, errIPv6NotSupported
+	}
+	if net.ParseIP(host) == nil {
+		var dnsServer net.IP
+		if dnsServerFunc != nil {
+			dnsServer = dnsServerFunc()
+		}
+		dnsDial := dial
+		if dnsServer != nil && dnsServer.IsLoopback() {
+			// local resolver: it is not reachable through the VPN interface (it forwards the queries by itself)
+			dnsDial = func(network, address string) (net.Conn, error) {
+				return net.DialTimeout(network, address, dnsTimeout)
+			}
+		}
+		ip, err := resolve(host, dnsServer, dnsDial)
+		if err != nil {
+			return nil, err
+		}
+		address = net.JoinHostPort(ip.String(), port)
+	}
+
+	remote, err := dial("tcp4", address)
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.track(remote) {
+		remote.Close()
+		return nil, errTunnelDown
+	}
+	return remote, nil
+}
+
+var (
+	errTunnelDown       = fmt.Errorf("VPN tunnel is down")
+	errIPv6NotSupported = fmt.Errorf("IPv6 destination is not supported")
+)
+
+// bufferedConn - connection which reads the data through the buffered reader
+// (the reader may contain the data received after the handshake)
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+func relay(client *bufferedConn, remote net.Conn) {
+	done := make(chan struct{}, 2)
+	copyData := func(dst net.Conn, dstTCP net.Conn, src io.Reader) {
+		io.Copy(dst, src)
+		if tc, ok := dstTCP.(*net.TCPConn); ok {
+			tc.CloseWrite()
+		}
+		done <- struct{}{}
+	}
+	go copyData(remote, remote, client)
+	go copyData(client, client.Conn, remote)
+	<-done
+	<-done
+}
@@ -0,0 +1,292 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package localproxy
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func startEchoServer(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() { io.Copy(c, c); c.Close() }()
+		}
+	}()
+	return l
+}
+
+func loopbackInterface(t *testing.T) *net.Interface {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, inf := range ifaces {
+		if inf.Flags&net.FlagLoopback != 0 {
+			return &inf
+		}
+	}
+	t.Fatal("loopback interface not found")
+	return nil
+}
+
+func startProxy(t *testing.T, cfg Config) (*Proxy, string) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Port = l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	p := &Proxy{}
+	if err := p.Start(cfg, net.IPv4(127, 0, 0, 1), loopbackInterface(t)); err != nil {
+		t.Fatal(err)
+	}
+	addr, _ := p.State()
+	return p, addr
+}
+
+func checkEcho(t *testing.T, c net.Conn) {
+	if _, err := c.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(c, buf); err != nil || string(buf) != "ping" {
+		t.Fatal("echo failed:", string(buf), err)
+	}
+}
+
+func socks5Connect(t *testing.T, proxyAddr string, target *net.TCPAddr, user, pass string) (net.Conn, byte) {
+	c, err := net.Dial("tcp4", proxyAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	method := byte(socks5AuthNone)
+	if len(user) > 0 {
+		method = socks5AuthUserPass
+	}
+	c.Write([]byte{socks5Version, 1, method})
+	resp := make([]byte, 2)
+	if _, err := io.ReadFull(c, resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp[1] != method {
+		return c, socks5RepNotAllowed
+	}
+	if method == socks5AuthUserPass {
+		auth := []byte{socks5UserPassVersion, byte(len(user))}
+		auth = append(auth, user...)
+		auth = append(auth, byte(len(pass)))
+		auth = append(auth, pass...)
+		c.Write(auth)
+		if _, err := io.ReadFull(c, resp); err != nil || resp[1] != 0 {
+			return c, socks5RepNotAllowed
+		}
+	}
+
+	req := []byte{socks5Version, socks5CmdConnect, 0, socks5AtypIPv4}
+	if ip4 := target.IP.To4(); ip4 != nil {
+		req = append(req, ip4...)
+	} else {
+		req[3] = socks5AtypIPv6
+		req = append(req, target.IP.To16()...)
+	}
+	req = append(req, byte(target.Port>>8), byte(target.Port))
+	c.Write(req)
+	reply := make([]byte, 10)
+	if _, err := io.ReadFull(c, reply); err != nil {
+		t.Fatal(err)
+	}
+	return c, reply[1]
+}
+
+func TestSocks5(t *testing.T) {
+	echo := startEchoServer(t)
+	defer echo.Close()
+	target := echo.Addr().(*net.TCPAddr)
+
+	p, addr := startProxy(t, Config{IsEnabled: true, Username: "user", Password: "pass"})
+	defer p.Stop()
+
+	c, rep := socks5Connect(t, addr, target, "user", "pass")
+	if rep != socks5RepSuccess {
+		t.Fatal("SOCKS5 connect failed:", rep)
+	}
+	checkEcho(t, c)
+	c.Close()
+
+	c, rep = socks5Connect(t, addr, target, "user", "wrong")
+	c.Close()
+	if rep == socks5RepSuccess {
+		t.Error("authentication with wrong password must fail")
+	}
+
+	// IPv6 destinations are not supported
+	c, rep = socks5Connect(t, addr, &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 80}, "user", "pass")
+	c.Close()
+	if rep != socks5RepAtypNotSupported {
+		t.Error("address type not supported expected for IPv6 destination:", rep)
+	}
+
+	// tunnel is down: connections must be refused
+	p.SetBindIP(nil, nil)
+	c, rep = socks5Connect(t, addr, target, "user", "pass")
+	c.Close()
+	if rep != socks5RepNotAllowed {
+		t.Error("connection must be refused when tunnel is down:", rep)
+	}
+}
+
+func TestHTTPConnect(t *testing.T) {
+	echo := startEchoServer(t)
+	defer echo.Close()
+	target := echo.Addr().String()
+
+	p, addr := startProxy(t, Config{IsEnabled: true, Username: "user", Password: "pass"})
+	defer p.Stop()
+
+	connect := func(credentials string) (net.Conn, int) {
+		c, err := net.Dial("tcp4", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := "CONNECT " + target + " HTTP/1.1\r\nHost: " + target + "\r\n"
+		if len(credentials) > 0 {
+			req += "Proxy-Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte(credentials)) + "\r\n"
+		}
+		c.Write([]byte(req + "\r\n"))
+
+		// read status line and headers (do not use bufio: the data after the headers belongs to the tunnel)
+		var resp strings.Builder
+		b := make([]byte, 1)
+		for !strings.HasSuffix(resp.String(), "\r\n\r\n") {
+			if _, err := c.Read(b); err != nil {
+				t.Fatal(err)
+			}
+			resp.WriteByte(b[0])
+		}
+		fields := strings.Fields(resp.String())
+		status, _ := strconv.Atoi(fields[1])
+		return c, status
+	}
+
+	c, status := connect("user:pass")
+	if status != 200 {
+		t.Fatal("HTTP CONNECT failed:", status)
+	}
+	checkEcho(t, c)
+	c.Close()
+
+	c, status = connect("")
+	c.Close()
+	if status != 407 {
+		t.Error("proxy authentication required expected:", status)
+	}
+
+	// non-CONNECT requests are not supported
+	c, err := net.Dial("tcp4", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.Write([]byte("GET http://" + target + "/ HTTP/1.1\r\nHost: " + target + "\r\n\r\n"))
+	line, _ := bufio.NewReader(c).ReadString('\n')
+	if !strings.Contains(line, "405") {
+		t.Error("method not allowed expected:", line)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	// DNS server which answers '127.0.0.2' for 'host.test.' and NXDOMAIN for the rest
+	srv, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, from, err := srv.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var p dnsmessage.Parser
+			hdr, err := p.Start(buf[:n])
+			if err != nil {
+				continue
+			}
+			q, err := p.Question()
+			if err != nil {
+				continue
+			}
+			resp := dnsmessage.Message{Header: dnsmessage.Header{ID: hdr.ID, Response: true}, Questions: []dnsmessage.Question{q}}
+			if q.Name.String() == "host.test." {
+				resp.Answers = []dnsmessage.Resource{{
+					Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET},
+					Body:   &dnsmessage.AResource{A: [4]byte{127, 0, 0, 2}},
+				}}
+			} else {
+				resp.Header.RCode = dnsmessage.RCodeNameError
+			}
+			data, _ := resp.Pack()
+			srv.WriteTo(data, from)
+		}
+	}()
+
+	// all the queries must go to the defined DNS server
+	var dialed []string
+	dial := func(network, address string) (net.Conn, error) {
+		dialed = append(dialed, address)
+		return net.Dial(network, srv.LocalAddr().String())
+	}
+
+	ip, err := resolve("host.test", net.IPv4(10, 0, 0, 1), dial)
+	if err != nil || !ip.Equal(net.IPv4(127, 0, 0, 2)) {
+		t.Fatal("unexpected result:", ip, err)
+	}
+	if len(dialed) != 1 || dialed[0] != "10.0.0.1:53" {
+		t.Error("query sent to unexpected server:", dialed)
+	}
+
+	if _, err := resolve("unknown.test", net.IPv4(10, 0, 0, 1), dial); err == nil {
+		t.Error("error expected for unknown host")
+	}
+	if _, err := resolve("host.test", nil, dial); err == nil {
+		t.Error("error expected when DNS server is not defined")
+	}
+}
@@ -0,0 +1,170 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package localproxy
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	dnsPort           = 53
+	dnsTimeout        = time.Second * 5
+	dnsMaxMessageSize = 65535
+)
+
+// resolve returns IPv4 address of the host.
+// The query is sent to the DNS server 'server' through the connection created by 'dial'
+// (the system resolver is not in use: its queries can go outside the VPN tunnel).
+func resolve(host string, server net.IP, dial func(network, address string) (net.Conn, error)) (net.IP, error) {
+	if server == nil {
+		return nil, fmt.Errorf("DNS server not defined")
+	}
+
+	name, err := dnsmessage.NewName(dnsName(host))
+	if err != nil {
+		return nil, fmt.Errorf("bad host name '%s': %w", host, err)
+	}
+	id := uint16(rand.Uint32())
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(dnsmessage.Question{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}); err != nil {
+		return nil, err
+	}
+	query, err := b.Finish()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := dnsExchange(query, server, false, dial)
+	if err != nil {
+		return nil, err
+	}
+	var p dnsmessage.Parser
+	hdr, err := p.Start(resp)
+	if err != nil {
+		return nil, err
+	}
+	if hdr.Truncated {
+		if resp, err = dnsExchange(query, server, true, dial); err != nil {
+			return nil, err
+		}
+		if hdr, err = p.Start(resp); err != nil {
+			return nil, err
+		}
+	}
+	if hdr.ID != id || !hdr.Response {
+		return nil, fmt.Errorf("bad DNS response")
+	}
+	if hdr.RCode != dnsmessage.RCodeSuccess {
+		return nil, fmt.Errorf("failed to resolve '%s': %s", host, hdr.RCode)
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return nil, err
+	}
+	for {
+		rh, err := p.AnswerHeader()
+		if err == dnsmessage.ErrSectionDone {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if rh.Type != dnsmessage.TypeA {
+			if err := p.SkipAnswer(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		a, err := p.AResource()
+		if err != nil {
+			return nil, err
+		}
+		return net.IP(a.A[:]), nil
+	}
+	return nil, fmt.Errorf("failed to resolve '%s': no IPv4 address", host)
+}
+
+// dnsName returns the fully qualified domain name (with the trailing dot)
+func dnsName(host string) string {
+	if len(host) > 0 && host[len(host)-1] == '.' {
+		return host
+	}
+	return host + "."
+}
+
+func dnsExchange(query []byte, server net.IP, isTCP bool, dial func(network, address string) (net.Conn, error)) ([]byte, error) {
+	network := "udp4"
+	if isTCP {
+		network = "tcp4"
+	}
+	conn, err := dial(network, net.JoinHostPort(server.String(), strconv.Itoa(dnsPort)))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(dnsTimeout))
+
+	if isTCP {
+		// the message is prefixed by two-byte length field (RFC1035 4.2.2)
+		buf := make([]byte, 2+len(query))
+		binary.BigEndian.PutUint16(buf, uint16(len(query)))
+		copy(buf[2:], query)
+		if _, err := conn.Write(buf); err != nil {
+			return nil, err
+		}
+		var l [2]byte
+		if _, err := io.ReadFull(conn, l[:]); err != nil {
+			return nil, err
+		}
+		resp := make([]byte, binary.BigEndian.Uint16(l[:]))
+		if _, err := io.ReadFull(conn, resp); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, dnsMaxMessageSize)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		// skip responses which are not related to our query (the ID is not matching)
+		if n >= 2 && buf[0] == query[0] && buf[1] == query[1] {
+			return buf[:n], nil
+		}
+	}
+}
@@ -0,0 +1,215 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package localproxy
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+)
+
+// SOCKS5 protocol (RFC 1928) with username/password authentication (RFC 1929).
+// Only CONNECT command is supported.
+const (
+	socks5Version = 0x05
+
+	socks5AuthNone         = 0x00
+	socks5AuthUserPass     = 0x02
+	socks5AuthNoAcceptable = 0xFF
+
+	socks5UserPassVersion = 0x01
+
+	socks5CmdConnect = 0x01
+
+	socks5AtypIPv4   = 0x01
+	socks5AtypDomain = 0x03
+	socks5AtypIPv6   = 0x04
+
+	socks5RepSuccess          = 0x00
+	socks5RepGeneralFailure   = 0x01
+	socks5RepNotAllowed       = 0x02
+	socks5RepHostUnreachable  = 0x04
+	socks5RepCmdNotSupported  = 0x07
+	socks5RepAtypNotSupported = 0x08
+)
+
+func (p *Proxy) handleSocks5(conn net.Conn, reader *bufio.Reader, cfg Config) (net.Conn, error) {
+	// greeting: VER | NMETHODS | METHODS
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, err
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(reader, methods); err != nil {
+		return nil, err
+	}
+
+	method := byte(socks5AuthNone)
+	if cfg.IsAuth() {
+		method = socks5AuthUserPass
+	}
+	isMethodSupported := false
+	for _, m := range methods {
+		if m == method {
+			isMethodSupported = true
+			break
+		}
+	}
+	if !isMethodSupported {
+		conn.Write([]byte{socks5Version, socks5AuthNoAcceptable})
+		return nil, fmt.Errorf("SOCKS5: no acceptable authentication method")
+	}
+	if _, err := conn.Write([]byte{socks5Version, method}); err != nil {
+		return nil, err
+	}
+
+	if method == socks5AuthUserPass {
+		if err := socks5Authenticate(conn, reader, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	// request: VER | CMD | RSV | ATYP | DST.ADDR | DST.PORT
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(reader, req); err != nil {
+		return nil, err
+	}
+	if req[0] != socks5Version {
+		return nil, fmt.Errorf("SOCKS5: bad version %d", req[0])
+	}
+
+	var host string
+	switch req[3] {
+	case socks5AtypIPv4, socks5AtypIPv6:
+		addrLen := net.IPv4len
+		if req[3] == socks5AtypIPv6 {
+			addrLen = net.IPv6len
+		}
+		addr := make([]byte, addrLen)
+		if _, err := io.ReadFull(reader, addr); err != nil {
+			return nil, err
+		}
+		host = net.IP(addr).String()
+	case socks5AtypDomain:
+		l, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		domain := make([]byte, l)
+		if _, err := io.ReadFull(reader, domain); err != nil {
+			return nil, err
+		}
+		host = string(domain)
+	default:
+		socks5Reply(conn, socks5RepAtypNotSupported, nil)
+		return nil, fmt.Errorf("SOCKS5: address type %d not supported", req[3])
+	}
+	portBytes := make([]byte, 2)
+	if _, err := io.ReadFull(reader, portBytes); err != nil {
+		return nil, err
+	}
+	address := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(portBytes))))
+
+	if req[1] != socks5CmdConnect {
+		socks5Reply(conn, socks5RepCmdNotSupported, nil)
+		return nil, fmt.Errorf("SOCKS5: command %d not supported", req[1])
+	}
+
+	remote, err := p.dial(address)
+	if err != nil {
+		rep := byte(socks5RepHostUnreachable)
+		switch err {
+		case errTunnelDown:
+			rep = socks5RepNotAllowed
+		case errIPv6NotSupported:
+			rep = socks5RepAtypNotSupported
+		}
+		socks5Reply(conn, rep, nil)
+		return nil, fmt.Errorf("SOCKS5: failed to connect '%s': %w", address, err)
+	}
+
+	if err := socks5Reply(conn, socks5RepSuccess, remote.LocalAddr()); err != nil {
+		remote.Close()
+		p.untrack(remote)
+		return nil, err
+	}
+	return remote, nil
+}
+
+// socks5Authenticate performs username/password authentication (RFC 1929)
+func socks5Authenticate(conn net.Conn, reader *bufio.Reader, cfg Config) error {
+	// VER | ULEN | UNAME | PLEN | PASSWD
+	ver, err := reader.ReadByte()
+	if err != nil {
+		return err
+	}
+	readString := func() ([]byte, error) {
+		l, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		b := make([]byte, l)
+		_, err = io.ReadFull(reader, b)
+		return b, err
+	}
+	user, err := readString()
+	if err != nil {
+		return err
+	}
+	pass, err := readString()
+	if err != nil {
+		return err
+	}
+
+	if ver != socks5UserPassVersion || !isCredentialsValid(cfg, string(user), string(pass)) {
+		conn.Write([]byte{socks5UserPassVersion, 0x01})
+		return fmt.Errorf("SOCKS5: authentication failed")
+	}
+	_, err = conn.Write([]byte{socks5UserPassVersion, 0x00})
+	return err
+}
+
+// socks5Reply sends reply: VER | REP | RSV | ATYP | BND.ADDR | BND.PORT
+func socks5Reply(conn net.Conn, rep byte, bindAddr net.Addr) error {
+	ip := net.IPv4zero.To4()
+	port := 0
+	if tcpAddr, ok := bindAddr.(*net.TCPAddr); ok && tcpAddr.IP.To4() != nil {
+		ip = tcpAddr.IP.To4()
+		port = tcpAddr.Port
+	}
+	reply := []byte{socks5Version, rep, 0x00, socks5AtypIPv4}
+	reply = append(reply, ip...)
+	reply = append(reply, byte(port>>8), byte(port))
+	_, err := conn.Write(reply)
+	return err
+}
+
+func isCredentialsValid(cfg Config, user, pass string) bool {
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(cfg.Username)) == 1
+	passOK := subtle.ConstantTimeCompare([]byte(pass), []byte(cfg.Password)) == 1
+	return userOK && passOK
+}
@@ -36,6 +36,30 @@ func CheckFileAccessRightsStaticConfig(file string) error {
 	return ensureFileAccessRights(file, defaultFilePermissionForStaticConfig)
 }
 
+// CheckFileAccessRightsAdminConfig ensures if given file has correct rights for config file created by administrator
+// If file does not exist or it can be writable by someone else except root - return error
+func CheckFileAccessRightsAdminConfig(file string) error {
+	stat, err := getFileStat(file)
+	if err != nil {
+		return err
+	}
+
+	if isDebug {
+		fmt.Println("WARNING! DEBUG MODE : permissions check skipped for file: ", file)
+		return nil
+	}
+
+	if err := ensureFileOwner(stat); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+
+	mode := stat.Mode()
+	if (mode & wrongExecutableFilePermissionsMask) > 0 {
+		return fmt.Errorf("file '%s' has wrong permissins (it can be modifyied not only by owner [%o])", file, mode)
+	}
+	return nil
+}
+
 // CheckFileAccessRightsExecutable checks if file has correct access-permission for executable
 // If file does not exist or it can be writable by someone else except root - return error
 func CheckFileAccessRightsExecutable(file string) error {
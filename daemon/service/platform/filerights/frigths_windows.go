@@ -42,6 +42,13 @@ func CheckFileAccessRightsStaticConfig(file string) error {
 	return isFileInProgramFiles(file)
 }
 
+// CheckFileAccessRightsAdminConfig ensures if given file has correct rights for config file created by administrator
+func CheckFileAccessRightsAdminConfig(file string) error {
+	// No file rights check for Windows
+	// Application is installed to a '%PROGRAMFILES%' which is write-accessible only for admins
+	return isFileInProgramFiles(file)
+}
+
 // CheckFileAccessRightsExecutable checks if file has correct access-permission for executable
 // If file does not exist or it can be writable by someone else except root - return error
 func CheckFileAccessRightsExecutable(file string) error {
@@ -46,6 +46,7 @@ var (
 	fwInitialValueAllowApiServers bool
 
 	settingsFile    string
+	daemonConfFile  string
 	servicePortFile string
 	serversFile     string
 	logFile         string
@@ -256,6 +257,17 @@ func SettingsFile() string {
 	return settingsFile
 }
 
+// ConnectionHistoryFile path to a file which contains journal of VPN connections
+// (located in the same folder as the settings file)
+func ConnectionHistoryFile() string {
+	return filepath.Join(filepath.Dir(settingsFile), "connection_history.json")
+}
+
+// DaemonConfigFile path to a declarative daemon configuration file (optional; created by administrator)
+func DaemonConfigFile() string {
+	return daemonConfFile
+}
+
 // ServicePortFile path to service port file
 func ServicePortFile() string {
 	return servicePortFile
@@ -273,6 +285,12 @@ func ServersFile() string {
 	return serversFile
 }
 
+// LatencyCacheFile path to a file which contains the latency history of the servers
+// (located in the same folder as the servers cache)
+func LatencyCacheFile() string {
+	return filepath.Join(filepath.Dir(serversFile), "latency.json")
+}
+
 // LogFile path to log-file
 func LogFile() string {
 	return logFile
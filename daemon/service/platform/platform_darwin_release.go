@@ -42,6 +42,7 @@ func doOsInitForBuild() (warnings []string, errors []error) {
 	// common variables initialization
 	settingsDir := "/Library/Application Support/IVPN"
 	settingsFile = path.Join(settingsDir, "settings.json")
+	daemonConfFile = path.Join(settingsDir, "daemon.conf")
 	serversFile = path.Join(settingsDir, "servers.json")
 	openvpnConfigFile = path.Join(settingsDir, "openvpn.cfg")
 	openvpnProxyAuthFile = path.Join(settingsDir, "proxyauth.txt")
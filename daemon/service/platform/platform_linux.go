@@ -47,6 +47,7 @@ func doInitConstants() {
 
 func doOsInit() (warnings []string, errors []error) {
 	openVpnBinaryPath = path.Join("/usr/sbin", "openvpn")
+	daemonConfFile = "/etc/ivpn/daemon.conf"
 	routeCommand = "/sbin/ip route"
 
 	warnings, errors = doOsInitForBuild()
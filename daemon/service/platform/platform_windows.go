@@ -78,6 +78,7 @@ func doOsInit() (warnings []string, errors []error) {
 	// common variables initialization
 	settingsDir := path.Join(_installDir, "etc")
 	settingsFile = path.Join(settingsDir, "settings.json")
+	daemonConfFile = path.Join(settingsDir, "daemon.conf")
 
 	serversFile = path.Join(settingsDir, "servers.json")
 	openvpnConfigFile = path.Join(settingsDir, "openvpn.cfg")
@@ -0,0 +1,56 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package preferences
+
+import (
+	"github.com/ivpn/desktop-app/daemon/service/dns"
+	"github.com/ivpn/desktop-app/daemon/vpn"
+)
+
+// ConnectionTarget - the rule of server selection for connections performed by the daemon
+type ConnectionTarget string
+
+const (
+	ConnectionTargetLast    ConnectionTarget = "last"    // the last used server and connection parameters
+	ConnectionTargetFastest ConnectionTarget = "fastest" // the server with the lowest ping
+	ConnectionTargetServer  ConnectionTarget = "server"  // the specific server (see 'Gateway')
+)
+
+// ConnectionSettings - parameters of VPN connections performed by the daemon itself
+// (e.g. auto-connect on daemon launch)
+type ConnectionSettings struct {
+	IsAutoconnectOnLaunch bool // when 'true' - the daemon performs automatic connection on launch
+
+	Target  ConnectionTarget
+	Gateway string // server gateway ID (e.g. "us-tx.wg.ivpn.net" or "us-tx"); in use when Target == ConnectionTargetServer
+	// Multi-Hop exit server gateway ID (e.g. "us-tx"); empty - Single-Hop connection
+	ExitGateway string
+
+	VpnType vpn.Type
+	IsTCP   bool // OpenVPN only
+	Port    int  // 0 - default port
+
+	ManualDNS             dns.DnsSettings
+	IsAntiTracker         bool
+	IsAntiTrackerHardcore bool
+}
@@ -0,0 +1,186 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package preferences
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ivpn/desktop-app/daemon/service/dns"
+	"github.com/ivpn/desktop-app/daemon/service/dns/querystats"
+	fwtypes "github.com/ivpn/desktop-app/daemon/service/firewall/types"
+	"github.com/ivpn/desktop-app/daemon/service/localproxy"
+)
+
+// ExportSchemaVersion - the current version of the exported settings format
+const ExportSchemaVersion = 1
+
+// ExportedSettings - portable representation of the daemon preferences (backup\restore; moving settings to another machine)
+type ExportedSettings struct {
+	SchemaVersion int
+
+	Firewall struct {
+		IsPersistent      bool
+		IsAllowLAN        bool
+		IsAllowMulticast  bool
+		IsAllowApiServers bool
+		Exceptions        []fwtypes.Exception
+		InboundRules      []fwtypes.InboundRule `json:",omitempty"`
+	}
+
+	SplitTunnel struct {
+		IsEnabled bool
+		Apps      []string
+	}
+
+	IsLogging                bool
+	IsObfsproxy              bool
+	IsStopOnClientDisconnect bool
+	IsAutoconnectOnLaunch    bool
+	DaemonConnection         ConnectionSettings
+
+	WGKeysRotationInterval int64 // seconds
+
+	Dns                    ExportedDns
+	Gateway                fwtypes.GatewayConfig
+	LocalProxy             localproxy.Config // the proxy credentials are not exported
+	LastConnection         ConnectionSettings
+	IsLatencyThroughTunnel bool
+
+	// Account credentials (session token, WireGuard keys ...).
+	// Exported only when it was explicitly requested.
+	Secrets *SessionStatus `json:",omitempty"`
+	// Stored (inactive) sessions of other accounts; exported together with 'Secrets'
+	StoredSecrets []SessionStatus `json:",omitempty"`
+
+	// Client-specific configuration (e.g. IVPN CLI configuration).
+	// The daemon does not interpret this data.
+	ClientConfig json.RawMessage `json:",omitempty"`
+}
+
+// ExportedDns - DNS configuration of the daemon
+type ExportedDns struct {
+	SplitRules        []dns.DomainRule
+	AntiTrackerFilter dns.FilterConfig
+	QueryStats        querystats.Config
+}
+
+// Export creates a portable representation of the preferences
+func (p *Preferences) Export(includeSecrets bool) ExportedSettings {
+	s := ExportedSettings{SchemaVersion: ExportSchemaVersion}
+
+	s.Firewall.IsPersistent = p.IsFwPersistant
+	s.Firewall.IsAllowLAN = p.IsFwAllowLAN
+	s.Firewall.IsAllowMulticast = p.IsFwAllowLANMulticast
+	s.Firewall.IsAllowApiServers = p.IsFwAllowApiServers
+	s.Firewall.Exceptions = append([]fwtypes.Exception{}, p.FwExceptions...)
+	s.Firewall.InboundRules = append([]fwtypes.InboundRule{}, p.FwInboundRules...)
+
+	s.SplitTunnel.IsEnabled = p.IsSplitTunnel
+	s.SplitTunnel.Apps = append([]string{}, p.SplitTunnelApps...)
+
+	s.IsLogging = p.IsLogging
+	s.IsObfsproxy = p.IsObfsproxy
+	s.IsStopOnClientDisconnect = p.IsStopOnClientDisconnect
+	s.IsAutoconnectOnLaunch = p.IsAutoconnectOnLaunch
+	s.DaemonConnection = p.DaemonConnection
+
+	s.WGKeysRotationInterval = int64(p.Session.WGKeysRegenInerval / time.Second)
+
+	s.Dns = ExportedDns{
+		SplitRules:        append([]dns.DomainRule{}, p.SplitDnsRules...),
+		AntiTrackerFilter: p.AntiTrackerFilter,
+		QueryStats:        p.DnsQueryStats,
+	}
+	s.Gateway = p.Gateway
+	s.LocalProxy = p.LocalProxy
+	s.LocalProxy.Username = ""
+	s.LocalProxy.Password = ""
+	s.LastConnection = p.LastConnection
+	s.IsLatencyThroughTunnel = p.IsLatencyThroughTunnel
+
+	if includeSecrets {
+		session := p.Session
+		s.Secrets = &session
+		s.StoredSecrets = append([]SessionStatus{}, p.StoredSessions...)
+	}
+
+	return s
+}
+
+// Import applies exported settings to the preferences object.
+// The account credentials are imported only if they present in exported data.
+func (p *Preferences) Import(s ExportedSettings) {
+	p.IsFwPersistant = s.Firewall.IsPersistent
+	p.IsFwAllowLAN = s.Firewall.IsAllowLAN
+	p.IsFwAllowLANMulticast = s.Firewall.IsAllowMulticast
+	p.IsFwAllowApiServers = s.Firewall.IsAllowApiServers
+	p.FwExceptions = append([]fwtypes.Exception{}, s.Firewall.Exceptions...)
+	p.FwInboundRules = append([]fwtypes.InboundRule{}, s.Firewall.InboundRules...)
+
+	p.IsSplitTunnel = s.SplitTunnel.IsEnabled
+	p.SplitTunnelApps = append([]string{}, s.SplitTunnel.Apps...)
+
+	p.IsLogging = s.IsLogging
+	p.IsObfsproxy = s.IsObfsproxy
+	p.IsStopOnClientDisconnect = s.IsStopOnClientDisconnect
+	p.IsAutoconnectOnLaunch = s.IsAutoconnectOnLaunch
+	p.DaemonConnection = s.DaemonConnection
+
+	p.SplitDnsRules = append([]dns.DomainRule{}, s.Dns.SplitRules...)
+	p.AntiTrackerFilter = s.Dns.AntiTrackerFilter
+	p.DnsQueryStats = s.Dns.QueryStats
+	p.Gateway = s.Gateway
+	// the proxy credentials are not exported: keep the current ones (the password is kept in LocalProxyPassword)
+	proxy := s.LocalProxy
+	proxy.Username = p.LocalProxy.Username
+	proxy.Password = ""
+	p.LocalProxy = proxy
+	p.LastConnection = s.LastConnection
+	p.IsLatencyThroughTunnel = s.IsLatencyThroughTunnel
+
+	if s.Secrets != nil {
+		p.Session = *s.Secrets
+		p.StoredSessions = append([]SessionStatus{}, s.StoredSecrets...)
+	}
+	if s.WGKeysRotationInterval > 0 {
+		p.Session.WGKeysRegenInerval = time.Second * time.Duration(s.WGKeysRotationInterval)
+	}
+}
+
+// ParseExportedSettings parses exported settings
+func ParseExportedSettings(data []byte) (*ExportedSettings, error) {
+	s := &ExportedSettings{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to parse settings: %w", err)
+	}
+	if s.SchemaVersion <= 0 {
+		return nil, fmt.Errorf("unknown settings format (schema version not defined)")
+	}
+	// Note: when the format will be changed - the conversion from the old versions should be implemented here
+	if s.SchemaVersion != ExportSchemaVersion {
+		return nil, fmt.Errorf("settings schema version %d is not supported (the latest supported version is %d)", s.SchemaVersion, ExportSchemaVersion)
+	}
+	return s, nil
+}
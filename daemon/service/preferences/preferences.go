@@ -33,6 +33,10 @@ import (
 
 	"github.com/ivpn/desktop-app/daemon/helpers"
 	"github.com/ivpn/desktop-app/daemon/logger"
+	"github.com/ivpn/desktop-app/daemon/service/dns"
+	"github.com/ivpn/desktop-app/daemon/service/dns/querystats"
+	fwtypes "github.com/ivpn/desktop-app/daemon/service/firewall/types"
+	"github.com/ivpn/desktop-app/daemon/service/localproxy"
 	"github.com/ivpn/desktop-app/daemon/service/platform"
 )
 
@@ -57,10 +61,28 @@ type Preferences struct {
 	IsFwAllowLAN             bool
 	IsFwAllowLANMulticast    bool
 	IsFwAllowApiServers      bool
-	FwUserExceptions         string // Firewall exceptions: comma separated list of IP addresses (masks) in format: x.x.x.x[/xx]
+	FwUserExceptions         string                       `json:",omitempty"` // Deprecated (converted to FwExceptions on load): comma separated list of IP addresses (masks) in format: x.x.x.x[/xx]
+	FwExceptions             []fwtypes.Exception          // Firewall exceptions: hosts/networks with optional protocol, ports and direction
+	FwInboundRules           []fwtypes.InboundRule        // Firewall rules allowing incoming connections to local services
+	FwTempExceptions         []fwtypes.TemporaryException `json:",omitempty"` // Temporary firewall exceptions (removed by the daemon when expired)
+	Gateway                  fwtypes.GatewayConfig        // VPN gateway mode: sharing the VPN tunnel with a LAN
+	LocalProxy               localproxy.Config            // local SOCKS5/HTTP proxy bound to the VPN interface (the password is kept in LocalProxyPassword)
+	SplitDnsRules            []dns.DomainRule             `json:",omitempty"` // domains resolved by specific DNS servers (split DNS)
+	AntiTrackerFilter        dns.FilterConfig             // local DNS filtering: custom AntiTracker blocklists, allowlist and overrides
+	DnsQueryStats            querystats.Config            // DNS query statistics (disabled by default; the data is kept in memory only)
 	IsStopOnClientDisconnect bool
 	IsObfsproxy              bool
 	IsAutoconnectOnLaunch    bool // when 'true' - UI app (not the daemon!) will perform automation connection on app launch
+	IsLatencyThroughTunnel   bool // when 'true' - the servers latency is measured through the VPN tunnel while connected
+
+	// parameters for connections performed by the daemon itself (e.g. auto-connect on daemon launch)
+	DaemonConnection ConnectionSettings
+	// parameters of the last established connection (in use by the daemon when DaemonConnection.Target == ConnectionTargetLast)
+	LastConnection ConnectionSettings
+
+	// Hash of the daemon configuration file which was applied last time
+	// (in use to detect changes in configuration file when it is in 'seed' mode)
+	DaemonConfigHash string
 
 	// split-tunnelling
 	IsSplitTunnel   bool
@@ -68,6 +90,10 @@ type Preferences struct {
 
 	// last known account status
 	Session SessionStatus
+	// inactive sessions of other accounts (available for fast switching between accounts)
+	StoredSessions []SessionStatus
+	// password of the local proxy (kept with the secrets: it is never exported)
+	LocalProxyPassword string `json:",omitempty"`
 }
 
 func Create() *Preferences {
@@ -178,6 +204,21 @@ func (p *Preferences) LoadPreferences() error {
 		p.IsFwAllowApiServers = platform.FwInitialValueAllowApiServers()
 	}
 
+	// convert firewall exceptions from the old format (comma separated list of IP addresses)
+	if len(p.FwUserExceptions) > 0 {
+		exceptions, _ := fwtypes.ParseUserExceptions(p.FwUserExceptions, true)
+		p.FwExceptions = append(p.FwExceptions, exceptions...)
+		p.FwUserExceptions = ""
+		p.SavePreferences()
+	}
+
+	// the local proxy password was a part of the proxy configuration in previous versions
+	if len(p.LocalProxy.Password) > 0 {
+		p.LocalProxyPassword = p.LocalProxy.Password
+		p.LocalProxy.Password = ""
+		p.SavePreferences()
+	}
+
 	// init WG properties
 	if len(p.Session.WGPublicKey) == 0 || len(p.Session.WGPrivateKey) == 0 || len(p.Session.WGLocalIP) == 0 {
 		p.Session.WGKeyGenerated = time.Time{}
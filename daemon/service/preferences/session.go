@@ -23,6 +23,7 @@
 package preferences
 
 import (
+	"fmt"
 	"net"
 	"strings"
 	"time"
@@ -75,3 +76,46 @@ func (s *SessionStatus) updateWgCredentials(wgPublicKey string, wgPrivateKey str
 		s.WGKeyGenerated = time.Time{}
 	}
 }
+
+// StoredAccounts returns IDs of the accounts which have stored (inactive) sessions
+func (p *Preferences) StoredAccounts() []string {
+	ret := make([]string, 0, len(p.StoredSessions))
+	for _, s := range p.StoredSessions {
+		ret = append(ret, s.AccountID)
+	}
+	return ret
+}
+
+// StoreActiveSession keeps a copy of the active session in the list of stored sessions
+// (the stored session of the same account is replaced)
+func (p *Preferences) StoreActiveSession() {
+	if !p.Session.IsLoggedIn() {
+		return
+	}
+	p.RemoveStoredSession(p.Session.AccountID)
+	p.StoredSessions = append(p.StoredSessions, p.Session)
+}
+
+// RemoveStoredSession removes the stored session of the account
+// Returns the removed session (nil if not found)
+func (p *Preferences) RemoveStoredSession(accountID string) *SessionStatus {
+	for i, s := range p.StoredSessions {
+		if s.AccountID == accountID {
+			p.StoredSessions = append(p.StoredSessions[:i:i], p.StoredSessions[i+1:]...)
+			return &s
+		}
+	}
+	return nil
+}
+
+// SwitchSession makes active the stored session of the account
+// (the currently active session is moved to the list of stored sessions)
+func (p *Preferences) SwitchSession(accountID string) error {
+	newSession := p.RemoveStoredSession(accountID)
+	if newSession == nil {
+		return fmt.Errorf("no stored session for the account")
+	}
+	p.StoreActiveSession()
+	p.Session = *newSession
+	return nil
+}
@@ -0,0 +1,243 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+// Package serverselector implements selection of the VPN server for connection
+// (the fastest, the nearest or a random server; optionally, within a country or city).
+// It is in use by all the connection initiators (clients requests and automatic connection),
+// so the server is selected in the same way everywhere.
+package serverselector
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+
+	apitypes "github.com/ivpn/desktop-app/daemon/api/types"
+	"github.com/ivpn/desktop-app/daemon/helpers"
+	"github.com/ivpn/desktop-app/daemon/vpn"
+)
+
+// Strategy - the way the server is selected
+type Strategy string
+
+const (
+	// Fastest - the server with the lowest ping
+	Fastest Strategy = "fastest"
+	// Nearest - the server nearest to the current geolocation
+	Nearest Strategy = "nearest"
+	// Random - random server
+	Random Strategy = "random"
+)
+
+// Selector - the rule of the server selection.
+// The filters (CountryCode, City, Gateways) are optional; they are combined by logical AND.
+type Selector struct {
+	Strategy Strategy
+	// (optional) the server has to be located in the country (ISO code; case-insensitive)
+	CountryCode string
+	// (optional) the server has to be located in the city (case-insensitive)
+	City string
+	// (optional) the server has to be one of the gateways (e.g. "us-tx1.wg.ivpn.net" or just ID "us-tx1")
+	Gateways []string
+	// (optional) the servers from these countries are not allowed
+	// (e.g. the country of the Multi-Hop exit server)
+	ExcludeCountryCodes []string
+}
+
+// IsDefined returns 'true' when the selector is defined
+func (s Selector) IsDefined() bool {
+	return len(s.Strategy) > 0
+}
+
+// Validate checks the selector parameters
+func (s Selector) Validate() error {
+	switch s.Strategy {
+	case Fastest, Nearest, Random:
+		return nil
+	default:
+		return fmt.Errorf("unsupported server selection strategy '%s'", s.Strategy)
+	}
+}
+
+func (s Selector) String() string {
+	ret := string(s.Strategy)
+	if len(s.City) > 0 {
+		ret += " in " + s.City
+	}
+	if len(s.CountryCode) > 0 {
+		ret += " in " + strings.ToUpper(s.CountryCode)
+	}
+	if len(s.Gateways) > 0 {
+		ret += fmt.Sprintf(" (of %d servers)", len(s.Gateways))
+	}
+	return ret
+}
+
+// Server - the server candidate for selection
+type Server struct {
+	Gateway     string
+	CountryCode string
+	City        string
+	Latitude    float32
+	Longitude   float32
+	// IP addresses of the server hosts
+	Hosts []string
+}
+
+// ServersFromList returns the candidates for selection of the defined VPN type from the servers list
+func ServersFromList(servers *apitypes.ServersInfoResponse, vpnType vpn.Type) []Server {
+	if servers == nil {
+		return nil
+	}
+
+	var ret []Server
+	if vpnType == vpn.WireGuard {
+		for _, s := range servers.WireguardServers {
+			svr := Server{Gateway: s.Gateway, CountryCode: s.CountryCode, City: s.City, Latitude: s.Latitude, Longitude: s.Longitude}
+			for _, h := range s.Hosts {
+				svr.Hosts = append(svr.Hosts, h.Host)
+			}
+			ret = append(ret, svr)
+		}
+	} else {
+		for _, s := range servers.OpenvpnServers {
+			svr := Server{Gateway: s.Gateway, CountryCode: s.CountryCode, City: s.City, Latitude: s.Latitude, Longitude: s.Longitude}
+			for _, h := range s.Hosts {
+				svr.Hosts = append(svr.Hosts, h.Host)
+			}
+			ret = append(ret, svr)
+		}
+	}
+	return ret
+}
+
+// Select returns the server selected from the candidates according to the selector.
+// The 'pings' (host IP => ms) are in use by 'Fastest' strategy;
+// the 'location' (current geolocation; can be nil) is in use by 'Nearest' strategy.
+// When there are no ping results, the 'Fastest' strategy falls back to the nearest server
+// (or to the first candidate when the location is unknown).
+func Select(sel Selector, servers []Server, pings map[string]int, location *apitypes.GeoLookupResponse) (Server, error) {
+	if err := sel.Validate(); err != nil {
+		return Server{}, err
+	}
+
+	candidates := filter(sel, servers)
+	if len(candidates) == 0 {
+		return Server{}, fmt.Errorf("no servers matching the selection criteria (%s)", sel)
+	}
+
+	switch sel.Strategy {
+	case Fastest:
+		if svr, ok := fastest(candidates, pings); ok {
+			return svr, nil
+		}
+		if location != nil {
+			return nearest(candidates, location), nil
+		}
+		return candidates[0], nil
+
+	case Nearest:
+		if location == nil {
+			return Server{}, fmt.Errorf("the current location is unknown")
+		}
+		return nearest(candidates, location), nil
+
+	default: // Random
+		idx := 0
+		if rnd, err := rand.Int(rand.Reader, big.NewInt(int64(len(candidates)))); err == nil {
+			idx = int(rnd.Int64())
+		}
+		return candidates[idx], nil
+	}
+}
+
+func filter(sel Selector, servers []Server) []Server {
+	isGatewayAllowed := func(gateway string) bool {
+		if len(sel.Gateways) == 0 {
+			return true
+		}
+		id := gatewayID(gateway)
+		for _, g := range sel.Gateways {
+			if gatewayID(g) == id {
+				return true
+			}
+		}
+		return false
+	}
+	isCountryExcluded := func(countryCode string) bool {
+		for _, cc := range sel.ExcludeCountryCodes {
+			if strings.EqualFold(cc, countryCode) {
+				return true
+			}
+		}
+		return false
+	}
+
+	ret := make([]Server, 0, len(servers))
+	for _, s := range servers {
+		if len(s.Hosts) == 0 {
+			continue
+		}
+		if len(sel.CountryCode) > 0 && !strings.EqualFold(sel.CountryCode, s.CountryCode) {
+			continue
+		}
+		if len(sel.City) > 0 && !strings.EqualFold(sel.City, s.City) {
+			continue
+		}
+		if !isGatewayAllowed(s.Gateway) || isCountryExcluded(s.CountryCode) {
+			continue
+		}
+		ret = append(ret, s)
+	}
+	return ret
+}
+
+// fastest returns the server with the lowest ping (any of the server hosts is taken into account)
+func fastest(servers []Server, pings map[string]int) (ret Server, ok bool) {
+	bestPing := 0
+	for _, s := range servers {
+		for _, h := range s.Hosts {
+			if p, exists := pings[h]; exists && p > 0 && (bestPing == 0 || p < bestPing) {
+				ret, bestPing = s, p
+			}
+		}
+	}
+	return ret, bestPing > 0
+}
+
+func nearest(servers []Server, location *apitypes.GeoLookupResponse) Server {
+	lat, lon := float64(location.Latitude), float64(location.Longitude)
+	ret, bestDistance := servers[0], -1.0
+	for _, s := range servers {
+		d := helpers.GetDistanceFromLatLonInKm(lat, lon, float64(s.Latitude), float64(s.Longitude))
+		if bestDistance < 0 || d < bestDistance {
+			ret, bestDistance = s, d
+		}
+	}
+	return ret
+}
+
+// gatewayID returns gateway ID. Example: "zz.wg.ivpn.net" => "zz"
+func gatewayID(gateway string) string {
+	return strings.ToLower(strings.Split(strings.TrimSpace(gateway), ".")[0])
+}
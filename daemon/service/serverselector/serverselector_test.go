@@ -0,0 +1,79 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package serverselector
+
+import (
+	"testing"
+
+	apitypes "github.com/ivpn/desktop-app/daemon/api/types"
+)
+
+func TestSelect(t *testing.T) {
+	servers := []Server{
+		{Gateway: "us-tx1.wg.ivpn.net", CountryCode: "US", City: "Dallas, TX", Latitude: 32.78, Longitude: -96.8, Hosts: []string{"10.0.0.1", "10.0.0.2"}},
+		{Gateway: "us-ny1.wg.ivpn.net", CountryCode: "US", City: "New York, NY", Latitude: 40.71, Longitude: -74.01, Hosts: []string{"10.0.0.3"}},
+		{Gateway: "de1.wg.ivpn.net", CountryCode: "DE", City: "Frankfurt", Latitude: 50.11, Longitude: 8.68, Hosts: []string{"10.0.0.4"}},
+		{Gateway: "nl1.wg.ivpn.net", CountryCode: "NL", City: "Amsterdam", Latitude: 52.37, Longitude: 4.89, Hosts: []string{"10.0.0.5"}},
+		{Gateway: "xx1.wg.ivpn.net", CountryCode: "XX", City: "Nowhere"}, // no hosts: never selected
+	}
+	pings := map[string]int{"10.0.0.2": 120, "10.0.0.3": 90, "10.0.0.4": 30, "10.0.0.5": 0}
+	berlin := &apitypes.GeoLookupResponse{Latitude: 52.52, Longitude: 13.4}
+	boston := &apitypes.GeoLookupResponse{Latitude: 42.36, Longitude: -71.06}
+
+	tests := []struct {
+		sel      Selector
+		pings    map[string]int
+		location *apitypes.GeoLookupResponse
+		expected string // "" - error expected
+	}{
+		{Selector{Strategy: Fastest}, pings, nil, "de1.wg.ivpn.net"},
+		{Selector{Strategy: Fastest, CountryCode: "us"}, pings, nil, "us-ny1.wg.ivpn.net"},
+		{Selector{Strategy: Fastest, City: "dallas, tx"}, pings, nil, "us-tx1.wg.ivpn.net"},
+		{Selector{Strategy: Fastest, Gateways: []string{"us-tx1", "nl1.wg.ivpn.net"}}, pings, nil, "us-tx1.wg.ivpn.net"},
+		{Selector{Strategy: Fastest, ExcludeCountryCodes: []string{"de"}}, pings, nil, "us-ny1.wg.ivpn.net"},
+		{Selector{Strategy: Fastest}, nil, boston, "us-ny1.wg.ivpn.net"}, // no pings: nearest
+		{Selector{Strategy: Fastest}, nil, nil, "us-tx1.wg.ivpn.net"},    // no pings, no location: first
+		{Selector{Strategy: Nearest}, pings, berlin, "de1.wg.ivpn.net"},
+		{Selector{Strategy: Nearest, ExcludeCountryCodes: []string{"DE"}}, pings, berlin, "nl1.wg.ivpn.net"},
+		{Selector{Strategy: Nearest, CountryCode: "US"}, pings, berlin, "us-ny1.wg.ivpn.net"},
+		{Selector{Strategy: Nearest}, pings, nil, ""},
+		{Selector{Strategy: Random, City: "Amsterdam"}, nil, nil, "nl1.wg.ivpn.net"},
+		{Selector{Strategy: Random, CountryCode: "XX"}, nil, nil, ""},
+		{Selector{Strategy: "slowest"}, pings, berlin, ""},
+	}
+
+	for i, test := range tests {
+		svr, err := Select(test.sel, servers, test.pings, test.location)
+		if len(test.expected) == 0 {
+			if err == nil {
+				t.Errorf("%d (%s): error expected; selected '%s'", i, test.sel, svr.Gateway)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d (%s): %s", i, test.sel, err)
+		} else if svr.Gateway != test.expected {
+			t.Errorf("%d (%s): expected '%s'; selected '%s'", i, test.sel, test.expected, svr.Gateway)
+		}
+	}
+}
@@ -40,10 +40,14 @@ import (
 	"github.com/ivpn/desktop-app/daemon/helpers"
 	"github.com/ivpn/desktop-app/daemon/logger"
 	"github.com/ivpn/desktop-app/daemon/netinfo"
+	"github.com/ivpn/desktop-app/daemon/ping"
 	"github.com/ivpn/desktop-app/daemon/oshelpers"
 	protocolTypes "github.com/ivpn/desktop-app/daemon/protocol/types"
 	"github.com/ivpn/desktop-app/daemon/service/dns"
+	"github.com/ivpn/desktop-app/daemon/service/dns/querystats"
 	"github.com/ivpn/desktop-app/daemon/service/firewall"
+	"github.com/ivpn/desktop-app/daemon/service/latency"
+	"github.com/ivpn/desktop-app/daemon/service/localproxy"
 	"github.com/ivpn/desktop-app/daemon/service/platform"
 	"github.com/ivpn/desktop-app/daemon/service/platform/filerights"
 	"github.com/ivpn/desktop-app/daemon/service/preferences"
@@ -86,6 +90,12 @@ type Service struct {
 	_preferences       preferences.Preferences
 	_connectMutex      sync.Mutex
 
+	// Use Preferences()/setPreferences()/updatePreferences() to access preferences
+	// (preferences are modified by client requests and by the daemon configuration reload, e.g. on SIGHUP)
+	_preferencesMutex sync.RWMutex
+	// serializes applying preferences at runtime (see applyPreferences())
+	_applyPreferencesMutex sync.Mutex
+
 	// Additional information about current VPN connection
 	// Use GetVpnSessionInfo()/SetVpnSessionInfo() to access this data
 	_vpnSessionInfo      VpnSessionInfo
@@ -101,11 +111,32 @@ type Service struct {
 	// Note: Disconnect() function will wait until VPN fully disconnects
 	_done chan struct{}
 
-	_isServersPingInProgress bool
+	// 1 - servers pinging is in progress (background latency refresh or PingServers request); access by 'sync/atomic' only
+	_isServersPingInProgress int32
+
+	// history of the servers latency (refreshed in background)
+	_latency *latency.Tracker
+	// latency measurement (ICMP or TCP/UDP probes when ICMP is not available)
+	_prober *ping.Prober
 
 	// nil - when session checker stopped
 	// to stop -> write to channel (it is synchronous channel)
 	_sessionCheckerStopChn chan struct{}
+
+	// journal of VPN connection sessions
+	_connHistory connectionHistory
+
+	// scheduler of the temporary firewall exceptions expiration
+	_fwTempExceptions fwTempExceptions
+
+	// captive portal detection and 'portal mode'
+	_captivePortal captivePortal
+
+	// local SOCKS5/HTTP proxy bound to the VPN interface
+	_localProxy localproxy.Proxy
+
+	// upstream DNS servers of the local resolver allowed in the firewall
+	_localResolverFwHosts localResolverFirewallHosts
 }
 
 // VpnSessionInfo - Additional information about current VPN connection
@@ -116,6 +147,8 @@ type VpnSessionInfo struct {
 	// local VPN addresses (outbound IPs)
 	VpnLocalIPv4 net.IP
 	VpnLocalIPv6 net.IP
+	// network namespace of the VPN interface (empty - host namespace)
+	NetNamespace string
 }
 
 // CreateService - service constructor
@@ -150,6 +183,16 @@ func (s *Service) init() error {
 		s._preferences.SavePreferences()
 	}
 
+	// apply daemon configuration file (if exists)
+	s.daemonConfigInit()
+
+	if err := s.historyLoad(); err != nil {
+		log.Error("Failed to load connection history: ", err)
+	}
+
+	// load the latency cache and start refreshing it in background
+	s.latencyTrackerStart()
+
 	// initialize firewall functionality
 	if err := firewall.Initialize(); err != nil {
 		return fmt.Errorf("service initialization error : %w", err)
@@ -159,6 +202,16 @@ func (s *Service) init() error {
 	if err := dns.Initialize(firewall.OnChangeDNS); err != nil {
 		log.Error(fmt.Sprintf("failed to initialize DNS : %s", err))
 	}
+	if _, err := dns.SetSplitDnsRules(s.Preferences().SplitDnsRules); err != nil {
+		log.Error("Failed to apply split DNS rules: ", err)
+	}
+	if _, err := dns.SetFilterConfig(s.Preferences().AntiTrackerFilter, true); err != nil {
+		log.Error("Failed to apply AntiTracker filtering lists: ", err)
+	}
+	dns.SetQueryStatsConfig(s.Preferences().DnsQueryStats)
+	dns.SetActiveDnsChangedHandler(func(active dns.DnsSettings) {
+		s._evtReceiver.OnActiveDnsChanged(active)
+	})
 
 	// initialize split-tunnel functionality
 	if err := splittun.Initialize(); err != nil {
@@ -173,21 +226,35 @@ func (s *Service) init() error {
 	//logger.Enable(s._preferences.IsLogging)
 
 	// firewall initial values
-	if err := firewall.AllowLAN(s._preferences.IsFwAllowLAN, s._preferences.IsFwAllowLANMulticast); err != nil {
+	if err := firewall.AllowLAN(s.Preferences().IsFwAllowLAN, s.Preferences().IsFwAllowLANMulticast); err != nil {
 		log.Error("Failed to initialize firewall with AllowLAN preference value: ", err)
 	}
 
 	//log.Info("Applying firewal exceptions (user configuration)")
-	if err := firewall.SetUserExceptions(s._preferences.FwUserExceptions, true); err != nil {
+	if err := firewall.SetUserExceptions(s.Preferences().FwExceptions); err != nil {
 		log.Error("Failed to apply firewall exceptions: ", err)
 	}
+	if err := firewall.SetInboundRules(s.Preferences().FwInboundRules); err != nil {
+		log.Error("Failed to apply firewall inbound rules: ", err)
+	}
+	// temporary exceptions are still valid after daemon restart (until they are expired)
+	s.fwTempExceptionsInit()
+	// notify clients about blocked packets (when the blocked traffic logging is enabled)
+	firewall.SetBlockedTrafficNotifier(s._evtReceiver.OnKillSwitchBlockedTraffic)
 
-	if s._preferences.IsFwPersistant {
+	if s.Preferences().IsFwPersistant {
 		log.Info("Enabling firewal (persistant configuration)")
 		if err := firewall.SetPersistant(true); err != nil {
 			log.Error("Failed to enable firewall: ", err)
 		}
 	}
+	// periodically check that firewall rules were not modified by third-party software
+	s.fwVerifierStart()
+
+	// VPN gateway mode (applying even when disabled: removing the rules which may remain after daemon crash)
+	if err := firewall.SetGatewayConfig(s.Preferences().Gateway); err != nil {
+		log.Error("Failed to apply VPN gateway mode configuration: ", err)
+	}
 
 	// start WireGuard keys rotation
 	if err := s._wgKeysMgr.Init(s); err != nil {
@@ -235,7 +302,7 @@ func (s *Service) init() error {
 }
 
 func (s *Service) IsConnectivityBlocked() (isBlocked bool, reasonDescription string, err error) {
-	preferences := s._preferences
+	preferences := s.Preferences()
 	if !preferences.IsFwAllowApiServers &&
 		preferences.Session.IsLoggedIn() &&
 		(!s.Connected() || s.IsPaused()) {
@@ -295,9 +362,9 @@ func (s *Service) updateAPIAddrInFWExceptions() {
 // - isServiceMustBeClosed: true informing that service have to be closed ("Stop IVPN Agent when application is not running" feature)
 // - err: error
 func (s *Service) OnControlConnectionClosed() (isServiceMustBeClosed bool, err error) {
-	isServiceMustBeClosed = s._preferences.IsStopOnClientDisconnect
+	isServiceMustBeClosed = s.Preferences().IsStopOnClientDisconnect
 	// disable firewall if it not persistant
-	if !s._preferences.IsFwPersistant {
+	if !s.Preferences().IsFwPersistant {
 		log.Info("Control connection was closed. Disabling firewall.")
 		err = s.SetKillSwitchState(false)
 	}
@@ -501,12 +568,16 @@ func (s *Service) ConnectWireGuard(connectionParams wireguard.ConnectionParams,
 	return s.keepConnection(createVpnObjfunc, manualDNS, firewallOn, firewallDuringConnection, stateChan)
 }
 
-func (s *Service) keepConnection(createVpnObj func() (vpn.Process, error), manualDNS dns.DnsSettings, firewallOn bool, firewallDuringConnection bool, stateChan chan<- vpn.StateInfo) error {
+func (s *Service) keepConnection(createVpnObj func() (vpn.Process, error), manualDNS dns.DnsSettings, firewallOn bool, firewallDuringConnection bool, stateChan chan<- vpn.StateInfo) (retErr error) {
 	prefs := s.Preferences()
 	if !prefs.Session.IsLoggedIn() {
 		return srverrors.ErrorNotLoggedIn{}
 	}
 
+	// register new session in connection history
+	s.historySessionStarted()
+	defer func() { s.historySessionFinished(retErr) }()
+
 	s._manualDNS = manualDNS
 
 	// Not necessary to keep connection until we are not connected
@@ -567,6 +638,7 @@ func (s *Service) keepConnection(createVpnObj func() (vpn.Process, error), manua
 			}
 
 			if s._requiredVpnState == KeepConnection {
+				s.historyOnReconnecting()
 				// consecutive reconnections has delay 5 seconds
 				delayBeforeReconnect = time.Second * 5
 				continue
@@ -642,6 +714,17 @@ func (s *Service) connect(vpnProc vpn.Process, manualDNS dns.DnsSettings, firewa
 			log.Error("(stopping) error on notifying FW about disconnected client:", err)
 		}
 
+		// IPv6 leak protection is in use only when VPN is connected
+		if err = firewall.SetIPv6LeakProtection(false, nil); err != nil {
+			log.Error("(stopping) failed to disable IPv6 leak protection:", err)
+		}
+
+		// local proxy is running only when VPN is connected
+		s._localProxy.Stop()
+
+		// the unfiltered DNS is defined only for current VPN connection
+		dns.SetUnfilteredDns(nil)
+
 		// when we were requested to enable firewall for this connection
 		// And initial FW state was disabled - we have to disable it back
 		if firewallDuringConnection && !fwInitState {
@@ -686,9 +769,16 @@ func (s *Service) connect(vpnProc vpn.Process, manualDNS dns.DnsSettings, firewa
 			connectRoutinesWaiter.Done()
 		}()
 
+		// periodically update traffic info in connection history
+		trafficTicker := time.NewTicker(connectionHistoryTrafficInterval)
+		defer trafficTicker.Stop()
+
 		var state vpn.StateInfo
 		for isRuning := true; isRuning; {
 			select {
+			case <-trafficTicker.C:
+				s.historyUpdateTraffic()
+
 			case state = <-internalStateChan:
 
 				// store info about current time
@@ -701,6 +791,8 @@ func (s *Service) connect(vpnProc vpn.Process, manualDNS dns.DnsSettings, firewa
 
 				log.Info(fmt.Sprintf("State: %v", state))
 
+				s.historyOnVpnState(state)
+
 				// internally process VPN state change
 				switch state.State {
 
@@ -724,38 +816,65 @@ func (s *Service) connect(vpnProc vpn.Process, manualDNS dns.DnsSettings, firewa
 						s._requiredVpnState = KeepConnection
 					}
 
-					// start routing change detection
-					if netInterface, err := netinfo.InterfaceByIPAddr(state.ClientIP); err != nil {
-						log.Error(fmt.Sprintf("Unable to initialize routing change detection. Failed to get interface '%s'", state.ClientIP.String()))
+					// remember connection parameters (in use by daemon-side auto-connect)
+					s.saveLastConnection(state)
+
+					if len(state.NetNamespace) > 0 {
+						// the VPN interface is in isolated network namespace: the host routing, DNS and firewall rules stay untouched
+						// (the VPN server is still allowed in the firewall: the encrypted traffic is sent by the host)
+						log.Info(fmt.Sprintf("VPN interface is in isolated network namespace '%s'", state.NetNamespace))
 					} else {
+						// start routing change detection
+						if netInterface, err := netinfo.InterfaceByIPAddr(state.ClientIP); err != nil {
+							log.Error(fmt.Sprintf("Unable to initialize routing change detection. Failed to get interface '%s'", state.ClientIP.String()))
+						} else {
 
-						log.Info("Starting route change detection")
-						s._netChangeDetector.Start(routingChangeChan, routingUpdateChan, netInterface)
-					}
+							log.Info("Starting route change detection")
+							s._netChangeDetector.Start(routingChangeChan, routingUpdateChan, netInterface)
+						}
+
+						// Inform firewall about client local IP
+						firewall.ClientConnected(
+							state.ClientIP, state.ClientIPv6,
+							state.ClientPort,
+							state.ServerIP, state.ServerPort,
+							state.IsTCP)
+
+						// Ensure firewall is configured to allow DNS communication
+						// At this moment, firewall must be already configured for custom DNS
+						// but if it still has no rule - apply DNS rules for default DNS
+						if _, isInitialized := firewall.GetDnsInfo(); !isInitialized {
+							d := dns.DnsSettingsCreate(vpnProc.DefaultDNS())
+							firewall.OnChangeDNS(&d)
+						}
 
-					// Inform firewall about client local IP
-					firewall.ClientConnected(
-						state.ClientIP, state.ClientIPv6,
-						state.ClientPort,
-						state.ServerIP, state.ServerPort,
-						state.IsTCP)
-
-					// Ensure firewall is configured to allow DNS communication
-					// At this moment, firewall must be already configured for custom DNS
-					// but if it still has no rule - apply DNS rules for default DNS
-					if _, isInitialized := firewall.GetDnsInfo(); !isInitialized {
-						d := dns.DnsSettingsCreate(vpnProc.DefaultDNS())
-						firewall.OnChangeDNS(&d)
+						// the VPN server default DNS is not blocking anything: in use for domains from AntiTracker allowlist
+						dns.SetUnfilteredDns(vpnProc.DefaultDNS())
+						// allow upstream DNS servers of the local resolver
+						s.localResolverFirewallApply()
 					}
 
 					// save ClientIP/ClientIPv6 into vpn-session-info
 					sInfo := s.GetVpnSessionInfo()
 					sInfo.VpnLocalIPv4 = state.ClientIP
 					sInfo.VpnLocalIPv6 = state.ClientIPv6
+					sInfo.NetNamespace = state.NetNamespace
 					s.SetVpnSessionInfo(sInfo)
 
 					// Notify Split-Tunneling module about connected VPN status
 					s.splitTunnelling_ApplyConfig()
+
+					// block native IPv6 of the host if IPv6 is not routed through the tunnel
+					s.ipv6LeakProtectionApply()
+
+					// start local proxy (if enabled)
+					if err := s.localProxyApply(); err != nil {
+						log.Error("Failed to start local proxy: ", err)
+					}
+
+					// captive portal is passed: 'portal mode' is not required anymore
+					// (asynchronously: do not block the connection routine)
+					go s.captivePortalOnVpnConnected()
 				default:
 				}
 
@@ -966,7 +1085,14 @@ func (s *Service) Pause() error {
 
 	log.Info("Pausing...")
 	firewall.ClientPaused()
-	return vpn.Pause()
+	err := vpn.Pause()
+	// the traffic is not routed through the tunnel in paused state: IPv6 leak protection is not applicable
+	s.ipv6LeakProtectionApply()
+	// local proxy refuses connections in paused state
+	if e := s.localProxyApply(); e != nil {
+		log.Error("Failed to update local proxy: ", e)
+	}
+	return err
 }
 
 // Resume resume vpn connection
@@ -981,7 +1107,12 @@ func (s *Service) Resume() error {
 
 	log.Info("Resuming...")
 	firewall.ClientResumed()
-	return vpn.Resume()
+	err := vpn.Resume()
+	s.ipv6LeakProtectionApply()
+	if e := s.localProxyApply(); e != nil {
+		log.Error("Failed to update local proxy: ", e)
+	}
+	return err
 }
 
 // IsPaused returns 'true' if current vpn connection is in paused state
@@ -1078,7 +1209,7 @@ func (s *Service) getHostsToPing(currentLocation *types.GeoLookupResponse) ([]ne
 // SetKillSwitchState enable\disable killswitch
 func (s *Service) SetKillSwitchState(isEnabled bool) error {
 
-	if !isEnabled && s._preferences.IsFwPersistant {
+	if !isEnabled && s.Preferences().IsFwPersistant {
 		return fmt.Errorf("unable to disable Firewall in 'Persistent' state. Please, disable 'Always-on firewall' first")
 	}
 
@@ -1091,16 +1222,21 @@ func (s *Service) SetKillSwitchState(isEnabled bool) error {
 
 // KillSwitchState returns killswitch state
 func (s *Service) KillSwitchState() (isEnabled, isPersistant, isAllowLAN, isAllowLanMulticast, isAllowApiServers bool, fwUserExceptions string, err error) {
-	prefs := s._preferences
+	prefs := s.Preferences()
 	enabled, err := firewall.GetEnabled()
-	return enabled, prefs.IsFwPersistant, prefs.IsFwAllowLAN, prefs.IsFwAllowLANMulticast, prefs.IsFwAllowApiServers, prefs.FwUserExceptions, err
+	return enabled, prefs.IsFwPersistant, prefs.IsFwAllowLAN, prefs.IsFwAllowLANMulticast, prefs.IsFwAllowApiServers, firewall.UserExceptionsString(prefs.FwExceptions), err
+}
+
+// KillSwitchExceptions returns the list of user-defined firewall exceptions
+func (s *Service) KillSwitchExceptions() []firewall.Exception {
+	return append([]firewall.Exception{}, s.Preferences().FwExceptions...)
 }
 
 // SetKillSwitchIsPersistent change kill-switch value
 func (s *Service) SetKillSwitchIsPersistent(isPersistant bool) error {
-	prefs := s._preferences
-	prefs.IsFwPersistant = isPersistant
-	s.setPreferences(prefs)
+	s.updatePreferences(func(p *preferences.Preferences) {
+		p.IsFwPersistant = isPersistant
+	})
 
 	err := firewall.SetPersistant(isPersistant)
 	if err == nil {
@@ -1111,21 +1247,23 @@ func (s *Service) SetKillSwitchIsPersistent(isPersistant bool) error {
 
 // SetKillSwitchAllowLAN change kill-switch value
 func (s *Service) SetKillSwitchAllowLAN(isAllowLan bool) error {
-	return s.setKillSwitchAllowLAN(isAllowLan, s._preferences.IsFwAllowLANMulticast)
+	return s.setKillSwitchAllowLAN(func(p *preferences.Preferences) { p.IsFwAllowLAN = isAllowLan })
 }
 
 // SetKillSwitchAllowLANMulticast change kill-switch value
 func (s *Service) SetKillSwitchAllowLANMulticast(isAllowLanMulticast bool) error {
-	return s.setKillSwitchAllowLAN(s._preferences.IsFwAllowLAN, isAllowLanMulticast)
+	return s.setKillSwitchAllowLAN(func(p *preferences.Preferences) { p.IsFwAllowLANMulticast = isAllowLanMulticast })
 }
 
-func (s *Service) setKillSwitchAllowLAN(isAllowLan bool, isAllowLanMulticast bool) error {
-	prefs := s._preferences
-	prefs.IsFwAllowLAN = isAllowLan
-	prefs.IsFwAllowLANMulticast = isAllowLanMulticast
-	s.setPreferences(prefs)
+// setKillSwitchAllowLAN modifies 'Allow LAN' values of preferences atomically and applies them to the firewall
+func (s *Service) setKillSwitchAllowLAN(update func(p *preferences.Preferences)) error {
+	var isAllowLan, isAllowLanMulticast bool
+	s.updatePreferences(func(p *preferences.Preferences) {
+		update(p)
+		isAllowLan, isAllowLanMulticast = p.IsFwAllowLAN, p.IsFwAllowLANMulticast
+	})
 
-	err := firewall.AllowLAN(prefs.IsFwAllowLAN, prefs.IsFwAllowLANMulticast)
+	err := firewall.AllowLAN(isAllowLan, isAllowLanMulticast)
 	if err == nil {
 		s._evtReceiver.OnKillSwitchStateChanged()
 	}
@@ -1142,65 +1280,232 @@ func (s *Service) SetKillSwitchAllowAPIServers(isAllowAPIServers bool) error {
 		}
 	}
 
-	prefs := s._preferences
-	prefs.IsFwAllowApiServers = isAllowAPIServers
-	s.setPreferences(prefs)
+	s.updatePreferences(func(p *preferences.Preferences) {
+		p.IsFwAllowApiServers = isAllowAPIServers
+	})
 	s._evtReceiver.OnKillSwitchStateChanged()
 	s.updateAPIAddrInFWExceptions()
 	return nil
 }
 
 // SetKillSwitchUserExceptions set ip/mask to be excluded from FW block
+// (only exceptions without protocol/ports/direction restrictions are replaced; the rest of exceptions are kept)
 // Parameters:
 //	- exceptions - comma separated list of IP addresses in format: x.x.x.x[/xx]
 func (s *Service) SetKillSwitchUserExceptions(exceptions string, ignoreParsingErrors bool) error {
-	prefs := s._preferences
-	prefs.FwUserExceptions = exceptions
-	s.setPreferences(prefs)
+	hostExceptions, err := firewall.ParseUserExceptions(exceptions, ignoreParsingErrors)
+	if err != nil {
+		return err
+	}
+	return s.updateKillSwitchExceptions(func(current []firewall.Exception) ([]firewall.Exception, error) {
+		return firewall.ReplaceHostOnlyExceptions(current, hostExceptions), nil
+	})
+}
+
+// AddKillSwitchException adds new user-defined firewall exception
+func (s *Service) AddKillSwitchException(exception firewall.Exception) error {
+	exception, err := exception.Normalized()
+	if err != nil {
+		return fmt.Errorf("bad firewall exception: %w", err)
+	}
+
+	return s.updateKillSwitchExceptions(func(exceptions []firewall.Exception) ([]firewall.Exception, error) {
+		for i, e := range exceptions {
+			if isSameFwException(e, exception) {
+				// exception already exists: just update the description
+				exceptions[i] = exception
+				return exceptions, nil
+			}
+		}
+		return append(exceptions, exception), nil
+	})
+}
+
+// RemoveKillSwitchException removes user-defined firewall exception
+// (the description of the exception is not taken into account)
+func (s *Service) RemoveKillSwitchException(exception firewall.Exception) error {
+	exception, err := exception.Normalized()
+	if err != nil {
+		return fmt.Errorf("bad firewall exception: %w", err)
+	}
+
+	return s.updateKillSwitchExceptions(func(current []firewall.Exception) ([]firewall.Exception, error) {
+		exceptions := make([]firewall.Exception, 0, len(current))
+		for _, e := range current {
+			if !isSameFwException(e, exception) {
+				exceptions = append(exceptions, e)
+			}
+		}
+		if len(exceptions) == len(current) {
+			return nil, fmt.Errorf("firewall exception not found: %s", exception.String())
+		}
+		return exceptions, nil
+	})
+}
+
+// SetKillSwitchExceptions set the list of user-defined firewall exceptions
+func (s *Service) SetKillSwitchExceptions(exceptions []firewall.Exception) error {
+	return s.updateKillSwitchExceptions(func([]firewall.Exception) ([]firewall.Exception, error) {
+		return exceptions, nil
+	})
+}
+
+// updateKillSwitchExceptions modifies the list of user-defined firewall exceptions atomically and applies it to the firewall
+// ('update' receives a copy of the current list)
+func (s *Service) updateKillSwitchExceptions(update func(current []firewall.Exception) ([]firewall.Exception, error)) error {
+	var exceptions []firewall.Exception
+	var err error
+	s.updatePreferences(func(p *preferences.Preferences) {
+		if exceptions, err = update(append([]firewall.Exception{}, p.FwExceptions...)); err == nil {
+			p.FwExceptions = exceptions
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	err = firewall.SetUserExceptions(exceptions)
+	if err == nil {
+		s._evtReceiver.OnKillSwitchStateChanged()
+	}
+	return err
+}
+
+// KillSwitchInboundRules returns the list of firewall rules allowing incoming connections to local services
+func (s *Service) KillSwitchInboundRules() []firewall.InboundRule {
+	return append([]firewall.InboundRule{}, s.Preferences().FwInboundRules...)
+}
+
+// AddKillSwitchInboundRule adds the firewall rule allowing incoming connections to local service
+func (s *Service) AddKillSwitchInboundRule(rule firewall.InboundRule) error {
+	rule, err := rule.Normalized()
+	if err != nil {
+		return fmt.Errorf("bad firewall inbound rule: %w", err)
+	}
 
-	err := firewall.SetUserExceptions(exceptions, ignoreParsingErrors)
+	return s.updateKillSwitchInboundRules(func(rules []firewall.InboundRule) ([]firewall.InboundRule, error) {
+		for i, r := range rules {
+			if isSameFwInboundRule(r, rule) {
+				// rule already exists: just update the description
+				rules[i] = rule
+				return rules, nil
+			}
+		}
+		return append(rules, rule), nil
+	})
+}
+
+// RemoveKillSwitchInboundRule removes the firewall inbound rule
+// (the description of the rule is not taken into account)
+func (s *Service) RemoveKillSwitchInboundRule(rule firewall.InboundRule) error {
+	return s.updateKillSwitchInboundRules(func(current []firewall.InboundRule) ([]firewall.InboundRule, error) {
+		rules := make([]firewall.InboundRule, 0, len(current))
+		for _, r := range current {
+			if !isSameFwInboundRule(r, rule) {
+				rules = append(rules, r)
+			}
+		}
+		if len(rules) == len(current) {
+			return nil, fmt.Errorf("firewall inbound rule not found: %s", rule.String())
+		}
+		return rules, nil
+	})
+}
+
+// SetKillSwitchInboundRules set the list of firewall rules allowing incoming connections to local services
+func (s *Service) SetKillSwitchInboundRules(rules []firewall.InboundRule) error {
+	return s.updateKillSwitchInboundRules(func([]firewall.InboundRule) ([]firewall.InboundRule, error) {
+		return rules, nil
+	})
+}
+
+// updateKillSwitchInboundRules modifies the list of firewall inbound rules atomically and applies it to the firewall
+// ('update' receives a copy of the current list)
+func (s *Service) updateKillSwitchInboundRules(update func(current []firewall.InboundRule) ([]firewall.InboundRule, error)) error {
+	var rules []firewall.InboundRule
+	var err error
+	s.updatePreferences(func(p *preferences.Preferences) {
+		if rules, err = update(append([]firewall.InboundRule{}, p.FwInboundRules...)); err == nil {
+			p.FwInboundRules = rules
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	err = firewall.SetInboundRules(rules)
 	if err == nil {
 		s._evtReceiver.OnKillSwitchStateChanged()
 	}
 	return err
 }
 
+// KillSwitchBlockedTrafficLog returns the log of packets blocked by the firewall
+// (only entries with the sequence number bigger than 'sinceSeq')
+func (s *Service) KillSwitchBlockedTrafficLog(sinceSeq uint64) (isEnabled bool, entries []firewall.BlockedPacket) {
+	return firewall.BlockedTrafficLog(sinceSeq)
+}
+
+// SetKillSwitchBlockedTrafficLog enables/disables logging of the packets blocked by the firewall
+func (s *Service) SetKillSwitchBlockedTrafficLog(enable bool) error {
+	return firewall.SetBlockedTrafficLog(enable)
+}
+
+func isSameFwInboundRule(a, b firewall.InboundRule) bool {
+	a, _ = a.Normalized()
+	b, _ = b.Normalized()
+	a.Description, b.Description = "", ""
+	return a == b
+}
+
+// isSameFwException returns 'true' when both exceptions are defining the same rule (the description is ignored)
+func isSameFwException(a, b firewall.Exception) bool {
+	a, _ = a.Normalized()
+	b, _ = b.Normalized()
+	a.Description, b.Description = "", ""
+	return a == b
+}
+
 //////////////////////////////////////////////////////////
 // PREFERENCES
 //////////////////////////////////////////////////////////
 
 // SetPreference set preference value
 func (s *Service) SetPreference(key protocolTypes.ServicePreference, val string) (isChanged bool, err error) {
-	prefs := s._preferences
 	isChanged = false
 
-	switch key {
-	case protocolTypes.Prefs_IsEnableLogging:
-		if val, err := strconv.ParseBool(val); err == nil {
-			isChanged = val != prefs.IsLogging
-			prefs.IsLogging = val
-			logger.Enable(val)
-		}
-	case protocolTypes.Prefs_IsStopServerOnClientDisconnect:
-		if val, err := strconv.ParseBool(val); err == nil {
-			isChanged = val != prefs.IsStopOnClientDisconnect
-			prefs.IsStopOnClientDisconnect = val
-		}
-	case protocolTypes.Prefs_IsEnableObfsproxy:
-		if val, err := strconv.ParseBool(val); err == nil {
-			isChanged = val != prefs.IsObfsproxy
-			prefs.IsObfsproxy = val
-		}
-	case protocolTypes.Prefs_IsAutoconnectOnLaunch:
-		if val, err := strconv.ParseBool(val); err == nil {
-			isChanged = val != prefs.IsAutoconnectOnLaunch
-			prefs.IsAutoconnectOnLaunch = val
+	s.updatePreferences(func(prefs *preferences.Preferences) {
+		switch key {
+		case protocolTypes.Prefs_IsEnableLogging:
+			if val, err := strconv.ParseBool(val); err == nil {
+				isChanged = val != prefs.IsLogging
+				prefs.IsLogging = val
+				logger.Enable(val)
+			}
+		case protocolTypes.Prefs_IsStopServerOnClientDisconnect:
+			if val, err := strconv.ParseBool(val); err == nil {
+				isChanged = val != prefs.IsStopOnClientDisconnect
+				prefs.IsStopOnClientDisconnect = val
+			}
+		case protocolTypes.Prefs_IsEnableObfsproxy:
+			if val, err := strconv.ParseBool(val); err == nil {
+				isChanged = val != prefs.IsObfsproxy
+				prefs.IsObfsproxy = val
+			}
+		case protocolTypes.Prefs_IsAutoconnectOnLaunch:
+			if val, err := strconv.ParseBool(val); err == nil {
+				isChanged = val != prefs.IsAutoconnectOnLaunch
+				prefs.IsAutoconnectOnLaunch = val
+			}
+		case protocolTypes.Prefs_IsLatencyThroughTunnel:
+			if val, err := strconv.ParseBool(val); err == nil {
+				isChanged = val != prefs.IsLatencyThroughTunnel
+				prefs.IsLatencyThroughTunnel = val
+			}
+		default:
+			log.Warning(fmt.Sprintf("Preference key '%s' not supported", key))
 		}
-	default:
-		log.Warning(fmt.Sprintf("Preference key '%s' not supported", key))
-	}
-
-	s.setPreferences(prefs)
+	})
 	log.Info(fmt.Sprintf("preferences %s='%s'", key, val))
 
 	return isChanged, nil
@@ -1208,11 +1513,29 @@ func (s *Service) SetPreference(key protocolTypes.ServicePreference, val string)
 
 // Preferences returns preferences
 func (s *Service) Preferences() preferences.Preferences {
+	s._preferencesMutex.RLock()
+	defer s._preferencesMutex.RUnlock()
 	return s._preferences
 }
 
 func (s *Service) ResetPreferences() error {
-	s._preferences = *preferences.Create()
+	// temporary firewall exceptions are still applied (until expiration), so keep them
+	tempExceptions := s.KillSwitchTempExceptions()
+	// the stored sessions are erased: delete them on the backend
+	s.storedSessionsDelete()
+
+	prefs := *preferences.Create()
+	prefs.FwTempExceptions = tempExceptions
+	s.setPreferences(prefs)
+	s._localProxy.Stop()
+	dns.SetSplitDnsRules(nil)
+	dns.SetFilterConfig(dns.FilterConfig{}, true)
+	dns.SetQueryStatsConfig(querystats.Config{})
+
+	// disable VPN gateway mode
+	if err := firewall.SetGatewayConfig(firewall.GatewayConfig{}); err != nil {
+		log.Error("Failed to disable VPN gateway mode: ", err)
+	}
 
 	// erase ST config
 	s.SplitTunnelling_SetConfig(false, true)
@@ -1253,17 +1576,17 @@ func (s *Service) SplitTunnelling_SetConfig(isEnabled bool, reset bool) error {
 		return s.splitTunnelling_Reset()
 	}
 
-	prefs := s._preferences
-	prefs.IsSplitTunnel = isEnabled
-	s.setPreferences(prefs)
+	s.updatePreferences(func(p *preferences.Preferences) {
+		p.IsSplitTunnel = isEnabled
+	})
 
 	return s.splitTunnelling_ApplyConfig()
 }
 func (s *Service) splitTunnelling_Reset() error {
-	prefs := s._preferences
-	prefs.IsSplitTunnel = false
-	prefs.SplitTunnelApps = make([]string, 0)
-	s.setPreferences(prefs)
+	s.updatePreferences(func(p *preferences.Preferences) {
+		p.IsSplitTunnel = false
+		p.SplitTunnelApps = make([]string, 0)
+	})
 
 	splittun.Reset()
 
@@ -1291,7 +1614,7 @@ func (s *Service) splitTunnelling_ApplyConfig() error {
 }
 
 func (s *Service) SplitTunnelling_AddApp(exec string) (cmdToExecute string, isAlreadyRunning bool, err error) {
-	if !s._preferences.IsSplitTunnel {
+	if !s.Preferences().IsSplitTunnel {
 		return "", false, fmt.Errorf("unable to run application in Split Tunneling environment: Split Tunneling is disabled")
 	}
 	// apply ST configuration after function ends
@@ -1322,20 +1645,21 @@ func (s *Service) SplitTunnelling_AddedPidInfo(pid int, exec string, cmdToExecut
 //////////////////////////////////////////////////////////
 
 func (s *Service) setCredentials(accountID, session, vpnUser, vpnPass, wgPublicKey, wgPrivateKey, wgLocalIP string, wgKeyGenerated int64) error {
-	// save session info
-	s._preferences.SetSession(accountID,
-		session,
-		vpnUser,
-		vpnPass,
-		wgPublicKey,
-		wgPrivateKey,
-		wgLocalIP)
-
-	// manually set info about WG keys timestamp
-	if wgKeyGenerated > 0 {
-		s._preferences.Session.WGKeyGenerated = time.Unix(wgKeyGenerated, 0)
-		s._preferences.SavePreferences()
-	}
+	s.updatePreferences(func(p *preferences.Preferences) {
+		// save session info
+		p.SetSession(accountID,
+			session,
+			vpnUser,
+			vpnPass,
+			wgPublicKey,
+			wgPrivateKey,
+			wgLocalIP)
+
+		// manually set info about WG keys timestamp
+		if wgKeyGenerated > 0 {
+			p.Session.WGKeyGenerated = time.Unix(wgKeyGenerated, 0)
+		}
+	})
 
 	// notify clients about session update
 	s._evtReceiver.OnServiceSessionChanged()
@@ -1346,7 +1670,9 @@ func (s *Service) setCredentials(accountID, session, vpnUser, vpnPass, wgPublicK
 }
 
 // SessionNew creates new session
-func (s *Service) SessionNew(accountID string, forceLogin bool, captchaID string, captcha string, confirmation2FA string) (
+// When 'keepCurrentSession' is true - the current session (of another account) is not logged out
+// but stored for fast switching between accounts (see SessionSwitch())
+func (s *Service) SessionNew(accountID string, forceLogin bool, captchaID string, captcha string, confirmation2FA string, keepCurrentSession bool) (
 	apiCode int,
 	apiErrorMsg string,
 	accountInfo preferences.AccountStatus,
@@ -1366,10 +1692,24 @@ func (s *Service) SessionNew(accountID string, forceLogin bool, captchaID string
 		}
 	}()
 
-	// delete current session (if exists)
-	isCanDeleteSessionLocally := true
-	if err := s.SessionDelete(isCanDeleteSessionLocally); err != nil {
-		log.Error("Creating new session -> Failed to delete active session: ", err)
+	currentSession := s.Preferences().Session
+	if keepCurrentSession && currentSession.IsLoggedIn() && currentSession.AccountID != accountID {
+		// the current session stays valid (it will be stored after successful login);
+		// the VPN connection is kept until the new session is activated
+		s._wgKeysMgr.StopKeysRotation()
+		defer func() {
+			if err := s._wgKeysMgr.StartKeysRotation(); err != nil {
+				log.Error("Failed to start WG keys rotation:", err)
+			}
+		}()
+	} else {
+		keepCurrentSession = false
+
+		// delete current session (if exists)
+		isCanDeleteSessionLocally := true
+		if err := s.SessionDelete(isCanDeleteSessionLocally); err != nil {
+			log.Error("Creating new session -> Failed to delete active session: ", err)
+		}
 	}
 
 	// generate new keys for WireGuard
@@ -1418,6 +1758,26 @@ func (s *Service) SessionNew(accountID string, forceLogin bool, captchaID string
 	// get account status info
 	accountInfo = s.createAccountStatus(successResp.ServiceStatus)
 
+	if keepCurrentSession {
+		// the active connection uses the credentials of the previous session
+		// (the caller is responsible to re-establish the connection)
+		s.Disconnect()
+	}
+
+	var oldSession *preferences.SessionStatus
+	s.updatePreferences(func(p *preferences.Preferences) {
+		if keepCurrentSession {
+			p.StoreActiveSession()
+		}
+		// the new session replaces the stored session of the same account (if exists)
+		oldSession = p.RemoveStoredSession(accountID)
+	})
+	if oldSession != nil {
+		if err := s._api.SessionDelete(oldSession.Session); err != nil {
+			log.Info("Failed to delete the old stored session of the account: ", err)
+		}
+	}
+
 	s.setCredentials(accountID,
 		successResp.Token,
 		successResp.VpnUsername,
@@ -1429,6 +1789,38 @@ func (s *Service) SessionNew(accountID string, forceLogin bool, captchaID string
 	return apiCode, "", accountInfo, rawResponse, nil
 }
 
+// SessionSwitch makes active the stored session of another account
+// (the current session is stored for fast switching back; see SessionNew())
+func (s *Service) SessionSwitch(accountID string) error {
+	if session := s.Preferences().Session; session.IsLoggedIn() && session.AccountID == accountID {
+		return nil // the session is already active
+	}
+
+	log.Info("Switching account session...")
+
+	s._wgKeysMgr.StopKeysRotation()
+	var err error
+	s.updatePreferences(func(p *preferences.Preferences) {
+		err = p.SwitchSession(accountID)
+	})
+	if err != nil {
+		if e := s._wgKeysMgr.StartKeysRotation(); e != nil {
+			log.Error("Failed to start WG keys rotation:", e)
+		}
+		return err
+	}
+
+	// notify clients about session update
+	s._evtReceiver.OnServiceSessionChanged()
+
+	s.startSessionChecker()
+	// the new session has its own WG keys and rotation schedule
+	if err := s._wgKeysMgr.StartKeysRotation(); err != nil {
+		log.Error("Failed to start WG keys rotation:", err)
+	}
+	return nil
+}
+
 // SessionDelete removes session info
 func (s *Service) SessionDelete(isCanDeleteSessionLocally bool) error {
 	sessionNeedToDeleteOnBackend := true
@@ -1458,16 +1850,7 @@ func (s *Service) logOut(sessionNeedToDeleteOnBackend bool, isCanDeleteSessionLo
 
 		// Temporary allow API server access (If Firewall is enabled)
 		// Otherwise, there will not be any possibility to Login (because all connectivity is blocked)
-		fwIsEnabled, _, _, _, fwIsAllowApiServers, _, _ := s.KillSwitchState()
-		if fwIsEnabled && !fwIsAllowApiServers {
-			s.SetKillSwitchAllowAPIServers(true)
-		}
-		defer func() {
-			if fwIsEnabled && !fwIsAllowApiServers {
-				// restore state for 'AllowAPIServers' configuration (previously, was enabled)
-				s.SetKillSwitchAllowAPIServers(false)
-			}
-		}()
+		defer s.fwTemporaryAllowApiServers()()
 
 		session := s.Preferences().Session
 		if session.IsLoggedIn() {
@@ -1484,7 +1867,9 @@ func (s *Service) logOut(sessionNeedToDeleteOnBackend bool, isCanDeleteSessionLo
 		}
 	}
 
-	s._preferences.SetSession("", "", "", "", "", "", "")
+	s.updatePreferences(func(p *preferences.Preferences) {
+		p.SetSession("", "", "", "", "", "", "")
+	})
 	log.Info("Logged out locally")
 
 	// notify clients about session update
@@ -1492,6 +1877,45 @@ func (s *Service) logOut(sessionNeedToDeleteOnBackend bool, isCanDeleteSessionLo
 	return nil
 }
 
+// fwTemporaryAllowApiServers allows access to API servers (if Firewall is enabled)
+// Returns the function which restores the previous state of 'AllowAPIServers' configuration
+func (s *Service) fwTemporaryAllowApiServers() (restore func()) {
+	fwIsEnabled, _, _, _, fwIsAllowApiServers, _, _ := s.KillSwitchState()
+	if fwIsEnabled && !fwIsAllowApiServers {
+		s.SetKillSwitchAllowAPIServers(true)
+	}
+	return func() {
+		if fwIsEnabled && !fwIsAllowApiServers {
+			// restore state for 'AllowAPIServers' configuration (previously, was enabled)
+			s.SetKillSwitchAllowAPIServers(false)
+		}
+	}
+}
+
+// storedSessionsDelete deletes the stored (inactive) sessions of other accounts on the backend
+// (the sessions must not remain active on the accounts when they are erased locally)
+func (s *Service) storedSessionsDelete() {
+	s.sessionsDelete(s.Preferences().StoredSessions)
+}
+
+// sessionsDelete deletes the sessions on the backend (e.g. the sessions replaced by imported ones)
+func (s *Service) sessionsDelete(sessions []preferences.SessionStatus) {
+	if len(sessions) == 0 {
+		return
+	}
+
+	defer s.fwTemporaryAllowApiServers()()
+
+	for _, session := range sessions {
+		if !session.IsLoggedIn() {
+			continue
+		}
+		if err := s._api.SessionDelete(session.Session); err != nil {
+			log.Info("Failed to delete the stored session on the backend: ", err)
+		}
+	}
+}
+
 func (s *Service) OnSessionNotFound() {
 	// Logging out now
 	log.Info("Session not found. Logging out.")
@@ -1630,7 +2054,9 @@ func (s *Service) stopSessionChecker() {
 
 // WireGuardSaveNewKeys saves WG keys
 func (s *Service) WireGuardSaveNewKeys(wgPublicKey string, wgPrivateKey string, wgLocalIP string) {
-	s._preferences.UpdateWgCredentials(wgPublicKey, wgPrivateKey, wgLocalIP)
+	s.updatePreferences(func(p *preferences.Preferences) {
+		p.UpdateWgCredentials(wgPublicKey, wgPrivateKey, wgLocalIP)
+	})
 
 	// notify clients about session (wg keys) update
 	s._evtReceiver.OnServiceSessionChanged()
@@ -1656,8 +2082,9 @@ func (s *Service) WireGuardSaveNewKeys(wgPublicKey string, wgPrivateKey string,
 
 // WireGuardSetKeysRotationInterval change WG key rotation interval
 func (s *Service) WireGuardSetKeysRotationInterval(interval int64) {
-	s._preferences.Session.WGKeysRegenInerval = time.Second * time.Duration(interval)
-	s._preferences.SavePreferences()
+	s.updatePreferences(func(p *preferences.Preferences) {
+		p.Session.WGKeysRegenInerval = time.Second * time.Duration(interval)
+	})
 
 	// restart WG keys rotation
 	if err := s._wgKeysMgr.StartKeysRotation(); err != nil {
@@ -1670,7 +2097,7 @@ func (s *Service) WireGuardSetKeysRotationInterval(interval int64) {
 
 // WireGuardGetKeys get WG keys
 func (s *Service) WireGuardGetKeys() (session, wgPublicKey, wgPrivateKey, wgLocalIP string, generatedTime time.Time, updateInterval time.Duration) {
-	p := s._preferences
+	p := s.Preferences()
 
 	return p.Session.Session,
 		p.Session.WGPublicKey,
@@ -1682,7 +2109,8 @@ func (s *Service) WireGuardGetKeys() (session, wgPublicKey, wgPrivateKey, wgLoca
 
 // WireGuardGenerateKeys - generate new wireguard keys
 func (s *Service) WireGuardGenerateKeys(updateIfNecessary bool) error {
-	if !s._preferences.Session.IsLoggedIn() {
+	prefs := s.Preferences()
+	if !prefs.Session.IsLoggedIn() {
 		return srverrors.ErrorNotLoggedIn{}
 	}
 
@@ -1704,10 +2132,28 @@ func (s *Service) WireGuardGenerateKeys(updateIfNecessary bool) error {
 // Internal methods
 //////////////////////////////////////////////////////////
 
+// setPreferences replaces the whole preferences object (e.g. reset or daemon start);
+// use updatePreferences() to modify the values
 func (s *Service) setPreferences(p preferences.Preferences) {
+	s._preferencesMutex.Lock()
+	defer s._preferencesMutex.Unlock()
+
 	if !reflect.DeepEqual(s._preferences, p) {
 		//if s._preferences != p {
 		s._preferences = p
 		s._preferences.SavePreferences()
 	}
 }
+
+// updatePreferences modifies and saves preferences atomically
+func (s *Service) updatePreferences(update func(p *preferences.Preferences)) {
+	s._preferencesMutex.Lock()
+	defer s._preferencesMutex.Unlock()
+
+	p := s._preferences
+	update(&p)
+	if !reflect.DeepEqual(s._preferences, p) {
+		s._preferences = p
+		s._preferences.SavePreferences()
+	}
+}
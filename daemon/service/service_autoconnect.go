@@ -0,0 +1,223 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	apitypes "github.com/ivpn/desktop-app/daemon/api/types"
+	protocolTypes "github.com/ivpn/desktop-app/daemon/protocol/types"
+	"github.com/ivpn/desktop-app/daemon/service/dns"
+	"github.com/ivpn/desktop-app/daemon/service/preferences"
+	"github.com/ivpn/desktop-app/daemon/service/serverselector"
+	"github.com/ivpn/desktop-app/daemon/vpn"
+)
+
+const (
+	autoConnectDefaultPortUDP = 2049 // default UDP port (WireGuard and OpenVPN UDP)
+	autoConnectDefaultPortTCP = 443  // default OpenVPN TCP port
+)
+
+// autoConnectDefaultPort returns the default port for the VPN type/protocol
+func autoConnectDefaultPort(vpnType vpn.Type, isTCP bool) int {
+	if vpnType == vpn.OpenVPN && isTCP {
+		return autoConnectDefaultPortTCP
+	}
+	return autoConnectDefaultPortUDP
+}
+
+// IsDaemonAutoConnect returns 'true' when the daemon have to perform automatic connection on launch
+func (s *Service) IsDaemonAutoConnect() bool {
+	return s.Preferences().DaemonConnection.IsAutoconnectOnLaunch
+}
+
+// DaemonAutoConnectRequest returns parameters of the automatic connection performed by the daemon on launch.
+// The server is selected according to the configured connection target (last used, fastest or specific server).
+func (s *Service) DaemonAutoConnectRequest() (*protocolTypes.Connect, error) {
+	prefs := s.Preferences()
+	if !prefs.Session.IsLoggedIn() {
+		return nil, fmt.Errorf("not logged in")
+	}
+
+	servers, err := s.ServersList()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get servers list: %w", err)
+	}
+	if servers == nil {
+		return nil, fmt.Errorf("servers list is empty")
+	}
+
+	cfg := prefs.DaemonConnection
+	switch cfg.Target {
+	case preferences.ConnectionTargetLast:
+		if len(prefs.LastConnection.Gateway) > 0 {
+			cfg = prefs.LastConnection
+			break
+		}
+		log.Info("Auto-connect: no info about the last connection. Connecting to the fastest server")
+		cfg.Gateway = ""
+	case preferences.ConnectionTargetServer:
+		if len(cfg.Gateway) == 0 {
+			return nil, fmt.Errorf("server for automatic connection is not defined")
+		}
+	default:
+		cfg.Gateway = ""
+	}
+
+	if len(cfg.Gateway) == 0 {
+		svr, err := s.selectServer(cfg.VpnType, serverselector.Selector{Strategy: serverselector.Fastest}, servers, cfg.ExitGateway)
+		if err != nil {
+			return nil, fmt.Errorf("unable to find a server for automatic connection: %w", err)
+		}
+		cfg.Gateway = svr.Gateway
+	}
+
+	return autoConnectCreateRequest(cfg, servers)
+}
+
+// autoConnectCreateRequest creates 'Connect' request for defined connection parameters
+func autoConnectCreateRequest(cfg preferences.ConnectionSettings, servers *apitypes.ServersInfoResponse) (*protocolTypes.Connect, error) {
+	port := cfg.Port
+	if port <= 0 {
+		port = autoConnectDefaultPort(cfg.VpnType, cfg.IsTCP)
+	}
+
+	req := &protocolTypes.Connect{VpnType: cfg.VpnType, ManualDNS: cfg.ManualDNS}
+	isMultihop := len(cfg.ExitGateway) > 0
+
+	if cfg.VpnType == vpn.WireGuard {
+		entry := findWireGuardServer(servers, cfg.Gateway)
+		if entry == nil {
+			return nil, fmt.Errorf("server '%s' not found in servers list", cfg.Gateway)
+		}
+		req.WireGuardParameters.EntryVpnServer.Hosts = entry.Hosts
+		req.WireGuardParameters.Port.Port = port
+
+		if isMultihop {
+			exit := findWireGuardServer(servers, cfg.ExitGateway)
+			if exit == nil {
+				return nil, fmt.Errorf("exit server '%s' not found in servers list", cfg.ExitGateway)
+			}
+			req.WireGuardParameters.MultihopExitServer.ExitSrvID = gatewayID(exit.Gateway)
+			req.WireGuardParameters.MultihopExitServer.Hosts = exit.Hosts
+		}
+	} else {
+		entry := findOpenVPNServer(servers, cfg.Gateway)
+		if entry == nil {
+			return nil, fmt.Errorf("server '%s' not found in servers list", cfg.Gateway)
+		}
+		req.OpenVpnParameters.EntryVpnServer.Hosts = entry.Hosts
+		req.OpenVpnParameters.Port.Port = port
+		if cfg.IsTCP {
+			req.OpenVpnParameters.Port.Protocol = 1
+		}
+
+		if isMultihop {
+			exit := findOpenVPNServer(servers, cfg.ExitGateway)
+			if exit == nil {
+				return nil, fmt.Errorf("exit server '%s' not found in servers list", cfg.ExitGateway)
+			}
+			req.OpenVpnParameters.MultihopExitSrvID = gatewayID(exit.Gateway)
+		}
+	}
+
+	if cfg.IsAntiTracker || cfg.IsAntiTrackerHardcore {
+		atInfo := servers.Config.Antitracker.Default
+		if cfg.IsAntiTrackerHardcore {
+			atInfo = servers.Config.Antitracker.Hardcore
+		}
+		atIP := atInfo.IP
+		if cfg.VpnType == vpn.OpenVPN && isMultihop {
+			atIP = atInfo.MultihopIP
+		}
+		if len(atIP) == 0 {
+			return nil, fmt.Errorf("AntiTracker DNS address is not defined in servers list")
+		}
+		req.ManualDNS = dns.DnsSettings{DnsHost: atIP}
+	}
+
+	return req, nil
+}
+
+// saveLastConnection keeps parameters of the established connection
+// (they are in use by automatic connection when the connection target is 'last')
+func (s *Service) saveLastConnection(state vpn.StateInfo) {
+	gateway, _ := s.findServerByHostIP(state.VpnType, state.ServerIP)
+	if len(gateway) == 0 {
+		return
+	}
+
+	conn := preferences.ConnectionSettings{
+		Target:      preferences.ConnectionTargetServer,
+		Gateway:     gateway,
+		ExitGateway: state.ExitServerID,
+		VpnType:     state.VpnType,
+		IsTCP:       state.IsTCP,
+		Port:        state.ServerPort,
+		ManualDNS:   s._manualDNS,
+	}
+
+	// AntiTracker addresses can be changed in servers list, so keep only the AntiTracker flags
+	if servers, err := s.ServersList(); err == nil && servers != nil && len(conn.ManualDNS.DnsHost) > 0 {
+		at := servers.Config.Antitracker
+		switch conn.ManualDNS.DnsHost {
+		case at.Default.IP, at.Default.MultihopIP:
+			conn.IsAntiTracker = true
+		case at.Hardcore.IP, at.Hardcore.MultihopIP:
+			conn.IsAntiTracker, conn.IsAntiTrackerHardcore = true, true
+		}
+		if conn.IsAntiTracker {
+			conn.ManualDNS = dns.DnsSettings{}
+		}
+	}
+
+	s.updatePreferences(func(p *preferences.Preferences) {
+		p.LastConnection = conn
+	})
+}
+
+func findWireGuardServer(servers *apitypes.ServersInfoResponse, gateway string) *apitypes.WireGuardServerInfo {
+	id := gatewayID(gateway)
+	for i, svr := range servers.WireguardServers {
+		if gatewayID(svr.Gateway) == id {
+			return &servers.WireguardServers[i]
+		}
+	}
+	return nil
+}
+
+func findOpenVPNServer(servers *apitypes.ServersInfoResponse, gateway string) *apitypes.OpenvpnServerInfo {
+	id := gatewayID(gateway)
+	for i, svr := range servers.OpenvpnServers {
+		if gatewayID(svr.Gateway) == id {
+			return &servers.OpenvpnServers[i]
+		}
+	}
+	return nil
+}
+
+// gatewayID returns gateway ID. Example: "zz.wg.ivpn.net" => "zz"
+func gatewayID(gateway string) string {
+	return strings.ToLower(strings.Split(strings.TrimSpace(gateway), ".")[0])
+}
@@ -0,0 +1,353 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package service
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ivpn/desktop-app/daemon/netinfo"
+	protocolTypes "github.com/ivpn/desktop-app/daemon/protocol/types"
+	"github.com/ivpn/desktop-app/daemon/service/captiveportal"
+	"github.com/ivpn/desktop-app/daemon/service/firewall"
+)
+
+const (
+	captivePortalProbeTimeout        = time.Second * 10
+	captivePortalModeDefaultDuration = time.Minute * 5
+	captivePortalModeMaxDuration     = time.Minute * 30
+)
+
+// captivePortal - state of the captive portal detection and 'portal mode'
+// 'Portal mode' is a time-limited firewall configuration which permits only DNS/HTTP(S) to the gateway network
+// (and HTTP(S) to the captive portal login page host, if it is known).
+// It is automatically closed when expired or when VPN is connected.
+type captivePortal struct {
+	// serializes the operations which change the captive portal firewall exceptions
+	// (detection, 'portal mode' start/stop); it is held during network I/O
+	operationMutex sync.Mutex
+	// protects the fields below (it is never held during network I/O)
+	mutex     sync.Mutex
+	lastCheck time.Time
+	result    captiveportal.Result
+
+	// 'portal mode' (modeExpiresAt is zero when the mode is not active)
+	modeExpiresAt  time.Time
+	modeNetwork    *net.IPNet
+	modeExceptions []firewall.Exception
+	modeTimer      *time.Timer
+}
+
+// CaptivePortalStatus returns the status of captive portal detection and 'portal mode'
+func (s *Service) CaptivePortalStatus() protocolTypes.CaptivePortalStatus {
+	cp := &s._captivePortal
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+
+	ret := protocolTypes.CaptivePortalStatus{
+		IsDetected:  cp.result.IsDetected,
+		RedirectURL: cp.result.RedirectURL,
+	}
+	if !cp.lastCheck.IsZero() {
+		ret.LastCheck = cp.lastCheck.Unix()
+	}
+	if !cp.modeExpiresAt.IsZero() {
+		ret.IsPortalMode = true
+		ret.PortalModeRemainingSec = int64(time.Until(cp.modeExpiresAt).Seconds())
+		if cp.modeNetwork != nil {
+			ret.PortalModeNetwork = cp.modeNetwork.String()
+		}
+	}
+	return ret
+}
+
+// CaptivePortalCheck performs captive portal detection
+// When the firewall is enabled, it temporarily allows only DNS requests to the default gateway
+// and HTTP request to the detection endpoint.
+func (s *Service) CaptivePortalCheck() (protocolTypes.CaptivePortalStatus, error) {
+	if s.Connected() {
+		return s.CaptivePortalStatus(), fmt.Errorf("captive portal detection is not applicable when VPN is connected")
+	}
+
+	cp := &s._captivePortal
+	cp.operationMutex.Lock()
+	if s.Connected() {
+		// VPN connected while waiting for the previous operation
+		cp.operationMutex.Unlock()
+		return s.CaptivePortalStatus(), fmt.Errorf("captive portal detection is not applicable when VPN is connected")
+	}
+	result, err := s.captivePortalDetect()
+	cp.mutex.Lock()
+	cp.lastCheck = time.Now()
+	cp.result = result
+	cp.mutex.Unlock()
+	cp.operationMutex.Unlock()
+
+	s._evtReceiver.OnCaptivePortalStatusChanged()
+	return s.CaptivePortalStatus(), err
+}
+
+// CaptivePortalModeEnable enables 'portal mode' for the specified duration (0 - default duration)
+func (s *Service) CaptivePortalModeEnable(duration time.Duration) error {
+	if duration == 0 {
+		duration = captivePortalModeDefaultDuration
+	}
+	if duration < 0 || duration > captivePortalModeMaxDuration {
+		return fmt.Errorf("bad duration of portal mode: %v (max allowed: %v)", duration, captivePortalModeMaxDuration)
+	}
+	if s.Connected() {
+		return fmt.Errorf("portal mode is not applicable when VPN is connected")
+	}
+
+	gw, err := netinfo.DefaultGatewayIP()
+	if err != nil {
+		return fmt.Errorf("unable to determine default gateway: %w", err)
+	}
+	gwNet := captivePortalGatewayNetwork(gw)
+
+	cp := &s._captivePortal
+	cp.operationMutex.Lock()
+	defer cp.operationMutex.Unlock()
+
+	// VPN may be connected while waiting for the lock: 'captivePortalOnVpnConnected' closes the mode under the same lock,
+	// so the mode must not be enabled after it
+	if s.Connected() {
+		return fmt.Errorf("portal mode is not applicable when VPN is connected")
+	}
+
+	exceptions := captivePortalModeExceptions(gwNet)
+	if err := firewall.SetCaptivePortalExceptions(exceptions); err != nil {
+		return err
+	}
+
+	// allow HTTP(S) to the login page host (if it is outside of the gateway network)
+	cp.mutex.Lock()
+	host := cp.result.RedirectHost()
+	cp.mutex.Unlock()
+	if len(host) > 0 {
+		var ips []net.IP
+		if ip := net.ParseIP(host); ip != nil {
+			ips = []net.IP{ip}
+		} else if ips, err = captiveportal.Resolve(host, gw, captivePortalProbeTimeout); err != nil {
+			log.Warning(fmt.Sprintf("Unable to resolve captive portal host '%s': %s", host, err))
+		}
+		for _, ip := range ips {
+			if ip4 := ip.To4(); ip4 != nil && !gwNet.Contains(ip4) {
+				exceptions = append(exceptions, captivePortalWebExceptions(&net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)})...)
+			}
+		}
+		if err := firewall.SetCaptivePortalExceptions(exceptions); err != nil {
+			log.Error("Failed to allow captive portal host: ", err)
+		}
+	}
+
+	cp.mutex.Lock()
+	if cp.modeTimer != nil {
+		cp.modeTimer.Stop()
+	}
+	expiresAt := time.Now().Add(duration)
+	cp.modeExpiresAt = expiresAt
+	cp.modeNetwork = gwNet
+	cp.modeExceptions = exceptions
+	cp.modeTimer = time.AfterFunc(duration, func() {
+		if s.captivePortalModeStop(expiresAt) {
+			log.Info("Portal mode expired")
+			s._evtReceiver.OnCaptivePortalStatusChanged()
+		}
+	})
+	cp.mutex.Unlock()
+
+	log.Info(fmt.Sprintf("Portal mode enabled for %v (network %s)", duration, gwNet.String()))
+	s._evtReceiver.OnCaptivePortalStatusChanged()
+	return nil
+}
+
+// CaptivePortalModeDisable disables 'portal mode'
+func (s *Service) CaptivePortalModeDisable() error {
+	if s.captivePortalModeStop(time.Time{}) {
+		log.Info("Portal mode disabled")
+		s._evtReceiver.OnCaptivePortalStatusChanged()
+	}
+	return nil
+}
+
+// captivePortalOnVpnConnected closes 'portal mode' (if active) when VPN is connected
+func (s *Service) captivePortalOnVpnConnected() {
+	cp := &s._captivePortal
+	// the same lock as for enabling the mode: the mode can not be enabled in parallel
+	cp.operationMutex.Lock()
+	defer cp.operationMutex.Unlock()
+
+	cp.mutex.Lock()
+	isChanged := cp.result.IsDetected
+	cp.result = captiveportal.Result{}
+	cp.mutex.Unlock()
+
+	if s.captivePortalModeStopLocked(time.Time{}) {
+		log.Info("Portal mode closed (VPN connected)")
+		isChanged = true
+	}
+	if isChanged {
+		s._evtReceiver.OnCaptivePortalStatusChanged()
+	}
+}
+
+// captivePortalOnNetworkChanged performs captive portal detection after network change
+// (only when the firewall is enabled and VPN is not connected: in this case the portal is blocked by the firewall)
+func (s *Service) captivePortalOnNetworkChanged() {
+	if s.Connected() {
+		return
+	}
+	if enabled, err := firewall.GetEnabled(); err != nil || !enabled {
+		return
+	}
+
+	// the previous 'portal mode' is not applicable for the new network
+	s.captivePortalModeStop(time.Time{})
+
+	if status, err := s.CaptivePortalCheck(); err != nil {
+		log.Info("Captive portal detection: ", err)
+	} else if status.IsDetected {
+		log.Info("Captive portal detected after network change")
+	}
+}
+
+// captivePortalModeStop stops 'portal mode'
+// If 'onlyIfExpiresAt' is defined - the mode is stopped only when its expiration time is the same (used by timer)
+// Returns 'true' when the mode was stopped
+func (s *Service) captivePortalModeStop(onlyIfExpiresAt time.Time) bool {
+	cp := &s._captivePortal
+	cp.operationMutex.Lock()
+	defer cp.operationMutex.Unlock()
+	return s.captivePortalModeStopLocked(onlyIfExpiresAt)
+}
+
+// captivePortalModeStopLocked stops 'portal mode' (must be called when the operationMutex is locked)
+func (s *Service) captivePortalModeStopLocked(onlyIfExpiresAt time.Time) bool {
+	cp := &s._captivePortal
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+
+	if cp.modeExpiresAt.IsZero() {
+		return false
+	}
+	if !onlyIfExpiresAt.IsZero() && !onlyIfExpiresAt.Equal(cp.modeExpiresAt) {
+		return false
+	}
+
+	if cp.modeTimer != nil {
+		cp.modeTimer.Stop()
+		cp.modeTimer = nil
+	}
+	cp.modeExpiresAt = time.Time{}
+	cp.modeNetwork = nil
+	cp.modeExceptions = nil
+
+	if err := firewall.SetCaptivePortalExceptions(nil); err != nil {
+		log.Error("Failed to remove portal mode firewall exceptions: ", err)
+	}
+	return true
+}
+
+// captivePortalDetect probes the detection endpoint (must be called when the operationMutex is locked)
+func (s *Service) captivePortalDetect() (captiveportal.Result, error) {
+	cp := &s._captivePortal
+	cp.mutex.Lock()
+	modeExceptions := cp.modeExceptions
+	cp.mutex.Unlock()
+
+	var dnsServer net.IP
+	if enabled, _ := firewall.GetEnabled(); enabled {
+		gw, err := netinfo.DefaultGatewayIP()
+		if err != nil {
+			return captiveportal.Result{}, fmt.Errorf("unable to determine default gateway: %w", err)
+		}
+		dnsServer = gw
+
+		// narrowly open the firewall: DNS to the gateway only (the exceptions of the 'portal mode' are kept)
+		gwHost := &net.IPNet{IP: gw.To4(), Mask: net.CIDRMask(32, 32)}
+		exceptions := append(append([]firewall.Exception{}, modeExceptions...), captivePortalDNSExceptions(gwHost)...)
+		if err := firewall.SetCaptivePortalExceptions(exceptions); err != nil {
+			return captiveportal.Result{}, err
+		}
+		defer func() {
+			if err := firewall.SetCaptivePortalExceptions(modeExceptions); err != nil {
+				log.Error("Failed to restore captive portal firewall exceptions: ", err)
+			}
+		}()
+
+		ips, err := captiveportal.Resolve(captiveportal.ProbeHost, dnsServer, captivePortalProbeTimeout)
+		if err != nil {
+			return captiveportal.Result{}, fmt.Errorf("unable to resolve '%s': %w", captiveportal.ProbeHost, err)
+		}
+
+		// HTTP to the detection endpoint
+		probeHost := &net.IPNet{IP: ips[0], Mask: net.CIDRMask(32, 32)}
+		exceptions = append(exceptions, firewall.Exception{Host: probeHost.String(), Protocol: firewall.ExceptionProtocolTCP, PortFrom: 80, Direction: firewall.ExceptionDirectionOut, Description: "captive portal probe"})
+		if err := firewall.SetCaptivePortalExceptions(exceptions); err != nil {
+			return captiveportal.Result{}, err
+		}
+		return captiveportal.Probe(ips[0], captivePortalProbeTimeout)
+	}
+
+	ips, err := captiveportal.Resolve(captiveportal.ProbeHost, nil, captivePortalProbeTimeout)
+	if err != nil {
+		return captiveportal.Result{}, fmt.Errorf("unable to resolve '%s': %w", captiveportal.ProbeHost, err)
+	}
+	return captiveportal.Probe(ips[0], captivePortalProbeTimeout)
+}
+
+// captivePortalGatewayNetwork returns the local network which contains the gateway
+// (or the network containing only gateway IP, if the local network is not found)
+func captivePortalGatewayNetwork(gw net.IP) *net.IPNet {
+	if localNets, err := netinfo.GetAllLocalV4Addresses(); err == nil {
+		for _, n := range localNets {
+			if n.Contains(gw) {
+				return &net.IPNet{IP: gw.Mask(n.Mask), Mask: n.Mask}
+			}
+		}
+	}
+	return &net.IPNet{IP: gw.To4(), Mask: net.CIDRMask(32, 32)}
+}
+
+// captivePortalModeExceptions returns firewall exceptions for 'portal mode': DNS/HTTP(S) to the gateway network
+// (DHCP is not included: it uses broadcast)
+func captivePortalModeExceptions(gwNet *net.IPNet) []firewall.Exception {
+	return append(captivePortalDNSExceptions(gwNet), captivePortalWebExceptions(gwNet)...)
+}
+
+func captivePortalDNSExceptions(n *net.IPNet) []firewall.Exception {
+	return []firewall.Exception{
+		{Host: n.String(), Protocol: firewall.ExceptionProtocolUDP, PortFrom: 53, Direction: firewall.ExceptionDirectionOut, Description: "portal mode: DNS"},
+		{Host: n.String(), Protocol: firewall.ExceptionProtocolTCP, PortFrom: 53, Direction: firewall.ExceptionDirectionOut, Description: "portal mode: DNS"},
+	}
+}
+
+func captivePortalWebExceptions(n *net.IPNet) []firewall.Exception {
+	return []firewall.Exception{
+		{Host: n.String(), Protocol: firewall.ExceptionProtocolTCP, PortFrom: 80, Direction: firewall.ExceptionDirectionOut, Description: "portal mode: HTTP"},
+		{Host: n.String(), Protocol: firewall.ExceptionProtocolTCP, PortFrom: 443, Direction: firewall.ExceptionDirectionOut, Description: "portal mode: HTTPS"},
+	}
+}
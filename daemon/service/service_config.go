@@ -0,0 +1,232 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package service
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+
+	"github.com/ivpn/desktop-app/daemon/helpers"
+	"github.com/ivpn/desktop-app/daemon/logger"
+	"github.com/ivpn/desktop-app/daemon/service/config"
+	"github.com/ivpn/desktop-app/daemon/service/platform"
+	"github.com/ivpn/desktop-app/daemon/service/platform/filerights"
+	"github.com/ivpn/desktop-app/daemon/service/preferences"
+)
+
+// daemonConfigApply reads the daemon configuration file (if exists) and applies it to a copy of the preferences
+// Returns nil (and no error) when there is nothing to change
+func (s *Service) daemonConfigApply(prefs preferences.Preferences) (*preferences.Preferences, error) {
+	file := platform.DaemonConfigFile()
+	if len(file) == 0 || !helpers.FileExists(file) {
+		return nil, nil
+	}
+
+	if err := filerights.CheckFileAccessRightsAdminConfig(file); err != nil {
+		return nil, fmt.Errorf("daemon configuration ignored: %w", err)
+	}
+
+	cfg, hash, err := config.Load(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.IsSeed() && prefs.DaemonConfigHash == hash {
+		log.Info("Daemon configuration (seed) was already applied: ", file)
+		return nil, nil
+	}
+
+	log.Info("Applying daemon configuration: ", file)
+	cfg.Apply(&prefs)
+	prefs.DaemonConfigHash = hash
+	return &prefs, nil
+}
+
+// daemonConfigInit applies the daemon configuration file on daemon start
+// (must be called right after preferences loaded, before applying them)
+func (s *Service) daemonConfigInit() {
+	s.updatePreferences(func(prefs *preferences.Preferences) {
+		newPrefs, err := s.daemonConfigApply(*prefs)
+		if err != nil {
+			reportDaemonConfigError(err)
+			return
+		}
+		if newPrefs == nil {
+			return
+		}
+
+		if newPrefs.IsLogging != prefs.IsLogging {
+			logger.Enable(newPrefs.IsLogging)
+		}
+		*prefs = *newPrefs
+	})
+}
+
+// ReloadDaemonConfig re-reads the daemon configuration file and applies the changes
+// (e.g. on SIGHUP)
+func (s *Service) ReloadDaemonConfig() error {
+	newPrefs, err := s.daemonConfigApply(s.Preferences())
+	if err != nil {
+		reportDaemonConfigError(err)
+		return err
+	}
+	if newPrefs == nil {
+		return nil
+	}
+
+	s.applyPreferences(*newPrefs)
+	return nil
+}
+
+// applyPreferences applies the changes of preferences at runtime
+// (firewall, logging, split tunnel ...; the account session is not changed)
+// (calls are serialized: it runs on the SIGHUP goroutine as well as on the client requests)
+func (s *Service) applyPreferences(newPrefs preferences.Preferences) {
+	s._applyPreferencesMutex.Lock()
+	defer s._applyPreferencesMutex.Unlock()
+
+	old := s.Preferences()
+
+	// firewall
+	if newPrefs.IsFwAllowLAN != old.IsFwAllowLAN || newPrefs.IsFwAllowLANMulticast != old.IsFwAllowLANMulticast {
+		err := s.setKillSwitchAllowLAN(func(p *preferences.Preferences) {
+			p.IsFwAllowLAN, p.IsFwAllowLANMulticast = newPrefs.IsFwAllowLAN, newPrefs.IsFwAllowLANMulticast
+		})
+		if err != nil {
+			log.Error("failed to apply firewall 'Allow LAN' configuration: ", err)
+		}
+	}
+	if !reflect.DeepEqual(newPrefs.FwExceptions, old.FwExceptions) {
+		if err := s.SetKillSwitchExceptions(newPrefs.FwExceptions); err != nil {
+			log.Error("failed to apply firewall exceptions: ", err)
+		}
+	}
+	if !reflect.DeepEqual(newPrefs.FwInboundRules, old.FwInboundRules) {
+		if err := s.SetKillSwitchInboundRules(newPrefs.FwInboundRules); err != nil {
+			log.Error("failed to apply firewall inbound rules: ", err)
+		}
+	}
+	if newPrefs.IsFwAllowApiServers != old.IsFwAllowApiServers {
+		if err := s.SetKillSwitchAllowAPIServers(newPrefs.IsFwAllowApiServers); err != nil {
+			log.Error("failed to apply firewall 'Allow IVPN servers' configuration: ", err)
+		}
+	}
+	if newPrefs.IsFwPersistant != old.IsFwPersistant {
+		if err := s.SetKillSwitchIsPersistent(newPrefs.IsFwPersistant); err != nil {
+			log.Error("failed to apply firewall 'Persistent' configuration: ", err)
+		}
+	}
+
+	// VPN gateway mode and local proxy
+	if !reflect.DeepEqual(newPrefs.Gateway, old.Gateway) {
+		if err := s.SetGatewayConfig(newPrefs.Gateway); err != nil {
+			log.Error("failed to apply VPN gateway configuration: ", err)
+		}
+	}
+	if !reflect.DeepEqual(newPrefs.LocalProxy, old.LocalProxy) {
+		// the credentials are not a part of imported/configured settings: keep the current ones
+		if err := s.SetLocalProxyConfig(newPrefs.LocalProxy, true); err != nil {
+			log.Error("failed to apply local proxy configuration: ", err)
+		}
+	}
+
+	// DNS
+	if !reflect.DeepEqual(newPrefs.SplitDnsRules, old.SplitDnsRules) {
+		if err := s.SetSplitDnsRules(newPrefs.SplitDnsRules); err != nil {
+			log.Error("failed to apply split DNS rules: ", err)
+		}
+	}
+	if !reflect.DeepEqual(newPrefs.AntiTrackerFilter, old.AntiTrackerFilter) {
+		if err := s.SetAntiTrackerFilter(newPrefs.AntiTrackerFilter); err != nil {
+			log.Error("failed to apply AntiTracker filter configuration: ", err)
+		}
+	}
+	if newPrefs.DnsQueryStats != old.DnsQueryStats {
+		if err := s.SetDnsQueryStatsConfig(newPrefs.DnsQueryStats); err != nil {
+			log.Error("failed to apply DNS query statistics configuration: ", err)
+		}
+	}
+
+	if newPrefs.IsLogging != old.IsLogging {
+		logger.Enable(newPrefs.IsLogging)
+	}
+
+	// save the rest of preferences (the firewall values were already saved by methods above)
+	// Only the changed values are written: the preferences could be modified meanwhile (e.g. the last connection saved)
+	s.updatePreferences(func(prefs *preferences.Preferences) {
+		if newPrefs.IsLogging != old.IsLogging {
+			prefs.IsLogging = newPrefs.IsLogging
+		}
+		if newPrefs.IsObfsproxy != old.IsObfsproxy {
+			prefs.IsObfsproxy = newPrefs.IsObfsproxy
+		}
+		if newPrefs.IsStopOnClientDisconnect != old.IsStopOnClientDisconnect {
+			prefs.IsStopOnClientDisconnect = newPrefs.IsStopOnClientDisconnect
+		}
+		if newPrefs.IsAutoconnectOnLaunch != old.IsAutoconnectOnLaunch {
+			prefs.IsAutoconnectOnLaunch = newPrefs.IsAutoconnectOnLaunch
+		}
+		if newPrefs.IsSplitTunnel != old.IsSplitTunnel {
+			prefs.IsSplitTunnel = newPrefs.IsSplitTunnel
+		}
+		if !equalStrings(newPrefs.SplitTunnelApps, old.SplitTunnelApps) {
+			prefs.SplitTunnelApps = newPrefs.SplitTunnelApps
+		}
+		if !reflect.DeepEqual(newPrefs.DaemonConnection, old.DaemonConnection) {
+			prefs.DaemonConnection = newPrefs.DaemonConnection
+		}
+		if newPrefs.IsLatencyThroughTunnel != old.IsLatencyThroughTunnel {
+			prefs.IsLatencyThroughTunnel = newPrefs.IsLatencyThroughTunnel
+		}
+		if newPrefs.DaemonConfigHash != old.DaemonConfigHash {
+			prefs.DaemonConfigHash = newPrefs.DaemonConfigHash
+		}
+	})
+
+	// split tunnel
+	if newPrefs.IsSplitTunnel != old.IsSplitTunnel || !equalStrings(newPrefs.SplitTunnelApps, old.SplitTunnelApps) {
+		if err := s.splitTunnelling_ApplyConfig(); err != nil {
+			log.Error("failed to apply Split Tunnel configuration: ", err)
+		}
+	}
+}
+
+// reportDaemonConfigError reports configuration problems to the log and to the standard error output
+// (the daemon log can be disabled, but the configuration problems must be visible to administrator)
+func reportDaemonConfigError(err error) {
+	log.Error(err)
+	fmt.Fprintln(os.Stderr, "ERROR:", err)
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -30,12 +30,13 @@ import (
 )
 
 func (s *Service) implPingServersStarting(hosts []net.IP) error {
-	const onlyForICMP = true
+	// not only ICMP: the TCP/UDP probes are in use when ICMP is filtered by the network
+	const onlyForICMP = false
 	const isPersistent = false
 	return firewall.AddHostsToExceptions(hosts, onlyForICMP, isPersistent)
 }
 func (s *Service) implPingServersStopped(hosts []net.IP) error {
-	const onlyForICMP = true
+	const onlyForICMP = false
 	const isPersistent = false
 	return firewall.RemoveHostsFromExceptions(hosts, onlyForICMP, isPersistent)
 }
@@ -0,0 +1,226 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package service
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ivpn/desktop-app/daemon/service/firewall"
+	"github.com/ivpn/desktop-app/daemon/service/preferences"
+)
+
+// max lifetime of the temporary firewall exception
+const fwTempExceptionMaxTTL = time.Hour * 24 * 7
+
+// fwTempExceptions - scheduler of the temporary firewall exceptions expiration
+// The list of temporary exceptions is kept in preferences, so they are still applied after the daemon restart.
+type fwTempExceptions struct {
+	mutex sync.Mutex
+	// timer to remove the exception which expires first (nil - when there are no temporary exceptions)
+	timer *time.Timer
+}
+
+// KillSwitchTempExceptions returns the list of temporary firewall exceptions
+func (s *Service) KillSwitchTempExceptions() []firewall.TemporaryException {
+	t := &s._fwTempExceptions
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return append([]firewall.TemporaryException{}, s.Preferences().FwTempExceptions...)
+}
+
+// AddKillSwitchTempException adds the firewall exception for the host (IP address or network)
+// which is automatically removed after 'ttl' duration.
+// If the temporary exception for the host already exists - its expiration time is updated.
+func (s *Service) AddKillSwitchTempException(host string, ttl time.Duration) error {
+	if ttl <= 0 || ttl > fwTempExceptionMaxTTL {
+		return fmt.Errorf("bad duration of temporary firewall exception: %v (max allowed: %v)", ttl, fwTempExceptionMaxTTL)
+	}
+
+	exception, err := firewall.TemporaryException{Host: host, ExpiresAt: time.Now().Add(ttl)}.Normalized()
+	if err != nil {
+		return fmt.Errorf("bad temporary firewall exception: %w", err)
+	}
+
+	t := &s._fwTempExceptions
+	t.mutex.Lock()
+	if err := firewall.AddTemporaryExceptions([]firewall.TemporaryException{exception}); err != nil {
+		t.mutex.Unlock()
+		return err
+	}
+
+	s.updatePreferences(func(p *preferences.Preferences) {
+		list := make([]firewall.TemporaryException, 0, len(p.FwTempExceptions)+1)
+		for _, e := range p.FwTempExceptions {
+			if e.Host != exception.Host {
+				list = append(list, e)
+			}
+		}
+		p.FwTempExceptions = append(list, exception)
+	})
+
+	log.Info(fmt.Sprintf("Temporary firewall exception added: %s", exception.String()))
+	s.fwTempExceptionsSchedule()
+	t.mutex.Unlock()
+
+	s._evtReceiver.OnKillSwitchStateChanged()
+	return nil
+}
+
+// RemoveKillSwitchTempException removes the temporary firewall exception for the host (before its expiration)
+func (s *Service) RemoveKillSwitchTempException(host string) error {
+	exception, err := firewall.TemporaryException{Host: host}.Normalized()
+	if err != nil {
+		return fmt.Errorf("bad temporary firewall exception: %w", err)
+	}
+
+	t := &s._fwTempExceptions
+	t.mutex.Lock()
+
+	var toRemove []firewall.TemporaryException
+	prefs := s.Preferences()
+	list := make([]firewall.TemporaryException, 0, len(prefs.FwTempExceptions))
+	for _, e := range prefs.FwTempExceptions {
+		if e.Host == exception.Host {
+			toRemove = append(toRemove, e)
+		} else {
+			list = append(list, e)
+		}
+	}
+	if len(toRemove) == 0 {
+		t.mutex.Unlock()
+		return fmt.Errorf("temporary firewall exception not found: %s", host)
+	}
+
+	err = s.fwTempExceptionsRemove(list, toRemove)
+	t.mutex.Unlock()
+
+	s._evtReceiver.OnKillSwitchStateChanged()
+	return err
+}
+
+// fwTempExceptionsInit applies the temporary exceptions from preferences (the expired ones are removed)
+// and starts the expiration scheduler
+func (s *Service) fwTempExceptionsInit() {
+	t := &s._fwTempExceptions
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	var active, expired []firewall.TemporaryException
+	for _, e := range s.Preferences().FwTempExceptions {
+		if e.IsExpired(now) {
+			expired = append(expired, e)
+		} else {
+			active = append(active, e)
+		}
+	}
+
+	if len(expired) > 0 {
+		s.updatePreferences(func(p *preferences.Preferences) {
+			p.FwTempExceptions = active
+		})
+	}
+
+	if len(active) > 0 {
+		if err := firewall.AddTemporaryExceptions(active); err != nil {
+			log.Error("Failed to apply temporary firewall exceptions: ", err)
+		}
+	}
+	s.fwTempExceptionsSchedule()
+}
+
+// fwTempExceptionsOnTimer removes the expired temporary exceptions
+func (s *Service) fwTempExceptionsOnTimer() {
+	if s.fwTempExceptionsRemoveExpired() {
+		s._evtReceiver.OnKillSwitchStateChanged()
+	}
+}
+
+// fwTempExceptionsRemoveExpired removes the expired temporary exceptions
+// Returns 'true' when the list of exceptions was changed
+func (s *Service) fwTempExceptionsRemoveExpired() bool {
+	t := &s._fwTempExceptions
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	var active, expired []firewall.TemporaryException
+	for _, e := range s.Preferences().FwTempExceptions {
+		if e.IsExpired(now) {
+			expired = append(expired, e)
+		} else {
+			active = append(active, e)
+		}
+	}
+
+	if len(expired) == 0 {
+		s.fwTempExceptionsSchedule()
+		return false
+	}
+
+	for _, e := range expired {
+		log.Info(fmt.Sprintf("Temporary firewall exception expired: %s", e.Host))
+	}
+	if err := s.fwTempExceptionsRemove(active, expired); err != nil {
+		log.Error("Failed to remove expired temporary firewall exceptions: ", err)
+	}
+	return true
+}
+
+// fwTempExceptionsRemove removes exceptions from the firewall, saves the new list to preferences and reschedules the timer
+// (must be called when the mutex is locked; the caller is responsible for notifying clients about the change)
+func (s *Service) fwTempExceptionsRemove(newList, toRemove []firewall.TemporaryException) error {
+	s.updatePreferences(func(p *preferences.Preferences) {
+		p.FwTempExceptions = newList
+	})
+
+	err := firewall.RemoveTemporaryExceptions(toRemove)
+
+	s.fwTempExceptionsSchedule()
+	return err
+}
+
+// fwTempExceptionsSchedule (re)starts timer for the nearest expiration time
+// (must be called when the mutex is locked)
+func (s *Service) fwTempExceptionsSchedule() {
+	t := &s._fwTempExceptions
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+
+	var nearest time.Time
+	for _, e := range s.Preferences().FwTempExceptions {
+		if nearest.IsZero() || e.ExpiresAt.Before(nearest) {
+			nearest = e.ExpiresAt
+		}
+	}
+	if nearest.IsZero() {
+		return
+	}
+
+	t.timer = time.AfterFunc(time.Until(nearest), s.fwTempExceptionsOnTimer)
+}
@@ -0,0 +1,66 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package service
+
+import (
+	"time"
+
+	"github.com/ivpn/desktop-app/daemon/service/firewall"
+)
+
+// interval of the firewall rules verification
+// Third-party software (Docker, ufw, firewalld ...) can flush or reorder the firewall rules at any time.
+const fwVerifyInterval = time.Second * 30
+
+// KillSwitchVerify compares the active firewall rules with the expected state.
+// If 'repair' is true, the rules modified by third-party software are re-applied.
+func (s *Service) KillSwitchVerify(repair bool) (firewall.VerifyReport, error) {
+	report, err := firewall.Verify(repair)
+	if report.IsTampered() && repair {
+		s._evtReceiver.OnFirewallTampered(report)
+	}
+	return report, err
+}
+
+func (s *Service) fwVerifierStart() {
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Error("PANIC in firewall verifier!: ", r)
+				if err, ok := r.(error); ok {
+					log.ErrorTrace(err)
+				}
+			}
+		}()
+
+		log.Info("Firewall verifier started")
+		ticker := time.NewTicker(fwVerifyInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if _, err := s.KillSwitchVerify(true); err != nil {
+				log.Error(err)
+			}
+		}
+	}()
+}
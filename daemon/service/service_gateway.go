@@ -0,0 +1,45 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package service
+
+import (
+	"github.com/ivpn/desktop-app/daemon/service/firewall"
+	"github.com/ivpn/desktop-app/daemon/service/preferences"
+)
+
+// SetGatewayConfig applies and saves the configuration of VPN gateway mode (sharing the VPN tunnel with a LAN)
+func (s *Service) SetGatewayConfig(cfg firewall.GatewayConfig) error {
+	if err := firewall.SetGatewayConfig(cfg); err != nil {
+		return err
+	}
+
+	s.updatePreferences(func(p *preferences.Preferences) {
+		p.Gateway = cfg
+	})
+	return nil
+}
+
+// GatewayStatus returns the current state of VPN gateway mode
+func (s *Service) GatewayStatus() firewall.GatewayStatus {
+	return firewall.GetGatewayStatus()
+}
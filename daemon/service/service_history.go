@@ -0,0 +1,311 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ivpn/desktop-app/daemon/helpers"
+	"github.com/ivpn/desktop-app/daemon/netinfo"
+	protocolTypes "github.com/ivpn/desktop-app/daemon/protocol/types"
+	"github.com/ivpn/desktop-app/daemon/service/platform"
+	"github.com/ivpn/desktop-app/daemon/vpn"
+)
+
+const (
+	// max number of sessions to keep in the connection history
+	connectionHistoryMaxEntries = 100
+	// interval of reading the traffic counters of the VPN interface
+	connectionHistoryTrafficInterval = time.Second * 10
+)
+
+// path to the connection history file (can be changed by tests)
+var connectionHistoryFile = platform.ConnectionHistoryFile
+
+// connectionHistory - bounded journal of VPN connection sessions
+type connectionHistory struct {
+	mutex   sync.Mutex
+	entries []protocolTypes.ConnectionHistoryEntry
+	// current (active) session; it is always the last element of 'entries'
+	current *protocolTypes.ConnectionHistoryEntry
+	// true when the VPN process reported authentication error
+	isAuthError bool
+
+	// traffic counters of the VPN interface (last values)
+	trafficInterface *net.Interface
+	lastRx, lastTx   uint64
+}
+
+// ConnectionHistory returns the journal of VPN connections (the newest entries are at the end)
+func (s *Service) ConnectionHistory() []protocolTypes.ConnectionHistoryEntry {
+	h := &s._connHistory
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	ret := make([]protocolTypes.ConnectionHistoryEntry, len(h.entries))
+	copy(ret, h.entries)
+	return ret
+}
+
+func (s *Service) historyLoad() error {
+	h := &s._connHistory
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.entries = nil
+	h.current = nil
+
+	file := connectionHistoryFile()
+	if !helpers.FileExists(file) {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read connection history: %w", err)
+	}
+	var entries []protocolTypes.ConnectionHistoryEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		os.Remove(file)
+		return fmt.Errorf("failed to parse connection history (file removed): %w", err)
+	}
+
+	// the sessions which were not finished - were interrupted by daemon stop;
+	// the last known time of such session is the time of the last history update (or the current time)
+	endTime := time.Now().Unix()
+	if fi, err := os.Stat(file); err == nil {
+		endTime = fi.ModTime().Unix()
+	}
+	for i := range entries {
+		if entries[i].EndTime != 0 {
+			continue
+		}
+		entries[i].EndTime = endTime
+		if entries[i].EndTime < entries[i].StartTime {
+			entries[i].EndTime = entries[i].StartTime
+		}
+		if len(entries[i].ReasonDescription) == 0 {
+			entries[i].ReasonDescription = "the daemon was stopped while the session was active"
+		}
+	}
+	h.entries = entries
+	return nil
+}
+
+// save saves connection history into the file
+// (must be called under locked mutex)
+func (h *connectionHistory) save() {
+	if len(h.entries) > connectionHistoryMaxEntries {
+		h.entries = h.entries[len(h.entries)-connectionHistoryMaxEntries:]
+		if h.current != nil {
+			h.current = &h.entries[len(h.entries)-1]
+		}
+	}
+
+	data, err := json.Marshal(h.entries)
+	if err != nil {
+		log.Error("failed to save connection history (json marshal error): ", err)
+		return
+	}
+	if err := helpers.WriteFile(connectionHistoryFile(), data, 0600); err != nil { // read\write only for privileged user
+		log.Error("failed to save connection history: ", err)
+	}
+}
+
+// historySessionStarted must be called when the new connection session started (on 'Connect' request)
+func (s *Service) historySessionStarted() {
+	h := &s._connHistory
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.entries = append(h.entries, protocolTypes.ConnectionHistoryEntry{StartTime: time.Now().Unix()})
+	h.current = &h.entries[len(h.entries)-1]
+	h.isAuthError = false
+	h.trafficInterface = nil
+
+	h.save()
+}
+
+// historySessionFinished must be called when the connection session finished
+// (VPN disconnected and it is not going to reconnect)
+func (s *Service) historySessionFinished(connErr error) {
+	h := &s._connHistory
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.current == nil {
+		return
+	}
+
+	h.current.EndTime = time.Now().Unix()
+	h.current.Reason = protocolTypes.Unknown
+	if h.isAuthError {
+		h.current.Reason = protocolTypes.AuthenticationError
+		if connErr == nil {
+			connErr = fmt.Errorf("authentication failure")
+		}
+	}
+	if s._requiredVpnState == Disconnect {
+		h.current.Reason = protocolTypes.DisconnectRequested
+	}
+	if connErr != nil {
+		h.current.Failure = true
+		h.current.ReasonDescription = connErr.Error()
+	}
+
+	h.current = nil
+	h.trafficInterface = nil
+
+	h.save()
+}
+
+// historyOnVpnState must be called on each VPN state change
+func (s *Service) historyOnVpnState(state vpn.StateInfo) {
+	h := &s._connHistory
+
+	switch state.State {
+	case vpn.CONNECTED:
+		gateway, hostname := s.findServerByHostIP(state.VpnType, state.ServerIP)
+
+		inf, _ := netinfo.InterfaceByIPAddr(state.ClientIP)
+
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		if h.current == nil {
+			return
+		}
+		if h.current.ConnectedTime == 0 {
+			h.current.ConnectedTime = state.Time
+		}
+		h.current.VpnType = state.VpnType
+		h.current.Gateway = gateway
+		h.current.Hostname = hostname
+		h.current.ServerIP = state.ServerIP.String()
+		h.current.IsTCP = state.IsTCP
+		h.current.Port = state.ServerPort
+		h.current.ExitServerID = state.ExitServerID
+
+		// start counting traffic of the VPN interface
+		h.trafficInterface = inf
+		h.lastRx, h.lastTx = 0, 0
+		if inf != nil {
+			if rx, tx, err := netinfo.InterfaceTraffic(inf); err == nil {
+				h.lastRx, h.lastTx = rx, tx
+			}
+		}
+
+		h.save()
+
+	case vpn.RECONNECTING:
+		s.historyUpdateTraffic()
+		s.historyOnReconnecting()
+
+	case vpn.EXITING:
+		s.historyUpdateTraffic()
+
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		if state.IsAuthError {
+			h.isAuthError = true
+		}
+	}
+}
+
+// historyOnReconnecting must be called when the VPN is going to reconnect
+func (s *Service) historyOnReconnecting() {
+	h := &s._connHistory
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.current != nil {
+		h.current.Reconnects++
+	}
+}
+
+// historyUpdateTraffic reads traffic counters of the VPN interface and updates the current session info
+func (s *Service) historyUpdateTraffic() {
+	h := &s._connHistory
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.current == nil || h.trafficInterface == nil {
+		return
+	}
+
+	rx, tx, err := netinfo.InterfaceTraffic(h.trafficInterface)
+	if err != nil {
+		// interface is not available anymore
+		h.trafficInterface = nil
+		return
+	}
+
+	// the counters can be reset (or overflowed) by OS
+	if rx >= h.lastRx {
+		h.current.BytesReceived += rx - h.lastRx
+	} else {
+		h.current.BytesReceived += rx
+	}
+	if tx >= h.lastTx {
+		h.current.BytesSent += tx - h.lastTx
+	} else {
+		h.current.BytesSent += tx
+	}
+	h.lastRx, h.lastTx = rx, tx
+}
+
+// findServerByHostIP looks for the gateway name and the host name of the server by its IP address
+func (s *Service) findServerByHostIP(vpnType vpn.Type, serverIP net.IP) (gateway, hostname string) {
+	if serverIP == nil {
+		return "", ""
+	}
+	servers, err := s.ServersList()
+	if err != nil || servers == nil {
+		return "", ""
+	}
+
+	ipStr := serverIP.String()
+	if vpnType == vpn.WireGuard {
+		for _, svr := range servers.WireguardServers {
+			for _, host := range svr.Hosts {
+				if host.Host == ipStr {
+					return svr.Gateway, host.Hostname
+				}
+			}
+		}
+	} else {
+		for _, svr := range servers.OpenvpnServers {
+			for _, host := range svr.Hosts {
+				if host.Host == ipStr {
+					return svr.Gateway, host.Hostname
+				}
+			}
+		}
+	}
+	return "", ""
+}
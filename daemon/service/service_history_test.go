@@ -0,0 +1,103 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package service
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ivpn/desktop-app/daemon/helpers"
+)
+
+func setTestConnectionHistoryFile(t *testing.T) string {
+	file := filepath.Join(t.TempDir(), "connection_history.json")
+	connectionHistoryFile = func() string { return file }
+	t.Cleanup(func() { connectionHistoryFile = defaultConnectionHistoryFile })
+	return file
+}
+
+var defaultConnectionHistoryFile = connectionHistoryFile
+
+func TestConnectionHistoryTrimming(t *testing.T) {
+	setTestConnectionHistoryFile(t)
+
+	s := &Service{}
+	for i := 0; i < connectionHistoryMaxEntries+5; i++ {
+		s.historySessionStarted()
+		s._connHistory.current.Port = i // session marker
+		s.historySessionFinished(nil)
+	}
+	s.historySessionStarted()
+
+	entries := s.ConnectionHistory()
+	if len(entries) != connectionHistoryMaxEntries {
+		t.Fatalf("unexpected number of entries: %d", len(entries))
+	}
+	// the oldest sessions are removed
+	if entries[0].Port != 6 || entries[len(entries)-2].Port != connectionHistoryMaxEntries+4 {
+		t.Errorf("unexpected entries order: first=%d; last finished=%d", entries[0].Port, entries[len(entries)-2].Port)
+	}
+	// the current session still points to the last entry after trimming
+	h := &s._connHistory
+	if h.current != &h.entries[len(h.entries)-1] {
+		t.Error("current session does not point to the last entry")
+	}
+}
+
+func TestConnectionHistoryPersistence(t *testing.T) {
+	file := setTestConnectionHistoryFile(t)
+
+	s := &Service{}
+	s.historySessionStarted()
+	s.historySessionFinished(errors.New("test error"))
+	s.historySessionStarted() // not finished: the daemon is 'stopped'
+
+	loaded := &Service{}
+	if err := loaded.historyLoad(); err != nil {
+		t.Fatal(err)
+	}
+	entries := loaded.ConnectionHistory()
+	if len(entries) != 2 {
+		t.Fatalf("unexpected number of entries: %d", len(entries))
+	}
+	if !entries[0].Failure || entries[0].ReasonDescription != "test error" || entries[0].EndTime == 0 {
+		t.Errorf("unexpected finished session: %+v", entries[0])
+	}
+	if entries[1].EndTime < entries[1].StartTime || entries[1].EndTime == 0 || !strings.Contains(entries[1].ReasonDescription, "daemon was stopped") {
+		t.Errorf("unexpected interrupted session: %+v", entries[1])
+	}
+
+	// corrupted file is removed
+	if err := ioutil.WriteFile(file, []byte("{bad json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.historyLoad(); err == nil {
+		t.Error("error expected for corrupted file")
+	}
+	if helpers.FileExists(file) || len(loaded.ConnectionHistory()) != 0 {
+		t.Error("corrupted history file must be removed")
+	}
+}
@@ -0,0 +1,101 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package service
+
+import (
+	"github.com/ivpn/desktop-app/daemon/netinfo"
+	"github.com/ivpn/desktop-app/daemon/service/firewall"
+)
+
+// IPv6LeakProtectionStatus returns the state of IPv6 leak protection and the name of the network interface
+// which is in use by the native (non-tunnel) global IPv6 route.
+// bypassInterface is empty when VPN is not connected, when there is no IPv6 connectivity
+// or when all global IPv6 traffic is routed through the tunnel.
+func (s *Service) IPv6LeakProtectionStatus() (isActive bool, bypassInterface string) {
+	isActive = firewall.IsIPv6LeakProtection()
+
+	sInfo := s.GetVpnSessionInfo()
+	if s._vpn == nil || sInfo.VpnLocalIPv4 == nil || len(sInfo.NetNamespace) > 0 {
+		return isActive, ""
+	}
+	return isActive, s.ipv6BypassInterface()
+}
+
+// ipv6LeakProtectionApply enables IPv6 leak protection when VPN is connected without IPv6 in the tunnel
+// (and disables it in all other cases: disconnected, paused or IPv6 is routed through the tunnel)
+func (s *Service) ipv6LeakProtectionApply() {
+	vpn := s._vpn
+	sInfo := s.GetVpnSessionInfo()
+	vpnLocalIP := sInfo.VpnLocalIPv4
+	if len(sInfo.NetNamespace) > 0 {
+		// the host traffic is not routed through the tunnel (VPN interface is in isolated network namespace)
+		vpnLocalIP = nil
+	}
+	enable := vpn != nil && vpnLocalIP != nil && !vpn.IsPaused() && !vpn.IsIPv6InTunnel()
+
+	wasActive := firewall.IsIPv6LeakProtection()
+	if err := firewall.SetIPv6LeakProtection(enable, vpnLocalIP); err != nil {
+		log.Error("Failed to apply IPv6 leak protection: ", err)
+	}
+	if wasActive != firewall.IsIPv6LeakProtection() {
+		// IPv6 leak protection status is a part of the kill-switch status
+		s._evtReceiver.OnKillSwitchStateChanged()
+	}
+
+	if vpn == nil || vpn.IsPaused() || vpnLocalIP == nil {
+		return
+	}
+	if iface := s.ipv6BypassInterface(); len(iface) > 0 {
+		if enable {
+			log.Info("Native IPv6 route via '", iface, "' is blocked by IPv6 leak protection")
+		} else {
+			log.Warning("Native IPv6 route via '", iface, "' bypasses the VPN tunnel")
+		}
+	}
+}
+
+// ipv6BypassInterface checks which interface is in use for the global IPv6 traffic.
+// Returns the name of the interface if it is not the VPN interface ("" - if there is no global IPv6 route or it is routed through the tunnel)
+func (s *Service) ipv6BypassInterface() string {
+	outIP, err := netinfo.GetOutboundIP(true)
+	if err != nil || outIP == nil || !outIP.IsGlobalUnicast() {
+		// no global IPv6 route
+		return ""
+	}
+
+	sInfo := s.GetVpnSessionInfo()
+	if sInfo.VpnLocalIPv6 != nil && outIP.Equal(sInfo.VpnLocalIPv6) {
+		return ""
+	}
+
+	inf, err := netinfo.InterfaceByIPAddr(outIP)
+	if err != nil {
+		return outIP.String()
+	}
+	if sInfo.VpnLocalIPv4 != nil {
+		if vpnInf, err := netinfo.InterfaceByIPAddr(sInfo.VpnLocalIPv4); err == nil && vpnInf.Name == inf.Name {
+			return ""
+		}
+	}
+	return inf.Name
+}
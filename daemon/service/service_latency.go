@@ -0,0 +1,220 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package service
+
+import (
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/ivpn/desktop-app/daemon/ping"
+	"github.com/ivpn/desktop-app/daemon/service/firewall"
+	"github.com/ivpn/desktop-app/daemon/service/latency"
+	"github.com/ivpn/desktop-app/daemon/service/platform"
+)
+
+const (
+	// interval of checking the latency info for stale entries
+	latencyRefreshInterval = time.Minute
+	// the latency info older than this has to be refreshed
+	latencyMaxAge = time.Minute * 30
+	// max number of hosts measured per one refresh iteration (the hosts are pinged one-by-one)
+	latencyHostsPerRefresh = 20
+	// timeout of a single ping in background
+	latencyPingTimeout = time.Second
+
+	// ports of the TCP/UDP latency probes (in use when ICMP is not available)
+	latencyProbeTCPPort = 443  // OpenVPN TCP port
+	latencyProbeWgPort  = 2049 // WireGuard UDP port
+)
+
+// LatencyStats returns the latency statistics of the servers hosts (host IP => statistics)
+func (s *Service) LatencyStats() map[string]latency.HostStats {
+	return s._latency.AllStats()
+}
+
+func (s *Service) latencyTrackerStart() {
+	s._prober = ping.NewProber(nil)
+	s._latency = latency.NewTracker()
+	if err := s._latency.Load(platform.LatencyCacheFile()); err != nil {
+		log.Warning(err)
+	}
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Error("PANIC in latency tracker!: ", r)
+				if err, ok := r.(error); ok {
+					log.ErrorTrace(err)
+				}
+			}
+		}()
+
+		ticker := time.NewTicker(latencyRefreshInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			s.latencyRefresh()
+		}
+	}()
+}
+
+// latencyRefresh measures the hosts with stale latency info.
+// When connected, the hosts are measured through the VPN tunnel (only if allowed by preferences).
+// When disconnected and the firewall is enabled, the hosts are not measured in background
+// (it requires temporary firewall exceptions for the servers) unless the IVPN servers are allowed by the firewall configuration.
+func (s *Service) latencyRefresh() {
+	isConnected := s._vpn != nil
+	prefs := s.Preferences()
+	if isConnected && !prefs.IsLatencyThroughTunnel {
+		return
+	}
+	if !isConnected && !prefs.IsFwAllowApiServers {
+		if fwEnabled, err := firewall.GetEnabled(); err != nil || fwEnabled {
+			return
+		}
+	}
+
+	hosts, err := s.getHostsToPing(nil)
+	if err != nil {
+		return
+	}
+	allHosts := hostsToStrings(hosts)
+	stale := s._latency.Stale(allHosts, latencyMaxAge)
+	if len(stale) == 0 {
+		return
+	}
+	if len(stale) > latencyHostsPerRefresh {
+		stale = stale[:latencyHostsPerRefresh]
+	}
+
+	staleIPs := make([]net.IP, 0, len(stale))
+	for _, h := range stale {
+		staleIPs = append(staleIPs, net.ParseIP(h))
+	}
+
+	if !atomic.CompareAndSwapInt32(&s._isServersPingInProgress, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&s._isServersPingInProgress, 0)
+
+	if !isConnected {
+		if err := s.implPingServersStarting(staleIPs); err != nil {
+			log.Error("implPingServersStarting failed: " + err.Error())
+		}
+		defer func() {
+			if err := s.implPingServersStopped(staleIPs); err != nil {
+				log.Error("implPingServersStopped failed: " + err.Error())
+			}
+		}()
+	}
+
+	// no WireGuard handshakes when connected: they must not interfere with the active VPN session
+	targets := s.latencyProbeTargets(!isConnected)
+
+	measured := 0
+	for _, h := range stale {
+		if (s._vpn != nil) != isConnected {
+			break // connection state changed
+		}
+		s._latency.Add(h, s.probeHost(targets, h, latencyPingTimeout), isConnected)
+		measured++
+	}
+
+	log.Debug(fmt.Sprintf("Latency info refreshed for %d hosts (through tunnel: %v)", measured, isConnected))
+	s.latencySave(allHosts)
+}
+
+// latencySave saves the latency history (only for the hosts from the servers list)
+func (s *Service) latencySave(hosts []string) {
+	s._latency.Retain(hosts)
+	if err := s._latency.Save(platform.LatencyCacheFile()); err != nil {
+		log.Error(err)
+	}
+}
+
+// probeHost returns the round-trip time to the host (0 - no response).
+// ICMP is in use when possible; otherwise - the TCP/UDP probes (see ping.Prober)
+func (s *Service) probeHost(targets map[string]ping.Target, host string, timeout time.Duration) time.Duration {
+	target, ok := targets[host]
+	if !ok {
+		target = ping.Target{IP: net.ParseIP(host)}
+	}
+	rtt, _, err := s._prober.Probe(target, timeout)
+	if err != nil {
+		return 0
+	}
+	return rtt
+}
+
+// latencyProbeTargets returns the parameters of the latency probes for the servers hosts (host IP => target)
+func (s *Service) latencyProbeTargets(withWgHandshake bool) map[string]ping.Target {
+	ret := make(map[string]ping.Target)
+	servers, err := s._serversUpdater.GetServers()
+	if err != nil || servers == nil {
+		return ret
+	}
+
+	wgPrivateKey := ""
+	if withWgHandshake {
+		wgPrivateKey = s.Preferences().Session.WGPrivateKey
+	}
+
+	for _, svr := range servers.WireguardServers {
+		for _, h := range svr.Hosts {
+			if ip := net.ParseIP(h.Host); ip != nil {
+				ret[h.Host] = ping.Target{IP: ip, WgPort: latencyProbeWgPort, WgServerPublicKey: h.PublicKey, WgPrivateKey: wgPrivateKey}
+			}
+		}
+	}
+	for _, svr := range servers.OpenvpnServers {
+		for _, h := range svr.Hosts {
+			if ip := net.ParseIP(h.Host); ip != nil {
+				ret[h.Host] = ping.Target{IP: ip, TCPPort: latencyProbeTCPPort}
+			}
+		}
+	}
+	return ret
+}
+
+// latencyCheckApi is in use when no server responds to the latency probes:
+// it checks the API server availability by HTTPS request to detect that the probes are filtered by the network
+func (s *Service) latencyCheckApi() {
+	url, ip := s._api.LatencyProbeTarget()
+	if rtt, err := ping.Measure(ping.HTTPS, ping.Target{URL: url, IP: ip}, time.Second*3); err == nil {
+		log.Warning(fmt.Sprintf("No response to the latency probes from the servers, but the API server is reachable (%dms): the probes are probably filtered by the network", rtt/time.Millisecond))
+	} else {
+		log.Warning("No response to the latency probes from the servers; the API server is not reachable: ", err)
+	}
+}
+
+func hostsToStrings(hosts []net.IP) []string {
+	ret := make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		if h != nil {
+			ret = append(ret, h.String())
+		}
+	}
+	return ret
+}
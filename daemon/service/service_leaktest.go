@@ -0,0 +1,59 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package service
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/ivpn/desktop-app/daemon/netinfo"
+	"github.com/ivpn/desktop-app/daemon/service/dns"
+)
+
+// RunLeakTest checks that the DNS requests and the outbound traffic of the host go through the VPN tunnel:
+// the OS resolves domain names using the expected DNS (IVPN or custom DNS)
+// and the outbound IP differs from the one detected before the VPN connection.
+// 'testZone' - (optional) the DNS zone to resolve the unique probe names in
+func (s *Service) RunLeakTest(testZone string) (dnsResult dns.LeakTestResult, outboundIPBefore, outboundIP net.IP, err error) {
+	vpnObj := s._vpn
+	if vpnObj == nil {
+		return dnsResult, nil, nil, fmt.Errorf("VPN is not connected")
+	}
+	sInfo := s.GetVpnSessionInfo()
+	if len(sInfo.NetNamespace) > 0 {
+		return dnsResult, nil, nil, fmt.Errorf("the VPN interface is in isolated network namespace '%s': host DNS is not changed", sInfo.NetNamespace)
+	}
+
+	expectedDns := dns.GetActiveManualDNS()
+	if expectedDns.IsEmpty() {
+		expectedDns = dns.DnsSettingsCreate(vpnObj.DefaultDNS())
+	}
+
+	dnsResult = dns.RunLeakTest(expectedDns, testZone)
+
+	outboundIP, err = netinfo.GetOutboundIP(false)
+	if err != nil {
+		log.Warning("Leak test: failed to get outbound IP: ", err)
+	}
+	return dnsResult, sInfo.OutboundIPv4, outboundIP, nil
+}
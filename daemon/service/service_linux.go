@@ -36,18 +36,19 @@ import (
 )
 
 func (s *Service) implPingServersStarting(hosts []net.IP) error {
-	const onlyForICMP = true
+	// not only ICMP: the TCP/UDP probes are in use when ICMP is filtered by the network
+	const onlyForICMP = false
 	const isPersistent = false
 	return firewall.AddHostsToExceptions(hosts, onlyForICMP, isPersistent)
 }
 func (s *Service) implPingServersStopped(hosts []net.IP) error {
-	const onlyForICMP = true
+	const onlyForICMP = false
 	const isPersistent = false
 	return firewall.RemoveHostsFromExceptions(hosts, onlyForICMP, isPersistent)
 }
 
 func (s *Service) implSplitTunnelling_AddApp(execCmd string) (requiredCmdToExec string, isAlreadyRunning bool, err error) {
-	if !s._preferences.IsSplitTunnel {
+	if !s.Preferences().IsSplitTunnel {
 		return "", false, fmt.Errorf("unable to run application in Split Tunneling environment: Split Tunneling is disabled")
 	}
 	execCmd = strings.TrimSpace(execCmd)
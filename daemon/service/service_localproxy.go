@@ -0,0 +1,119 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package service
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/ivpn/desktop-app/daemon/netinfo"
+	protocolTypes "github.com/ivpn/desktop-app/daemon/protocol/types"
+	"github.com/ivpn/desktop-app/daemon/service/dns"
+	"github.com/ivpn/desktop-app/daemon/service/localproxy"
+	"github.com/ivpn/desktop-app/daemon/service/preferences"
+)
+
+// LocalProxyStatus returns the configuration and the state of the local SOCKS5/HTTP proxy
+func (s *Service) LocalProxyStatus() protocolTypes.LocalProxyStatus {
+	cfg := s.Preferences().LocalProxy
+	ret := protocolTypes.LocalProxyStatus{
+		IsEnabled: cfg.IsEnabled,
+		Port:      cfg.ListenPort(),
+		Username:  cfg.Username,
+	}
+
+	listenAddr, bindIP := s._localProxy.State()
+	if len(listenAddr) > 0 {
+		ret.IsRunning = true
+		ret.ListenAddress = listenAddr
+		if bindIP != nil {
+			ret.BindIP = bindIP.String()
+		}
+	}
+	return ret
+}
+
+// SetLocalProxyConfig saves the configuration of the local SOCKS5/HTTP proxy
+// and applies it (the proxy is running only when VPN is connected).
+// If 'keepCredentials' is true - the username/password stored before are kept.
+func (s *Service) SetLocalProxyConfig(cfg localproxy.Config, keepCredentials bool) error {
+	if keepCredentials {
+		prefs := s.Preferences()
+		cfg.Username = prefs.LocalProxy.Username
+		cfg.Password = prefs.LocalProxyPassword
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	// the password is kept with the secrets (it is not a part of the proxy configuration in preferences)
+	password := cfg.Password
+	cfg.Password = ""
+	s.updatePreferences(func(p *preferences.Preferences) {
+		p.LocalProxy = cfg
+		p.LocalProxyPassword = password
+	})
+	return s.localProxyApply()
+}
+
+// localProxyApply starts the local proxy when VPN is connected (and stops it in all other cases).
+// In paused state the proxy is running but all connections are refused: the tunnel is not in use.
+func (s *Service) localProxyApply() error {
+	prefs := s.Preferences()
+	cfg := prefs.LocalProxy
+	cfg.Password = prefs.LocalProxyPassword
+	vpn := s._vpn
+	sInfo := s.GetVpnSessionInfo()
+	vpnLocalIP := sInfo.VpnLocalIPv4
+
+	// the VPN interface is not reachable from the host when it is in isolated network namespace
+	if !cfg.IsEnabled || vpn == nil || vpnLocalIP == nil || len(sInfo.NetNamespace) > 0 {
+		s._localProxy.Stop()
+		return nil
+	}
+
+	var bindIP net.IP
+	var bindIf *net.Interface
+	if !vpn.IsPaused() {
+		inf, err := netinfo.InterfaceByIPAddr(vpnLocalIP)
+		if err != nil {
+			return fmt.Errorf("failed to get local interface by IP: %w", err)
+		}
+		bindIP, bindIf = vpnLocalIP, inf
+	}
+	s._localProxy.SetDnsServerFunc(s.localProxyDnsServer)
+	return s._localProxy.Start(cfg, bindIP, bindIf)
+}
+
+// localProxyDnsServer returns the DNS server for resolving the domain names requested by the local proxy clients:
+// the DNS applied by the daemon (local resolver, dnscrypt-proxy or custom DNS) or the default DNS of the VPN server.
+// (the system resolver is not in use: the queries can go outside the VPN tunnel; only IPv4 is supported by the proxy)
+func (s *Service) localProxyDnsServer() net.IP {
+	if ip := dns.AppliedSystemDns().Ip(); ip != nil && ip.To4() != nil {
+		return ip
+	}
+	if vpn := s._vpn; vpn != nil {
+		return vpn.DefaultDNS()
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package service
+
+import (
+	"net"
+	"sync"
+
+	"github.com/ivpn/desktop-app/daemon/service/dns"
+	"github.com/ivpn/desktop-app/daemon/service/dns/querystats"
+	"github.com/ivpn/desktop-app/daemon/service/firewall"
+	"github.com/ivpn/desktop-app/daemon/service/preferences"
+)
+
+// DNS servers of the local resolver (split DNS and unfiltered DNS servers) which are allowed in the firewall
+type localResolverFirewallHosts struct {
+	mutex sync.Mutex
+	hosts []net.IP
+}
+
+// SplitDnsRules returns the split DNS rules and 'true' when the rules are applied at the moment
+func (s *Service) SplitDnsRules() (rules []dns.DomainRule, isActive bool) {
+	rules = dns.GetSplitDnsRules()
+	return rules, len(rules) > 0 && dns.IsLocalResolverActive()
+}
+
+// SetSplitDnsRules saves the split DNS rules (domains resolved by specific DNS servers)
+// and applies them to the current VPN connection
+func (s *Service) SetSplitDnsRules(rules []dns.DomainRule) error {
+	normalized, err := dns.SetSplitDnsRules(rules)
+	if err != nil {
+		return err
+	}
+
+	s.updatePreferences(func(p *preferences.Preferences) {
+		p.SplitDnsRules = normalized
+	})
+
+	return s.localResolverReapply()
+}
+
+// AntiTrackerFilter returns the configuration and the state of the local DNS filtering (custom AntiTracker lists)
+func (s *Service) AntiTrackerFilter(topBlockedCount int) (cfg dns.FilterConfig, status dns.FilterStatus) {
+	return dns.GetFilterConfig(), dns.GetFilterStatus(topBlockedCount)
+}
+
+// SetAntiTrackerFilter saves the configuration of the local DNS filtering (custom AntiTracker lists)
+// and applies it to the current VPN connection
+func (s *Service) SetAntiTrackerFilter(cfg dns.FilterConfig) error {
+	normalized, err := dns.SetFilterConfig(cfg, false)
+	if err != nil {
+		return err
+	}
+
+	s.updatePreferences(func(p *preferences.Preferences) {
+		p.AntiTrackerFilter = normalized
+	})
+
+	return s.localResolverReapply()
+}
+
+// DnsQueryStats returns the configuration of the DNS query statistics and the collected data
+func (s *Service) DnsQueryStats() (cfg querystats.Config, stats querystats.Stats) {
+	return dns.GetQueryStatsConfig(), dns.GetQueryStats()
+}
+
+// SetDnsQueryStatsConfig saves the configuration of the DNS query statistics (enable/disable)
+// and re-applies the DNS configuration of the current VPN connection (the queries are accounted by the local DNS services)
+func (s *Service) SetDnsQueryStatsConfig(cfg querystats.Config) error {
+	old := dns.GetQueryStatsConfig()
+	normalized := dns.SetQueryStatsConfig(cfg)
+
+	s.updatePreferences(func(p *preferences.Preferences) {
+		p.DnsQueryStats = normalized
+	})
+
+	if old.Enabled == normalized.Enabled {
+		return nil
+	}
+	return s.localResolverReapply()
+}
+
+// ResetDnsQueryStats erases the collected DNS query statistics
+func (s *Service) ResetDnsQueryStats() {
+	dns.ResetQueryStats()
+}
+
+// localResolverReapply re-applies current DNS configuration (the local resolver is started/updated/stopped)
+func (s *Service) localResolverReapply() error {
+	vpn := s._vpn
+	if vpn == nil || len(s.GetVpnSessionInfo().NetNamespace) > 0 {
+		return nil
+	}
+
+	s.localResolverFirewallApply()
+
+	if manualDNS := dns.GetLastManualDNS(); !manualDNS.IsEmpty() {
+		return vpn.SetManualDNS(manualDNS)
+	}
+	return vpn.ResetManualDNS()
+}
+
+// localResolverFirewallApply allows the upstream DNS servers of the local resolver in the firewall:
+// the servers from split DNS rules and the unfiltered DNS server for the allowlisted domains.
+// The firewall must not block DNS requests to them:
+//   - the servers in LAN are added to the firewall exceptions (they are reachable outside the VPN tunnel);
+//   - the rest of servers are allowed by the DNS rules (only plain DNS through the VPN tunnel).
+//
+// The exceptions are not persistent: they are removed by firewall on VPN disconnection.
+func (s *Service) localResolverFirewallApply() {
+	var hosts, dnsServers []net.IP
+	for _, r := range dns.GetSplitDnsRules() {
+		if ip := net.ParseIP(r.Server); ip != nil {
+			if ip.IsPrivate() || ip.IsLinkLocalUnicast() {
+				hosts = append(hosts, ip)
+			} else {
+				dnsServers = append(dnsServers, ip)
+			}
+		}
+	}
+	if unfilteredDns := dns.UnfilteredDns(); unfilteredDns != nil && len(dns.GetFilterConfig().Allowlist) > 0 {
+		dnsServers = append(dnsServers, unfilteredDns)
+	}
+
+	if err := firewall.SetDnsUpstreamServers(dnsServers); err != nil {
+		log.Error("Failed to allow local resolver upstream DNS servers in firewall: ", err)
+	}
+
+	s._localResolverFwHosts.mutex.Lock()
+	defer s._localResolverFwHosts.mutex.Unlock()
+
+	if len(s._localResolverFwHosts.hosts) > 0 {
+		if err := firewall.RemoveHostsFromExceptions(s._localResolverFwHosts.hosts, false, false); err != nil {
+			log.Error("Failed to remove local resolver upstream servers from firewall exceptions: ", err)
+		}
+		s._localResolverFwHosts.hosts = nil
+	}
+	if len(hosts) > 0 {
+		if err := firewall.AddHostsToExceptions(hosts, false, false); err != nil {
+			log.Error("Failed to allow local resolver upstream servers in firewall: ", err)
+			return
+		}
+		s._localResolverFwHosts.hosts = hosts
+	}
+}
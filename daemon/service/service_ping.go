@@ -26,10 +26,11 @@ package service
 
 import (
 	"fmt"
+	"net"
+	"sync/atomic"
 	"time"
 
 	"github.com/ivpn/desktop-app/daemon/api/types"
-	"github.com/ivpn/desktop-app/daemon/ping"
 )
 
 // PingServers ping vpn servers.
@@ -39,8 +40,8 @@ import (
 func (s *Service) PingServers(retryCount int, timeoutMs int) (map[string]int, error) {
 
 	if s._vpn != nil {
-		log.Info("Servers pinging skipped due to connected state")
-		return nil, nil
+		log.Info("Servers pinging skipped due to connected state (cached latency info returned)")
+		return s._latency.Results(0), nil
 	}
 
 	if timeoutMs <= 0 {
@@ -56,6 +57,21 @@ func (s *Service) PingServers(retryCount int, timeoutMs int) (map[string]int, er
 		}
 	*/
 
+	// the hosts with recent latency info are not pinged: the cached results are returned for them
+	allHosts, err := s.getHostsToPing(nil)
+	if err != nil {
+		log.Info("Servers ping failed: " + err.Error())
+		return nil, err
+	}
+	staleHosts := make(map[string]struct{})
+	for _, h := range s._latency.Stale(hostsToStrings(allHosts), latencyMaxAge) {
+		staleHosts[h] = struct{}{}
+	}
+	if len(staleHosts) == 0 {
+		log.Info("Servers pinging skipped: recent latency info is available for all servers")
+		return s._latency.Results(latencyMaxAge), nil
+	}
+
 	timeoutTime := time.Now().Add(time.Millisecond * time.Duration(timeoutMs))
 
 	var geoLocation *types.GeoLookupResponse = nil
@@ -71,13 +87,20 @@ func (s *Service) PingServers(retryCount int, timeoutMs int) (map[string]int, er
 
 	// get servers IP
 	// IPs will be sorted by distance from current location (nearest - first)
-	hosts, err := s.getHostsToPing(geoLocation)
+	sortedHosts, err := s.getHostsToPing(geoLocation)
 	if err != nil {
 		log.Info("Servers ping failed: " + err.Error())
 		return nil, err
 	}
+	hosts := make([]net.IP, 0, len(staleHosts))
+	for _, h := range sortedHosts {
+		if _, ok := staleHosts[h.String()]; ok {
+			hosts = append(hosts, h)
+		}
+	}
 
-	result := make(map[string]int)
+	result := s._latency.Results(latencyMaxAge)
+	targets := s.latencyProbeTargets(true)
 
 	funcPingIteration := func(onePingTimeoutMs int, timeout *time.Time) map[string]int {
 
@@ -102,21 +125,15 @@ func (s *Service) PingServers(retryCount int, timeoutMs int) (map[string]int, er
 				continue
 			}
 
-			pinger, err := ping.NewPinger(ipStr)
-			if err != nil {
-				log.Error("Pinger creation error: " + err.Error())
-				continue
-			}
-
-			pinger.SetPrivileged(true)
-			pinger.Count = 1
-			pinger.Timeout = time.Millisecond * time.Duration(onePingTimeoutMs)
-			pinger.Run()
-			stat := pinger.Statistics()
+			rtt := s.probeHost(targets, ipStr, time.Millisecond*time.Duration(onePingTimeoutMs))
 			i++
 
-			if stat.AvgRtt > 0 {
-				retMap[ipStr] = int(stat.AvgRtt / time.Millisecond)
+			if rtt > 0 {
+				retMap[ipStr] = int(rtt / time.Millisecond)
+			}
+			// the fast iteration (with short timeout) is not taken into account for the packets loss
+			if rtt > 0 || timeout == nil {
+				s._latency.Add(ipStr, rtt, false)
 			}
 
 			if timeout == nil && len(retMap) > 0 && len(retMap)%10 == 0 {
@@ -130,11 +147,10 @@ func (s *Service) PingServers(retryCount int, timeoutMs int) (map[string]int, er
 	}
 
 	// do not allow multiple ping request simultaneously
-	if s._isServersPingInProgress {
-		log.Info("Servers pinging skipped. Ping already in progress")
-		return nil, nil
+	if !atomic.CompareAndSwapInt32(&s._isServersPingInProgress, 0, 1) {
+		log.Info("Servers pinging skipped. Ping already in progress (cached latency info returned)")
+		return s._latency.Results(0), nil
 	}
-	s._isServersPingInProgress = true
 
 	// OS-specific preparations (e.g. we need to add servers IPs to firewall exceptions list)
 	if err := s.implPingServersStarting(hosts); err != nil {
@@ -142,7 +158,13 @@ func (s *Service) PingServers(retryCount int, timeoutMs int) (map[string]int, er
 	}
 
 	// First ping iteration. Doing it fast. 300ms max for each server
-	result = funcPingIteration(300, &timeoutTime)
+	firstResult := funcPingIteration(300, &timeoutTime)
+	if len(firstResult) == 0 && len(hosts) > 0 {
+		s.latencyCheckApi()
+	}
+	for k, v := range firstResult {
+		result[k] = v
+	}
 
 	// The first ping result already received.
 	// So, now there is no rush to do second ping iteration. Doing it in background.
@@ -159,7 +181,7 @@ func (s *Service) PingServers(retryCount int, timeoutMs int) (map[string]int, er
 				log.Error("implPingServersStopped failed: " + err.Error())
 			}
 
-			s._isServersPingInProgress = false
+			atomic.StoreInt32(&s._isServersPingInProgress, 0)
 		}()
 
 		ret := funcPingIteration(1000, nil)
@@ -176,6 +198,7 @@ func (s *Service) PingServers(retryCount int, timeoutMs int) (map[string]int, er
 			}
 		}
 		s._evtReceiver.OnPingStatus(result)
+		s.latencySave(hostsToStrings(allHosts))
 	}()
 
 	// Return first ping result
@@ -0,0 +1,127 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package service
+
+import (
+	"fmt"
+
+	apitypes "github.com/ivpn/desktop-app/daemon/api/types"
+	protocolTypes "github.com/ivpn/desktop-app/daemon/protocol/types"
+	"github.com/ivpn/desktop-app/daemon/service/serverselector"
+	"github.com/ivpn/desktop-app/daemon/vpn"
+)
+
+const (
+	serverSelectPingTimeout = 5000 // ms; max time for detection of the fastest server
+	serverSelectGeoTimeout  = 1500 // ms; max time for detection of the current location
+)
+
+// ApplyServerSelector selects the entry server according to the 'ServerSelector' of the 'Connect' request
+// and defines the hosts of the selected server in the request parameters.
+// Nothing is changed when the selector is not defined.
+func (s *Service) ApplyServerSelector(req *protocolTypes.Connect) (gateway string, err error) {
+	if req == nil || !req.ServerSelector.IsDefined() {
+		return "", nil
+	}
+
+	servers, err := s.ServersList()
+	if err != nil {
+		return "", fmt.Errorf("unable to get servers list: %w", err)
+	}
+	if servers == nil {
+		return "", fmt.Errorf("servers list is empty")
+	}
+
+	exitSrvID := req.OpenVpnParameters.MultihopExitSrvID
+	if req.VpnType == vpn.WireGuard {
+		exitSrvID = req.WireGuardParameters.MultihopExitServer.ExitSrvID
+	}
+
+	svr, err := s.selectServer(req.VpnType, req.ServerSelector, servers, exitSrvID)
+	if err != nil {
+		return "", err
+	}
+
+	if req.VpnType == vpn.WireGuard {
+		entry := findWireGuardServer(servers, svr.Gateway)
+		if entry == nil {
+			return "", fmt.Errorf("server '%s' not found in servers list", svr.Gateway)
+		}
+		req.WireGuardParameters.EntryVpnServer.Hosts = entry.Hosts
+	} else {
+		entry := findOpenVPNServer(servers, svr.Gateway)
+		if entry == nil {
+			return "", fmt.Errorf("server '%s' not found in servers list", svr.Gateway)
+		}
+		req.OpenVpnParameters.EntryVpnServer.Hosts = entry.Hosts
+	}
+
+	return svr.Gateway, nil
+}
+
+// selectServer returns the server selected according to the selector.
+// 'exitGateway' - (optional) Multi-Hop exit server; the entry server is not selected from the same country.
+func (s *Service) selectServer(vpnType vpn.Type, sel serverselector.Selector, servers *apitypes.ServersInfoResponse, exitGateway string) (serverselector.Server, error) {
+	if err := sel.Validate(); err != nil {
+		return serverselector.Server{}, err
+	}
+
+	if len(exitGateway) > 0 {
+		exitCountry := ""
+		if vpnType == vpn.WireGuard {
+			if exit := findWireGuardServer(servers, exitGateway); exit != nil {
+				exitCountry = exit.CountryCode
+			}
+		} else {
+			if exit := findOpenVPNServer(servers, exitGateway); exit != nil {
+				exitCountry = exit.CountryCode
+			}
+		}
+		if len(exitCountry) > 0 {
+			sel.ExcludeCountryCodes = append(sel.ExcludeCountryCodes, exitCountry)
+		}
+	}
+
+	var (
+		pings    map[string]int
+		location *apitypes.GeoLookupResponse
+		err      error
+	)
+	switch sel.Strategy {
+	case serverselector.Fastest:
+		if pings, err = s.PingServers(1, serverSelectPingTimeout); err != nil {
+			log.Warning("Server selection: unable to ping servers: ", err)
+		}
+	case serverselector.Nearest:
+		if location, err = s._api.GeoLookup(serverSelectGeoTimeout); err != nil {
+			log.Warning("Server selection: unable to obtain geolocation: ", err)
+		}
+	}
+
+	svr, err := serverselector.Select(sel, serverselector.ServersFromList(servers, vpnType), pings, location)
+	if err != nil {
+		return svr, err
+	}
+	log.Info(fmt.Sprintf("Server selection (%s): '%s'", sel, svr.Gateway))
+	return svr, nil
+}
@@ -0,0 +1,155 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ivpn/desktop-app/daemon/service/firewall"
+	"github.com/ivpn/desktop-app/daemon/service/preferences"
+)
+
+// ExportSettings returns the daemon settings in a portable format (JSON)
+// Account credentials are included only when 'includeSecrets' is true.
+// 'clientConfig' - client-specific configuration to be stored together with the daemon settings
+func (s *Service) ExportSettings(includeSecrets bool, clientConfig json.RawMessage) ([]byte, error) {
+	prefs := s.Preferences()
+	exported := prefs.Export(includeSecrets)
+	exported.ClientConfig = clientConfig
+
+	data, err := json.MarshalIndent(exported, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize settings: %w", err)
+	}
+	return data, nil
+}
+
+// ImportSettings applies the settings exported by ExportSettings()
+// Returns client-specific configuration which was stored together with the daemon settings (if exists)
+func (s *Service) ImportSettings(data []byte) (clientConfig json.RawMessage, err error) {
+	imported, err := preferences.ParseExportedSettings(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if imported.Secrets != nil && s.Connected() {
+		return nil, fmt.Errorf("unable to import account credentials while VPN is connected")
+	}
+
+	log.Info(fmt.Sprintf("Importing settings (schema version %d; account credentials: %t)", imported.SchemaVersion, imported.Secrets != nil))
+
+	prefs := s.Preferences()
+	prefs.Import(*imported)
+	if err := validateImportedPreferences(&prefs); err != nil {
+		return nil, fmt.Errorf("bad settings: %w", err)
+	}
+	s.applyPreferences(prefs)
+	// the last connection is not applied by applyPreferences(): it is changed by the daemon at runtime
+	s.updatePreferences(func(p *preferences.Preferences) {
+		p.LastConnection = prefs.LastConnection
+	})
+
+	// account session and WireGuard keys rotation
+	if imported.Secrets != nil || prefs.Session.WGKeysRegenInerval != s.Preferences().Session.WGKeysRegenInerval {
+		var replaced []preferences.SessionStatus
+		s.updatePreferences(func(p *preferences.Preferences) {
+			if imported.Secrets != nil {
+				replaced = replacedSessions(*p, prefs)
+			}
+			p.Session = prefs.Session
+			p.StoredSessions = prefs.StoredSessions
+		})
+		// the replaced sessions must not remain active on the accounts
+		s.sessionsDelete(replaced)
+
+		// restart WG keys rotation
+		if err := s._wgKeysMgr.StartKeysRotation(); err != nil {
+			log.Error(err)
+		}
+		// notify clients about session update
+		s._evtReceiver.OnServiceSessionChanged()
+	}
+
+	return imported.ClientConfig, nil
+}
+
+// replacedSessions returns the sessions of 'old' preferences which are not present in 'new' preferences
+func replacedSessions(old, new preferences.Preferences) []preferences.SessionStatus {
+	isKept := func(session preferences.SessionStatus) bool {
+		if new.Session.Session == session.Session {
+			return true
+		}
+		for _, s := range new.StoredSessions {
+			if s.Session == session.Session {
+				return true
+			}
+		}
+		return false
+	}
+
+	var ret []preferences.SessionStatus
+	for _, session := range append([]preferences.SessionStatus{old.Session}, old.StoredSessions...) {
+		if session.IsLoggedIn() && !isKept(session) {
+			ret = append(ret, session)
+		}
+	}
+	return ret
+}
+
+// validateImportedPreferences checks and normalizes the imported values
+// (the same checks as for the values received from clients)
+func validateImportedPreferences(prefs *preferences.Preferences) error {
+	exceptions := make([]firewall.Exception, 0, len(prefs.FwExceptions))
+	for _, e := range prefs.FwExceptions {
+		normalized, err := e.Normalized()
+		if err != nil {
+			return fmt.Errorf("bad firewall exception: %w", err)
+		}
+		exceptions = append(exceptions, normalized)
+	}
+	prefs.FwExceptions = exceptions
+
+	rules := make([]firewall.InboundRule, 0, len(prefs.FwInboundRules))
+	for _, r := range prefs.FwInboundRules {
+		normalized, err := r.Normalized()
+		if err != nil {
+			return fmt.Errorf("bad firewall inbound rule: %w", err)
+		}
+		rules = append(rules, normalized)
+	}
+	prefs.FwInboundRules = rules
+
+	for i, r := range prefs.SplitDnsRules {
+		normalized, err := r.Validate()
+		if err != nil {
+			return fmt.Errorf("bad split DNS rule: %w", err)
+		}
+		prefs.SplitDnsRules[i] = normalized
+	}
+
+	if err := prefs.LocalProxy.Validate(); err != nil {
+		return fmt.Errorf("bad local proxy configuration: %w", err)
+	}
+	return nil
+}
@@ -74,6 +74,9 @@ func (s *Service) onWiFiChanged(ssid string) {
 
 		// notify clients about WiFi change
 		s._evtReceiver.OnWiFiChanged(ssid, isInsecure)
+
+		// new network can require login through captive portal
+		go s.captivePortalOnNetworkChanged()
 	})
 }
 
@@ -28,6 +28,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/ivpn/desktop-app/daemon/service/preferences"
 )
 
 func (s *Service) implPingServersStarting(hosts []net.IP) error {
@@ -47,7 +49,6 @@ func (s *Service) implSplitTunnelling_AddApp(binaryFile string) (requiredCmdToEx
 		return "", false, nil
 	}
 
-	prefs := s._preferences
 	// current binary folder path
 	var exeDir string
 	if ex, err := os.Executable(); err == nil && len(ex) > 0 {
@@ -64,15 +65,15 @@ func (s *Service) implSplitTunnelling_AddApp(binaryFile string) (requiredCmdToEx
 	}
 
 	binaryPathLowCase := strings.ToLower(binaryFile)
-	for _, a := range prefs.SplitTunnelApps {
-		if strings.ToLower(a) == binaryPathLowCase {
-			// the binary is already in configuration
-			return "", false, nil
+	s.updatePreferences(func(p *preferences.Preferences) {
+		for _, a := range p.SplitTunnelApps {
+			if strings.ToLower(a) == binaryPathLowCase {
+				// the binary is already in configuration
+				return
+			}
 		}
-	}
-
-	prefs.SplitTunnelApps = append(prefs.SplitTunnelApps, binaryFile)
-	s.setPreferences(prefs)
+		p.SplitTunnelApps = append(p.SplitTunnelApps, binaryFile)
+	})
 
 	return "", false, nil
 }
@@ -83,19 +84,17 @@ func (s *Service) implSplitTunnelling_RemoveApp(pid int, binaryPath string) (err
 		return nil
 	}
 
-	prefs := s._preferences
-	newStApps := make([]string, 0, len(prefs.SplitTunnelApps))
 	binaryPathLowCase := strings.ToLower(binaryPath)
-
-	for _, a := range prefs.SplitTunnelApps {
-		if strings.ToLower(a) == binaryPathLowCase {
-			continue
+	s.updatePreferences(func(p *preferences.Preferences) {
+		newStApps := make([]string, 0, len(p.SplitTunnelApps))
+		for _, a := range p.SplitTunnelApps {
+			if strings.ToLower(a) == binaryPathLowCase {
+				continue
+			}
+			newStApps = append(newStApps, a)
 		}
-		newStApps = append(newStApps, a)
-	}
-
-	prefs.SplitTunnelApps = newStApps
-	s.setPreferences(prefs)
+		p.SplitTunnelApps = newStApps
+	})
 
 	return nil
 }
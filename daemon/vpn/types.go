@@ -136,6 +136,7 @@ type StateInfo struct {
 	ServerPort   int    // applicable only for 'CONNECTED' state (destination port)
 	ExitServerID string // applicable only for 'CONNECTED' state
 	IsCanPause   bool   // applicable only for 'CONNECTED' state
+	NetNamespace string // applicable only for 'CONNECTED' state: network namespace of the VPN interface (empty - host namespace)
 	IsAuthError  bool   // applicable only for 'EXITING' state
 
 	// TODO: try to avoid using this protocol-specific parameter in future
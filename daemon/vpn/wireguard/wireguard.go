@@ -26,6 +26,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net"
+	"runtime"
 	"strconv"
 	"strings"
 
@@ -38,6 +39,9 @@ import (
 
 var log *logger.Logger
 
+// IsolatedNetnsName - name of the network namespace for the isolated WireGuard connection
+const IsolatedNetnsName = "ivpn"
+
 func init() {
 	log = logger.NewLogger("wg")
 }
@@ -56,6 +60,10 @@ type ConnectionParams struct {
 	// in same manner as for OpenVPN connection.
 	// Example: "gateway":"zz.wg.ivpn.net" => "zz"
 	multihopExitSrvID string
+
+	// (Linux only) name of the network namespace for the WireGuard interface
+	// (empty - the interface is created in the host namespace)
+	netNamespace string
 }
 
 func (cp *ConnectionParams) GetIPv6ClientLocalIP() net.IP {
@@ -71,6 +79,18 @@ func (cp *ConnectionParams) GetIPv6HostLocalIP() net.IP {
 	return net.ParseIP(cp.ipv6Prefix + cp.hostLocalIP.String())
 }
 
+// SetNetNamespace defines the network namespace for the WireGuard interface (Linux only).
+// The host network configuration (routing, DNS) stays untouched: only the applications started
+// in this namespace (e.g. 'ip netns exec') are able to reach the network, and only through the tunnel.
+func (cp *ConnectionParams) SetNetNamespace(name string) {
+	cp.netNamespace = name
+}
+
+// NetNamespace returns the network namespace for the WireGuard interface (empty - host namespace)
+func (cp *ConnectionParams) NetNamespace() string {
+	return cp.netNamespace
+}
+
 // SetCredentials update WG credentials
 func (cp *ConnectionParams) SetCredentials(privateKey string, localIP net.IP) {
 	cp.clientPrivateKey = privateKey
@@ -113,6 +133,9 @@ func NewWireGuardObject(wgBinaryPath string, wgToolBinaryPath string, wgConfigFi
 	if connectionParams.clientLocalIP == nil || len(connectionParams.clientPrivateKey) == 0 {
 		return nil, fmt.Errorf("WireGuard local credentials not defined")
 	}
+	if len(connectionParams.netNamespace) > 0 && runtime.GOOS != "linux" {
+		return nil, fmt.Errorf("isolated network namespace is not supported on this platform")
+	}
 
 	return &WireGuard{
 		binaryPath:     wgBinaryPath,
@@ -269,6 +292,7 @@ func (wg *WireGuard) notifyConnectedStat(stateChan chan<- vpn.StateInfo) {
 		isCanPause)
 
 	si.ExitServerID = wg.connectParams.multihopExitSrvID
+	si.NetNamespace = wg.connectParams.netNamespace
 
 	stateChan <- si
 }
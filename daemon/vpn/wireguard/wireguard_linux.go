@@ -30,6 +30,7 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ivpn/desktop-app/daemon/service/dns"
@@ -50,6 +51,8 @@ type internalVariables struct {
 	isRunning            bool
 	isPaused             bool
 	resumeDisconnectChan chan operation // control connection pause\resume or disconnect from paused state
+	netnsStopChan        chan struct{}  // (isolated network namespace) closed when the WireGuard interface is removed
+	netnsMutex           sync.Mutex     // protects netnsStopChan (it is closed from a different goroutine: disconnect/pause)
 }
 
 func (wg *WireGuard) init() error {
@@ -59,6 +62,11 @@ func (wg *WireGuard) init() error {
 	// We should close it in this case. Otherwise, new connection would not be established
 	wgInterfaceName := filepath.Base(wg.configFilePath)
 	wgInterfaceName = strings.TrimSuffix(wgInterfaceName, path.Ext(wgInterfaceName))
+	// remove the isolated network namespace which may remain after previous connection
+	if _, err := os.Stat(filepath.Join(netnsRunDir, IsolatedNetnsName)); err == nil {
+		log.Info(fmt.Sprintf("Removing network namespace '%s' (expected to be removed before the new connection)...", IsolatedNetnsName))
+		removeNetns(IsolatedNetnsName, wgInterfaceName)
+	}
 	// stop current WG connection (if exists)
 	i, _ := net.InterfaceByName(wgInterfaceName)
 	if i != nil {
@@ -90,6 +98,10 @@ func (wg *WireGuard) connect(stateChan chan<- vpn.StateInfo) error {
 
 	wg.internals.resumeDisconnectChan = make(chan operation, 1)
 
+	if wg.isIsolated() {
+		return wg.connectIsolated(stateChan)
+	}
+
 	// loop connection initialisation (required for pause\resume functionality)
 	// on 'pause' - we stopping WG interface but not exiting this (connect) method
 	// (method 'connect' is synchronous, must NOT exit on pause)
@@ -187,6 +199,11 @@ func (wg *WireGuard) disconnect() error {
 }
 
 func (wg *WireGuard) internalDisconnect() error {
+	if wg.isIsolated() {
+		// in paused state the namespace is kept: the applications started in it stay isolated
+		return wg.netnsDown(wg.isPaused())
+	}
+
 	err := shell.Exec(log, wg.binaryPath, "down", wg.configFilePath)
 	if err != nil {
 		return fmt.Errorf("failed to stop WireGuard: %w", err)
@@ -225,6 +242,9 @@ func (wg *WireGuard) setManualDNS(dnsCfg dns.DnsSettings) error {
 	if wg.isPaused() || wg.internals.isRunning == false {
 		return nil
 	}
+	if wg.isIsolated() {
+		return wg.netnsSetDNS(dnsCfg)
+	}
 	return dns.SetManual(dnsCfg, nil)
 }
 
@@ -234,6 +254,12 @@ func (wg *WireGuard) resetManualDNS() error {
 	if wg.isPaused() {
 		return nil
 	}
+	if wg.isIsolated() {
+		if wg.internals.isRunning {
+			return wg.netnsSetDNS(dns.DnsSettings{})
+		}
+		return nil
+	}
 
 	if wg.internals.isRunning {
 		// changing DNS to default value for current WireGuard connection
@@ -251,6 +277,12 @@ func (wg *WireGuard) getOSSpecificConfigParams() (interfaceCfg []string, peerCfg
 		allowedIPsV6 = ", ::/0"
 	}
 
+	if wg.isIsolated() {
+		// the configuration is applied by 'wg setconf' (addresses and routes are configured separately)
+		peerCfg = append(peerCfg, "AllowedIPs = 0.0.0.0/0"+allowedIPsV6)
+		return interfaceCfg, peerCfg
+	}
+
 	interfaceCfg = append(interfaceCfg, "Address = "+wg.connectParams.clientLocalIP.String()+"/32"+ipv6LocalIPStr)
 	interfaceCfg = append(interfaceCfg, "SaveConfig = true")
 
@@ -0,0 +1,206 @@
+//
+//  Daemon for IVPN Client Desktop
+//  https://github.com/ivpn/desktop-app
+//
+//  Created by Stelnykovych Alexandr.
+//  Copyright (c) 2020 Privatus Limited.
+//
+//  This file is part of the Daemon for IVPN Client Desktop.
+//
+//  The Daemon for IVPN Client Desktop is free software: you can redistribute it and/or
+//  modify it under the terms of the GNU General Public License as published by the Free
+//  Software Foundation, either version 3 of the License, or (at your option) any later version.
+//
+//  The Daemon for IVPN Client Desktop is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of MERCHANTABILITY
+//  or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for more
+//  details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with the Daemon for IVPN Client Desktop. If not, see <https://www.gnu.org/licenses/>.
+//
+
+package wireguard
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/ivpn/desktop-app/daemon/service/dns"
+	"github.com/ivpn/desktop-app/daemon/shell"
+	"github.com/ivpn/desktop-app/daemon/vpn"
+)
+
+// Isolated network namespace mode:
+// the WireGuard interface is created in the host namespace (so the encrypted UDP traffic is sent by the host)
+// and moved to a dedicated network namespace which has no other interfaces except loopback.
+// The applications started in this namespace are not able to reach the network except through the tunnel.
+// The host network configuration (routing, DNS) stays untouched.
+// DNS configuration for the namespace is stored in '/etc/netns/<name>/resolv.conf' ('ip netns exec' mounts it over '/etc/resolv.conf').
+
+const (
+	netnsRunDir = "/run/netns"
+	netnsEtcDir = "/etc/netns"
+)
+
+func (wg *WireGuard) isIsolated() bool {
+	return len(wg.connectParams.netNamespace) > 0
+}
+
+func (wg *WireGuard) interfaceName() string {
+	wgInterfaceName := filepath.Base(wg.configFilePath)
+	return strings.TrimSuffix(wgInterfaceName, path.Ext(wgInterfaceName))
+}
+
+// connectIsolated - SYNCHRONOUSLY establish connection in isolated network namespace (wait until it finished)
+func (wg *WireGuard) connectIsolated(stateChan chan<- vpn.StateInfo) error {
+	defer wg.netnsDown(false)
+
+	for {
+		// generate configuration
+		if err := wg.generateAndSaveConfigFile(wg.configFilePath); err != nil {
+			return fmt.Errorf("failed to save WG config file: %w", err)
+		}
+
+		stopChan := make(chan struct{})
+		wg.internals.netnsMutex.Lock()
+		wg.internals.netnsStopChan = stopChan
+		wg.internals.netnsMutex.Unlock()
+
+		if err := wg.netnsUp(); err != nil {
+			return fmt.Errorf("failed to start WireGuard in network namespace '%s': %w", wg.connectParams.netNamespace, err)
+		}
+		if err := wg.netnsSetDNS(wg.internals.manualDNS); err != nil {
+			return fmt.Errorf("failed to set DNS for network namespace '%s': %w", wg.connectParams.netNamespace, err)
+		}
+
+		// notify connected
+		wg.notifyConnectedStat(stateChan)
+
+		// wait until the interface is removed (disconnect or pause)
+		<-stopChan
+
+		// if connection not PAUSED - exit
+		if !wg.isPaused() {
+			break
+		}
+		log.Info("Paused")
+		// wait for resume or disconnect request
+		if op := <-wg.internals.resumeDisconnectChan; op != resume {
+			break
+		}
+		log.Info("Resuming...")
+	}
+	return nil
+}
+
+func (wg *WireGuard) netnsUp() error {
+	ns := wg.connectParams.netNamespace
+	ifName := wg.interfaceName()
+
+	// the namespace is kept in paused state
+	if _, err := os.Stat(filepath.Join(netnsRunDir, ns)); err != nil {
+		if err := shell.Exec(log, "ip", "netns", "add", ns); err != nil {
+			return err
+		}
+	}
+
+	commands := [][]string{
+		{"ip", "-n", ns, "link", "set", "lo", "up"},
+		// the interface is created in the host namespace: the UDP socket of WireGuard stays in the host namespace
+		{"ip", "link", "add", ifName, "type", "wireguard"},
+		{wg.toolBinaryPath, "setconf", ifName, wg.configFilePath},
+		{"ip", "link", "set", ifName, "netns", ns},
+		{"ip", "-n", ns, "address", "add", wg.connectParams.clientLocalIP.String() + "/32", "dev", ifName},
+	}
+	ipv6LocalIP := wg.connectParams.GetIPv6ClientLocalIP()
+	if ipv6LocalIP != nil {
+		commands = append(commands, []string{"ip", "-n", ns, "-6", "address", "add", ipv6LocalIP.String() + "/128", "dev", ifName})
+	}
+	commands = append(commands,
+		[]string{"ip", "-n", ns, "link", "set", ifName, "up"},
+		[]string{"ip", "-n", ns, "route", "add", "default", "dev", ifName})
+	if ipv6LocalIP != nil {
+		commands = append(commands, []string{"ip", "-n", ns, "-6", "route", "add", "default", "dev", ifName})
+	}
+
+	for _, c := range commands {
+		if err := shell.Exec(log, c[0], c[1:]...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// netnsDown removes the WireGuard interface and (if keepNamespace==false) the network namespace.
+// Note: the applications still running in the removed namespace stay isolated (the namespace has no interfaces except loopback)
+func (wg *WireGuard) netnsDown(keepNamespace bool) error {
+	ns := wg.connectParams.netNamespace
+	ifName := wg.interfaceName()
+
+	if keepNamespace {
+		removeNetnsInterface(ns, ifName)
+	} else {
+		removeNetns(ns, ifName)
+	}
+
+	wg.internals.netnsMutex.Lock()
+	defer wg.internals.netnsMutex.Unlock()
+	if c := wg.internals.netnsStopChan; c != nil {
+		wg.internals.netnsStopChan = nil
+		close(c)
+	}
+	return nil
+}
+
+// netnsSetDNS updates DNS configuration of the network namespace
+// (empty configuration - the default DNS of the VPN server is in use)
+func (wg *WireGuard) netnsSetDNS(dnsCfg dns.DnsSettings) error {
+	dnsIP := net.ParseIP(dnsCfg.DnsHost)
+	if dnsIP != nil && dnsCfg.Encryption != dns.EncryptionNone {
+		// DNS-over-HTTPS/TLS is processed by the host; it is not reachable from the namespace
+		log.Warning("Encrypted DNS is not supported in isolated network namespace; using default DNS of the VPN server")
+		dnsIP = nil
+	}
+	if dnsIP == nil {
+		dnsIP = wg.DefaultDNS()
+	}
+	if dnsIP == nil {
+		return fmt.Errorf("DNS server not defined")
+	}
+
+	dir := filepath.Join(netnsEtcDir, wg.connectParams.netNamespace)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	// Note: the file is rewritten in place (the running applications see the changes: 'ip netns exec' bind-mounts the file)
+	return ioutil.WriteFile(filepath.Join(dir, "resolv.conf"), []byte("# Generated by IVPN daemon\nnameserver "+dnsIP.String()+"\n"), 0644)
+}
+
+func removeNetnsInterface(ns string, ifName string) {
+	if _, err := os.Stat(filepath.Join(netnsRunDir, ns)); err == nil {
+		// error ignored: the interface may not exist
+		shell.Exec(nil, "ip", "-n", ns, "link", "delete", ifName)
+	}
+	// the interface may remain in the host namespace (if the connection failed before it was moved)
+	if i, _ := net.InterfaceByName(ifName); i != nil {
+		shell.Exec(nil, "ip", "link", "delete", ifName)
+	}
+}
+
+func removeNetns(ns string, ifName string) {
+	removeNetnsInterface(ns, ifName)
+	if _, err := os.Stat(filepath.Join(netnsRunDir, ns)); err == nil {
+		if err := shell.Exec(log, "ip", "netns", "delete", ns); err != nil {
+			log.Warning(err)
+		}
+	}
+	if err := os.RemoveAll(filepath.Join(netnsEtcDir, ns)); err != nil {
+		log.Warning(err)
+	}
+}